@@ -0,0 +1,247 @@
+package exif
+
+// support for detecting signs of image edition
+
+import (
+    "fmt"
+    "math"
+    "strings"
+    "time"
+)
+
+/*
+    Metadata written by cameras has a few common traits that image editors
+    and manual edition tend to break. Anomalies looks for the following signs,
+    each one giving a weight between 0 and 1:
+
+      - Software names a known image editor, or an ImageHistory is present,
+      - DateTime (last modification) differs from DateTimeOriginal,
+      - the thumbnail aspect ratio does not match the image aspect ratio, as
+        when the image was cropped without updating the thumbnail. Standard
+        DCF thumbnails (160x120, padded if needed) are not checked. Only the
+        thumbnail is decoded, since the image data is not available here,
+      - Make names a vendor with a supported maker note, but there is no
+        maker note or it comes from another vendor,
+      - Make or Model is given, but some of the capture information always
+        written by cameras is missing,
+      - the layout of the metadata is suspicious, see LayoutAnomalies.
+
+    The edited likelihood is 1 - (1-w1)(1-w2)...(1-wn), 0 if no sign was
+    found. It is only a heuristic: none of those signs is a proof, and edited
+    images whose metadata was carefully rewritten show none of them.
+*/
+
+// AnomalyKind is the kind of a sign of edition
+type AnomalyKind int
+
+const (
+    EditorSoftware AnomalyKind = iota   // Software or ImageHistory
+    DateTimeMismatch                    // DateTime is not DateTimeOriginal
+    ThumbnailMismatch                   // thumbnail and image aspect ratios
+    MakerNoteMismatch                   // maker note missing or from another vendor
+    MissingCameraFields                 // capture information missing
+    SuspiciousLayout                    // see LayoutAnomalies
+)
+
+func (k AnomalyKind) String( ) string {
+    switch k {
+    case EditorSoftware:        return "editor software"
+    case DateTimeMismatch:      return "date time mismatch"
+    case ThumbnailMismatch:     return "thumbnail mismatch"
+    case MakerNoteMismatch:     return "maker note mismatch"
+    case MissingCameraFields:   return "missing camera fields"
+    case SuspiciousLayout:      return "suspicious layout"
+    }
+    return fmt.Sprintf( "anomaly %d", int(k) )
+}
+
+// Anomaly is a sign of edition found in the metadata
+type Anomaly struct {
+    Kind    AnomalyKind
+    Detail  string          // human readable description
+    Weight  float64         // contribution to the edited likelihood (0 to 1)
+}
+
+func (a Anomaly) String( ) string {
+    return fmt.Sprintf( "%s: %s", a.Kind, a.Detail )
+}
+
+// AnomalyReport is returned by Anomalies
+type AnomalyReport struct {
+    Anomalies           []Anomaly       // signs found, in AnomalyKind order
+    Layout              []LayoutAnomaly // as returned by LayoutAnomalies
+    EditedLikelihood    float64         // 0 (no sign) to 1
+}
+
+const (                                 // anomaly weights
+    _editorWeight           = 0.6
+    _historyWeight          = 0.4
+    _dateTimeWeight         = 0.4
+    _thumbnailWeight        = 0.5
+    _noMakerNoteWeight      = 0.3
+    _otherMakerNoteWeight   = 0.6
+    _missingFieldsWeight    = 0.2
+    _layoutWeight           = 0.5
+
+    _dateTimeTolerance      = 2 * time.Second
+    _aspectTolerance        = 0.03  // relative difference of aspect ratios
+)
+
+// editors are lower case names of image editors found in Software
+var editors = []string{ "photoshop", "lightroom", "gimp", "affinity",
+                        "pixelmator", "paint.net", "capture one", "darktable",
+                        "rawtherapee", "luminar", "snapseed", "picasa",
+                        "acdsee", "photoscape", "photo editor", "imagemagick",
+                        "graphicsmagick", "canva", "fotor", "photopea",
+                        "corel", "paintshop", "digikam", "shotwell" }
+
+// findEditor returns the editor named in software, or ""
+func findEditor( software string ) string {
+    s := strings.ToLower( software )
+    for _, e := range editors {
+        if strings.Contains( s, e ) {
+            return e
+        }
+    }
+    return ""
+}
+
+func (r *AnomalyReport) add( kind AnomalyKind, weight float64,
+                             format string, a ...interface{} ) {
+    r.Anomalies = append( r.Anomalies,
+                          Anomaly{ kind, fmt.Sprintf( format, a... ), weight } )
+}
+
+func (d *Desc) checkSoftware( r *AnomalyReport ) {
+    software := d.getSummaryString( PRIMARY, _Software )
+    if e := findEditor( software ); e != "" {
+        r.add( EditorSoftware, _editorWeight, "software %q", software )
+    }
+    if history := d.getSummaryString( EXIF, _ImageHistory ); history != "" {
+        r.add( EditorSoftware, _historyWeight, "image history %q", history )
+    } else if history = d.getSummaryString( PRIMARY, _ImageHistory ); history != "" {
+        r.add( EditorSoftware, _historyWeight, "image history %q", history )
+    }
+}
+
+func (d *Desc) checkDateTime( r *AnomalyReport ) {
+    modified, err := d.GetDateTime( Modified )
+    if err != nil {
+        return
+    }
+    original, err := d.GetDateTime( Original )
+    if err != nil {
+        return
+    }
+    delta := modified.Sub( original )
+    if delta > _dateTimeTolerance || delta < -_dateTimeTolerance {
+        r.add( DateTimeMismatch, _dateTimeWeight,
+               "DateTime differs from DateTimeOriginal by %v", delta )
+    }
+}
+
+// getImageDimensions returns the image dimensions given in the Exif IFD, or
+// in IFD0 if absent from the Exif IFD.
+func (d *Desc) getImageDimensions( ) (w, h uint32) {
+    w = d.getSummaryInteger( EXIF, _PixelXDimension )
+    h = d.getSummaryInteger( EXIF, _PixelYDimension )
+    if w == 0 || h == 0 {
+        w = d.getSummaryInteger( PRIMARY, _ImageWidth )
+        h = d.getSummaryInteger( PRIMARY, _ImageLength )
+    }
+    return
+}
+
+func (d *Desc) checkThumbnail( r *AnomalyReport ) {
+    primary := d.ifds[PRIMARY]
+    if primary == nil {
+        return
+    }
+    ti, ok := primary.getThumbnailInfo( )
+    if ! ok || ti.Width == 0 || ti.Height == 0 ||
+       (ti.Width == 160 && ti.Height == 120) {  // DCF thumbnail
+        return
+    }
+    w, h := d.getImageDimensions( )
+    if w == 0 || h == 0 {
+        return
+    }
+    ia := float64(w) / float64(h)
+    ta := float64(ti.Width) / float64(ti.Height)
+    if math.Abs( ia - ta ) / ia > _aspectTolerance {
+        r.add( ThumbnailMismatch, _thumbnailWeight,
+               "thumbnail %dx%d, image %dx%d", ti.Width, ti.Height, w, h )
+    }
+}
+
+func (d *Desc) checkMakerNote( r *AnomalyReport ) {
+    maker := d.getSummaryString( PRIMARY, _Make )
+    if maker == "" {
+        return
+    }
+    lmake := strings.ToLower( maker )
+    vendor := d.stats.MakerNote
+    if vendor != "" {
+        if ! strings.Contains( lmake, strings.ToLower( vendor ) ) {
+            r.add( MakerNoteMismatch, _otherMakerNoteWeight,
+                   "make %q with %s maker note", maker, vendor )
+        }
+        return
+    }
+    if exif := d.ifds[EXIF]; exif != nil && exif.getValue( _MakerNote ) != nil {
+        return                              // unsupported maker note
+    }
+    for _, m := range makerNotes {
+        if strings.Contains( lmake, strings.ToLower( m.name ) ) {
+            r.add( MakerNoteMismatch, _noMakerNoteWeight,
+                   "make %q without maker note", maker )
+            return
+        }
+    }
+}
+
+// cameraFields are the capture information always written by cameras
+var cameraFields = []struct{
+    tag     tTag
+    name    string
+}{ { _ExifVersion, "ExifVersion" }, { _DateTimeOriginal, "DateTimeOriginal" },
+   { _ExposureTime, "ExposureTime" }, { _FNumber, "FNumber" } }
+
+func (d *Desc) checkCameraFields( r *AnomalyReport ) {
+    if d.getSummaryString( PRIMARY, _Make ) == "" &&
+       d.getSummaryString( PRIMARY, _Model ) == "" {
+        return
+    }
+    var missing []string
+    for _, f := range cameraFields {
+        if d.getSummaryValue( EXIF, f.tag ) == nil {
+            missing = append( missing, f.name )
+        }
+    }
+    if len(missing) > 0 {
+        r.add( MissingCameraFields, _missingFieldsWeight,
+               "missing %s", strings.Join( missing, ", " ) )
+    }
+}
+
+// Anomalies returns a report of the signs of edition found in the metadata,
+// with a heuristic likelihood that the image was edited after capture. See
+// AnomalyKind for the signs looked for.
+func (d *Desc) Anomalies( ) (r AnomalyReport) {
+    d.checkSoftware( &r )
+    d.checkDateTime( &r )
+    d.checkThumbnail( &r )
+    d.checkMakerNote( &r )
+    d.checkCameraFields( &r )
+    r.Layout = d.LayoutAnomalies( )
+    if n := len(r.Layout); n > 0 {
+        r.add( SuspiciousLayout, _layoutWeight, "%d layout anomalies", n )
+    }
+
+    unedited := 1.0
+    for _, a := range r.Anomalies {
+        unedited *= 1 - a.Weight
+    }
+    r.EditedLikelihood = 1 - unedited
+    return
+}
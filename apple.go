@@ -38,6 +38,9 @@ const (             // Apple Maker note tags
     _Apple001a                  = 0x001a  // 1 _ASCIIString [6]"q825s\0"
 
     _Apple001f                  = 0x001f  // 1 _SignedLong
+
+    _AppleHDRHeadroom           = 0x0021  // 1 _SignedRational
+    _AppleHDRGain               = 0x0030  // 1 _SignedRational
 )
 
 /* pList types are mapped to go types as follow:
@@ -283,12 +286,12 @@ func getPlist( pList []byte ) ( *pNode, error ) {
     return getObject( topObjectStart )
 }
 
-func dumpPlist( w io.Writer, v interface{}, indent string ) {
+func dumpPlist( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
     data := v.([]byte)
-    dumpData( w, "plist", indent + "  ", true, data )
+    dumpData( w, "plist", indent + getIndentUnit( w ), true, data )
 }
 
-func printRuntime( w io.Writer, v interface{}, indent string ) {
+func printRuntime( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
     pList := v.([]byte)
     root, err := getPlist( pList ); if err != nil {
         fmt.Fprintf( w, "Invalid runtime (not a plist)\n" )
@@ -364,7 +367,7 @@ https://developer.apple.com/library/ios/documentation/CoreMedia/Reference/CMTime
 func (ifd *ifdd) storeAppleAccelerationVector( ) error {
     v, err := ifd.checkSignedRationals( 3 )
     if err == nil {
-        p := func( w io.Writer,v interface{}, indent string ) {
+        p := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
             av := v.([]SignedRational)
     /*
         AccelerationVector
@@ -375,15 +378,9 @@ func (ifd *ifdd) storeAppleAccelerationVector( ) error {
         See
     http://nscookbook.com/2013/03/ios-programming-recipe-19-using-core-motion-to-access-gyro-and-accelerometer/
     */
-            fmt.Fprintf( w, "Vector X: %f (%d/%d)\n",
-                        float32(av[0].Numerator)/float32(av[0].Denominator),
-                        av[0].Numerator, av[0].Denominator )
-            fmt.Fprintf( w, "%sVector Y: %f (%d/%d)\n", indent,
-                        float32(av[1].Numerator)/float32(av[1].Denominator),
-                        av[1].Numerator, av[1].Denominator )
-            fmt.Fprintf( w, "%sVector Z: %f (%d/%d)", indent,
-                        float32(av[2].Numerator)/float32(av[2].Denominator),
-                        av[2].Numerator, av[2].Denominator )
+            fmt.Fprintf( w, "Vector X: %s\n", av[0].formatFraction( ) )
+            fmt.Fprintf( w, "%sVector Y: %s\n", indent, av[1].formatFraction( ) )
+            fmt.Fprintf( w, "%sVector Z: %s", indent, av[2].formatFraction( ) )
         }
         ifd.storeValue( ifd.newSignedRationalValue( "Acceleration Vectors", p, v ) )
     }
@@ -392,8 +389,8 @@ func (ifd *ifdd) storeAppleAccelerationVector( ) error {
 
 func (ifd *ifdd) storeAppleImageType( ) error {
 //          = 0x000a  // 1 _SignedLong: 2=iPad mini 2, 3=HDR Image, 4=Original Image
-    var fait = func ( w io.Writer, v interface{}, indent string ) {
-        it := v.(int32)
+    var fait = func ( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        it := v.([]int32)[0]
         var s string
         switch it {
         case 2: s = "iPad mini 2"
@@ -403,22 +400,33 @@ func (ifd *ifdd) storeAppleImageType( ) error {
         }
         io.WriteString( w, s )
     }
-    return ifd.storeSignedLongs( "  Apple Image Type", 1, fait )
+    return ifd.storeSignedLongs( "Apple Image Type", 1, fait )
 }
 
 func (ifd *ifdd) storeAppleOrientation( ) error {
 // 1 _SignedLong Orientation? 0=landscape? 4=portrait?
-    var fao = func( w io.Writer, v interface{}, indent string ) {
-        o := v.(int32)
+    var fao = func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        o := v.([]int32)[0]
         var s string
-        switch v {
+        switch o {
         case 0: s = "Landscape"
         case 4: s = "portrait"
         default: s = fmt.Sprintf( "Undefined (%d)", o )
         }
         io.WriteString( w, s )
     }
-    return ifd.storeSignedLongs( "  Apple Image orientation", 1, fao )
+    return ifd.storeSignedLongs( "Apple Image Orientation", 1, fao )
+}
+
+// HDR values are signed rationals in recent models, but are kept as unknown
+// values if they happen to be of another type.
+func (ifd *ifdd) storeAppleHDRValue( name string ) error {
+    if ifd.fType != _SignedRational || ifd.fCount != 1 {
+        ifd.makerWarning( "Apple", "%s: unexpected %d %s", name, ifd.fCount,
+                          getTiffTString( ifd.fType ) )
+        return ifd.processUnknownTag( )
+    }
+    return ifd.storeSignedRationals( name, 1, nil )
 }
 
 func storeAppleTags( ifd *ifdd ) error {
@@ -474,13 +482,16 @@ func storeAppleTags( ifd *ifdd ) error {
         return ifd.storeSignedLongs( "Apple #0019", 1, nil )
     case _Apple001a:
 //             = 0x001a  // 1 _ASCIIString [6]"q825s\0"
-        return ifd.storeAsciiString( "  Apple #001a" )
+        return ifd.storeAsciiString( "Apple #001a" )
     case _Apple001f:
-        return ifd.storeSignedLongs( "  Apple #001f", 1, nil )
+        return ifd.storeSignedLongs( "Apple #001f", 1, nil )
+    case _AppleHDRHeadroom:
+        return ifd.storeAppleHDRValue( "Apple HDR Headroom" )
+    case _AppleHDRGain:
+        return ifd.storeAppleHDRValue( "Apple HDR Gain" )
     default:
         return ifd.processUnknownTag( )
     }
-    return nil
 }
 
 const (
@@ -498,16 +509,15 @@ func (ifd *ifdd) processAppleMakerNote( offset uint32 ) error {
     // in big endian and a 2-byte endian idendifier: "MM" for big endian,
     // before mapping to a regular IFD structure: 2-byte number of entries
     // in the IFD followed by the regular IFD entries and IFD data
-    endian, err := getEndianess(
-                ifd.desc.data[offset + _APPLE_MAKER_ENDIAN_OFFSET:
-                              offset+ifd.fCount - _APPLE_MAKER_ENDIAN_OFFSET] )
+    mknd, err := ifd.newMakerDesc( offset, ifd.fCount, _APPLE_MAKER_IFD_OFFSET,
+                                   _APPLE_MAKER_ENDIAN_OFFSET )
     if err != nil {
         return err
     }
-    mknd := new(Desc)
-    mknd.Control = ifd.desc.Control     // propagate original control
-    mknd.data = ifd.desc.data[offset:offset+ifd.fCount]
-    mknd.endian = endian
+    if version := binary.BigEndian.Uint16( mknd.data[_APPLE_MAKER_SIGNATURE_SIZE:] );
+       version != 1 {
+        ifd.makerWarning( "Apple", "unexpected version %d", version )
+    }
 
 //    fmt.Printf( "Apple maker notes: origin %#04x start %#04x, end %#04x, endian %v\n",
 //                offset, 14, offset + ifd.fCount, endian )
@@ -521,19 +531,97 @@ func (ifd *ifdd) processAppleMakerNote( offset uint32 ) error {
 //                ifd.dOffset + apple.dOffset, ifd.dOffset + ifd.fCount )
 
     mknd.root = apple
-    ifd.storeValue( ifd.newDescValue( mknd, "Apple iOS\x00\x00\x01MM",
-                                      _APPLE_MAKER_IFD_OFFSET ) )
+    ifd.storeValue( ifd.newDescValue( mknd, "Apple iOS\x00\x00\x01MM" ) )
     ifd.desc.ifds[MAKER] = apple
     return err
 }
 
 func tryAppleMakerNote( ifd *ifdd, offset uint32 ) ( func( uint32 ) error ) {
 
-    if bytes.Equal( ifd.desc.data[offset:offset+_APPLE_MAKER_SIGNATURE_SIZE],
-                    []byte( _APPLE_MAKER_SIGNATURE ) ) {
+    if ifd.hasMakerNoteSignature( offset, _APPLE_MAKER_SIGNATURE ) {
 //        fmt.Printf("    MakerNote: Apple iOS\n" )
         return ifd.processAppleMakerNote
     }
     return nil
 }
 
+
+// DeviceAttitude is the device position at capture time, estimated from the
+// direction of gravity in the Apple acceleration vector
+type DeviceAttitude int
+
+const (
+    UnknownAttitude     DeviceAttitude = iota // no clear dominant direction
+    Portrait                                  // upright, bottom side down
+    PortraitUpsideDown                        // top side down
+    LandscapeLeftDown                         // left side down (viewed from the front)
+    LandscapeRightDown                        // right side down (viewed from the front)
+    FaceUp                                    // lying flat, screen up
+    FaceDown                                  // lying flat, screen down
+)
+
+func (a DeviceAttitude) String( ) string {
+    switch a {
+    case Portrait:              return "Portrait"
+    case PortraitUpsideDown:    return "Portrait upside down"
+    case LandscapeLeftDown:     return "Landscape, left side down"
+    case LandscapeRightDown:    return "Landscape, right side down"
+    case FaceUp:                return "Face up"
+    case FaceDown:              return "Face down"
+    }
+    return "Unknown attitude"
+}
+
+// GetAccelerationVector returns the X, Y and Z coordinates of the Apple maker
+// note acceleration vector, in units of g. As viewed from the front of the
+// phone, positive X is toward the left side, positive Y toward the bottom and
+// positive Z into the face of the phone.
+//
+// It returns a non-nil error if there is no Apple acceleration vector.
+func (d *Desc)GetAccelerationVector( ) (x, y, z float64, err error) {
+    if d.stats.MakerNote == "Apple" && d.ifds[MAKER] != nil {
+        if sr, ok := d.ifds[MAKER].getValue( _AppleAccelerationVector ).(*signedRationalValue);
+           ok && len(sr.v) == 3 {
+            var f [3]float64
+            for i, r := range sr.v {
+                f[i] = r.checkedFloat( )
+            }
+            return f[0], f[1], f[2], nil
+        }
+    }
+    return 0, 0, 0, fmt.Errorf( "GetAccelerationVector: no acceleration vector\n" )
+}
+
+// GetDeviceAttitude returns the device position at capture time estimated from
+// the Apple acceleration vector, which mostly measures gravity when the phone
+// is held still: the attitude follows the axis where gravity dominates. It can
+// be used to decide an automatic rotation when the Orientation tag is missing.
+//
+// It returns UnknownAttitude if no axis is clearly dominant, and a non-nil
+// error if there is no Apple acceleration vector.
+func (d *Desc)GetDeviceAttitude( ) (DeviceAttitude, error) {
+    x, y, z, err := d.GetAccelerationVector( )
+    if err != nil {
+        return UnknownAttitude, fmt.Errorf( "GetDeviceAttitude: %w", err )
+    }
+    ax, ay, az := math.Abs( x ), math.Abs( y ), math.Abs( z )
+    const minGravity = 0.5      // in g, below that the phone is moving
+    switch {
+    case az >= ax && az >= ay && az > minGravity:
+        if z > 0 {
+            return FaceUp, nil
+        }
+        return FaceDown, nil
+    case ay >= ax && ay > minGravity:
+        if y > 0 {
+            return Portrait, nil
+        }
+        return PortraitUpsideDown, nil
+    case ax > minGravity:
+        if x > 0 {
+            return LandscapeLeftDown, nil
+        }
+        return LandscapeRightDown, nil
+    }
+    return UnknownAttitude, nil
+}
@@ -0,0 +1,71 @@
+package exif
+
+import (
+    "encoding/binary"
+    "strings"
+    "testing"
+)
+
+// testAppleMakerNote returns an Apple maker note made of entries, which are
+// always big endian.
+func testAppleMakerNote( entries []testEntry ) []byte {
+    note := []byte( _APPLE_MAKER_SIGNATURE + "\x00\x01MM" )
+    return append( note, testIfd( binary.BigEndian, uint32(len(note)),
+                                  entries, 0 )... )
+}
+
+func TestAppleFormatters( t *testing.T ) {
+    e := binary.BigEndian
+    for _, c := range []struct {
+        imageType, orientation  uint32
+        want                    []string
+    } {
+        { 3, 4, []string{ "Apple Image Type:\n    HDR Image",
+                          "Apple Image Orientation:\n    portrait" } },
+        { 4, 0, []string{ "Apple Image Type:\n    Original Image",
+                          "Apple Image Orientation:\n    Landscape" } },
+        { 9, 2, []string{ "Apple Image Type:\n    Unknown Image Type",
+                          "Apple Image Orientation:\n    Undefined (2)" } },
+    } {
+        note := testAppleMakerNote( []testEntry{
+            { _Apple001, uint16(_SignedLong), 1, testLongs( e, 11 ) },
+            { _AppleAccelerationVector, uint16(_SignedRational), 3,
+              testLongs( e, 1, 2, 0xfffffffd, 4, 5, 6 ) },
+            { _AppleHDRImageType, uint16(_SignedLong), 1, testLongs( e, c.imageType ) },
+            { _AppleOrientation, uint16(_SignedLong), 1, testLongs( e, c.orientation ) },
+        } )
+        d := testParse( t, testMakerNoteTiff( e, "Apple", note ), &Control{ } )
+        f := testFormat( t, d, MAKER )
+        want := append( c.want, "Apple #0001:\n    11",
+                        "Vector Y: -0.750000 (-3/4)" )
+        for _, w := range want {
+            if ! strings.Contains( f, w ) {
+                t.Errorf( "%q not found in:\n%s", w, f )
+            }
+        }
+    }
+}
+
+func TestAppleFixture( t *testing.T ) {
+    d, err := Read( "testdata/apple.tif", 0, &Control{ } )
+    if err != nil {
+        t.Fatalf( "Read: %v", err )
+    }
+    // every value must be named, so that it is formatted
+    for _, v := range d.ifds[MAKER].values {
+        if v != nil && v.getName( ) == "" {
+            t.Errorf( "Apple tag %#04x has no name", v.getTag( ) )
+        }
+    }
+    f := testFormat( t, d, MAKER )
+    for _, w := range []string{ "Apple Image Type:\n    HDR Image",
+                                "Apple Image Orientation:\n    portrait" } {
+        if ! strings.Contains( f, w ) {
+            t.Errorf( "%q not found in:\n%s", w, f )
+        }
+    }
+    x, y, z, err := d.GetAccelerationVector( )
+    if err != nil || x != 0.5 || y != 0.75 || z != 5.0 / 6 {
+        t.Errorf( "acceleration vector %g %g %g (%v)", x, y, z, err )
+    }
+}
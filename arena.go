@@ -0,0 +1,249 @@
+package exif
+
+// support for pooled allocation of values
+
+import (
+    "sync"
+)
+
+/*
+    Each entry allocates a value structure and, except for bytes that are taken
+    directly from the data, a slice of decoded values. When scanning a large
+    number of images this creates a lot of short lived objects for the garbage
+    collector.
+
+    If Control Pooled is set, the most common value structures and slices are
+    taken from slabs owned by an arena, which is shared by the descriptor and
+    its maker notes. Slabs are allocated by chunks of _slabSize items, or more
+    for a single large slice. Once the descriptor is not needed anymore, the
+    arena can be given back to a pool by calling Release, so that its slabs
+    are reused by the next descriptor.
+*/
+
+const _slabSize = 256
+
+type valueArena struct {
+    shorts      []uint16
+    longs       []uint32
+    rationals   []UnsignedRational
+
+    ubValues    []unsignedByteValue
+    usValues    []unsignedShortValue
+    ulValues    []unsignedLongValue
+    urValues    []unsignedRationalValue
+
+    used        [7]int          // items allocated since reset, by slab kind
+}
+
+const (                         // slab kinds
+    _shortSlab = iota
+    _longSlab
+    _rationalSlab
+    _ubSlab
+    _usSlab
+    _ulSlab
+    _urSlab
+)
+
+var arenaPool = sync.Pool{ New: func( ) interface{} { return new( valueArena ) } }
+
+// reset makes the current slabs available again, dropping the references
+// they hold so that they do not keep the previous data alive. If more items
+// than a slab can hold were allocated since the previous reset, the slab is
+// replaced by a larger one able to hold all of them, so that the next
+// descriptors of the same kind need only one slab.
+func (a *valueArena) reset( ) {
+    grow := func( kind, capacity int ) bool {
+        used := a.used[kind]
+        a.used[kind] = 0
+        return used > capacity
+    }
+    if n := a.used[_shortSlab]; grow( _shortSlab, cap(a.shorts) ) {
+        a.shorts = make( []uint16, 0, n )
+    }
+    a.shorts = a.shorts[:0]
+    if n := a.used[_longSlab]; grow( _longSlab, cap(a.longs) ) {
+        a.longs = make( []uint32, 0, n )
+    }
+    a.longs = a.longs[:0]
+    if n := a.used[_rationalSlab]; grow( _rationalSlab, cap(a.rationals) ) {
+        a.rationals = make( []UnsignedRational, 0, n )
+    }
+    a.rationals = a.rationals[:0]
+
+    for i := range a.ubValues {
+        a.ubValues[i] = unsignedByteValue{}
+    }
+    if n := a.used[_ubSlab]; grow( _ubSlab, cap(a.ubValues) ) {
+        a.ubValues = make( []unsignedByteValue, 0, n )
+    }
+    a.ubValues = a.ubValues[:0]
+    for i := range a.usValues {
+        a.usValues[i] = unsignedShortValue{}
+    }
+    if n := a.used[_usSlab]; grow( _usSlab, cap(a.usValues) ) {
+        a.usValues = make( []unsignedShortValue, 0, n )
+    }
+    a.usValues = a.usValues[:0]
+    for i := range a.ulValues {
+        a.ulValues[i] = unsignedLongValue{}
+    }
+    if n := a.used[_ulSlab]; grow( _ulSlab, cap(a.ulValues) ) {
+        a.ulValues = make( []unsignedLongValue, 0, n )
+    }
+    a.ulValues = a.ulValues[:0]
+    for i := range a.urValues {
+        a.urValues[i] = unsignedRationalValue{}
+    }
+    if n := a.used[_urSlab]; grow( _urSlab, cap(a.urValues) ) {
+        a.urValues = make( []unsignedRationalValue, 0, n )
+    }
+    a.urValues = a.urValues[:0]
+}
+
+// slabCapacity returns the capacity of a new slab able to hold n items
+func slabCapacity( n uint32 ) int {
+    if n > _slabSize {
+        return int(n)
+    }
+    return _slabSize
+}
+
+// The alloc functions return zeroed slices of n items, whose capacity is
+// limited to n so that appending to them does not overwrite the slab. The
+// make functions take them from the arena of d if any, or allocate them.
+
+func (d *Desc) makeShorts( n uint32 ) []uint16 {
+    if d.arena == nil {
+        return make( []uint16, n )
+    }
+    return d.arena.allocShorts( n )
+}
+
+func (d *Desc) makeLongs( n uint32 ) []uint32 {
+    if d.arena == nil {
+        return make( []uint32, n )
+    }
+    return d.arena.allocLongs( n )
+}
+
+func (d *Desc) makeRationals( n uint32 ) []UnsignedRational {
+    if d.arena == nil {
+        return make( []UnsignedRational, n )
+    }
+    return d.arena.allocRationals( n )
+}
+
+func (a *valueArena) allocShorts( n uint32 ) []uint16 {
+    a.used[_shortSlab] += int(n)
+    l := len(a.shorts)
+    if cap(a.shorts) - l < int(n) {
+        a.shorts, l = make( []uint16, 0, slabCapacity( n ) ), 0
+    }
+    a.shorts = a.shorts[:l+int(n)]
+    s := a.shorts[l:l+int(n):l+int(n)]
+    for i := range s {
+        s[i] = 0
+    }
+    return s
+}
+
+func (a *valueArena) allocLongs( n uint32 ) []uint32 {
+    a.used[_longSlab] += int(n)
+    l := len(a.longs)
+    if cap(a.longs) - l < int(n) {
+        a.longs, l = make( []uint32, 0, slabCapacity( n ) ), 0
+    }
+    a.longs = a.longs[:l+int(n)]
+    s := a.longs[l:l+int(n):l+int(n)]
+    for i := range s {
+        s[i] = 0
+    }
+    return s
+}
+
+func (a *valueArena) allocRationals( n uint32 ) []UnsignedRational {
+    a.used[_rationalSlab] += int(n)
+    l := len(a.rationals)
+    if cap(a.rationals) - l < int(n) {
+        a.rationals, l = make( []UnsignedRational, 0, slabCapacity( n ) ), 0
+    }
+    a.rationals = a.rationals[:l+int(n)]
+    s := a.rationals[l:l+int(n):l+int(n)]
+    for i := range s {
+        s[i] = UnsignedRational{}
+    }
+    return s
+}
+
+// The alloc<Type>Value functions return a zeroed value structure, taken from
+// the arena of d if any, or newly allocated otherwise.
+
+func (d *Desc) allocUnsignedByteValue( ) *unsignedByteValue {
+    a := d.arena
+    if a == nil {
+        return new( unsignedByteValue )
+    }
+    a.used[_ubSlab] ++
+    if len(a.ubValues) == cap(a.ubValues) {
+        a.ubValues = make( []unsignedByteValue, 0, _slabSize )
+    }
+    a.ubValues = a.ubValues[:len(a.ubValues)+1]
+    return &a.ubValues[len(a.ubValues)-1]
+}
+
+func (d *Desc) allocUnsignedShortValue( ) *unsignedShortValue {
+    a := d.arena
+    if a == nil {
+        return new( unsignedShortValue )
+    }
+    a.used[_usSlab] ++
+    if len(a.usValues) == cap(a.usValues) {
+        a.usValues = make( []unsignedShortValue, 0, _slabSize )
+    }
+    a.usValues = a.usValues[:len(a.usValues)+1]
+    return &a.usValues[len(a.usValues)-1]
+}
+
+func (d *Desc) allocUnsignedLongValue( ) *unsignedLongValue {
+    a := d.arena
+    if a == nil {
+        return new( unsignedLongValue )
+    }
+    a.used[_ulSlab] ++
+    if len(a.ulValues) == cap(a.ulValues) {
+        a.ulValues = make( []unsignedLongValue, 0, _slabSize )
+    }
+    a.ulValues = a.ulValues[:len(a.ulValues)+1]
+    return &a.ulValues[len(a.ulValues)-1]
+}
+
+func (d *Desc) allocUnsignedRationalValue( ) *unsignedRationalValue {
+    a := d.arena
+    if a == nil {
+        return new( unsignedRationalValue )
+    }
+    a.used[_urSlab] ++
+    if len(a.urValues) == cap(a.urValues) {
+        a.urValues = make( []unsignedRationalValue, 0, _slabSize )
+    }
+    a.urValues = a.urValues[:len(a.urValues)+1]
+    return &a.urValues[len(a.urValues)-1]
+}
+
+// Release gives the memory used by the values of a descriptor parsed with
+// Control Pooled back to a pool, for reuse by the next descriptors. It must
+// be called only once the descriptor is not needed anymore: neither the
+// descriptor nor any slice obtained from it, e.g. by GetIfdTagValue, can be
+// used after Release. It does nothing if Control Pooled was not set.
+func (d *Desc) Release( ) {
+    if d.arena == nil {
+        return
+    }
+    a := d.arena
+    d.arena = nil
+    d.root = nil
+    d.ifds = [_IFD_N]*ifdd{}
+    a.reset( )
+    arenaPool.Put( a )
+}
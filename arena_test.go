@@ -0,0 +1,128 @@
+package exif
+
+import (
+    "bytes"
+    "io/ioutil"
+    "path/filepath"
+    "testing"
+)
+
+/*
+    The parse benchmarks read the TIFF fixtures in testdata, with and without
+    Control Pooled, and report allocations:
+
+        go test -run XXX -bench Parse -benchmem
+
+    With Pooled, each descriptor is released after parsing, as an application
+    scanning many images would do, so that the next parse reuses its slabs.
+*/
+
+// testTiffFixtures returns the content of the TIFF fixtures in testdata
+func testTiffFixtures( tb testing.TB ) [][]byte {
+    files, err := filepath.Glob( filepath.Join( "testdata", "*.tif" ) )
+    if err != nil || len(files) == 0 {
+        tb.Fatalf( "no TIFF fixture in testdata: %v", err )
+    }
+    var fixtures [][]byte
+    for _, f := range files {
+        data, err := ioutil.ReadFile( f )
+        if err != nil {
+            tb.Fatal( err )
+        }
+        fixtures = append( fixtures, data )
+    }
+    return fixtures
+}
+
+// parseFixtures parses all fixtures once, releasing each descriptor
+func parseFixtures( tb testing.TB, fixtures [][]byte, ec *Control ) {
+    for _, data := range fixtures {
+        d, err := parseTiff( data, 0, nil, ec )
+        if err != nil {
+            tb.Fatal( err )
+        }
+        d.Release( )
+    }
+}
+
+func benchParse( b *testing.B, pooled bool ) {
+    fixtures := testTiffFixtures( b )
+    ec := &Control{ Pooled: pooled }
+    b.ReportAllocs( )
+    b.ResetTimer( )
+    for i := 0; i < b.N; i++ {
+        parseFixtures( b, fixtures, ec )
+    }
+}
+
+func BenchmarkParse( b *testing.B ) {
+    benchParse( b, false )
+}
+
+func BenchmarkParsePooled( b *testing.B ) {
+    benchParse( b, true )
+}
+
+func TestPooledAllocs( t *testing.T ) {
+    fixtures := testTiffFixtures( t )
+    parseFixtures( t, fixtures, &Control{ Pooled: true } )     // fill the pool
+    plain := testing.AllocsPerRun( 20, func( ) {
+        parseFixtures( t, fixtures, &Control{ } )
+    } )
+    pooled := testing.AllocsPerRun( 20, func( ) {
+        parseFixtures( t, fixtures, &Control{ Pooled: true } )
+    } )
+    t.Logf( "allocs per corpus parse: %.0f, pooled %.0f", plain, pooled )
+    if pooled >= plain {
+        t.Errorf( "pooled parse allocates %.0f objects, not fewer than %.0f",
+                  pooled, plain )
+    }
+}
+
+func TestPooledSameValues( t *testing.T ) {
+    for _, data := range testTiffFixtures( t ) {
+        d, err := parseTiff( data, 0, nil, &Control{ } )
+        if err != nil {
+            t.Fatal( err )
+        }
+        for i := 0; i < 2; i++ {        // second time with reused slabs
+            p, err := parseTiff( data, 0, nil, &Control{ Pooled: true } )
+            if err != nil {
+                t.Fatal( err )
+            }
+            var want, got bytes.Buffer
+            d.Format( &want )
+            p.Format( &got )
+            if ! bytes.Equal( want.Bytes( ), got.Bytes( ) ) {
+                t.Errorf( "pooled values differ:\n%s",
+                          lineDiff( want.Bytes( ), got.Bytes( ) ) )
+            }
+            p.Release( )
+        }
+    }
+}
+
+func TestArenaReset( t *testing.T ) {
+    a := new( valueArena )
+    d := &Desc{ arena: a }
+    s := d.makeShorts( 3 )
+    if len(s) != 3 || cap(s) != 3 {
+        t.Errorf( "makeShorts: len %d cap %d", len(s), cap(s) )
+    }
+    s = append( s, 1 )                  // must not overwrite the slab
+    if n := d.makeShorts( 1 ); n[0] != 0 {
+        t.Errorf( "append to a slice overwrote the slab" )
+    }
+    for i := 0; i < _slabSize; i++ {
+        d.makeRationals( 2 )
+    }
+    a.reset( )
+    if cap(a.rationals) != 2 * _slabSize || len(a.rationals) != 0 {
+        t.Errorf( "reset: rational slab len %d cap %d instead of 0 %d",
+                  len(a.rationals), cap(a.rationals), 2 * _slabSize )
+    }
+    if cap(a.shorts) != _slabSize {
+        t.Errorf( "reset: short slab cap %d instead of %d",
+                  cap(a.shorts), _slabSize )
+    }
+}
@@ -0,0 +1,142 @@
+package exif
+
+// support for building TIFF test data
+
+import (
+    "bytes"
+    "encoding/binary"
+    "image"
+    "image/color"
+    "image/jpeg"
+    "testing"
+)
+
+// testEntry is an IFD entry, with its value already encoded
+type testEntry struct {
+    tag, typ    uint16
+    count       uint32
+    data        []byte
+}
+
+// testIfd returns an IFD located at offset at, made of its entries, the next
+// IFD offset and the data area for values that do not fit in their entry.
+func testIfd( e binary.ByteOrder, at uint32, entries []testEntry,
+              next uint32 ) []byte {
+    var ifd, data bytes.Buffer
+    dataStart := at + 2 + uint32(len(entries)) * 12 + 4
+    binary.Write( &ifd, e, uint16(len(entries)) )
+    for _, en := range entries {
+        binary.Write( &ifd, e, en.tag )
+        binary.Write( &ifd, e, en.typ )
+        binary.Write( &ifd, e, en.count )
+        if len(en.data) <= 4 {
+            v := make( []byte, 4 )
+            copy( v, en.data )
+            ifd.Write( v )
+        } else {
+            binary.Write( &ifd, e, dataStart + uint32(data.Len()) )
+            data.Write( en.data )
+            if data.Len() & 1 == 1 {
+                data.WriteByte( 0 )
+            }
+        }
+    }
+    binary.Write( &ifd, e, next )
+    ifd.Write( data.Bytes() )
+    return ifd.Bytes()
+}
+
+// testIfdSize returns the size of the IFD made of entries
+func testIfdSize( entries []testEntry ) uint32 {
+    return uint32(len(testIfd( binary.LittleEndian, 0, entries, 0 )))
+}
+
+func testShorts( e binary.ByteOrder, v ...uint16 ) []byte {
+    var b bytes.Buffer
+    binary.Write( &b, e, v )
+    return b.Bytes()
+}
+
+func testLongs( e binary.ByteOrder, v ...uint32 ) []byte {
+    var b bytes.Buffer
+    binary.Write( &b, e, v )
+    return b.Bytes()
+}
+
+func testString( s string ) []byte {
+    return append( []byte(s), 0 )
+}
+
+// testTiffHeader returns a TIFF header pointing to IFD0 at offset 8
+func testTiffHeader( e binary.ByteOrder ) []byte {
+    h := []byte( "MM" )
+    if e == binary.LittleEndian {
+        h = []byte( "II" )
+    }
+    return append( append( h, testShorts( e, 42 )... ), testLongs( e, 8 )... )
+}
+
+// testTiff returns TIFF data made of IFD0 and an Exif IFD. The Exif IFD
+// pointer is added to ifd0 entries, which must have smaller tags.
+func testTiff( e binary.ByteOrder, ifd0, exif []testEntry ) []byte {
+    ifd0 = append( ifd0[:len(ifd0):len(ifd0)],
+                   testEntry{ _ExifIFD, uint16(_UnsignedLong), 1, nil } )
+    exifOffset := 8 + testIfdSize( ifd0 )
+    ifd0[len(ifd0)-1].data = testLongs( e, exifOffset )
+    data := append( testTiffHeader( e ), testIfd( e, 8, ifd0, 0 )... )
+    return append( data, testIfd( e, exifOffset, exif, 0 )... )
+}
+
+// testGPSTiff returns TIFF data made of IFD0 and a GPS IFD
+func testGPSTiff( e binary.ByteOrder, gps []testEntry ) []byte {
+    ifd0 := []testEntry{
+        { _Make, uint16(_ASCIIString), 6, testString( "Nikon" ) },
+        { _GpsIFD, uint16(_UnsignedLong), 1, nil },
+    }
+    gpsOffset := 8 + testIfdSize( ifd0 )
+    ifd0[1].data = testLongs( e, gpsOffset )
+    data := append( testTiffHeader( e ), testIfd( e, 8, ifd0, 0 )... )
+    return append( data, testIfd( e, gpsOffset, gps, 0 )... )
+}
+
+// testParse parses TIFF data with the control ec
+func testParse( t *testing.T, tiff []byte, ec *Control ) *Desc {
+    t.Helper( )
+    data := append( []byte( "Exif\x00\x00" ), tiff... )
+    d, err := Parse( data, 0, uint(len(data)), ec )
+    if err != nil {
+        t.Fatalf( "Parse: %v", err )
+    }
+    return d
+}
+
+// testFormat returns the Format output of the ifd id in d
+func testFormat( t *testing.T, d *Desc, id IfdId ) string {
+    t.Helper( )
+    var b bytes.Buffer
+    if _, err := d.FormatIfds( &b, []IfdId{ id } ); err != nil {
+        t.Fatalf( "FormatIfds: %v", err )
+    }
+    return b.String( )
+}
+
+// testImage returns a small gradient image
+func testImage( w, h int ) image.Image {
+    img := image.NewRGBA( image.Rect( 0, 0, w, h ) )
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            img.Set( x, y, color.RGBA{ uint8(x * 16), uint8(y * 16), 100, 255 } )
+        }
+    }
+    return img
+}
+
+// testJpegImage returns a small JPEG image, without metadata
+func testJpegImage( t *testing.T, w, h int ) []byte {
+    t.Helper( )
+    var b bytes.Buffer
+    if err := jpeg.Encode( &b, testImage( w, h ), nil ); err != nil {
+        t.Fatal( err )
+    }
+    return b.Bytes( )
+}
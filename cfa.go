@@ -0,0 +1,186 @@
+package exif
+
+// support for the Exif Color Filter Array pattern (CFAPattern)
+
+import (
+    "fmt"
+    "encoding/binary"
+    "io"
+)
+
+/*
+    The CFAPattern tag (0xa302) is an _Undefined tag in the Exif IFD:
+
+      <horizontal repeat>       2-byte number of columns
+      <vertical repeat>         2-byte number of rows
+      { <color> } * rows * cols 1 byte per color, row after row
+
+    The repeat values should follow the TIFF byte order, but it seems that
+    older microsoft tools do not use the proper endianess. The byte order is
+    therefore switched if the repeat values are not consistent with the total
+    count. For metadata written by those tools (quirkCFASwapped), the pattern
+    is rewritten in the proper byte order while parsing.
+*/
+
+// CFAColor is a color in a CFA pattern
+type CFAColor uint8
+const (
+    CFARed CFAColor = iota
+    CFAGreen
+    CFABlue
+    CFACyan
+    CFAMagenta
+    CFAYellow
+    CFAWhite
+)
+
+var cfaColorNames = [...]string{
+    "RED", "GREEN", "BLUE", "CYAN", "MAGENTA", "YELLOW", "WHITE",
+}
+
+// CFAPattern is the color filter array of the image sensor, given as a
+// matrix of Rows x Cols colors.
+type CFAPattern struct {
+    Rows, Cols  int
+    Colors      [][]CFAColor
+}
+
+// parseCFAPattern returns the CFA pattern found in data, whether the byte
+// order had to be switched, or an error if data is not a valid pattern.
+func parseCFAPattern( data []byte,
+                      endian binary.ByteOrder ) (p CFAPattern, swapped bool, err error) {
+    if len(data) < 4 {
+        err = fmt.Errorf( "CFAPattern: invalid count (%d)\n", len(data) )
+        return
+    }
+    hz := int(endian.Uint16( data[0:2] ))
+    vt := int(endian.Uint16( data[2:4] ))
+    if hz * vt != len(data) - 4 {   // if not try changing endianess
+        other := swapEndian( endian )
+        h1 := int(other.Uint16( data[0:2] ))
+        v1 := int(other.Uint16( data[2:4] ))
+        if h1 * v1 != len(data) - 4 {
+            err = fmt.Errorf( "CFAPattern: Invalid repeat patterns(%d,%d)\n",
+                              hz, vt )
+            return
+        }
+        hz, vt, swapped = h1, v1, true
+    }
+    p.Rows, p.Cols = vt, hz
+    p.Colors = make( [][]CFAColor, vt )
+    for i := 0; i < vt; i++ {
+        p.Colors[i] = make( []CFAColor, hz )
+        for j := 0; j < hz; j++ {
+            p.Colors[i][j] = CFAColor(data[4+i*hz+j])
+        }
+    }
+    return
+}
+
+// encodeCFAPattern checks the pattern and returns its encoding in the given
+// byte order.
+func encodeCFAPattern( p CFAPattern, endian binary.ByteOrder ) ([]byte, error) {
+    if p.Rows <= 0 || p.Cols <= 0 || p.Rows > 0xffff || p.Cols > 0xffff ||
+       len(p.Colors) != p.Rows {
+        return nil, fmt.Errorf( "invalid CFA pattern size (%d rows, %d cols)",
+                                p.Rows, p.Cols )
+    }
+    data := make( []byte, 4, 4 + p.Rows * p.Cols )
+    endian.PutUint16( data[0:2], uint16(p.Cols) )
+    endian.PutUint16( data[2:4], uint16(p.Rows) )
+    for _, row := range p.Colors {
+        if len(row) != p.Cols {
+            return nil, fmt.Errorf( "invalid CFA pattern row (%d colors)",
+                                    len(row) )
+        }
+        for _, c := range row {
+            if int(c) >= len(cfaColorNames) {
+                return nil, fmt.Errorf( "invalid CFA color (%d)", c )
+            }
+            data = append( data, byte(c) )
+        }
+    }
+    return data, nil
+}
+
+func fmtCFAPattern( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+    p, _, err := parseCFAPattern( v.([]byte), ifd.desc.endian )
+    if err != nil {
+        io.WriteString( w, "Invalid pattern" )
+        return
+    }
+    for i, row := range p.Colors {
+        if i > 0 {  // indent if not the first line
+            io.WriteString( w, "\n" + indent )
+        }
+        fmt.Fprintf( w, "Row %d:", i )
+        for _, c := range row {
+            if int(c) >= len(cfaColorNames) {
+                fmt.Fprintf( w, " Invalid color (%d)", c )
+                return
+            }
+            io.WriteString( w, " " + cfaColorNames[c] )
+        }
+    }
+}
+
+func (ifd *ifdd) storeExifCFAPattern( ) error {
+    if ifd.fType != _Undefined {
+        return fmt.Errorf( "CFAPattern: invalid type (%s)\n", getTiffTString( ifd.fType ) )
+    }
+    bSlice := ifd.getUnsignedBytes( )
+    p, swapped, err := parseCFAPattern( bSlice, ifd.desc.endian )
+    if err != nil {
+        return err
+    }
+    if swapped {
+        if ifd.desc.hasQuirk( quirkCFASwapped ) {
+            if bSlice, err = encodeCFAPattern( p, ifd.desc.endian ); err != nil {
+                return err
+            }
+            if ifd.desc.ParsDbg {
+                ifd.desc.logf( LogDebug, "CFAPattern: known quirk, byte order fixed\n" )
+            }
+        } else if ifd.desc.Warn {
+            ifd.desc.logf( LogWarning, "CFAPattern: Warning: incorrect endianess\n")
+        }
+    }
+    ifd.storeValue( ifd.newUnsignedByteValue( "Color Filter Array Pattern",
+                                              fmtCFAPattern, bSlice ) )
+    return nil
+}
+
+// GetCFAPattern returns the color filter array pattern found in the Exif IFD,
+// or a non-nil error if it is absent or invalid. Patterns written by older
+// tools with the wrong byte order are accepted.
+func (d *Desc) GetCFAPattern( ) (CFAPattern, error) {
+    if ifd := d.ifds[EXIF]; ifd != nil {
+        if ub, ok := ifd.getValue( _CFAPattern ).(*unsignedByteValue); ok {
+            p, _, err := parseCFAPattern( ub.v, d.endian )
+            if err != nil {
+                return p, fmt.Errorf( "GetCFAPattern: %w", err )
+            }
+            return p, nil
+        }
+    }
+    return CFAPattern{}, fmt.Errorf( "GetCFAPattern: no CFA pattern\n" )
+}
+
+// SetCFAPattern sets the color filter array pattern in the Exif IFD, using
+// the metadata byte order. It returns a non-nil error if the pattern is not
+// valid or if the Exif IFD is not present, unless Control CreateExif is set.
+func (d *Desc) SetCFAPattern( p CFAPattern ) error {
+    data, err := encodeCFAPattern( p, d.endian )
+    if err != nil {
+        return fmt.Errorf( "SetCFAPattern: %w",
+                           &ValidationError{ EXIF, _CFAPattern, err } )
+    }
+    ifd, err := d.getExifIfd( )
+    if err != nil {
+        return fmt.Errorf( "SetCFAPattern: %w", err )
+    }
+    ifd.newEntry( _CFAPattern, _Undefined )
+    ifd.setValue( ifd.newUnsignedByteValue( "Color Filter Array Pattern",
+                                            fmtCFAPattern, data ) )
+    return nil
+}
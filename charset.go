@@ -0,0 +1,191 @@
+package exif
+
+// support for decoding text in various character sets
+
+import (
+    "fmt"
+    "bytes"
+    "strings"
+    "encoding/binary"
+    "unicode/utf8"
+    "unicode/utf16"
+)
+
+/*
+    The UserComment value starts with an 8-byte character code identifying the
+    character set of the following text:
+
+      "ASCII\x00\x00\x00"       ITU-T T.50 IA5 (ASCII)
+      "JIS\x00\x00\x00\x00\x00" JIS X0208-1990, in practice often Shift-JIS or
+                                ISO-2022-JP
+      "UNICODE\x00"             UTF-16, in the metadata byte order unless it
+                                starts with a byte order mark
+      8 NUL bytes               undefined, in practice often UTF-8
+
+    ASCII tags such as ImageDescription are also often written in UTF-8 or in
+    Latin-1 by non conforming software.
+
+    Text is decoded into UTF-8 for display only, lossily if needed: the
+    original bytes are kept unchanged when the metadata is serialized. JIS
+    decoding requires conversion tables that are not available here: only the
+    ASCII characters are kept and each JIS character is replaced with U+FFFD.
+*/
+
+// Charset identifies the character set of a text value
+type Charset uint8
+const (
+    UndefinedCharset Charset = iota // unknown or not specified
+    ASCIICharset                    // ITU-T T.50 IA5 (ASCII)
+    JISCharset                      // JIS X0208-1990
+    UnicodeCharset                  // UTF-16
+    UTF8Charset                     // UTF-8 (not standard)
+    Latin1Charset                   // ISO 8859-1 (not standard)
+)
+
+var charsetNames = [...]string {
+    "Undefined", "ASCII", "JIS", "Unicode", "UTF-8", "Latin-1",
+}
+
+// String returns the character set name
+func (c Charset)String( ) string {
+    if int(c) < len(charsetNames) {
+        return charsetNames[c]
+    }
+    return fmt.Sprintf( "Charset(%d)", c )
+}
+
+// decodeUTF16 converts UTF-16 text, in the given byte order unless it starts
+// with a byte order mark, into a go string, stopping at the first NUL.
+func decodeUTF16( b []byte, endian binary.ByteOrder ) string {
+    if len(b) >= 2 {
+        switch {
+        case b[0] == 0xfe && b[1] == 0xff:
+            endian, b = binary.BigEndian, b[2:]
+        case b[0] == 0xff && b[1] == 0xfe:
+            endian, b = binary.LittleEndian, b[2:]
+        }
+    }
+    u := make( []uint16, 0, len(b)/2 )
+    for i := 0; i + 1 < len(b); i += 2 {
+        c := endian.Uint16( b[i:] )
+        if c == 0 {
+            break
+        }
+        u = append( u, c )
+    }
+    return string( utf16.Decode( u ) )
+}
+
+// decodeJIS keeps the ASCII characters from JIS text (raw JIS X0208, Shift-JIS
+// or ISO-2022-JP) and replaces all other characters with U+FFFD.
+func decodeJIS( b []byte ) string {
+    var sb strings.Builder
+    twoByte := false            // ISO-2022-JP shift state
+    for i := 0; i < len(b); i++ {
+        c := b[i]
+        switch {
+        case c == 0:
+            return sb.String( )
+        case c == 0x1b && i + 2 < len(b):   // escape sequence
+            twoByte = b[i+1] == '$'
+            i += 2
+        case c >= 0x80:                     // Shift-JIS or EUC lead byte
+            if ( c < 0xa1 || c > 0xdf ) && i + 1 < len(b) {
+                i ++                        // not half-width katakana
+            }
+            sb.WriteRune( utf8.RuneError )
+        case twoByte && i + 1 < len(b):
+            i ++
+            sb.WriteRune( utf8.RuneError )
+        default:
+            sb.WriteByte( c )
+        }
+    }
+    return sb.String( )
+}
+
+// decodeText converts text that should be ASCII but may be in UTF-8 or in
+// Latin-1 into a go string, stopping at the first NUL.
+func decodeText( b []byte ) (string, Charset) {
+    if i := bytes.IndexByte( b, 0 ); i != -1 {
+        b = b[:i]
+    }
+    ascii := true
+    for _, c := range b {
+        if c >= 0x80 {
+            ascii = false
+            break
+        }
+    }
+    switch {
+    case ascii:
+        return string(b), ASCIICharset
+    case utf8.Valid( b ):
+        return string(b), UTF8Charset
+    }
+    r := make( []rune, len(b) )     // Latin-1 maps to the first 256 runes
+    for i, c := range b {
+        r[i] = rune(c)
+    }
+    return string(r), Latin1Charset
+}
+
+// decodeUserComment returns the character set and the text in a UserComment
+// value, decoded into UTF-8.
+func decodeUserComment( ud []byte, endian binary.ByteOrder ) (Charset, string) {
+    if len(ud) < 8 {
+        return UndefinedCharset, ""
+    }
+    var cs Charset
+    var text string
+    switch string(ud[0:8]) {
+    case "ASCII\x00\x00\x00":
+        text, cs = decodeText( ud[8:] )
+        if cs == UTF8Charset || cs == Latin1Charset {
+            cs = ASCIICharset               // as declared
+        }
+    case "JIS\x00\x00\x00\x00\x00":
+        cs, text = JISCharset, decodeJIS( ud[8:] )
+    case "UNICODE\x00":
+        cs, text = UnicodeCharset, decodeUTF16( ud[8:], endian )
+    default:
+        text, cs = decodeText( ud[8:] )
+        if cs == ASCIICharset {
+            cs = UndefinedCharset           // as declared
+        }
+    }
+    return cs, strings.TrimRight( text, " " )
+}
+
+// GetUserComment returns the Exif UserComment text, decoded into UTF-8, and
+// its declared character set. Decoding may be lossy (see Charset), but the
+// original value is not modified.
+//
+// It returns a non-nil error if there is no valid UserComment.
+func (d *Desc)GetUserComment( ) (Charset, string, error) {
+    if ifd := d.ifds[EXIF]; ifd != nil {
+        if ub, ok := ifd.getValue( _UserComment ).(*unsignedByteValue);
+           ok && len(ub.v) >= 8 {
+            cs, text := decodeUserComment( ub.v, d.endian )
+            return cs, text, nil
+        }
+    }
+    return UndefinedCharset, "", fmt.Errorf( "GetUserComment: no user comment\n" )
+}
+
+// GetImageDescription returns the ImageDescription text from the primary IFD,
+// decoded into UTF-8, and the actual character set detected: ASCII as
+// required, or UTF-8 or Latin-1 as written by some software. The original
+// value is not modified.
+//
+// It returns a non-nil error if there is no ImageDescription.
+func (d *Desc)GetImageDescription( ) (Charset, string, error) {
+    if ifd := d.ifds[PRIMARY]; ifd != nil {
+        if ub, ok := ifd.getValue( _ImageDescription ).(*unsignedByteValue);
+           ok && ub.s {
+            text, cs := decodeText( ub.v )
+            return cs, text, nil
+        }
+    }
+    return UndefinedCharset, "", fmt.Errorf( "GetImageDescription: no image description\n" )
+}
@@ -0,0 +1,201 @@
+package exif
+
+// support for deep copies of descriptors
+
+import (
+    "fmt"
+)
+
+/*
+    Clone returns a copy of a descriptor that can be modified independently of
+    the original, for instance to prepare a modified copy for export while
+    keeping the original metadata pristine.
+
+    All IFDs and their values, including value slices, maker note descriptors
+    and their IFDs, dynamic namespaces, statistics and global information are
+    duplicated, and all links between them (parent IFD, embedded IFDs, maker
+    notes, next IFD) are redirected to the copies. The parsed data, which is
+    never modified, is shared.
+
+    The copy never uses pooled values, even if the original was parsed with
+    Control Pooled, so that releasing one of them does not affect the other.
+
+    Formatting a few values looks up another tag at format time, such as the
+    GPS reference of a coordinate. Formatters are given the IFD where the
+    value is when it is formatted, so that copied values look up tags in the
+    copy, never in the original.
+*/
+
+// cloner keeps track of the copies made while cloning a descriptor
+type cloner struct {
+    stats   *Stats                  // copied statistics, shared by all descs
+    ns      *namespaces             // copied namespaces, shared as well
+    descs   map[*Desc]*Desc         // original to copy
+    ifds    map[*ifdd]*ifdd         // original to copy
+}
+
+func (s *Stats) clone( ) *Stats {
+    c := *s
+    c.Dynamic = append( []IfdStats(nil), s.Dynamic... )
+    c.Warnings = append( []MakerNoteWarning(nil), s.Warnings... )
+    c.RemovedEntries = append( []RemovedEntry(nil), s.RemovedEntries... )
+    return &c
+}
+
+func (c *cloner) desc( d *Desc ) *Desc {
+    nd := new( Desc )
+    *nd = *d
+    nd.stats, nd.ns = c.stats, c.ns
+    nd.arena, nd.parallel, nd.jobs = nil, nil, nil
+    if d.global.makerNote != nil {
+        nd.global.makerNote = append( []byte(nil), d.global.makerNote... )
+    }
+    if d.global.quickTimeKeys != nil {
+        nd.global.quickTimeKeys = make( map[string]string )
+        for k, v := range d.global.quickTimeKeys {
+            nd.global.quickTimeKeys[k] = v
+        }
+    }
+    nd.global.previews = append( []makerPreviewInfo(nil), d.global.previews... )
+    c.descs[d] = nd
+
+    if d.root != nil {
+        nd.root = c.ifd( d.root, nd )
+    }
+    for id, ifd := range d.ifds {   // all reachable from root
+        nd.ifds[id] = c.ifds[ifd]
+    }
+    return nd
+}
+
+func (c *cloner) ifd( ifd *ifdd, d *Desc ) *ifdd {
+    n := new( ifdd )
+    *n = *ifd
+    n.desc = d
+    n.pValue = nil                  // set by the parent value, if any
+    c.ifds[ifd] = n
+
+    n.values = make( []serializer, len(ifd.values) )
+    for i, v := range ifd.values {
+        if v != nil {
+            n.values[i] = c.value( v, n )
+        }
+    }
+    if ifd.next != nil {
+        n.next = c.ifd( ifd.next, d )
+    }
+    return n
+}
+
+func (c *cloner) value( v serializer, ifd *ifdd ) serializer {
+    switch v := v.(type) {
+    case *ifdValue:
+        n := *v
+        d := c.descs[v.v.desc]
+        if d == nil {
+            d = ifd.desc
+        }
+        n.v = c.ifd( v.v, d )
+        n.v.pValue = &n
+        n.ifd = ifd
+        return &n
+    case *descValue:
+        n := *v
+        n.v = c.desc( v.v )
+        n.v.root.pValue = &n
+        n.ifd = ifd
+        return &n
+    case *thumbnailValue:
+        n := *v
+        n.v = append( []uint8(nil), v.v... )
+        n.ifd = ifd
+        return &n
+    case *unsignedByteValue:
+        n := *v
+        n.v = append( []uint8(nil), v.v... )
+        n.ifd = ifd
+        return &n
+    case *signedByteValue:
+        n := *v
+        n.v = append( []int8(nil), v.v... )
+        n.ifd = ifd
+        return &n
+    case *unsignedShortValue:
+        n := *v
+        n.v = append( []uint16(nil), v.v... )
+        n.ifd = ifd
+        return &n
+    case *signedShortValue:
+        n := *v
+        n.v = append( []int16(nil), v.v... )
+        n.ifd = ifd
+        return &n
+    case *unsignedLongValue:
+        n := *v
+        n.v = append( []uint32(nil), v.v... )
+        n.ifd = ifd
+        return &n
+    case *signedLongValue:
+        n := *v
+        n.v = append( []int32(nil), v.v... )
+        n.ifd = ifd
+        return &n
+    case *unsignedLong8Value:
+        n := *v
+        n.v = append( []uint64(nil), v.v... )
+        n.ifd = ifd
+        return &n
+    case *signedLong8Value:
+        n := *v
+        n.v = append( []int64(nil), v.v... )
+        n.ifd = ifd
+        return &n
+    case *floatValue:
+        n := *v
+        n.v = append( []float32(nil), v.v... )
+        n.ifd = ifd
+        return &n
+    case *doubleValue:
+        n := *v
+        n.v = append( []float64(nil), v.v... )
+        n.ifd = ifd
+        return &n
+    case *rawValue:
+        n := *v
+        n.v = append( []byte(nil), v.v... )
+        n.ifd = ifd
+        return &n
+    case *unsignedRationalValue:
+        n := *v
+        n.v = append( []UnsignedRational(nil), v.v... )
+        n.ifd = ifd
+        return &n
+    case *signedRationalValue:
+        n := *v
+        n.v = append( []SignedRational(nil), v.v... )
+        n.ifd = ifd
+        return &n
+    }
+    panic( fmt.Sprintf( "Clone: unexpected value type %T\n", v ) )
+}
+
+// Clone returns a deep copy of the descriptor, which can be modified without
+// affecting the original descriptor, and vice versa. The parsed data is
+// shared, since it is never modified.
+func (d *Desc) Clone( ) *Desc {
+    c := &cloner{ stats: d.stats.clone( ),
+                  descs: make( map[*Desc]*Desc ),
+                  ifds: make( map[*ifdd]*ifdd ) }
+    c.ns = &namespaces{ names: append( []string(nil), d.ns.names... ),
+                        ifds: make( []*ifdd, len(d.ns.ifds) ),
+                        embedded: append( []bool(nil), d.ns.embedded... ) }
+    nd := c.desc( d )
+    for i, ifd := range d.ns.ifds {
+        if n := c.ifds[ifd]; n != nil || ifd == nil {
+            c.ns.ifds[i] = n
+        } else if od := c.descs[ifd.desc]; od != nil {
+            c.ns.ifds[i] = c.ifd( ifd, od )   // not linked, e.g. maker previews
+        }
+    }
+    return nd
+}
@@ -0,0 +1,62 @@
+package exif
+
+import (
+    "encoding/binary"
+    "strings"
+    "testing"
+)
+
+// testGPSPosition returns GPS entries for a latitude with its reference and
+// a destination bearing and distance, with their references
+func testGPSPosition( e binary.ByteOrder ) []testEntry {
+    return []testEntry{
+        { _GPSLatitudeRef, uint16(_ASCIIString), 2, testString( "S" ) },
+        { _GPSLatitude, uint16(_UnsignedRational), 3,
+                        testLongs( e, 33, 1, 30, 1, 0, 1 ) },
+        { _GPSDestBearingRef, uint16(_ASCIIString), 2, testString( "T" ) },
+        { _GPSDestBearing, uint16(_UnsignedRational), 1, testLongs( e, 90, 1 ) },
+        { _GPSDestDistanceRef, uint16(_ASCIIString), 2, testString( "K" ) },
+        { _GPSDestDistance, uint16(_UnsignedRational), 1, testLongs( e, 12, 1 ) },
+    }
+}
+
+func TestCloneFormatUsesClone( t *testing.T ) {
+    e := binary.LittleEndian
+    for _, pooled := range []bool{ false, true } {
+        d := testParse( t, testGPSTiff( e, testGPSPosition( e ) ),
+                        &Control{ Pooled: pooled } )
+        c := d.Clone( )
+        if err := c.Remove( GPS, _GPSLatitudeRef ); err != nil {
+            t.Fatalf( "Remove: %v", err )
+        }
+        if err := c.Remove( GPS, _GPSDestDistance ); err != nil {
+            t.Fatalf( "Remove: %v", err )
+        }
+        d.Release( )                        // must not affect the clone
+
+        f := testFormat( t, c, GPS )
+        if strings.Contains( f, "0.00\" S" ) {
+            t.Errorf( "pooled %v: clone latitude uses the original ref:\n%s",
+                      pooled, f )
+        }
+        if strings.Contains( f, "12.0 km" ) {
+            t.Errorf( "pooled %v: clone bearing uses the original distance:\n%s",
+                      pooled, f )
+        }
+        if ! strings.Contains( f, "bearing 90.0° T" ) {
+            t.Errorf( "pooled %v: clone bearing not formatted:\n%s", pooled, f )
+        }
+    }
+}
+
+func TestCloneIsIndependent( t *testing.T ) {
+    e := binary.BigEndian
+    d := testParse( t, testGPSTiff( e, testGPSPosition( e ) ), &Control{ } )
+    c := d.Clone( )
+    if err := c.Remove( GPS, _GPSLatitudeRef ); err != nil {
+        t.Fatalf( "Remove: %v", err )
+    }
+    if f := testFormat( t, d, GPS ); ! strings.Contains( f, "33° 30' 0.00\" S" ) {
+        t.Errorf( "original changed by clone update:\n%s", f )
+    }
+}
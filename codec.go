@@ -0,0 +1,130 @@
+package exif
+
+// support for decoding and encoding JPEG images with their metadata
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "image"
+    "image/jpeg"
+    "io"
+    "io/ioutil"
+)
+
+/*
+    The standard image/jpeg package decodes and encodes images, but ignores
+    their metadata. DecodeWithMetadata returns both the decoded image and its
+    metadata, and EncodeWithMetadata encodes an image with the given metadata,
+    so that an image can be decoded, transformed and encoded again without
+    losing its metadata:
+
+        img, d, err := exif.DecodeWithMetadata( r )
+        ...                                 // resize, crop, redact d...
+        err = exif.EncodeWithMetadata( w, resized, d, nil )
+
+    The decoded image is not rotated according to the Orientation tag, which
+    is kept as is. Only the exif APP1 segment and the ICC profile (APP2
+    segments) are written: other segments, such as XMP, and any trailer are
+    not preserved.
+*/
+
+// DecodeWithMetadata reads a JPEG image from r, and returns the decoded image
+// along with its metadata. The metadata is parsed with a Control built from
+// opts, see NewControl. If the image has no metadata, an empty descriptor is
+// returned, as with Control Empty. The ICC profile of the image, if any, is
+// kept in the descriptor in both cases (see SetICCProfile).
+//
+// It returns a non-nil error if the image cannot be decoded or if its metadata
+// cannot be parsed.
+func DecodeWithMetadata( r io.Reader,
+                         opts ...Option ) (img image.Image, d *Desc, err error) {
+    defer func ( ) {
+        if err != nil {
+            img, d, err = nil, nil, fmt.Errorf( "DecodeWithMetadata: %w", err )
+        }
+    }()
+
+    var data []byte
+    if data, err = ioutil.ReadAll( r ); err != nil {
+        return
+    }
+    if img, err = jpeg.Decode( bytes.NewReader( data ) ); err != nil {
+        return
+    }
+    ec := NewControl( opts... )
+    if d, err = parseJpeg( data, 0, ec ); errors.Is( err, ErrNoExif ) {
+        d, err = newEmptyDesc( ec ), nil
+        if profile := getJpegIccProfile( data, 0 ); profile != nil {
+            d.SetICCProfile( profile )
+        }
+    }
+    return
+}
+
+// isEmpty returns true if d holds no value, as an empty descriptor returned by
+// DecodeWithMetadata or created with Control Empty.
+func (d *Desc)isEmpty( ) bool {
+    if d.root == nil {
+        return true
+    }
+    if d.root.next != nil {
+        return false
+    }
+    for _, v := range d.root.values {
+        if v != nil {
+            return false
+        }
+    }
+    return true
+}
+
+// EncodeWithMetadata writes img to w as a JPEG image encoded with options o,
+// as jpeg.Encode does, with the metadata d and its ICC profile, if any, in
+// APP2 segments. If d is nil, the image is written without metadata. If d is
+// empty, the image is written without exif metadata, but with its ICC profile.
+//
+// The pixel dimensions in the metadata are set to the image size, as done by
+// SetPixelDimensions, if the Exif IFD is present, and the Control Software
+// identity is stamped as by UpdateJpeg. This is done on a copy, and d is not
+// modified.
+//
+// It returns a non-nil error if the image cannot be encoded, if the metadata
+// cannot be serialized in an APP1 segment or if the ICC profile does not fit
+// in APP2 segments.
+func EncodeWithMetadata( w io.Writer, img image.Image, d *Desc,
+                         o *jpeg.Options ) (err error) {
+    defer func ( ) {
+        if err != nil { err = fmt.Errorf( "EncodeWithMetadata: %w", err ) }
+    }()
+
+    var b bytes.Buffer
+    if err = jpeg.Encode( &b, img, o ); err != nil {
+        return
+    }
+    if d == nil {
+        _, err = w.Write( b.Bytes( ) )
+        return
+    }
+    data := b.Bytes( )
+    if profile := d.global.iccProfile; profile != nil {
+        var icc []byte              // right after SOI, exif will precede it
+        if icc, err = getJpegIccSegments( profile ); err != nil {
+            return
+        }
+        data = append( append( []byte{ 0xff, _SOI }, icc... ), data[2:]... )
+    }
+    if d.isEmpty( ) {               // no exif metadata
+        _, err = w.Write( data )
+        return
+    }
+    c := d.Clone( )
+    c.CreateExif = false
+    size := img.Bounds( ).Size( )
+    err = c.SetPixelDimensions( uint32(size.X), uint32(size.Y) )
+    if err != nil && ! errors.Is( err, ErrIfdNotPresent ) {
+        return
+    }
+    _, err = c.UpdateJpeg( w, data, false )
+    return
+}
@@ -0,0 +1,80 @@
+package exif
+
+import (
+    "bytes"
+    "image/jpeg"
+    "testing"
+)
+
+// testEncode returns the image encoded with EncodeWithMetadata and d
+func testEncode( t *testing.T, d *Desc ) []byte {
+    t.Helper( )
+    var b bytes.Buffer
+    if err := EncodeWithMetadata( &b, testImage( 8, 8 ), d, nil ); err != nil {
+        t.Fatalf( "EncodeWithMetadata: %v", err )
+    }
+    return b.Bytes( )
+}
+
+func TestEncodeICCProfile( t *testing.T ) {
+    img := testJpegImage( t, 8, 8 )
+    for _, c := range []struct {
+        name    string
+        data    []byte
+        exif    bool            // expected in the encoded image
+    } {
+        { "EXIF and ICC", testJpegWith( img, testExifSegment( ), testIccSegment ), true },
+        { "ICC only", testJpegWith( img, testIccSegment ), false },
+    } {
+        _, d, err := DecodeWithMetadata( bytes.NewReader( c.data ) )
+        if err != nil {
+            t.Fatalf( "%s: DecodeWithMetadata: %v", c.name, err )
+        }
+        data := testEncode( t, d )
+        if p := getJpegIccProfile( data, 0 ); string(p) != "profile" {
+            t.Errorf( "%s: ICC profile %q", c.name, p )
+        }
+        if _, _, err := findJpegExif( data, 0 ); (err == nil) != c.exif {
+            t.Errorf( "%s: exif segment %v", c.name, err )
+        }
+        if _, err := jpeg.Decode( bytes.NewReader( data ) ); err != nil {
+            t.Errorf( "%s: encoded image: %v", c.name, err )
+        }
+    }
+}
+
+func TestEncodeWithoutMetadata( t *testing.T ) {
+    want := testJpegImage( t, 8, 8 )
+    if got := testEncode( t, nil ); ! bytes.Equal( got, want ) {
+        t.Errorf( "nil metadata: image differs from jpeg.Encode" )
+    }
+    _, d, err := DecodeWithMetadata( bytes.NewReader( want ) )
+    if err != nil {
+        t.Fatalf( "DecodeWithMetadata: %v", err )
+    }
+    if got := testEncode( t, d ); ! bytes.Equal( got, want ) {
+        t.Errorf( "empty metadata: image differs from jpeg.Encode" )
+    }
+}
+
+func TestJpegIccSegments( t *testing.T ) {
+    profile := make( []byte, 2 * _iccChunkSize + 10 )
+    for i := range profile {
+        profile[i] = byte(i)
+    }
+    segs, err := getJpegIccSegments( profile )
+    if err != nil {
+        t.Fatalf( "getJpegIccSegments: %v", err )
+    }
+    data := testJpegWith( testJpegImage( t, 8, 8 ), segs )
+    if n := bytes.Count( data, []byte( _iccSignature ) ); n != 3 {
+        t.Errorf( "%d APP2 segments instead of 3", n )
+    }
+    if p := getJpegIccProfile( data, 0 ); ! bytes.Equal( p, profile ) {
+        t.Errorf( "reassembled profile differs (%d bytes)", len(p) )
+    }
+    if _, err := getJpegIccSegments( make( []byte, 255 * _iccChunkSize + 1 ) );
+       err == nil {
+        t.Errorf( "oversized profile accepted" )
+    }
+}
@@ -0,0 +1,209 @@
+package exif
+
+// support for reporting the effective color space
+
+import (
+    "fmt"
+    "bytes"
+    "strings"
+    "encoding/binary"
+    "unicode/utf16"
+)
+
+/*
+    The Exif ColorSpace tag can only indicate sRGB (1) or Uncalibrated (65535).
+    Other color spaces are given as Uncalibrated, with additional information:
+
+    - the Interoperability IFD InteroperabilityIndex "R03" indicates Adobe RGB,
+      (DCF option file) while "R98" indicates sRGB (DCF basic file).
+    - an ICC profile, stored in JPEG APP2 segments starting with the signature
+      "ICC_PROFILE\x00", followed by a 1-byte sequence number and a 1-byte
+      number of segments. The profile description (tag 'desc') identifies the
+      usual color spaces, such as "Display P3" used by Apple devices.
+
+    ICC profile layout (big endian):
+      128-byte header
+      4-byte tag count
+      { 4-byte signature, 4-byte offset, 4-byte size } * tag count
+
+    The 'desc' tag value is either a textDescriptionType ('desc', 4 reserved
+    bytes, 4-byte ASCII count, ASCII string) or a multiLocalizedUnicodeType
+    ('mluc', 4 reserved bytes, 4-byte record count, 4-byte record size, then
+    records of 2-byte language, 2-byte country, 4-byte length and 4-byte
+    offset from the tag start, of UTF-16BE strings).
+*/
+
+// ColorSpace is the effective color space of the image
+type ColorSpace uint8
+const (
+    UnknownColorSpace ColorSpace = iota // no color space information
+    SRGB                                // sRGB
+    AdobeRGB                            // Adobe RGB (1998)
+    DisplayP3                           // Display P3
+    UncalibratedColorSpace              // any other color space
+)
+
+var colorSpaceNames = [...]string {
+    "Unknown", "sRGB", "Adobe RGB", "Display P3", "Uncalibrated",
+}
+
+// String returns the color space name
+func (cs ColorSpace)String( ) string {
+    if int(cs) < len(colorSpaceNames) {
+        return colorSpaceNames[cs]
+    }
+    return fmt.Sprintf( "ColorSpace(%d)", cs )
+}
+
+const _iccSignature = "ICC_PROFILE\x00"
+
+// getJpegIccProfile returns the ICC profile, reassembled from all APP2
+// segments in the JPEG data, or nil if no valid profile is found.
+func getJpegIccProfile( data []byte, start uint ) []byte {
+    segments, _ := getJpegSegments( data, start )
+    var chunks [][]byte
+    for _, s := range segments {
+        p := data[s.payload:s.end]
+        if s.marker != _APP2 || len(p) < len(_iccSignature) + 2 ||
+           ! bytes.HasPrefix( p, []byte( _iccSignature ) ) {
+            continue
+        }
+        seq, n := int(p[len(_iccSignature)]), int(p[len(_iccSignature)+1])
+        if chunks == nil {
+            chunks = make( [][]byte, n )
+        }
+        if seq < 1 || seq > len(chunks) || n != len(chunks) {
+            return nil
+        }
+        chunks[seq-1] = p[len(_iccSignature)+2:]
+    }
+    var profile []byte
+    for _, c := range chunks {
+        if c == nil {
+            return nil
+        }
+        profile = append( profile, c... )
+    }
+    return profile
+}
+
+// _iccChunkSize is the maximum size of a profile chunk in an APP2 segment
+const _iccChunkSize = 0xffff - 2 - len(_iccSignature) - 2
+
+// getJpegIccSegments returns the APP2 segments holding the ICC profile, or
+// an error if the profile is too large for the 255 segments available.
+func getJpegIccSegments( profile []byte ) ([]byte, error) {
+    n := (len(profile) + _iccChunkSize - 1) / _iccChunkSize
+    if n > 255 {
+        return nil, fmt.Errorf( "ICC profile size %d %w\n", len(profile),
+                                ErrSegmentTooLarge )
+    }
+    var b bytes.Buffer
+    for i := 0; i < n; i++ {
+        chunk := profile[i*_iccChunkSize:]
+        if len(chunk) > _iccChunkSize {
+            chunk = chunk[:_iccChunkSize]
+        }
+        sLen := 2 + len(_iccSignature) + 2 + len(chunk)
+        b.Write( []byte{ 0xff, _APP2, byte(sLen >> 8), byte(sLen) } )
+        b.WriteString( _iccSignature )
+        b.Write( []byte{ byte(i + 1), byte(n) } )
+        b.Write( chunk )
+    }
+    return b.Bytes( ), nil
+}
+
+// getIccDescription returns the description found in the ICC profile, or
+// an empty string if no description is found.
+func getIccDescription( profile []byte ) string {
+    be := binary.BigEndian
+    if len(profile) < 132 {
+        return ""
+    }
+    count := be.Uint32( profile[128:] )
+    for i := uint64(0); i < uint64(count); i++ {
+        e := 132 + i * 12
+        if e + 12 > uint64(len(profile)) {
+            break
+        }
+        if string(profile[e:e+4]) != "desc" {
+            continue
+        }
+        o, s := uint64(be.Uint32( profile[e+4:] )), uint64(be.Uint32( profile[e+8:] ))
+        if o + s > uint64(len(profile)) || s < 12 {
+            return ""
+        }
+        v := profile[o:o+s]
+        switch string(v[0:4]) {
+        case "desc":
+            n := uint64(be.Uint32( v[8:] ))
+            if 12 + n > s {
+                return ""
+            }
+            return string( bytes.TrimRight( v[12:12+n], "\x00" ) )
+        case "mluc":
+            if s < 28 {
+                return ""
+            }
+            l, ro := uint64(be.Uint32( v[20:] )), uint64(be.Uint32( v[24:] ))
+            if ro + l > s {
+                return ""
+            }
+            u := make( []uint16, l / 2 )
+            for j := range u {
+                u[j] = be.Uint16( v[ro+uint64(j)*2:] )
+            }
+            return string( utf16.Decode( u ) )
+        }
+        return ""
+    }
+    return ""
+}
+
+// SetICCProfile gives the ICC profile associated with the metadata, when the
+// metadata is not read from a JPEG file by Read, which retrieves it from the
+// file. The profile is used to determine the effective color space, and is
+// written along with the metadata by EncodeWithMetadata.
+func (d *Desc)SetICCProfile( profile []byte ) {
+    d.global.iccProfile = profile
+    if desc := getIccDescription( profile ); desc != "" {
+        d.global.iccDescription = desc
+    } else {
+        d.global.iccDescription = ""
+    }
+}
+
+// ICCProfileDescription returns the description of the ICC profile given by
+// SetICCProfile or found by Read in the JPEG file, or "" if there is none.
+func (d *Desc)ICCProfileDescription( ) string {
+    return d.global.iccDescription
+}
+
+// EffectiveColorSpace returns the actual color space of the image. If the
+// ColorSpace tag indicates Uncalibrated, the Interoperability index and the
+// ICC profile description, if available, are used to identify the actual
+// color space, such as Adobe RGB or Display P3.
+func (d *Desc)EffectiveColorSpace( ) ColorSpace {
+    cs, ok := d.getExifUnsignedInteger( _ColorSpace )
+    if ok && cs == 1 {
+        return SRGB
+    }
+    if desc := d.global.iccDescription; desc != "" {
+        desc = strings.ToLower( desc )
+        switch {
+        case strings.Contains( desc, "display p3" ):  return DisplayP3
+        case strings.Contains( desc, "adobe rgb" ):   return AdobeRGB
+        case strings.Contains( desc, "srgb" ):        return SRGB
+        }
+    }
+    if iop := d.ifds[IOP]; iop != nil {
+        switch index, _ := iop.getAsciiString( _InteroperabilityIndex ); index {
+        case "R03": return AdobeRGB
+        case "R98": return SRGB
+        }
+    }
+    if ok {
+        return UncalibratedColorSpace
+    }
+    return UnknownColorSpace
+}
@@ -0,0 +1,230 @@
+package exif
+
+// support for composite image information
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io"
+)
+
+/*
+    Exif 2.32 describes images made by combining several captures, as done by
+    smartphones for night or HDR shots, with 3 tags in the Exif IFD:
+
+      0xa460 CompositeImage                 1 _UnsignedShort: 0 unknown, 1 not
+                                            a composite image, 2 general
+                                            composite image, 3 composite image
+                                            captured while shooting
+      0xa461 SourceImageNumberOfCompositeImage
+                                            2 _UnsignedShort: total number of
+                                            source images and number of source
+                                            images used for the composite image
+      0xa462 SourceExposureTimesOfCompositeImage
+                                            _Undefined bytes, in the byte order
+                                            of the metadata:
+
+        total exposure time period of the composite image   RATIONAL
+        total exposure time of the source images used       RATIONAL
+        total exposure time of the source images not used   RATIONAL
+        number n of different exposure times                SHORT
+        n times:
+            exposure time                                   RATIONAL
+            number of source images with that exposure time SHORT
+*/
+
+// ExposureTimeCount gives the number of source images captured with the same
+// exposure time.
+type ExposureTimeCount struct {
+    Time            UnsignedRational    // exposure time in seconds
+    Count           uint16              // number of source images
+}
+
+// SourceExposureTimes gives the exposure times of the source images of a
+// composite image, as stored in SourceExposureTimesOfCompositeImage.
+type SourceExposureTimes struct {
+    Total           UnsignedRational    // exposure period of the composite image
+    Used            UnsignedRational    // exposure time of source images used
+    Unused          UnsignedRational    // exposure time of source images not used
+    Times           []ExposureTimeCount // each exposure time with its count
+}
+
+// CompositeInfo gives the composite image information found in the Exif IFD
+type CompositeInfo struct {
+    Type            uint16              // CompositeImage value, 0 if unknown
+    SourceImages    uint16              // total number of source images
+    UsedImages      uint16              // number of source images used
+    Exposure        *SourceExposureTimes // nil if not given
+}
+
+const (
+    _rationalSize = 8
+    _exposureTimesHeaderSize = 3 * _rationalSize + _ShortSize
+    _exposureTimeCountSize = _rationalSize + _ShortSize
+)
+
+func getRational( data []byte, endian binary.ByteOrder ) UnsignedRational {
+    return UnsignedRational{ endian.Uint32( data ), endian.Uint32( data[4:] ) }
+}
+
+// decodeSourceExposureTimes returns the exposure times encoded in data with
+// the given byte order, or false if data does not match the expected layout.
+func decodeSourceExposureTimes( data []byte,
+                                endian binary.ByteOrder ) (*SourceExposureTimes,
+                                                           bool) {
+    if len(data) < _exposureTimesHeaderSize {
+        return nil, false
+    }
+    et := new( SourceExposureTimes )
+    et.Total = getRational( data, endian )
+    et.Used = getRational( data[_rationalSize:], endian )
+    et.Unused = getRational( data[2*_rationalSize:], endian )
+    n := int(endian.Uint16( data[3*_rationalSize:] ))
+    if len(data) < _exposureTimesHeaderSize + n * _exposureTimeCountSize {
+        return nil, false
+    }
+    et.Times = make( []ExposureTimeCount, n )
+    for i := 0; i < n; i++ {
+        o := _exposureTimesHeaderSize + i * _exposureTimeCountSize
+        et.Times[i].Time = getRational( data[o:], endian )
+        et.Times[i].Count = endian.Uint16( data[o+_rationalSize:] )
+    }
+    return et, true
+}
+
+// encode returns the exposure times encoded with the given byte order
+func (et *SourceExposureTimes) encode( endian binary.ByteOrder ) []byte {
+    var b bytes.Buffer
+    binary.Write( &b, endian, et.Total )
+    binary.Write( &b, endian, et.Used )
+    binary.Write( &b, endian, et.Unused )
+    binary.Write( &b, endian, uint16(len(et.Times)) )
+    for _, t := range et.Times {
+        binary.Write( &b, endian, t.Time )
+        binary.Write( &b, endian, t.Count )
+    }
+    return b.Bytes()
+}
+
+func fmtExposure( w io.Writer, r UnsignedRational ) {
+    if ! r.IsValid( ) {
+        io.WriteString( w, zeroDenominator( int64(r.Numerator) ) )
+        return
+    }
+    fmt.Fprintf( w, "%g seconds", r.Float( ) )
+}
+
+func (ifd *ifdd) storeExifCompositeImage( ) error {
+    return ifd.storeUnsignedShorts( "Composite Image", 1,
+                                    ifd.fmtEnum( _CompositeImage, "composite image" ) )
+}
+
+func fmtSourceImageNumber( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+    n := v.([]uint16)
+    fmt.Fprintf( w, "%d source images, %d used", n[0], n[1] )
+}
+
+func (ifd *ifdd) storeExifSourceImageNumber( ) error {
+    return ifd.storeUnsignedShorts( "Source Image Number Of Composite Image",
+                                    2, fmtSourceImageNumber )
+}
+
+func fmtSourceExposureTimes( ifd *ifdd, w io.Writer, v interface{},
+                              indent string ) {
+    et, ok := decodeSourceExposureTimes( v.([]byte), ifd.desc.endian )
+    if ! ok {
+        fmt.Fprintf( w, "Invalid exposure times (%d bytes)", len(v.([]byte)) )
+        return
+    }
+    io.WriteString( w, "total: " )
+    fmtExposure( w, et.Total )
+    fmt.Fprintf( w, "\n%sused: ", indent )
+    fmtExposure( w, et.Used )
+    fmt.Fprintf( w, "\n%snot used: ", indent )
+    fmtExposure( w, et.Unused )
+    for _, t := range et.Times {
+        fmt.Fprintf( w, "\n%s%d x ", indent, t.Count )
+        fmtExposure( w, t.Time )
+    }
+}
+
+func (ifd *ifdd) storeExifSourceExposureTimes( ) error {
+    return ifd.storeUndefinedAsUnsignedBytes(
+                            "Source Exposure Times Of Composite Image", 0,
+                            fmtSourceExposureTimes )
+}
+
+// CompositeImage returns the composite image information found in the Exif
+// IFD, or false if none of the composite image tags is present. Exposure is
+// nil if SourceExposureTimesOfCompositeImage is absent or cannot be decoded.
+func (d *Desc) CompositeImage( ) (ci CompositeInfo, ok bool) {
+    exif := d.ifds[EXIF]
+    if exif == nil {
+        return
+    }
+    if v, present := exif.getUnsignedInteger( _CompositeImage ); present {
+        ci.Type, ok = uint16(v), true
+    }
+    if n, present := exif.getValue( _SourceImageNumberOfCompositeImage ).(*unsignedShortValue);
+       present && len(n.v) == 2 {
+        ci.SourceImages, ci.UsedImages, ok = n.v[0], n.v[1], true
+    }
+    if et, present := exif.getValue( _SourceExposureTimesOfCompositeImage ).(*unsignedByteValue);
+       present {
+        ci.Exposure, _ = decodeSourceExposureTimes( et.v, d.endian )
+        ok = true
+    }
+    return
+}
+
+// SetCompositeImage sets the composite image tags in the Exif IFD from ci:
+// CompositeImage is always set, SourceImageNumberOfCompositeImage only if
+// ci.SourceImages is not 0 and SourceExposureTimesOfCompositeImage only if
+// ci.Exposure is not nil. Tags that are not set are removed if present, so
+// that the Exif IFD matches ci.
+//
+// It returns a non-nil error if ci.Type is not a valid CompositeImage value,
+// if more images are used than available, or if the Exif IFD is not present,
+// unless Control CreateExif is set.
+func (d *Desc) SetCompositeImage( ci CompositeInfo ) error {
+    if ci.Type > 3 {
+        return fmt.Errorf( "SetCompositeImage: %w",
+                    &ValidationError{ EXIF, _CompositeImage,
+                        fmt.Errorf( "invalid value (%d)\n", ci.Type ) } )
+    }
+    if ci.UsedImages > ci.SourceImages {
+        return fmt.Errorf( "SetCompositeImage: %w",
+                    &ValidationError{ EXIF, _SourceImageNumberOfCompositeImage,
+                        fmt.Errorf( "%d images used out of %d\n",
+                                    ci.UsedImages, ci.SourceImages ) } )
+    }
+    exif, err := d.getExifIfd( )
+    if err != nil {
+        return fmt.Errorf( "SetCompositeImage: %w", err )
+    }
+    exif.newEntry( _CompositeImage, _UnsignedShort )
+    exif.setValue( exif.newUnsignedShortValue( "Composite Image",
+                        exif.fmtEnum( _CompositeImage, "composite image" ),
+                        []uint16{ ci.Type } ) )
+
+    if ci.SourceImages != 0 {
+        exif.newEntry( _SourceImageNumberOfCompositeImage, _UnsignedShort )
+        exif.setValue( exif.newUnsignedShortValue(
+                        "Source Image Number Of Composite Image",
+                        fmtSourceImageNumber,
+                        []uint16{ ci.SourceImages, ci.UsedImages } ) )
+    } else if exif.getValue( _SourceImageNumberOfCompositeImage ) != nil {
+        exif.removeIfdTag( _SourceImageNumberOfCompositeImage )
+    }
+    if ci.Exposure != nil {
+        exif.newEntry( _SourceExposureTimesOfCompositeImage, _Undefined )
+        exif.setValue( exif.newUnsignedByteValue(
+                        "Source Exposure Times Of Composite Image",
+                        fmtSourceExposureTimes,
+                        ci.Exposure.encode( d.endian ) ) )
+    } else if exif.getValue( _SourceExposureTimesOfCompositeImage ) != nil {
+        exif.removeIfdTag( _SourceExposureTimesOfCompositeImage )
+    }
+    return nil
+}
@@ -0,0 +1,125 @@
+package exif
+
+// support for checking tag values against their specification
+
+import (
+    "fmt"
+)
+
+/*
+    Some tags only accept a few values, or values within a range, as defined
+    by the TIFF and Exif specifications. Those constraints are kept in the
+    tagConstraints table, indexed by namespace and tag as enumTables, and are
+    used both by Validate, to report out-of-spec values found in metadata, and
+    when metadata is serialized, to refuse writing out-of-spec values given by
+    the application:
+
+      - a value that comes from parsing is written as is, even if it is out of
+        spec, since it is what the original file contained. Validate reports
+        it.
+      - a value created or modified by the application (setters, Merge,
+        Redact...) must satisfy its constraint, otherwise Serialize,
+        SerializeTiff and SerializeTiffPages fail with a ValidationError,
+        unless Control Force is set.
+
+    A constraint gives either a range of values, a list of valid values or a
+    mask of valid bits, possibly with a reserved bit field value.
+*/
+
+type tagConstraint struct {
+    min, max        uint32      // valid range, if max is not 0
+    values          []uint32    // valid values, if not nil
+    mask            uint32      // valid bits, if not 0
+    reservedMask    uint32      // bit field including a reserved value,
+    reservedValue   uint32      // if reservedMask is not 0
+}
+
+var tagConstraints = map[enumKey]tagConstraint {
+    { PRIMARY, _Orientation }:      { min: 1, max: 8 },
+    { PRIMARY, _ResolutionUnit }:   { min: 1, max: 3 },
+    // Flash bits: 0 fired, 1-2 return light (1 is reserved), 3-4 mode,
+    // 5 no flash function, 6 red-eye reduction
+    { EXIF, _Flash }:               { mask: 0x7f,
+                                      reservedMask: 0x06, reservedValue: 0x02 },
+    { EXIF, _ColorSpace }:          { values: []uint32{ 1, 0xffff } },
+}
+
+// check returns an error if v does not satisfy the constraint
+func (c *tagConstraint) check( v uint32 ) error {
+    switch {
+    case c.max != 0:
+        if v < c.min || v > c.max {
+            return fmt.Errorf( "value %d out of range [%d-%d]\n", v, c.min, c.max )
+        }
+    case c.values != nil:
+        for _, cv := range c.values {
+            if v == cv {
+                return nil
+            }
+        }
+        return fmt.Errorf( "value %d not in %v\n", v, c.values )
+    case c.mask != 0:
+        if v & ^c.mask != 0 {
+            return fmt.Errorf( "value %#x has invalid bits %#x\n", v, v & ^c.mask )
+        }
+    }
+    if c.reservedMask != 0 && v & c.reservedMask == c.reservedValue {
+        return fmt.Errorf( "value %#x uses reserved bits %#x\n", v, c.reservedValue )
+    }
+    return nil
+}
+
+// checkConstraint returns an error if v is not a valid value for tag in the
+// namespace id, or nil if it is valid or if tag is not constrained.
+func checkConstraint( id IfdId, tag tTag, v uint32 ) error {
+    if c, ok := tagConstraints[getEnumKey( id, tag )]; ok {
+        return c.check( v )
+    }
+    return nil
+}
+
+// checkConstraints returns a ValidationError for each value in the ifd that
+// does not satisfy its constraint. If all is false, only values that do not
+// come from parsing are checked.
+func (ifd *ifdd) checkConstraints( all bool ) (errs []error) {
+    for _, v := range ifd.values {
+        if v == nil {
+            continue
+        }
+        tag := v.getTag( )
+        c, ok := tagConstraints[getEnumKey( ifd.id, tag )]
+        if ! ok || (! all && v.getSource( ).entry != 0) {
+            continue
+        }
+        if uv, ok := ifd.getUnsignedInteger( tag ); ok {
+            if err := c.check( uv ); err != nil {
+                errs = append( errs, &ValidationError{ ifd.id, uint16(tag), err } )
+            }
+        }
+    }
+    return
+}
+
+// validateConstraints checks all values in the ifds that include constrained
+// tags. If all is false, only values that do not come from parsing are
+// checked.
+func (d *Desc)validateConstraints( all bool ) (errs []error) {
+    for _, id := range []IfdId{ PRIMARY, THUMBNAIL, EXIF } {
+        if ifd := d.ifds[id]; ifd != nil {
+            errs = append( errs, ifd.checkConstraints( all )... )
+        }
+    }
+    return
+}
+
+// checkWrite returns the first value created or modified by the application
+// that does not satisfy its constraint, unless Control Force is set.
+func (d *Desc)checkWrite( ) error {
+    if d.Force {
+        return nil
+    }
+    if errs := d.validateConstraints( false ); len(errs) > 0 {
+        return errs[0]
+    }
+    return nil
+}
@@ -0,0 +1,78 @@
+package exif
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "io/ioutil"
+    "testing"
+)
+
+// testOrientationTiff returns TIFF data with an Orientation of 9, out of spec
+func testOrientationTiff( e binary.ByteOrder ) []byte {
+    ifd0 := []testEntry{
+        { _Make, uint16(_ASCIIString), 6, testString( "Nikon" ) },
+        { _Orientation, uint16(_UnsignedShort), 1, testShorts( e, 9 ) },
+    }
+    exif := []testEntry{
+        { _ExifVersion, uint16(_Undefined), 4, []byte( "0232" ) },
+    }
+    return testTiff( e, ifd0, exif )
+}
+
+// checkOrientationError checks that err is a ValidationError for Orientation
+func checkOrientationError( t *testing.T, from string, err error ) {
+    t.Helper( )
+    var ve *ValidationError
+    if ! errors.As( err, &ve ) || ve.Ifd != PRIMARY || ve.Tag != _Orientation {
+        t.Errorf( "%s: %v instead of an Orientation ValidationError", from, err )
+    }
+}
+
+func TestParsedOutOfSpecWritten( t *testing.T ) {
+    d := testParse( t, testOrientationTiff( binary.LittleEndian ), &Control{ } )
+    if _, err := d.Serialize( ioutil.Discard ); err != nil {
+        t.Errorf( "parsed value not written as is: %v", err )
+    }
+    if errs := d.validateConstraints( true ); len(errs) != 1 {
+        t.Errorf( "Validate: %d errors instead of 1", len(errs) )
+    }
+}
+
+func TestRedactChecked( t *testing.T ) {
+    e := binary.BigEndian
+    ifd0 := []testEntry{
+        { _Make, uint16(_ASCIIString), 6, testString( "Nikon" ) },
+        { _Orientation, uint16(_UnsignedShort), 1, testShorts( e, 6 ) },
+    }
+    d := testParse( t, testTiff( e, ifd0, nil ), &Control{ } )
+    if err := d.Redact( PRIMARY, _Orientation, nil ); err != nil {
+        t.Fatalf( "Redact: %v", err )
+    }
+    _, err := d.Serialize( ioutil.Discard )
+    checkOrientationError( t, "Serialize", err )
+    _, err = d.SerializeTiff( ioutil.Discard )
+    checkOrientationError( t, "SerializeTiff", err )
+
+    d.Force = true
+    if _, err = d.Serialize( ioutil.Discard ); err != nil {
+        t.Errorf( "Serialize with Force: %v", err )
+    }
+}
+
+func TestSerializeTiffPagesChecked( t *testing.T ) {
+    e := binary.LittleEndian
+    pages, err := ParseTiffAll( testOrientationTiff( e ), &Control{ } )
+    if err != nil {
+        t.Fatalf( "ParseTiffAll: %v", err )
+    }
+    var b bytes.Buffer
+    if _, err = SerializeTiffPages( &b, pages ); err != nil {
+        t.Fatalf( "parsed value not written as is: %v", err )
+    }
+    if err = pages[0].Redact( PRIMARY, _Orientation, nil ); err != nil {
+        t.Fatalf( "Redact: %v", err )
+    }
+    _, err = SerializeTiffPages( &b, pages )
+    checkOrientationError( t, "SerializeTiffPages", err )
+}
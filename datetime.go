@@ -0,0 +1,136 @@
+package exif
+
+// support for dates and times
+
+import (
+    "fmt"
+    "strings"
+    "time"
+)
+
+/*
+    Exif dates and times are given as ASCII strings "YYYY:MM:DD HH:MM:SS", in
+    local time. They may be completed by a string giving the sub-second digits
+    and, since Exif 2.31, by a string giving the offset from UTC ("+hh:mm" or
+    "-hh:mm"). Unknown fields are replaced with spaces.
+
+    There are 3 different dates, each with its own tags:
+        Modified    DateTime (IFD0), SubsecTime & OffsetTime (Exif IFD)
+        Original    DateTimeOriginal, SubsecTimeOriginal & OffsetTimeOriginal
+        Digitized   DateTimeDigitized, SubsecTimeDigitized & OffsetTimeDigitized
+*/
+
+// DateTimeKind selects one of the Exif dates
+type DateTimeKind uint8
+const (
+    Modified DateTimeKind = iota    // date of last file modification
+    Original                        // date of the original image capture
+    Digitized                       // date when the image was digitized
+)
+
+const (
+    _exifDateTimeFormat = "2006:01:02 15:04:05"
+    _exifOffsetFormat   = "-07:00"
+)
+
+type dateTimeTags struct {
+    id                      IfdId   // namespace of the date time tag
+    dateTime, subsec, offset tTag
+    dtName, ssName, otName  string
+}
+
+var dateTimes = [...]dateTimeTags {
+    Modified:   { PRIMARY, _DateTime, _SubsecTime, _OffsetTime,
+                  "Date", "Subsec Time", "Offset Time" },
+    Original:   { EXIF, _DateTimeOriginal, _SubsecTimeOriginal,
+                  _OffsetTimeOriginal, "DateTime Original",
+                  "Subsec Time Original", "Offset Time Original" },
+    Digitized:  { EXIF, _DateTimeDigitized, _SubsecTimeDigitized,
+                  _OffsetTimeDigitized, "DateTime Digitized",
+                  "Subsec Time Digitized", "Offset Time Digitized" },
+}
+
+// GetDateTime returns the date and time of the given kind, including the
+// sub-second digits if available. If the corresponding offset time is given,
+// the returned time is in that time zone, otherwise it is in the local time
+// zone. It returns a non-nil error if the date is absent or not valid.
+func (d *Desc) GetDateTime( k DateTimeKind ) (t time.Time, err error) {
+    if int(k) >= len(dateTimes) {
+        return t, fmt.Errorf( "GetDateTime: invalid kind (%d)\n", k )
+    }
+    dtt := &dateTimes[k]
+    var dt string
+    if ifd := d.ifds[dtt.id]; ifd != nil {
+        dt, _ = ifd.getAsciiString( dtt.dateTime )
+    }
+    if dt == "" {
+        return t, fmt.Errorf( "GetDateTime: no date\n" )
+    }
+
+    loc := time.Local
+    var ss string
+    if exif := d.ifds[EXIF]; exif != nil {
+        ss, _ = exif.getAsciiString( dtt.subsec )
+        if ot, ok := exif.getAsciiString( dtt.offset ); ok {
+            if o, oErr := time.Parse( _exifOffsetFormat, ot ); oErr == nil {
+                _, offset := o.Zone( )
+                loc = time.FixedZone( ot, offset )
+            }
+        }
+    }
+    t, err = time.ParseInLocation( _exifDateTimeFormat, dt, loc )
+    if err != nil {
+        return t, fmt.Errorf( "GetDateTime: %w", err )
+    }
+    ss = strings.TrimSpace( ss )
+    if ss != "" && strings.Trim( ss, "0123456789" ) == "" {
+        var ns int
+        for i := 0; i < 9; i++ {
+            ns *= 10
+            if i < len(ss) {
+                ns += int(ss[i] - '0')
+            }
+        }
+        t = t.Add( time.Duration(ns) )
+    }
+    return
+}
+
+// SetDateTime sets the date and time of the given kind. The date is written
+// in the time zone of t, which is also written in the corresponding offset
+// time tag. The sub-second digits are written if t has a fractional second.
+//
+// Modified dates are set in the primary IFD, their sub-second and offset
+// tags are only written if the Exif IFD is present. Other dates require the
+// Exif IFD, which is created if missing when Control CreateExif is set. It
+// returns a non-nil error if the required IFD is not present.
+func (d *Desc) SetDateTime( k DateTimeKind, t time.Time ) error {
+    if int(k) >= len(dateTimes) {
+        return fmt.Errorf( "SetDateTime: invalid kind (%d)\n", k )
+    }
+    dtt := &dateTimes[k]
+    ifd := d.ifds[dtt.id]
+    if dtt.id == EXIF {
+        var err error
+        if ifd, err = d.getExifIfd( ); err != nil {
+            return fmt.Errorf( "SetDateTime: %w", err )
+        }
+    } else if ifd == nil {
+        return fmt.Errorf( "SetDateTime: %s %w\n",
+                           GetIfdName( dtt.id ), ErrIfdNotPresent )
+    }
+    ifd.setAsciiString( dtt.dateTime, dtt.dtName, t.Format( _exifDateTimeFormat ) )
+
+    exif := d.ifds[EXIF]
+    if exif == nil {
+        return nil
+    }
+    if ns := t.Nanosecond( ); ns != 0 {
+        ss := strings.TrimRight( fmt.Sprintf( "%09d", ns ), "0" )
+        exif.setAsciiString( dtt.subsec, dtt.ssName, ss )
+    } else if exif.getValue( dtt.subsec ) != nil {
+        exif.removeIfdTag( dtt.subsec )
+    }
+    exif.setAsciiString( dtt.offset, dtt.otName, t.Format( _exifOffsetFormat ) )
+    return nil
+}
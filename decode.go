@@ -0,0 +1,252 @@
+package exif
+
+// fast decoding of typed value slices
+
+import (
+    "encoding/binary"
+    "math"
+)
+
+/*
+    Values were initially decoded with binary.Read, which relies on reflection
+    and allocates an intermediate buffer for each value. As it was the main
+    cost while parsing, in particular for maker notes made of many rationals,
+    slices are now decoded directly from the data, with a loop specialized for
+    each byte order so that the calls to binary.LittleEndian or BigEndian can
+    be inlined. Loops are unrolled by 4 for the most common types: shorts,
+    longs and rationals.
+
+    As with binary.Read, if less than count values are available at offset,
+    the missing values are left as 0.
+*/
+
+// getTIFFData returns the data available at offset for count items of size
+// bytes, which may be shorter than count * size if the data is truncated.
+func (d *Desc) getTIFFData( offset, count, size uint32 ) []byte {
+    end := uint64(offset) + uint64(count) * uint64(size)
+    if end > uint64(len(d.data)) {
+        end = uint64(len(d.data))
+    }
+    if uint64(offset) >= end {
+        return nil
+    }
+    return d.data[offset:end]
+}
+
+// decodeUint16s fills r with the 16-bit values in b in the given byte order
+func decodeUint16s( r []uint16, b []byte, endian binary.ByteOrder ) {
+    n := len(b) / 2
+    if n > len(r) {
+        n = len(r)
+    }
+    i := 0
+    if endian == binary.LittleEndian {
+        for ; i + 4 <= n; i += 4 {
+            p := b[2*i:2*i+8]
+            r[i] = binary.LittleEndian.Uint16( p )
+            r[i+1] = binary.LittleEndian.Uint16( p[2:] )
+            r[i+2] = binary.LittleEndian.Uint16( p[4:] )
+            r[i+3] = binary.LittleEndian.Uint16( p[6:] )
+        }
+        for ; i < n; i++ {
+            r[i] = binary.LittleEndian.Uint16( b[2*i:] )
+        }
+        return
+    }
+    for ; i + 4 <= n; i += 4 {
+        p := b[2*i:2*i+8]
+        r[i] = binary.BigEndian.Uint16( p )
+        r[i+1] = binary.BigEndian.Uint16( p[2:] )
+        r[i+2] = binary.BigEndian.Uint16( p[4:] )
+        r[i+3] = binary.BigEndian.Uint16( p[6:] )
+    }
+    for ; i < n; i++ {
+        r[i] = binary.BigEndian.Uint16( b[2*i:] )
+    }
+}
+
+// decodeUint32s fills r with the 32-bit values in b in the given byte order
+func decodeUint32s( r []uint32, b []byte, endian binary.ByteOrder ) {
+    n := len(b) / 4
+    if n > len(r) {
+        n = len(r)
+    }
+    i := 0
+    if endian == binary.LittleEndian {
+        for ; i + 4 <= n; i += 4 {
+            p := b[4*i:4*i+16]
+            r[i] = binary.LittleEndian.Uint32( p )
+            r[i+1] = binary.LittleEndian.Uint32( p[4:] )
+            r[i+2] = binary.LittleEndian.Uint32( p[8:] )
+            r[i+3] = binary.LittleEndian.Uint32( p[12:] )
+        }
+        for ; i < n; i++ {
+            r[i] = binary.LittleEndian.Uint32( b[4*i:] )
+        }
+        return
+    }
+    for ; i + 4 <= n; i += 4 {
+        p := b[4*i:4*i+16]
+        r[i] = binary.BigEndian.Uint32( p )
+        r[i+1] = binary.BigEndian.Uint32( p[4:] )
+        r[i+2] = binary.BigEndian.Uint32( p[8:] )
+        r[i+3] = binary.BigEndian.Uint32( p[12:] )
+    }
+    for ; i < n; i++ {
+        r[i] = binary.BigEndian.Uint32( b[4*i:] )
+    }
+}
+
+// decodeUint64s fills r with the 64-bit values in b in the given byte order
+func decodeUint64s( r []uint64, b []byte, endian binary.ByteOrder ) {
+    n := len(b) / 8
+    if n > len(r) {
+        n = len(r)
+    }
+    if endian == binary.LittleEndian {
+        for i := 0; i < n; i++ {
+            r[i] = binary.LittleEndian.Uint64( b[8*i:] )
+        }
+        return
+    }
+    for i := 0; i < n; i++ {
+        r[i] = binary.BigEndian.Uint64( b[8*i:] )
+    }
+}
+
+// decodeRationals fills r with the numerator and denominator pairs in b in
+// the given byte order
+func decodeRationals( r []UnsignedRational, b []byte, endian binary.ByteOrder ) {
+    n := len(b) / 8
+    if n > len(r) {
+        n = len(r)
+    }
+    i := 0
+    if endian == binary.LittleEndian {
+        for ; i + 4 <= n; i += 4 {
+            p := b[8*i:8*i+32]
+            r[i] = UnsignedRational{ binary.LittleEndian.Uint32( p ),
+                                     binary.LittleEndian.Uint32( p[4:] ) }
+            r[i+1] = UnsignedRational{ binary.LittleEndian.Uint32( p[8:] ),
+                                       binary.LittleEndian.Uint32( p[12:] ) }
+            r[i+2] = UnsignedRational{ binary.LittleEndian.Uint32( p[16:] ),
+                                       binary.LittleEndian.Uint32( p[20:] ) }
+            r[i+3] = UnsignedRational{ binary.LittleEndian.Uint32( p[24:] ),
+                                       binary.LittleEndian.Uint32( p[28:] ) }
+        }
+        for ; i < n; i++ {
+            r[i] = UnsignedRational{ binary.LittleEndian.Uint32( b[8*i:] ),
+                                     binary.LittleEndian.Uint32( b[8*i+4:] ) }
+        }
+        return
+    }
+    for ; i + 4 <= n; i += 4 {
+        p := b[8*i:8*i+32]
+        r[i] = UnsignedRational{ binary.BigEndian.Uint32( p ),
+                                 binary.BigEndian.Uint32( p[4:] ) }
+        r[i+1] = UnsignedRational{ binary.BigEndian.Uint32( p[8:] ),
+                                   binary.BigEndian.Uint32( p[12:] ) }
+        r[i+2] = UnsignedRational{ binary.BigEndian.Uint32( p[16:] ),
+                                   binary.BigEndian.Uint32( p[20:] ) }
+        r[i+3] = UnsignedRational{ binary.BigEndian.Uint32( p[24:] ),
+                                   binary.BigEndian.Uint32( p[28:] ) }
+    }
+    for ; i < n; i++ {
+        r[i] = UnsignedRational{ binary.BigEndian.Uint32( b[8*i:] ),
+                                 binary.BigEndian.Uint32( b[8*i+4:] ) }
+    }
+}
+
+// (d *Desc)get<tType>s(offset, count) functions read the requested count of
+// typed data from an offset anywhere in the data slice, using the endianess
+// and data slice from d. The result is a slice of the corresponding go type.
+
+func (d *Desc) getUnsignedBytes( offset, count uint32 ) []uint8 {
+    return d.data[offset:offset+count]
+}
+
+func (d *Desc) getSignedBytes( offset uint32, count uint32 ) []int8 {
+    r := make( []int8, count )
+    for i, b := range d.getTIFFData( offset, count, 1 ) {
+        r[i] = int8(b)
+    }
+    return r
+}
+
+func (d *Desc) getUnsignedShorts( offset, count uint32 ) []uint16 {
+    r := d.makeShorts( count )
+    decodeUint16s( r, d.getTIFFData( offset, count, _ShortSize ), d.endian )
+    return r
+}
+
+func (d *Desc) getSignedShorts( offset uint32, count uint32 ) []int16 {
+    u := d.getUnsignedShorts( offset, count )
+    r := make( []int16, count )
+    for i, v := range u {
+        r[i] = int16(v)
+    }
+    return r
+}
+
+func (d *Desc) getUnsignedLongs( offset, count uint32 ) []uint32 {
+    r := d.makeLongs( count )
+    decodeUint32s( r, d.getTIFFData( offset, count, _LongSize ), d.endian )
+    return r
+}
+
+func (d *Desc) getSignedLongs( offset, count uint32 ) []int32 {
+    u := d.getUnsignedLongs( offset, count )
+    r := make( []int32, count )
+    for i, v := range u {
+        r[i] = int32(v)
+    }
+    return r
+}
+
+func (d *Desc) getUnsignedLong8s( offset, count uint32 ) []uint64 {
+    r := make( []uint64, count )
+    decodeUint64s( r, d.getTIFFData( offset, count, 8 ), d.endian )
+    return r
+}
+
+func (d *Desc) getSignedLong8s( offset, count uint32 ) []int64 {
+    u := d.getUnsignedLong8s( offset, count )
+    r := make( []int64, count )
+    for i, v := range u {
+        r[i] = int64(v)
+    }
+    return r
+}
+
+func (d *Desc) getFloats( offset, count uint32 ) []float32 {
+    u := d.getUnsignedLongs( offset, count )
+    r := make( []float32, count )
+    for i, v := range u {
+        r[i] = math.Float32frombits( v )
+    }
+    return r
+}
+
+func (d *Desc) getDoubles( offset, count uint32 ) []float64 {
+    u := d.getUnsignedLong8s( offset, count )
+    r := make( []float64, count )
+    for i, v := range u {
+        r[i] = math.Float64frombits( v )
+    }
+    return r
+}
+
+func (d *Desc) getUnsignedRationals( offset, count uint32 ) []UnsignedRational {
+    r := d.makeRationals( count )
+    decodeRationals( r, d.getTIFFData( offset, count, 8 ), d.endian )
+    return r
+}
+
+func (d *Desc) getSignedRationals( offset, count uint32 ) []SignedRational {
+    u := d.getUnsignedRationals( offset, count )
+    r := make( []SignedRational, count )
+    for i, v := range u {
+        r[i] = SignedRational{ int32(v.Numerator), int32(v.Denominator) }
+    }
+    return r
+}
@@ -0,0 +1,217 @@
+package exif
+
+import (
+    "bytes"
+    "encoding/binary"
+    "flag"
+    "io/ioutil"
+    "math"
+    "reflect"
+    "testing"
+)
+
+/*
+    Typed value slices used to be decoded with binary.Read (readTIFFData),
+    which is kept here as the reference implementation, both to check that
+    the specialized decoders give the same result and to benchmark them
+    against it:
+
+        go test -run XXX -bench Decode -benchmem
+
+    BenchmarkDecode*BinaryRead measure the previous implementation, and
+    BenchmarkDecode* the current one, on a rational-heavy maker note like
+    data: 40 values of 64 rationals each.
+*/
+
+// readTIFFData is the previous implementation of the typed slice readers
+func readTIFFData( d *Desc, offset uint32, dest interface{} ) {
+    b := bytes.NewBuffer( d.data[offset:] )
+    binary.Read( b, d.endian, dest )
+}
+
+const (
+    _benchValues    = 40                // values per maker note
+    _benchCount     = 64                // rationals per value
+)
+
+// testDecodeDesc returns a desc whose data is made of n pseudo random bytes
+func testDecodeDesc( e binary.ByteOrder, n int ) *Desc {
+    data := make( []byte, n )
+    x := uint32(0x12345678)
+    for i := range data {
+        x = x * 1664525 + 1013904223
+        data[i] = byte(x >> 24)
+    }
+    return &Desc{ data: data, endian: e }
+}
+
+func TestDecodeMatchesBinaryRead( t *testing.T ) {
+    for _, e := range []binary.ByteOrder{ binary.LittleEndian, binary.BigEndian } {
+        d := testDecodeDesc( e, 256 )
+        for _, count := range []uint32{ 0, 1, 3, 4, 5, 8, 13, 31 } {
+            for _, offset := range []uint32{ 0, 1, 7, 200, 250 } {
+                // truncated data: missing values are left as 0, as with
+                // binary.Read, which leaves dest unchanged if it is short
+                check := func( name string, got, want interface{} ) {
+                    if uint64(offset) + uint64(reflect.ValueOf( want ).Len( )) *
+                       uint64(reflect.TypeOf( want ).Elem( ).Size( )) >
+                       uint64(len(d.data)) {
+                        return
+                    }
+                    if ! reflect.DeepEqual( got, want ) {
+                        t.Errorf( "%v %s(%d, %d): %v instead of %v",
+                                  e, name, offset, count, got, want )
+                    }
+                }
+                us := make( []uint16, count )
+                readTIFFData( d, offset, &us )
+                check( "getUnsignedShorts", d.getUnsignedShorts( offset, count ), us )
+                ss := make( []int16, count )
+                readTIFFData( d, offset, &ss )
+                check( "getSignedShorts", d.getSignedShorts( offset, count ), ss )
+                ul := make( []uint32, count )
+                readTIFFData( d, offset, &ul )
+                check( "getUnsignedLongs", d.getUnsignedLongs( offset, count ), ul )
+                sl := make( []int32, count )
+                readTIFFData( d, offset, &sl )
+                check( "getSignedLongs", d.getSignedLongs( offset, count ), sl )
+                u8 := make( []uint64, count )
+                readTIFFData( d, offset, &u8 )
+                check( "getUnsignedLong8s", d.getUnsignedLong8s( offset, count ), u8 )
+                f := make( []float32, count )
+                readTIFFData( d, offset, &f )
+                check( "getFloats", testFloatBits( d.getFloats( offset, count ) ),
+                       testFloatBits( f ) )
+                ur := make( []UnsignedRational, count )
+                readTIFFData( d, offset, &ur )
+                check( "getUnsignedRationals", d.getUnsignedRationals( offset, count ), ur )
+                sr := make( []SignedRational, count )
+                readTIFFData( d, offset, &sr )
+                check( "getSignedRationals", d.getSignedRationals( offset, count ), sr )
+            }
+        }
+    }
+}
+
+// testFloatBits returns the bits of each float in f, with a single NaN value,
+// since NaN != NaN and a signaling NaN may be quieted when copied.
+func testFloatBits( f []float32 ) []uint32 {
+    b := make( []uint32, len(f) )
+    for i, v := range f {
+        if v != v {
+            b[i] = 0x7fc00000
+        } else {
+            b[i] = math.Float32bits( v )
+        }
+    }
+    return b
+}
+
+func TestDecodeTruncated( t *testing.T ) {
+    d := testDecodeDesc( binary.BigEndian, 10 )
+    r := d.getUnsignedRationals( 4, 2 )        // 6 bytes available
+    if len(r) != 2 || r[1] != (UnsignedRational{ }) {
+        t.Errorf( "truncated rationals: %v", r )
+    }
+    if s := d.getUnsignedShorts( 8, 3 ); len(s) != 3 || s[1] != 0 || s[2] != 0 {
+        t.Errorf( "truncated shorts: %v", s )
+    }
+}
+
+// benchDecode decodes _benchValues slices of _benchCount rationals with read
+func benchDecode( b *testing.B, e binary.ByteOrder,
+                  read func( d *Desc, offset uint32 ) ) {
+    d := testDecodeDesc( e, _benchValues * _benchCount * 8 )
+    b.ReportAllocs( )
+    b.ResetTimer( )
+    for i := 0; i < b.N; i++ {
+        for v := uint32(0); v < _benchValues; v++ {
+            read( d, v * _benchCount * 8 )
+        }
+    }
+}
+
+func readRationalsBinaryRead( d *Desc, offset uint32 ) {
+    r := make( []UnsignedRational, _benchCount )
+    readTIFFData( d, offset, &r )
+}
+
+func readRationals( d *Desc, offset uint32 ) {
+    d.getUnsignedRationals( offset, _benchCount )
+}
+
+func readShortsBinaryRead( d *Desc, offset uint32 ) {
+    r := make( []uint16, _benchCount * 4 )
+    readTIFFData( d, offset, &r )
+}
+
+func readShorts( d *Desc, offset uint32 ) {
+    d.getUnsignedShorts( offset, _benchCount * 4 )
+}
+
+func BenchmarkDecodeRationalsLEBinaryRead( b *testing.B ) {
+    benchDecode( b, binary.LittleEndian, readRationalsBinaryRead )
+}
+
+func BenchmarkDecodeRationalsLE( b *testing.B ) {
+    benchDecode( b, binary.LittleEndian, readRationals )
+}
+
+func BenchmarkDecodeRationalsBEBinaryRead( b *testing.B ) {
+    benchDecode( b, binary.BigEndian, readRationalsBinaryRead )
+}
+
+func BenchmarkDecodeRationalsBE( b *testing.B ) {
+    benchDecode( b, binary.BigEndian, readRationals )
+}
+
+func BenchmarkDecodeShortsLEBinaryRead( b *testing.B ) {
+    benchDecode( b, binary.LittleEndian, readShortsBinaryRead )
+}
+
+func BenchmarkDecodeShortsLE( b *testing.B ) {
+    benchDecode( b, binary.LittleEndian, readShorts )
+}
+
+// BenchmarkReadNikon parses a Nikon maker note fixture
+func BenchmarkReadNikon( b *testing.B ) {
+    data, err := ioutil.ReadFile( "testdata/nikon.tif" )
+    if err != nil {
+        b.Fatal( err )
+    }
+    b.ReportAllocs( )
+    b.ResetTimer( )
+    for i := 0; i < b.N; i++ {
+        if _, err := parseTiff( data, 0, nil, &Control{ } ); err != nil {
+            b.Fatal( err )
+        }
+    }
+}
+
+var checkSpeedup = flag.Bool( "speedup", false, "check decoding speedup" )
+
+// TestDecodeSpeedup checks that decoding rationals is at least 3 times as
+// fast as with binary.Read. Since it relies on timing, it runs only when
+// requested, on an otherwise idle machine:
+//
+//      go test -run DecodeSpeedup -speedup
+func TestDecodeSpeedup( t *testing.T ) {
+    if ! *checkSpeedup {
+        t.Skip( "timing test runs only with -speedup" )
+    }
+    for _, e := range []binary.ByteOrder{ binary.LittleEndian, binary.BigEndian } {
+        e := e
+        old := testing.Benchmark( func( b *testing.B ) {
+            benchDecode( b, e, readRationalsBinaryRead )
+        } )
+        cur := testing.Benchmark( func( b *testing.B ) {
+            benchDecode( b, e, readRationals )
+        } )
+        speedup := float64(old.NsPerOp( )) / float64(cur.NsPerOp( ))
+        t.Logf( "%v: binary.Read %d ns/op, decode %d ns/op: %.1fx",
+                e, old.NsPerOp( ), cur.NsPerOp( ), speedup )
+        if speedup < 3 {
+            t.Errorf( "%v: speedup %.1fx, less than 3x", e, speedup )
+        }
+    }
+}
@@ -0,0 +1,155 @@
+package exif
+
+// support for DJI (drone) Maker notes
+
+import (
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+)
+
+/*
+    DJI maker notes do not have any signature: they are a plain IFD, using the
+    TIFF byte order and offsets relative to the TIFF header. They are only
+    recognized by the camera make, "DJI".
+
+    Angles are given in degrees and speeds in meters per second. The flight
+    altitude is not part of the maker note: DJI stores it in the XMP metadata
+    of the JPEG file, as drone-dji:RelativeAltitude (above the take off point)
+    and drone-dji:AbsoluteAltitude (above sea level), in meters.
+*/
+
+const (
+    _DJIMake                    = 0x0001  // ASCII string
+    _DJISpeedX                  = 0x0003  // 1 _Float
+    _DJISpeedY                  = 0x0004  // 1 _Float
+    _DJISpeedZ                  = 0x0005  // 1 _Float
+    _DJIPitch                   = 0x0006  // 1 _Float, aircraft attitude
+    _DJIYaw                     = 0x0007  // 1 _Float
+    _DJIRoll                    = 0x0008  // 1 _Float
+    _DJICameraPitch             = 0x0009  // 1 _Float, gimbal attitude
+    _DJICameraYaw               = 0x000a  // 1 _Float
+    _DJICameraRoll              = 0x000b  // 1 _Float
+)
+
+func fmtDJIDegrees( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+    fmt.Fprintf( w, "%.1f degrees", v.([]float32)[0] )
+}
+
+func fmtDJISpeed( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+    fmt.Fprintf( w, "%.1f m/s", v.([]float32)[0] )
+}
+
+func storeDJITags( ifd *ifdd ) error {
+//    fmt.Printf( "storeDJITags: tag (%#04x) @offset %#04x type %s count %d\n",
+//                 ifd.fTag, ifd.sOffset-8, getTiffTString( ifd.fType ), ifd.fCount )
+    switch ifd.fTag {
+    case _DJIMake:
+        return ifd.storeAsciiString( "DJI Make" )
+    case _DJISpeedX:
+        return ifd.storeFloats( "DJI Speed X", 1, fmtDJISpeed )
+    case _DJISpeedY:
+        return ifd.storeFloats( "DJI Speed Y", 1, fmtDJISpeed )
+    case _DJISpeedZ:
+        return ifd.storeFloats( "DJI Speed Z", 1, fmtDJISpeed )
+    case _DJIPitch:
+        return ifd.storeFloats( "DJI Pitch", 1, fmtDJIDegrees )
+    case _DJIYaw:
+        return ifd.storeFloats( "DJI Yaw", 1, fmtDJIDegrees )
+    case _DJIRoll:
+        return ifd.storeFloats( "DJI Roll", 1, fmtDJIDegrees )
+    case _DJICameraPitch:
+        return ifd.storeFloats( "DJI Gimbal Pitch", 1, fmtDJIDegrees )
+    case _DJICameraYaw:
+        return ifd.storeFloats( "DJI Gimbal Yaw", 1, fmtDJIDegrees )
+    case _DJICameraRoll:
+        return ifd.storeFloats( "DJI Gimbal Roll", 1, fmtDJIDegrees )
+    default:
+        return ifd.processUnknownTag( )
+    }
+}
+
+func (ifd *ifdd) processDJIMakerNote( offset uint32 ) error {
+    _, dji, err := ifd.desc.storeIFD( MAKER, offset, storeDJITags )
+    if err == nil {
+        ifd.storeValue( ifd.newIfdValue( dji ) )
+    }
+    return err
+}
+
+func tryDJIMakerNote( ifd *ifdd, offset uint32 ) ( func( uint32 ) error ) {
+    if strings.HasPrefix( ifd.desc.global.make, "DJI" ) {
+//        fmt.Printf("    MakerNote: DJI\n" )
+        return ifd.processDJIMakerNote
+    }
+    return nil
+}
+
+// getJpegDroneAltitude returns the relative and absolute flight altitudes
+// found in the DJI XMP metadata of the JPEG data starting at start, or false
+// if none is found.
+func getJpegDroneAltitude( data []byte, start uint ) (rel, abs float64, ok bool) {
+    xmp := findJpegXmp( data, start )
+    for _, a := range []struct {
+        name    string
+        v       *float64
+    } {
+        { "drone-dji:RelativeAltitude", &rel },
+        { "drone-dji:AbsoluteAltitude", &abs },
+    } {
+        if s, found := getXmpValue( xmp, a.name ); found {
+            if f, err := strconv.ParseFloat( s, 64 ); err == nil {
+                *a.v, ok = f, true
+            }
+        }
+    }
+    return
+}
+
+// DroneAttitude gives the aircraft and gimbal attitudes, in degrees, and
+// the aircraft speed, in meters per second, as found in DJI maker notes,
+// and the flight altitudes, in meters, found in the DJI XMP metadata if
+// HasAltitude is true.
+type DroneAttitude struct {
+    Pitch, Yaw, Roll                    float32
+    GimbalPitch, GimbalYaw, GimbalRoll  float32
+    SpeedX, SpeedY, SpeedZ              float32
+    RelativeAltitude                    float64 // above the take off point
+    AbsoluteAltitude                    float64 // above sea level
+    HasAltitude                         bool
+}
+
+// GetDroneAttitude returns the drone attitude and speed found in the maker
+// note, or a non-nil error if the maker note is not from a DJI drone.
+// Missing values are returned as 0. The flight altitudes are only available
+// if the metadata was read from a JPEG file, with Read or DecodeWithMetadata.
+// Otherwise, the GPSAltitude tag may be used instead, see GetIfdTagValue.
+func (d *Desc) GetDroneAttitude( ) (da DroneAttitude, err error) {
+    ifd := d.ifds[MAKER]
+    if ifd == nil || ! strings.HasPrefix( d.global.make, "DJI" ) {
+        err = fmt.Errorf( "GetDroneAttitude: no DJI maker note\n" )
+        return
+    }
+    for _, v := range ifd.values {
+        fv, ok := v.(*floatValue)
+        if ! ok || len(fv.v) != 1 {
+            continue
+        }
+        switch fv.vTag {
+        case _DJISpeedX:        da.SpeedX = fv.v[0]
+        case _DJISpeedY:        da.SpeedY = fv.v[0]
+        case _DJISpeedZ:        da.SpeedZ = fv.v[0]
+        case _DJIPitch:         da.Pitch = fv.v[0]
+        case _DJIYaw:           da.Yaw = fv.v[0]
+        case _DJIRoll:          da.Roll = fv.v[0]
+        case _DJICameraPitch:   da.GimbalPitch = fv.v[0]
+        case _DJICameraYaw:     da.GimbalYaw = fv.v[0]
+        case _DJICameraRoll:    da.GimbalRoll = fv.v[0]
+        }
+    }
+    da.RelativeAltitude = d.global.relAltitude
+    da.AbsoluteAltitude = d.global.absAltitude
+    da.HasAltitude = d.global.hasAltitude
+    return
+}
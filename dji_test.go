@@ -0,0 +1,55 @@
+package exif
+
+import (
+    "bytes"
+    "encoding/binary"
+    "math"
+    "testing"
+)
+
+// testDJIExifSegment returns an EXIF APP1 segment with a DJI maker note
+// giving the aircraft pitch and the gimbal yaw.
+func testDJIExifSegment( ) []byte {
+    e := binary.LittleEndian
+    note := testIfd( e, 0, []testEntry{
+        { _DJIPitch, uint16(_Float), 1, testLongs( e, math.Float32bits( 2.5 ) ) },
+        { _DJICameraYaw, uint16(_Float), 1, testLongs( e, math.Float32bits( -90 ) ) },
+    }, 0 )
+    tiff := testMakerNoteTiff( e, "DJI", note )
+    return testJpegSegment( _APP1, append( []byte( "Exif\x00\x00" ), tiff... ) )
+}
+
+func TestDroneAltitude( t *testing.T ) {
+    img := testJpegImage( t, 8, 8 )
+    xmp := testJpegSegment( _APP1, []byte( _xmpSignature +
+            `<rdf:Description drone-dji:AbsoluteAltitude="+152.47" ` +
+            `drone-dji:RelativeAltitude="-3.20"/>` ) )
+    for _, c := range []struct {
+        name        string
+        segments    [][]byte
+        has         bool
+        rel, abs    float64
+    } {
+        { "XMP altitude", [][]byte{ testDJIExifSegment( ), xmp }, true, -3.2, 152.47 },
+        { "no XMP", [][]byte{ testDJIExifSegment( ) }, false, 0, 0 },
+    } {
+        data := testJpegWith( img, c.segments... )
+        _, d, err := DecodeWithMetadata( bytes.NewReader( data ) )
+        if err != nil {
+            t.Fatalf( "%s: DecodeWithMetadata: %v", c.name, err )
+        }
+        da, err := d.GetDroneAttitude( )
+        if err != nil {
+            t.Fatalf( "%s: GetDroneAttitude: %v", c.name, err )
+        }
+        if da.Pitch != 2.5 || da.GimbalYaw != -90 {
+            t.Errorf( "%s: pitch %g gimbal yaw %g", c.name, da.Pitch, da.GimbalYaw )
+        }
+        if da.HasAltitude != c.has || da.RelativeAltitude != c.rel ||
+           da.AbsoluteAltitude != c.abs {
+            t.Errorf( "%s: altitude %v %g %g instead of %v %g %g", c.name,
+                      da.HasAltitude, da.RelativeAltitude, da.AbsoluteAltitude,
+                      c.has, c.rel, c.abs )
+        }
+    }
+}
@@ -0,0 +1,55 @@
+package exif
+
+// errors that can be checked with errors.Is or errors.As
+
+import (
+    "errors"
+)
+
+// ErrNoExif is returned (wrapped) by Read when the file does not contain any
+// exif metadata, for example in a JPEG file with only JFIF or XMP segments.
+var ErrNoExif = errors.New( "no exif metadata" )
+
+// ErrInvalidTiffHeader is returned (wrapped) when the TIFF header is not valid
+var ErrInvalidTiffHeader = errors.New( "invalid TIFF header" )
+
+// ErrUnknownTag is returned (wrapped) when an unknown tag is found while
+// parsing with Control Unknown set to Stop.
+var ErrUnknownTag = errors.New( "unknown tag" )
+
+// ErrIfdNotPresent is returned (wrapped) when an operation requires an IFD
+// that is not present in the metadata.
+var ErrIfdNotPresent = errors.New( "ifd is not present" )
+
+// ErrUnsupportedMakerNote is returned (wrapped) when the maker note is not
+// supported while parsing with Control Unknown set to Stop.
+var ErrUnsupportedMakerNote = errors.New( "unsupported maker note" )
+
+// ErrSuspiciousLayout is returned (wrapped) when the layout of the metadata is
+// suspicious while parsing with Control Strict set. See LayoutError.
+var ErrSuspiciousLayout = errors.New( "suspicious layout" )
+
+// ErrZeroDenominator is returned (wrapped) when a rational value has a zero
+// denominator and a non-zero numerator while parsing with Control Strict set.
+var ErrZeroDenominator = errors.New( "zero denominator" )
+
+// ErrSegmentTooLarge is returned (wrapped) when the serialized metadata does
+// not fit in a JPEG APP1 segment (64KB). See SerializeTiff.
+var ErrSegmentTooLarge = errors.New( "exceeds APP1 segment capacity" )
+
+// ValidationError is returned (wrapped) when an entry is not valid, either
+// during parsing or when modifying metadata. It gives the IFD and the tag of
+// the invalid entry, and wraps the reason why it is not valid.
+type ValidationError struct {
+    Ifd     IfdId           // IFD where the entry is
+    Tag     uint16          // entry tag
+    Err     error           // reason
+}
+
+func (e *ValidationError) Error( ) string {
+    return "invalid field: " + e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap( ) error {
+    return e.Err
+}
@@ -16,11 +16,14 @@ package exif
 import (
     "fmt"
     "bytes"
+    "errors"
     "strings"
     "encoding/binary"
     "io/ioutil"
     "io"
     "os"
+    "unicode"
+    "time"
 )
 
 /*
@@ -111,11 +114,55 @@ const (
     Stop                    // Stop in error at first unknown tag
 )
 
+// UnknownAction is the action returned by a Control OnUnknown callback
+type UnknownAction = ConUnTag
+
 type Control struct {
     Unknown ConUnTag        // how to deal with unknown tags
     Warn    bool            // turn on warnings (unknown tags & non-fatal errors)
     ParsDbg bool            // turn on parse debug
     SrlzDbg bool            // turn on serialize debug
+    Empty   bool            // Read returns an empty descriptor if no metadata
+    Software string         // if not empty, identity stamped in written metadata
+    AllowUTF8 bool          // accept UTF-8 in ASCII strings given to setters
+    CreateExif bool         // setters create the Exif IFD if it is missing
+    Indent  string          // Format indentation unit, 2 spaces if empty
+    Width   int             // Format maximum line width for lists, 0 if none
+    Vocabulary Vocabulary   // Format text for enumerated values, if not nil
+    Codes   bool            // Format enumerated values with their code
+    MaxDump int             // Format maximum bytes dumped per tag, 0 if none
+    DumpRow int             // Format bytes per dump row, 16 if 0
+    DumpNoASCII bool        // Format dumps without their ASCII column
+    DumpOffsets bool        // Format dump offsets in the input, when known
+    DumpThreshold int       // Format byte values longer than that as dumps,
+                            // 16 if 0
+    Lenient bool            // coerce common type mistakes instead of failing
+    Placement Placement     // where to store tags common to TIFF/EP and Exif
+    NoDescramble bool       // keep scrambled maker note data opaque
+                            // if not nil, called for each unknown tag with
+                            // its raw value to decide what to do, instead of
+                            // following Unknown
+    OnUnknown func( id IfdId, tag, typ uint16, count uint32,
+                    raw []byte ) UnknownAction
+    Logger  Logger          // if not nil, receives warnings and debug traces
+                            // if not nil, called to report parse and
+                            // serialize progress
+    OnProgress func( stage ProgressStage, done, total uint )
+    Pooled  bool            // allocate values from a pool, see Desc Release
+    Parallel bool           // parse independent IFDs in parallel
+    Strict  bool            // reject metadata with a suspicious layout
+                            // or with invalid rationals (n/0)
+    Limits  Limits          // bounds on parsed IFDs, none if zero
+    Force   bool            // write out-of-spec values set by the application
+}
+
+// Limits bounds the resources used for parsing untrusted metadata. A zero
+// field means no limit. Exceeding a limit is an error, or in lenient mode the
+// IFD is clamped to the maximum number of entries and values that are too
+// large are removed.
+type Limits struct {
+    MaxEntries      uint16  // maximum number of entries in an IFD
+    MaxValueSize    uint32  // maximum size in bytes of a single value
 }
 
 // IFD ID, used as a namespace for IFD tags
@@ -127,14 +174,70 @@ const (
     GPS                     // GPS namespace, embedded in IFD0 
     IOP                     // Interoperability namespace, embedded in EXIF IFD
     MAKER                   // non-standard IFD for each maker, embedded in EXIF IFD
-    EMBEDDED                // possible non-standard IFD embedded in MAKER
+    EMBEDDED                // Deprecated: IFDs embedded in MAKER now have
+                            // vendor-scoped ids, see EmbeddedIfds
     _IFD_N                  // last entry + 1 to size arrays
 )
 
 type ThumbnailInfo struct {
-    Origin  IfdId           // either THUMBNAIL or EMBEDDED
+    Origin  IfdId           // THUMBNAIL or an embedded IFD (see EmbeddedIfds)
     Comp    Compression     // type of image compression
     Size    uint32          // image size
+    Offset  int64           // image data offset in the input (file)
+    Width   uint32          // image width in pixels, 0 if unknown
+    Height  uint32          // image height in pixels, 0 if unknown
+    MIME    string          // image MIME type, e.g. "image/jpeg"
+}
+
+// IfdInfo describes an IFD present in the metadata
+type IfdInfo struct {
+    Id      IfdId           // IFD namespace
+    Name    string          // IFD name, as given by GetIfdName
+    Entries uint            // current number of entries
+    Size    uint32          // serialized size estimate, including embedded IFDs
+}
+
+// IfdStats gives the parse statistics of one IFD
+type IfdStats struct {
+    Entries     uint        // number of entries parsed
+    Unknown     uint        // number of unknown entries
+    Unsupported uint        // number of known entries not supported or not
+                            // decodable, see TagName
+    Removed     uint        // number of unknown entries removed while parsing
+    DataSize    uint32      // bytes of data area referenced by entries
+    Coerced     uint        // number of entries fixed in lenient mode
+    Normalized  uint        // number of ASCII strings whose count did not
+                            // match their content
+}
+
+// RemovedEntry describes an entry removed while parsing, either because it is
+// unknown (or padding) and Control Unknown is RemoveTag or OnUnknown returned
+// RemoveTag, or because it was not valid and could be safely dropped. It is
+// meant for audit logs, e.g. in privacy tools that need to report what was
+// stripped.
+type RemovedEntry struct {
+    Ifd     IfdId           // IFD where the entry was
+    Tag     uint16          // entry tag
+    Type    uint16          // entry TIFF type
+    Count   uint32          // entry count
+}
+
+func (r RemovedEntry) String( ) string {
+    return fmt.Sprintf( "%s IFD tag %#04x type %s count %d", GetIfdName( r.Ifd ),
+                        r.Tag, getTiffTString( tType(r.Type) ), r.Count )
+}
+
+// Stats gives the parse statistics of an exif descriptor, including its
+// maker note IFDs.
+type Stats struct {
+    Ifds        [_IFD_N]IfdStats    // statistics per IFD, indexed by IfdId
+    Dynamic     []IfdStats          // statistics per dynamic IFD, indexed
+                                    // by IfdId - _IFD_N
+    MakerNote   string              // maker note vendor or "" if none found
+    Warnings    []MakerNoteWarning  // non-conforming maker note structures
+    RemovedEntries []RemovedEntry   // entries removed while parsing
+    Duration    time.Duration       // total parsing time
+    parsed      uint                // entries parsed, for progress reports
 }
 
 var ifdNames  = [...]string{ "Primary", "Thumbnail", "Exif",
@@ -154,22 +257,92 @@ type maker  struct {
     try     func( *ifdd, uint32 ) (func( uint32 ) error)
 }
 
-var makerNotes = [...]maker{ { "Apple", tryAppleMakerNote },
-                             { "Nikon", tryNikonMakerNote } }
+// makerNotes is the list of known maker notes, tried in order. It is never
+// modified, so that it can be used by concurrent parses without locking.
+var makerNotes = []maker{
+    { "Apple", tryAppleMakerNote },
+    { "Nikon", tryNikonMakerNote },
+    { "DJI", tryDJIMakerNote },
+    { "GoPro", tryGoProMakerNote },
+    { "Ricoh", tryRicohMakerNote },
+}
+
+// globals holds the information found while parsing some entries, which is
+// needed later by other entries or by accessors. Flags indicate whether the
+// preceding fields were found.
+type globals struct {
+    make, model     string          // primary IFD camera make and model
+    software        string          // primary IFD software, for quirks
+    thumbOffset     uint32          // JPEGInterchangeFormat
+    thumbSource     tSource         // where the thumbnail data was read
+    thumbIfd        IfdId           // ifd holding the thumbnail
+    hasThumbOffset  bool
+    hasThumbIfd     bool            // false if thumbnail ignored
+    thumbLen        uint32          // JPEGInterchangeFormatLength
+    hasThumbLen     bool
+    thumbType       Compression     // thumbnail compression, if given
+    makerNote       []byte          // raw maker note payload, or nil
+    trailer         Trailer         // data following the JPEG image
+    hasTrailer      bool
+    gainMap         HDRInfo         // JPEG gain map
+    hasGainMap      bool
+    relAltitude     float64         // DJI flight altitudes, from XMP
+    absAltitude     float64
+    hasAltitude     bool
+    iccProfile      []byte          // ICC profile, or nil
+    iccDescription  string          // ICC profile description, or ""
+    quickTimeKeys   map[string]string // MP4 or QuickTime text keys, or nil
+    previews        []makerPreviewInfo // previews in unsupported maker notes
+}
+
+// adopt sets the information found by a worker, which is not yet set in g
+func (g *globals) adopt( w *globals ) {
+    if g.make == "" && g.model == "" {
+        g.make, g.model = w.make, w.model
+    }
+    if g.software == "" {
+        g.software = w.software
+    }
+    if ! g.hasThumbOffset && w.hasThumbOffset {
+        g.thumbOffset, g.thumbSource = w.thumbOffset, w.thumbSource
+        g.thumbIfd, g.hasThumbIfd = w.thumbIfd, w.hasThumbIfd
+        g.hasThumbOffset = true
+    }
+    if ! g.hasThumbLen && w.hasThumbLen {
+        g.thumbLen, g.hasThumbLen = w.thumbLen, true
+    }
+    if g.thumbType == Undefined {
+        g.thumbType = w.thumbType
+    }
+    if g.makerNote == nil {
+        g.makerNote = w.makerNote
+    }
+    if len(g.previews) == 0 {
+        g.previews = w.previews
+    }
+}
 
 type Desc struct {
     data    []byte          // starts at TIFF header (right after exif header)
-    origin  uint32          // except for some maker notes (e.g. apple)
+    base    uint32          // data offset in the original input (file)
+    source  []byte          // secondary data, starting as data, or nil
+    origin  uint32          // maker note ifd offset in data, for rewriting
     dataEnd uint32          // data area end, updated during parsing
 
     endian  binary.ByteOrder // endianess as defined in binary
 
-    global  map[string]interface{}  // storage for global information
+    global  globals         // storage for global information
 
             control         // what to do when parsing
+    stats   *Stats          // parse statistics, shared with maker notes
 
     root    *ifdd           // tree of ifd for rewriting exif metadata
     ifds    [_IFD_N]*ifdd   // flat access to ifd by id
+    ns      *namespaces     // dynamic namespaces, shared with maker notes
+    arena   *valueArena     // pooled values if not nil, shared as well
+
+    parallel *parallelParse // not nil if parsing in parallel
+    jobs    []*parseJob     // entries being parsed in parallel
 }
 
 type control struct {
@@ -194,15 +367,17 @@ const (                         // TIFF Types
     _Double
 )
 
-// UnsignedRational structure mapping to TIFF RATIONAL type
-type UnsignedRational struct {
-    Numerator, Denominator  uint32
-}
+const (                         // 64-bit TIFF Types (BigTIFF, some maker notes)
+    _UnsignedLong8 tType = 16 + iota
+    _SignedLong8
+    _IFD8                       // stored as _UnsignedLong8
+)
 
-// SignedRational structure mapping to TIFF SRATIONAL type
-type SignedRational struct {
-    Numerator, Denominator  int32
-}
+// UnsignedRational is the former name of Rational, kept for compatibility
+type UnsignedRational = Rational
+
+// SignedRational is the former name of SRational, kept for compatibility
+type SignedRational = SRational
 
 const (                 // TIFF Type sizes (signed or unsigned)
     _ASCIIChar      = 1
@@ -212,26 +387,31 @@ const (                 // TIFF Type sizes (signed or unsigned)
     _RationalSize   = 8
     _FloatSize      = 4
     _DoubleSize     = 8
+    _Long8Size      = 8
 )
 
-func getTiffTypeSize( t tType ) uint32 {
+func getTiffTypeSize( t tType ) (uint32, error) {
     switch t {
-        case _UnsignedByte: return _ByteSize
-        case _ASCIIString: return _ByteSize
-        case _UnsignedShort: return _ShortSize
-        case _UnsignedLong: return _LongSize
-        case _UnsignedRational: return _RationalSize
-        case _SignedByte: return _ByteSize
-        case _Undefined: return _ByteSize   // count in bytes
-        case _SignedShort: return _ShortSize
-        case _SignedLong: return _LongSize
-        case _SignedRational: return _RationalSize
-        case _Float: return _FloatSize
-        case _Double: return _DoubleSize
+        case _UnsignedByte: return _ByteSize, nil
+        case _ASCIIString: return _ByteSize, nil
+        case _UnsignedShort: return _ShortSize, nil
+        case _UnsignedLong: return _LongSize, nil
+        case _UnsignedRational: return _RationalSize, nil
+        case _SignedByte: return _ByteSize, nil
+        case _Undefined: return _ByteSize, nil  // count in bytes
+        case _SignedShort: return _ShortSize, nil
+        case _SignedLong: return _LongSize, nil
+        case _SignedRational: return _RationalSize, nil
+        case _Float: return _FloatSize, nil
+        case _Double: return _DoubleSize, nil
+        case _UnsignedLong8: return _Long8Size, nil
+        case _SignedLong8: return _Long8Size, nil
+        case _IFD8: return _Long8Size, nil
         default:
             break
     }
-     panic(fmt.Sprintf("TIFF type %s does not have a size", getTiffTString(t)))
+    return 0, fmt.Errorf( "getTiffTypeSize: TIFF type %s does not have a size\n",
+                          getTiffTString(t) )
 }
 
 func getTiffTString( t tType ) string {
@@ -248,94 +428,39 @@ func getTiffTString( t tType ) string {
         case _SignedRational: return "Signed rational"
         case _Float: return "Float"
         case _Double: return "Double"
+        case _UnsignedLong8: return "Unsigned long8"
+        case _SignedLong8: return "Signed long8"
+        case _IFD8: return "IFD8"
         default: break
     }
     return fmt.Sprintf("Unknown (%d)", t )
 }
 
-func (d *Desc) readTIFFData( offset uint32, dest interface{} ) {
-    b := bytes.NewBuffer( d.data[offset:] )
-    binary.Read( b, d.endian, dest )
-    return
-}
-
-// (d *Desc)get<tType>s(offset, count) functions read the requested count of
-// typed data from an offset anywhere in the data slice, using the endianess
-// and data slice from d. The result is a slice of the corresponding go type.
+// (d *Desc)get<tType>(offset) functions read a single typed value at an
+// offset anywhere in the data slice, using the endianess and data slice from
+// d. Slices of typed values are read by the get<tType>s functions in decode.go
 
 func (d *Desc) getByte( offset uint32 ) uint8 {
     return d.data[offset]
 }
 
-func (d *Desc) getUnsignedBytes( offset, count uint32 ) []uint8 {
-    return d.data[offset:offset+count]
-}
-
-func (d *Desc) getSignedBytes( offset uint32, count uint32 ) []int8 {
-    r := make( []int8, count )
-    d.readTIFFData( offset, &r )
-    return r
-}
-
-func (d *Desc) getUnsignedShort( offset uint32 ) (us uint16) {
-    b := bytes.NewBuffer( d.data[offset:offset+_ShortSize] )
-    binary.Read( b, d.endian, &us )
-    return
+func (d *Desc) getUnsignedShort( offset uint32 ) uint16 {
+    return d.endian.Uint16( d.data[offset:offset+_ShortSize] )
 }
 
-func (d *Desc) getUnsignedShorts( offset, count uint32 ) []uint16 {
-    r := make( []uint16, count )
-    d.readTIFFData( offset, &r )
-    return r
+func (d *Desc) getUnsignedLong( offset uint32 ) uint32 {
+    return d.endian.Uint32( d.data[offset:offset+_LongSize] )
 }
 
-func (d *Desc) getSignedShorts( offset uint32, count uint32 ) []int16 {
-    r := make( []int16, count )
-    d.readTIFFData( offset, &r )
-    return r
-}
-
-func (d *Desc) getUnsignedLong( offset uint32 ) (ul uint32) {
-    b := bytes.NewBuffer( d.data[offset:offset+_LongSize] )
-    binary.Read( b, d.endian, &ul )
-    return
-}
-
-func (d *Desc) getUnsignedLongs( offset, count uint32 ) []uint32 {
-    r := make( []uint32, count )
-    d.readTIFFData( offset, &r )
-    return r
-}
-
-func (d *Desc) getSignedLong( offset uint32 ) (l int32) {
-    b := bytes.NewBuffer( d.data[offset:offset+_LongSize] )
-    binary.Read( b, d.endian, &l )
-    return
-}
-
-func (d *Desc) getSignedLongs( offset, count uint32 ) []int32 {
-    r := make( []int32, count )
-    d.readTIFFData( offset, &r )
-    return r
-}
-
-func (d *Desc) getUnsignedRationals( offset, count uint32 ) []UnsignedRational {
-    r := make( []UnsignedRational, count )
-    d.readTIFFData( offset, &r )
-    return r
-}
-
-func (d *Desc) getSignedRationals( offset, count uint32 ) []SignedRational {
-    r := make( []SignedRational, count )
-    d.readTIFFData( offset, &r )
-    return r
+func (d *Desc) getSignedLong( offset uint32 ) int32 {
+    return int32(d.endian.Uint32( d.data[offset:offset+_LongSize] ))
 }
 
 func (d *Desc) checkValidTiff( ) (uint32, error) {
     validTiff := d.getUnsignedShort( 2 )
     if validTiff != 0x2a {
         return 0, fmt.Errorf(
-            "checkValidTiff: invalid TIFF header (invalid identifier: %#02x)\n",
+            "checkValidTiff: %w (invalid identifier: %#02x)\n", ErrInvalidTiffHeader,
              validTiff )
     }
     // followed by Primary Image File directory (IFD) offset
@@ -438,35 +563,104 @@ type ifdd struct {
       next IFD = 0
 */
 
+// recordRemoved counts and records an entry removed while parsing
+func (d *Desc) recordRemoved( id IfdId, tag tTag, typ tType, count uint32 ) {
+    d.stats.getIfd( id ).Removed ++
+    d.stats.RemovedEntries = append( d.stats.RemovedEntries,
+                        RemovedEntry{ id, uint16(tag), uint16(typ), count } )
+}
+
+// removeEntry records the removal of the current entry
+func (ifd *ifdd) removeEntry( ) {
+    ifd.desc.recordRemoved( ifd.id, ifd.fTag, ifd.fType, ifd.fCount )
+}
+
 func (ifd *ifdd) processPadding( ) error {
     if 0 == ifd.desc.Unknown & RemoveTag {
         return ifd.storeAnyUnknownSilently( )
     }
+    ifd.removeEntry( )
     return nil
 }
 
 func (ifd *ifdd) processUnknownTag( ) error {
+    name, known := ifd.desc.getTagName( ifd.id, ifd.fTag )
+    if known {
+        ifd.desc.stats.getIfd( ifd.id ).Unsupported ++
+    } else {
+        ifd.desc.stats.getIfd( ifd.id ).Unknown ++
+    }
     if ifd.desc.Warn {
-        fmt.Printf( "%s: unknown or unsupported tag (%#02x) @offset %#04x type %s count %d\n",
-                    GetIfdName(ifd.id), ifd.fTag, ifd.sOffset-8,
-                    getTiffTString( ifd.fType ), ifd.fCount )
+        what := "unknown tag"
+        if known {
+            what = "unsupported tag " + name
+        }
+        ifd.desc.logf( LogWarning, "%s: %s (%#02x) @offset %#04x type %s count %d\n",
+                       ifd.desc.IfdName(ifd.id), what, ifd.fTag, ifd.sOffset-8,
+                       getTiffTString( ifd.fType ), ifd.fCount )
     }
-    if 0 != ifd.desc.Unknown & Stop {
-        return fmt.Errorf( "%s: storeExifTags: stop at unknown tag %#02x\n",
-                           GetIfdName(ifd.id), ifd.fTag )
+    action := ifd.desc.Unknown
+    if ifd.desc.OnUnknown != nil {
+        action = ifd.desc.OnUnknown( ifd.id, uint16(ifd.fTag),
+                                     uint16(ifd.fType), ifd.fCount,
+                                     ifd.getRawBytes( ) )
     }
-    if 0 == ifd.desc.Unknown & RemoveTag {
+    if 0 != action & Stop {
+        return fmt.Errorf( "%s: storeExifTags: stop at %w %#02x\n",
+                           ifd.desc.IfdName(ifd.id), ErrUnknownTag, ifd.fTag )
+    }
+    if 0 == action & RemoveTag {
         return ifd.storeAnyUnknownSilently( )
     }
+    ifd.removeEntry( )
     return nil
 }
 
+// dumpFormat gives how raw data is dumped in a formatting context
+type dumpFormat struct {
+    row         int     // bytes per row
+    ascii       bool    // with an ASCII column
+    threshold   int     // byte values longer than threshold are dumped
+    max         int     // maximum bytes dumped per tag, 0 if no limit
+    data        []byte  // parsed data, if offsets in the input are shown
+    base        uint32  // parsed data offset in the input
+}
+
+const (
+    _defaultDumpRow         = 16
+    _defaultDumpThreshold   = 16
+)
+
+var defaultDumpFormat = dumpFormat{ row: _defaultDumpRow, ascii: true,
+                                    threshold: _defaultDumpThreshold }
+
+// getOffset returns the offset of data in the input, if data is part of the
+// parsed data and offsets in the input are shown, or 0 otherwise, in which
+// case offsets are given from the start of data. Slices of the parsed data
+// are recognized since they end at the end of the same underlying array.
+func (df *dumpFormat) getOffset( data []byte ) int64 {
+    in := df.data
+    if cap(in) == 0 || cap(data) == 0 || cap(data) > cap(in) ||
+       &in[:cap(in)][cap(in)-1] != &data[:cap(data)][cap(data)-1] {
+        return 0
+    }
+    return int64(df.base) + int64(cap(in) - cap(data))
+}
+
 func dumpData(w io.Writer,  header, indent string, noLf bool, data []byte ) {
     fmt.Fprintf( w, "%s:\n", header )
-    for i := 0; i < len(data); i += 16 {
-        fmt.Fprintf( w, "%s%#04x: ", indent, i );
-        l := 16
-        if len(data)-i < 16 {
+    df := getDumpFormat( w )
+    more, lastLf := 0, ! noLf
+    if df.max > 0 && len(data) > df.max {
+        more = len(data) - df.max   // truncated dump, followed by a summary
+        data = data[:df.max]
+        noLf = false
+    }
+    base := df.getOffset( data )
+    for i := 0; i < len(data); i += df.row {
+        fmt.Fprintf( w, "%s%#04x: ", indent, base + int64(i) );
+        l := df.row
+        if len(data)-i < df.row {
             l = len(data)-i
         }
         var b strings.Builder
@@ -479,65 +673,140 @@ func dumpData(w io.Writer,  header, indent string, noLf bool, data []byte ) {
             }
             fmt.Fprintf( w, "%02x ", data[i+j] )
         }
-        for ; j < 16; j++ {
-            io.WriteString( w, "   " )
+        if df.ascii {
+            for ; j < df.row; j++ {
+                io.WriteString( w, "   " )
+            }
+        } else {
+            b.Reset()
         }
-        if noLf && i + 16 >= len(data) {
+        if noLf && i + df.row >= len(data) {
             io.WriteString( w, b.String() )
         } else {
             fmt.Fprintf( w, "%s\n", b.String() )
         }
     }
+    if more > 0 {
+        fmt.Fprintf( w, "%s... (%d more bytes)", indent, more )
+        if lastLf {
+            io.WriteString( w, "\n" )
+        }
+    }
 }
 
-func (ifd *ifdd)removeIfdTag( tag tTag ) {
+// removeIfdTag removes the value for tag in the ifd and returns it, or nil if
+// the tag was not present.
+func (ifd *ifdd)removeIfdTag( tag tTag ) serializer {
     for i, v := range( ifd.values ) {
         if v != nil {
             t := v.getTag()
             if t == tag {
 //                fmt.Printf( "removeTag: found tag %d @ entry %d in ifd %s (%d)\n",
-//                            tag, i, GetIfdName(ifd.id), ifd.id )
+//                            tag, i, ifd.desc.IfdName(ifd.id), ifd.id )
                 ifd.values[i] = nil
-                return
+                return v
             }
         }
     }
     if ifd.desc.Warn {
-        fmt.Printf( "removeTag: missing tag %d in ifd %s (%d)\n",
-                    tag, GetIfdName(ifd.id), ifd.id )
+        ifd.desc.logf( LogWarning, "removeTag: missing tag %d in ifd %s (%d)\n",
+                       tag, ifd.desc.IfdName(ifd.id), ifd.id )
+    }
+    return nil
+}
+
+// isEmbeddedIn returns true if the ifd is anc or is embedded in anc, directly
+// or through other embedded ifds or maker notes.
+func (ifd *ifdd)isEmbeddedIn( anc *ifdd ) bool {
+    for ifd != nil {
+        if ifd == anc {
+            return true
+        }
+        switch pv := ifd.pValue.(type) {
+        case *ifdValue:
+            ifd = pv.ifd
+        case *descValue:
+            ifd = pv.ifd
+        default:
+            return false
+        }
+    }
+    return false
+}
+
+// dropIfd forgets the removed ifd and all ifds embedded in it, in the main
+// desc and in their own desc in case of maker notes, so that they cannot be
+// accessed anymore. Their parent values must have been removed already.
+func (d *Desc)dropIfd( removed *ifdd ) {
+    for id := PRIMARY; id < d.ifdCount(); id++ {
+        if ifd := d.getIfd( id ); ifd != nil && ifd.isEmbeddedIn( removed ) {
+            if ifd.desc != d && ifd.desc.getIfd( id ) == ifd {
+                ifd.desc.setIfd( id, nil )
+            }
+            d.setIfd( id, nil )
+        }
     }
 }
 
 func (d *Desc)removeIfdTag( id IfdId, tag uint ) error {
-    if id >= _IFD_N {
+    if id >= d.ifdCount() {
         return fmt.Errorf( "RemoveIfdTag: id %d is not valid for an ifd\n", id )
     }
-    ifd := d.ifds[id]
+    ifd := d.getIfd( id )
     if ifd == nil {
-        return fmt.Errorf( "RemoveIfdTag: ifd %d is not present\n", id )
+        return fmt.Errorf( "RemoveIfdTag: %s %w\n", d.IfdName(id), ErrIfdNotPresent )
     }
     if tag >0xffff {
         return fmt.Errorf( "RemoveIfdTag: tag %d is out of range\n", tag )
     }
     eTag := tTag(tag)
-    ifd.removeIfdTag( eTag )
-
-    // special cases for JPEGInterchangeFormat/Length
-    if id == PRIMARY || id == THUMBNAIL || id == EMBEDDED {
-        if eTag == _JPEGInterchangeFormat {
-            eTag = _JPEGInterchangeFormatLength
-        } else if eTag == _JPEGInterchangeFormatLength {
-            eTag = _JPEGInterchangeFormat
-        } else {
-            eTag = 0
-        }
-        if eTag != 0 {
-            ifd.removeIfdTag( eTag )
-         }
+    switch v := ifd.removeIfdTag( eTag ).(type) {
+    case *ifdValue:         // embedded ifd is removed as well
+        d.dropIfd( v.v )
+    case *descValue:        // so is an embedded maker note
+        d.dropIfd( v.v.root )
+    }
+
+    lId := id
+    if d.isEmbedded( id ) {
+        lId = EMBEDDED
+    }
+    for _, linked := range getLinkedTags( lId, eTag ) {
+        ifd.removeIfdTag( linked )
     }
     return nil
 }
 
+// tiffLinkedTags are groups of TIFF tags that are meaningless without each
+// other: image data offsets and sizes.
+var tiffLinkedTags = [][]tTag {
+    { _JPEGInterchangeFormat, _JPEGInterchangeFormatLength },
+    { _StripOffsets, _StripByteCounts },
+    { _TileOffsets, _TileByteCounts },
+}
+
+// linkedTags gives, per ifd namespace, the groups of tags that must be
+// removed together: removing one tag in a group removes all the others.
+var linkedTags = map[IfdId][][]tTag {
+    PRIMARY:    tiffLinkedTags,
+    THUMBNAIL:  tiffLinkedTags,
+    EMBEDDED:   tiffLinkedTags,     // all embedded IFDs, e.g. Nikon preview
+}
+
+// getLinkedTags returns the tags linked to tag in the ifd namespace id
+func getLinkedTags( id IfdId, tag tTag ) (linked []tTag) {
+    for _, group := range linkedTags[id] {
+        if containsTag( group, tag ) {
+            for _, t := range group {
+                if t != tag {
+                    linked = append( linked, t )
+                }
+            }
+        }
+    }
+    return
+}
+
 func removeVal( val serializer) {
     if ifdVal, ok := val.(*ifdValue); ok == true {
         ifd := ifdVal.ifd
@@ -568,16 +837,16 @@ func removeVal( val serializer) {
 }
 
 func (d *Desc)removeIfd( id IfdId ) error {
-    if id >= _IFD_N {
+    if id >= d.ifdCount() {
         return fmt.Errorf( "RemoveIfd: id %d is not valid for an ifd\n", id )
     }
     if id == PRIMARY {
         return fmt.Errorf( "RemoveIfd: removing ifd PRIMARY is not possible\n")
     }
 
-    ifd := d.ifds[id]
+    ifd := d.getIfd( id )
     if ifd == nil {
-        return fmt.Errorf( "RemoveIfd: ifd %d is not present\n", id )
+        return fmt.Errorf( "RemoveIfd: %s %w\n", d.IfdName(id), ErrIfdNotPresent )
     }
 
     // 1. remove entry in parent ifd, if any
@@ -591,8 +860,8 @@ func (d *Desc)removeIfd( id IfdId ) error {
         chain.next = nil
     }
 
-    // 3. remove ifd in ifid ids in main Desc
-    d.ifds[id] = nil
+    // 3. remove ifd and all embedded ifds in ifd ids in main Desc
+    d.dropIfd( ifd )
 
     return nil
 }
@@ -611,24 +880,26 @@ func (d *Desc)removeIfd( id IfdId ) error {
 // all tags in the ifd). Beware that removing a whole IFD removes all embedded
 // IFDs and any embedded thumbnail as well, and removing the whole PRIMARY ifd
 // will remove all existing ifds, resulting in an empty metadata descriptor.
+// Similarly, removing a tag pointing to an embedded ifd or to a maker note
+// (e.g. the Nikon Preview tag) removes the embedded ifds as well.
 //
 // Removing a tag can make the enclosing ifd meaningless. Some tags come in
-// couples, like _JPEGInterchangeFormat and _JPEGInterchangeFormatLength and
-// must always be both removed even if only one is specified. This case is
-// handled here, but other possible similar cases, in maker notes for example,
-// are not.
+// groups, like JPEGInterchangeFormat and JPEGInterchangeFormatLength, or
+// StripOffsets and StripByteCounts, and must always be removed together even
+// if only one is specified. Such linked tags are declared per ifd namespace in
+// the linkedTags table.
 func (d *Desc)Remove( id IfdId, tag int ) (err error) {
     if id == 0 {        // remove all exif metadata
         d.root = nil
-        for id := PRIMARY; id < _IFD_N; id ++ {
-            d.ifds[id] = nil
+        for id := PRIMARY; id < d.ifdCount(); id ++ {
+            d.setIfd( id, nil )
         }
         return
     }
     if tag < -1 {
         return fmt.Errorf( "Remove: invalid tag %d\n", tag )
     }
-    defer func ( ) { if err != nil { err = fmt.Errorf( "Remove: %v", err ) } }()
+    defer func ( ) { if err != nil { err = fmt.Errorf( "Remove: %w", err ) } }()
 
     if tag == -1 {      // remove the whole ifd
         err = d.removeIfd( IfdId(id) )
@@ -638,6 +909,87 @@ func (d *Desc)Remove( id IfdId, tag int ) (err error) {
     return
 }
 
+// normalizeTagName returns a tag name in lower case, without space, dash or
+// underscore, so that "DateTimeOriginal" matches "DateTime Original".
+func normalizeTagName( name string ) string {
+    return strings.Map( func( r rune ) rune {
+        switch r {
+        case ' ', '-', '_':
+            return -1
+        }
+        return unicode.ToLower( r )
+    }, name )
+}
+
+// getTagByName returns the tag of the value named name in the ifd, or false
+// if there is no such value. Names are matched as given by Format, ignoring
+// case, spaces, dashes and underscores.
+func (ifd *ifdd)getTagByName( name string ) (tTag, bool) {
+    name = normalizeTagName( name )
+    for _, v := range ifd.values {
+        if v == nil {
+            continue
+        }
+        if normalizeTagName( v.getName( ) ) == name {
+            return v.getTag( ), true
+        }
+    }
+    return 0, false
+}
+
+// RemoveByName removes a tag given by its name instead of its numeric value.
+// The name is the one used by Format (e.g. "DateTime Original"), matched
+// ignoring case, spaces, dashes and underscores (e.g. "datetimeoriginal").
+//
+// The argument id indicates the enclosing ifd. If the ifd id is not present or
+// if no tag with that name is found in the ifd an error is returned. Otherwise
+// the tag is removed as with Remove.
+func (d *Desc)RemoveByName( id IfdId, name string ) error {
+    ifd := d.getIfd( id )
+    if ifd == nil {
+        return fmt.Errorf( "RemoveByName: %s %w\n", d.IfdName(id),
+                           ErrIfdNotPresent )
+    }
+    tag, ok := ifd.getTagByName( name )
+    if ! ok {
+        return fmt.Errorf( "RemoveByName: tag %q is not present in %s\n",
+                           name, d.IfdName(id) )
+    }
+    return d.Remove( id, int(tag) )
+}
+
+// RemoveAll removes all tags for which the predicate pred returns true. The
+// predicate is called with the enclosing ifd id and the tag, for each tag in
+// each ifd present, except for the tags pointing to embedded ifds (e.g. the
+// Exif IFD in the PRIMARY ifd). Instead, an embedded ifd that ends up without
+// any entry is removed, along with its pointer in the parent ifd.
+//
+// For example, keeping only a set of tags is done by returning true for any
+// tag not in that set. Couples of tags are removed together as with Remove.
+func (d *Desc)RemoveAll( pred func( id IfdId, tag uint16 ) bool ) {
+    for id := d.ifdCount() - 1; ; id-- {    // embedded ifds first
+        if ifd := d.getIfd( id ); ifd != nil {
+            empty := true
+            for _, v := range ifd.values {
+                if v == nil {
+                    continue
+                }
+                if _, ok := v.(*ifdValue); ! ok && pred( id, uint16(v.getTag()) ) {
+                    d.removeIfdTag( id, uint(v.getTag()) )
+                } else {
+                    empty = false
+                }
+            }
+            if empty && id != PRIMARY {
+                d.removeIfd( id )
+            }
+        }
+        if id == PRIMARY {
+            break
+        }
+    }
+}
+
 func getEndianess( data []byte ) ( endian binary.ByteOrder, err error ) {
     endian = binary.BigEndian
     err = nil
@@ -648,32 +1000,148 @@ func getEndianess( data []byte ) ( endian binary.ByteOrder, err error ) {
         endian = binary.LittleEndian
     } else if ! bytes.Equal( data[:2], []byte( "MM" ) ) {
         err = fmt.Errorf(
-                "getEndianess: invalid TIFF header (unknown byte ordering: %v)\n",
-                data[:2] )
+                "getEndianess: %w (unknown byte ordering: %v)\n",
+                ErrInvalidTiffHeader, data[:2] )
     }
     return
 }
 
+// swapEndian returns the byte order opposite to endian
+func swapEndian( endian binary.ByteOrder ) binary.ByteOrder {
+    if endian == binary.BigEndian {
+        return binary.LittleEndian
+    }
+    return binary.BigEndian
+}
+
+// blobEndian declares the byte order of a structure stored in a single value
+// (blob), such as an undefined maker note entry. Some vendors write those
+// structures in a fixed byte order, independent of the metadata byte order,
+// and indicate it with a marker (e.g. a specific version) in the blob.
+type blobEndian struct {
+    offset  int                 // marker offset in blob
+    marker  []byte              // marker indicating the fixed byte order
+    endian  binary.ByteOrder    // fixed byte order
+}
+
+// get returns the byte order to use for blob: the fixed byte order if the
+// marker is found in blob, or the given metadata byte order otherwise.
+func (be *blobEndian) get( blob []byte,
+                           metadata binary.ByteOrder ) binary.ByteOrder {
+    if be.offset + len(be.marker) <= len(blob) &&
+       bytes.Equal( blob[be.offset:be.offset+len(be.marker)], be.marker ) {
+        return be.endian
+    }
+    return metadata
+}
+
 func newDesc( data []byte, c *Control ) *Desc {
     d := new( Desc )
     d.data = data
     d.Control = *c
-    d.global = make(map[string]interface{})
+    d.stats = new( Stats )
+    d.ns = new( namespaces )
+    return d
+}
+
+// newMakerDesc returns a new descriptor for a maker note that has its own
+// structure, starting at offset in the ifd desc data and including size bytes.
+// All offsets in the maker note entries are relative to the start of the new
+// descriptor data. The maker note ifd is at the offset origin in that data,
+// and its byte order is given by the TIFF byte order mark ("II" or "MM") at
+// the offset endianOffset. The new descriptor shares the control and the
+// statistics of its parent and knows the camera make and model for model
+// dependent decoding.
+//
+// It returns an error if the maker note is out of bounds or too short to hold
+// the byte order mark and the ifd entry count, or if the byte order is not
+// valid.
+func (ifd *ifdd) newMakerDesc( offset, size, origin,
+                               endianOffset uint32 ) (*Desc, error) {
+    if uint64(offset) + uint64(size) > uint64(len(ifd.desc.data)) ||
+       uint64(size) < uint64(origin) + _ShortSize ||
+       uint64(size) < uint64(endianOffset) + 2 {
+        return nil, fmt.Errorf( "newMakerDesc: invalid maker note size %d @%#08x\n",
+                                size, offset )
+    }
+    endian, err := getEndianess( ifd.desc.data[offset+endianOffset:offset+size] )
+    if err != nil {
+        return nil, err
+    }
+    mknd := newDesc( ifd.desc.data[offset:offset+size], &ifd.desc.Control )
+    mknd.stats = ifd.desc.stats         // collect statistics in parent
+    mknd.ns = ifd.desc.ns               // and dynamic namespaces
+    mknd.arena = ifd.desc.arena         // and pooled values
+    mknd.parallel = ifd.desc.parallel   // and parallel progress
+    mknd.base = ifd.desc.base + offset  // for reporting file offsets
+    mknd.origin = origin
+    mknd.endian = endian
+    mknd.global.make = ifd.desc.global.make
+    mknd.global.model = ifd.desc.global.model
+    mknd.global.software = ifd.desc.global.software
+    return mknd, nil
+}
+
+// hasMakerNoteSignature returns true if the maker note at offset in the ifd
+// desc data starts with signature.
+func (ifd *ifdd) hasMakerNoteSignature( offset uint32, signature string ) bool {
+    return ifd.fCount >= uint32(len(signature)) &&
+           bytes.HasPrefix( ifd.desc.data[offset:offset+ifd.fCount],
+                            []byte( signature ) )
+}
+
+// newEmptyDesc returns a descriptor without any metadata, but with an empty
+// primary IFD so that it can be serialized or tags can be added later.
+func newEmptyDesc( c *Control ) *Desc {
+    d := newDesc( nil, c )
+    d.endian = binary.BigEndian
+    d.root = new( ifdd )
+    d.root.id = PRIMARY
+    d.root.desc = d
+    d.ifds[PRIMARY] = d.root
     return d
 }
 
 // Parse starting at the tiff header
-func parseTiff( data []byte, ec *Control ) (desc *Desc, err error) {
+func parseTiff( data []byte, base uint32, source []byte,
+                ec *Control ) (*Desc, error) {
+    desc, _, err := parseTiffIfd( data, base, source, ec, 0 )
+    return desc, err
+}
+
+// parseTiffIfd parses the tiff data starting at the tiff header. If page is 0,
+// the first IFD given by the header is parsed as the primary IFD, followed by
+// the thumbnail IFD if any. Otherwise, only the IFD at offset page is parsed,
+// as the primary IFD, and the offset of the following IFD is returned in next.
+func parseTiffIfd( data []byte, base uint32, source []byte, ec *Control,
+                   page uint32 ) (desc *Desc, next uint32, err error) {
 
     d := newDesc( data, ec )
+    d.base = base                   // needed by maker notes while parsing
+    d.source = source
+    if d.Pooled {
+        d.arena = arenaPool.Get( ).(*valueArena)
+    }
+    if d.Parallel {
+        d.parallel = new( parallelParse )
+    }
+    start := time.Now()
     defer func ( ) {
+        d.joinWorkers( )            // in case of early error
+        d.stats.Duration = time.Since( start )
         if err != nil {
-            err = fmt.Errorf( "parseTiff: %v", err )
+            d.Release( )            // give back pooled values, if any
+            err = fmt.Errorf( "parseTiff: %w", err )
         } else {
             desc = d
         }
     }()
 
+    if len(d.data) < _headerSize {
+        err = fmt.Errorf( "%w (too short: %d bytes)\n", ErrInvalidTiffHeader,
+                          len(d.data) )
+        return
+    }
     d.endian, err = getEndianess( d.data )
     if err != nil {
         return
@@ -684,12 +1152,44 @@ func parseTiff( data []byte, ec *Control ) (desc *Desc, err error) {
     if err != nil {
         return
     }
+    if d.Strict {
+        if anomalies := d.LayoutAnomalies( ); len(anomalies) > 0 {
+            err = &LayoutError{ anomalies }
+            return
+        }
+    }
+    if page != 0 {
+        offset = page
+    }
     offset, d.root, err = d.storeIFD( PRIMARY, offset, storeTiffTags )
     if err != nil {
         return
     }
-    if offset != 0 {
+    if page != 0 {
+        next = offset
+    } else if offset != 0 {
         _, d.root.next, err = d.storeIFD( THUMBNAIL, offset, storeTiffTags )
+        if err != nil {
+            return
+        }
+    }
+    if err = d.joinWorkers( ); err != nil {
+        return
+    }
+    if d.parallel != nil {
+        d.stats.parsed = d.parallel.parsed
+    }
+    d.placeTiffEPTags( d.Placement )
+
+    // JPEGInterchangeFormat is only stored with JPEGInterchangeFormatLength
+    if d.global.hasThumbOffset {
+        if ! d.global.hasThumbLen {
+            if d.Warn {
+                d.logf( LogWarning, "Warning: JPEGInterchangeFormat without length is removed\n" )
+            }
+            d.recordRemoved( d.global.thumbIfd, _JPEGInterchangeFormat,
+                             _UnsignedLong, 1 )
+        }
     }
     return
 }
@@ -703,29 +1203,74 @@ func parseTiff( data []byte, ec *Control ) (desc *Desc, err error) {
 // An EXIF header is expected at the starting offset and the whole metadata
 // must fit in the following number of bytes. If the metadata size is unknown,
 // dLen can be given as 0, in which case parsing will use the rest of the input
-// slice.
+// slice. In a JPEG file, start is the offset of the EXIF header in the APP1
+// segment payload and dLen is the payload size (segment length - 2).
 //
 // It returns the descriptor in case of success or a non-nil error in case of
 // failure.
 func Parse( data []byte, start, dLen uint, ec *Control ) (desc *Desc, err error) {
+    desc, err = ParseWithSource( data, start, dLen, nil, 0, ec )
+    if err != nil {
+        err = fmt.Errorf( "Parse: %w", err )
+    }
+    return
+}
+
+// ParseWithSource parses data for exif metadata as Parse does, with a secondary
+// data source for values located outside the metadata. Some cameras write
+// maker notes beyond the exif metadata, with offsets pointing further in the
+// original file. Such maker notes are read from the secondary source instead
+// of being ignored.
+//
+// It takes the same arguments as Parse, plus the secondary source (source),
+// usually the whole file content, and the offset in source of the first byte
+// of data (pos). If data is the whole file content, source is data and pos is
+// 0. If source is nil, ParseWithSource behaves as Parse.
+//
+// It returns the descriptor in case of success or a non-nil error in case of
+// failure.
+func ParseWithSource( data []byte, start, dLen uint,
+                      source []byte, pos uint,
+                      ec *Control ) (desc *Desc, err error) {
+    end := uint(len(data))
+    if dLen != 0 {
+        if start + dLen > end {
+            return nil, fmt.Errorf( "ParseWithSource: metadata size %d exceeds data size %d\n",
+                                    dLen, end - start )
+        }
+        end = start + dLen
+    }
+    if start + _originOffset + _headerSize > end {
+        return nil, fmt.Errorf( "ParseWithSource: metadata too short @%#08x\n", start )
+    }
     if ! bytes.Equal( data[start:start+_originOffset], []byte( "Exif\x00\x00" ) ) {
-        return nil, fmt.Errorf( "Parse: invalid signature (%s)\n",
-                                string(data[0:6]) )
+        return nil, fmt.Errorf( "ParseWithSource: invalid signature (%s)\n",
+                                string(data[start:start+_originOffset]) )
     }
 
     // Exif\0\0 is followed immediately by TIFF header
-    return parseTiff( data[start+_originOffset:start+dLen-_originOffset], ec )
+    tiff := start + _originOffset
+    if source != nil {
+        if pos + tiff > uint(len(source)) {
+            return nil, fmt.Errorf( "ParseWithSource: invalid source position %d\n", pos )
+        }
+        source = source[pos+tiff:]      // same origin as the TIFF header
+    }
+    return parseTiff( data[tiff:end], uint32(tiff), source, ec )
 }
 
-var masks [256]byte
-
-func init() {
-    for i:= 0; i < 256; i++ { masks[i] = 0xff }
-    masks['E'] = 0xfe   // position at bit 0 in pattern
-    masks['x'] = 0xfd   // position at bit 1 ...
-    masks['i'] = 0xfb
-    masks['f'] = 0xf7
-    masks[ 0 ] = 0xcf   // 2 positions for \x0 (bits 4 and 5)
+// masks is the bitap table used by Search. It is computed once, at package
+// initialization, and is never modified afterwards.
+var masks = makeMasks( )
+
+func makeMasks( ) (m [256]byte) {
+    for i:= 0; i < 256; i++ { m[i] = 0xff }
+    m['E'] = 0xfe       // position at bit 0 in pattern
+    m['x'] = 0xfd       // position at bit 1 ...
+    m['i'] = 0xfb
+    m['f'] = 0xf7
+    m[ 0 ] = 0xcf       // 2 positions for \x0 (bits 4 and 5)
+    return
 }
 
 // Search looks up for the EXIF header in memory. It takes a source data slice
@@ -754,19 +1299,35 @@ func Search( data []byte, start uint ) ([]byte, error) {
 // Read the file whose path name is given and parse the data.
 //
 // It takes the path name (path) and a starting offset in that file.
-// It searches for the EXIF header from that starting offset, which
-// should therefore be given as 0 if it is unknown.
+//
+// If the file is a JPEG file starting at that offset, its segments are walked
+// until the EXIF APP1 segment is found, whatever APPn segments (e.g. JFIF APP0
+// or ICC APP2) precede it. Otherwise, it searches for the EXIF header from that
+// starting offset, which should therefore be given as 0 if it is unknown.
+//
+// If the file is an MP4 or QuickTime file starting at that offset, the exif
+// metadata is read from its exif box, as described in ParseMp4.
 //
 // If the exif signature "Exif\x00\x00" is not found, an attempt is made to
 // read instead a TIFF header without signature at the starting offset.
 // If this succeeds, the TIFF data is parsed and a reduced exif descriptor
 // is generated.
 //
+// If no exif metadata is found, the returned error wraps ErrNoExif. However,
+// if ec.Empty is true, an empty exif descriptor is returned instead, without
+// error, so that metadata can be created from scratch.
+//
 // It returns an exif descriptor in case of success or an error in
 // case of failure.
 func Read( path string, start uint, ec *Control ) (d *Desc, err error) {
     defer func ( ) {
-        if err != nil { err = fmt.Errorf( "Read: %v", err ) }
+        if err != nil {
+            if ec.Empty && errors.Is( err, ErrNoExif ) {
+                d, err = newEmptyDesc( ec ), nil
+                return
+            }
+            err = fmt.Errorf( "Read: %w", err )
+        }
     }()
 
     var data []byte
@@ -774,28 +1335,72 @@ func Read( path string, start uint, ec *Control ) (d *Desc, err error) {
     if err != nil {
         return
     }
-    data, err = Search( data, start )
+    if isJpeg( data, start ) {
+        d, err = parseJpeg( data, start, ec )
+        return
+    }
+    if uint(len(data)) >= start && isMp4( data[start:] ) {
+        d, err = ParseMp4( data, start, ec )
+        return
+    }
+
+    var exif []byte
+    exif, err = Search( data, start )
     if err != nil {
-        if ! bytes.Equal( data[0:2], []byte( "II" ) ) &&
-            ! bytes.Equal( data[0:2], []byte( "MM" ) ) {
+        if uint(len(data)) < start + _headerSize ||
+           ( ! bytes.Equal( data[start:start+2], []byte( "II" ) ) &&
+             ! bytes.Equal( data[start:start+2], []byte( "MM" ) ) ) {
+            err = fmt.Errorf( "%w\n", ErrNoExif )
             return
         }
-        d, err = parseTiff( data, ec )
+        d, err = parseTiff( data[start:], uint32(start), nil, ec )
         return
     }
-    d, err = Parse( data, 0, uint(len(data)), ec )
+    // parse from the whole data, so that offsets are relative to the file
+    d, err = ParseWithSource( data, uint(len(data)-len(exif)), uint(len(exif)),
+                              data, 0, ec )
     return
 }
 
+// parseJpeg parses the exif metadata of the JPEG image starting at start in
+// data, along with its trailer, ICC profile and gain map if any.
+func parseJpeg( data []byte, start uint, ec *Control ) (*Desc, error) {
+    offset, size, err := findJpegExif( data, start )
+    if err != nil {
+        return nil, err
+    }
+    d, err := ParseWithSource( data, offset, size, data, 0, ec )
+    if err != nil {
+        return nil, err
+    }
+    if t, ok, _ := FindJpegTrailer( data, start ); ok {
+        d.global.trailer, d.global.hasTrailer = t, true
+    }
+    if profile := getJpegIccProfile( data, start ); profile != nil {
+        d.SetICCProfile( profile )
+    }
+    if h, ok := getJpegGainMap( data, start ); ok {
+        d.global.gainMap, d.global.hasGainMap = h, true
+    }
+    if rel, abs, ok := getJpegDroneAltitude( data, start ); ok {
+        d.global.relAltitude, d.global.absAltitude = rel, abs
+        d.global.hasAltitude = true
+    }
+    return d, nil
+}
+
 // Write the parsed EXIF metadata into a file.
 // The argument path gives the path of the new file to write.
 //
+// If the Control Software identity is not empty, it is stamped into the
+// written metadata, as done by AppendSoftware, without modifying d.
+//
 // It returns the number of bytes written in the file in case of success
 // or a non-nil error in case of failure.
 func (d *Desc)Write( path string ) (n int, err error) {
 
     defer func ( ) {
-        if err != nil { err = fmt.Errorf( "Write: %v", err ) }
+        if err != nil { err = fmt.Errorf( "Write: %w", err ) }
     }()
 
     var f *os.File
@@ -804,7 +1409,11 @@ func (d *Desc)Write( path string ) (n int, err error) {
         return
     }
     defer func ( ) { if e := f.Close(); err == nil { err = e } }()
-    n, err = d.Serialize( f )
+    var s *Desc
+    if s, err = d.stamped( ); err != nil {
+        return
+    }
+    n, err = s.Serialize( f )
     return
 }
 
@@ -819,7 +1428,7 @@ func (d *Desc)Write( path string ) (n int, err error) {
 func (d *Desc)WriteOriginal( path string ) (n int, err error) {
 
     defer func ( ) {
-        if err != nil { err = fmt.Errorf( "WriteOriginal: %v", err ) }
+        if err != nil { err = fmt.Errorf( "WriteOriginal: %w", err ) }
     }()
     var f *os.File
     f, err = os.OpenFile( path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
@@ -838,6 +1447,21 @@ func (d *Desc)WriteOriginal( path string ) (n int, err error) {
     return
 }
 
+// GetMakerNoteRaw returns the maker note payload, as found in the original
+// input, and the maker note vendor if it was recognized, or an empty string
+// otherwise. The payload is returned even if the maker note could not be
+// decoded, so that it can be given to an external decoder or archived. The
+// returned slice must not be modified.
+//
+// It returns a non-nil error if no maker note was found.
+func (d *Desc)GetMakerNoteRaw( ) ([]byte, string, error) {
+    raw := d.global.makerNote
+    if raw == nil {
+        return nil, "", fmt.Errorf( "GetMakerNoteRaw: no maker note\n" )
+    }
+    return raw, d.stats.MakerNote, nil
+}
+
 // GetThumnailData
 // The argument id gives the id of the ifd that provides the thumbnail.
 //
@@ -847,28 +1471,56 @@ func (d *Desc)WriteOriginal( path string ) (n int, err error) {
 //
 // Actually any existing ifd in [ exif.PRIMARY, exif.THUMBNAIL, exif.EXIF,
 // exif.GPS, exif.IOP ] will return the exif thumbnail (if it exists),
-// while any existing ifd in [ exif.MAKER, exif.EMBEDDED] will return the
-// maker thumbnail (or preview image) if it exists.
+// while any existing ifd in [ exif.MAKER, embedded ifds ] will return the
+// maker thumbnail (or preview image) if it exists. The deprecated id
+// exif.EMBEDDED stands for the first embedded ifd, e.g. the Nikon preview.
 func (d *Desc)GetThumbnailData( id IfdId ) ([]byte, error) {
     var ifd *ifdd
 // First locate the ifd in the main descriptor ifd list, then use the ifd 
-// parent desc as the source of thumbnail data (EMBEDDED IFD has a different
+// parent desc as the source of thumbnail data (embedded IFDs have a different
 // desc and different data origin).
-    if id < _IFD_N {
-        ifd = d.ifds[id]
+    ifd = d.getIfd( id )
+    if ifd == nil && id == EMBEDDED {
+        ifd = d.firstEmbeddedIfd( )
     }
     if ifd == nil {
-        return nil, fmt.Errorf( "ifd %d not found\n", id )
+        return nil, fmt.Errorf( "GetThumbnailData: %s %w\n", d.IfdName(id),
+                                ErrIfdNotPresent )
     }
-    tOffset, _ := ifd.desc.global["thumbOffset"].(uint32)
-    if tOffset == 0 {
+    data := ifd.getThumbnail( )
+    if data == nil {
         return nil, fmt.Errorf( "thumbnail not found in ifd %d\n", id )
     }
-    tLen, _ := ifd.desc.global["thumbLen"].(uint32)
-    if tLen == 0 {
+    if len(data) == 0 {
         return nil, fmt.Errorf( "empty thumbnail found in ifd %d\n", id )
     }
-    return ifd.desc.data[tOffset:tOffset+tLen], nil
+    return data, nil
+}
+
+// getThumbnail returns the current thumbnail data in the ifd desc, taken from
+// the ifd holding it (THUMBNAIL, or an embedded IFD in maker notes), or nil if there
+// is no thumbnail or if the ifd holding it has been removed.
+func (ifd *ifdd)getThumbnail( ) []byte {
+    if ifd.desc.isMakerPreview( ifd.id ) {
+        for _, v := range ifd.values {
+            if tbn, ok := v.(*thumbnailValue); ok {
+                return tbn.v
+            }
+        }
+        return nil
+    }
+    if ! ifd.desc.global.hasThumbIfd {
+        return nil
+    }
+    tId := ifd.desc.global.thumbIfd
+    if tifd := ifd.desc.getIfd( tId ); tifd != nil {
+        for _, v := range tifd.values {
+            if tbn, ok := v.(*thumbnailValue); ok {
+                return tbn.v
+            }
+        }
+    }
+    return nil
 }
 
 // WriteThumbnail writes the thumbnail data into a new seperate file.
@@ -881,7 +1533,7 @@ func (d *Desc)GetThumbnailData( id IfdId ) ([]byte, error) {
 //
 // Actually any existing ifd in [ exif.PRIMARY, exif.THUMBNAIL, exif.EXIF,
 // exif.GPS, exif.IOP ] will write the exif thumbnail (if it exists),
-// while any existing ifd in [ exif.MAKER, exif.EMBEDDED] will write the
+// while any existing ifd in [ exif.MAKER, embedded ifds ] will write the
 // maker thumbnail (or preview image) if it exists.
 //
 // If succesful, it returns the number of bytes written, otherwise it returns
@@ -889,7 +1541,7 @@ func (d *Desc)GetThumbnailData( id IfdId ) ([]byte, error) {
 func (d *Desc)WriteThumbnail( path string, from IfdId ) (n int, err error) {
 
     defer func ( ) {
-        if err != nil { err = fmt.Errorf(  "WriteThumbail: %v", err ) }
+        if err != nil { err = fmt.Errorf(  "WriteThumbail: %w", err ) }
     }()
 
     var data []byte
@@ -906,45 +1558,235 @@ func (d *Desc)WriteThumbnail( path string, from IfdId ) (n int, err error) {
     return f.Write( data )
 }
 
+// getThumbnailInfo returns information about the thumbnail found in the ifd
+// desc, or false if there is none.
+func (ifd *ifdd)getThumbnailInfo( ) (ti ThumbnailInfo, ok bool) {
+    data := ifd.getThumbnail( )
+    if data == nil {
+        return
+    }
+    ti.Origin = ifd.desc.global.thumbIfd
+    ti.Comp = ifd.desc.global.thumbType
+    ti.Size = uint32(len(data))
+    ti.Offset = int64(ifd.desc.base) + int64(ifd.desc.global.thumbOffset)
+
+    switch {
+    case isJpeg( data, 0 ):     // even if compression is not given
+        ti.MIME = "image/jpeg"
+        ti.Width, ti.Height, _ = getJpegDimensions( data )
+    case ti.Comp == JPEG || ti.Comp == JPEG_Technote2:
+        ti.MIME = "image/jpeg"
+    case ti.Comp != Undefined:
+        ti.MIME = "image/tiff"
+        if tifd := ifd.desc.getIfd( ti.Origin ); tifd != nil {
+            ti.Width, _ = tifd.getUnsignedInteger( _ImageWidth )
+            ti.Height, _ = tifd.getUnsignedInteger( _ImageLength )
+        }
+    default:
+        ti.MIME = "application/octet-stream"
+    }
+    return ti, true
+}
+
+// GetPreviews returns information about all thumbnails and preview images
+// found in the metadata, including in maker notes. It returns a slice of
+// ThumbnailInfo structures, in the order the ifds are stored. The Origin of
+// each ThumbnailInfo can be given to GetThumbnailData or WriteThumbnail to
+// retrieve the image data.
+func (d *Desc)GetPreviews( ) (ti []ThumbnailInfo) {
+    ti = make( []ThumbnailInfo, 0, 2 )
+    seen := make( map[*Desc]bool )
+    for id := IfdId(0); id < d.ifdCount(); id++ {
+        ifd := d.getIfd( id )
+        if ifd == nil || seen[ifd.desc] || d.isMakerPreview( id ) {
+            continue
+        }
+        seen[ifd.desc] = true
+        if info, ok := ifd.getThumbnailInfo( ); ok {
+            ti = append( ti, info )
+        }
+    }
+    return append( ti, d.getMakerPreviewInfo( )... )
+}
+
 // GetThumbnailInfo returns information about all possible thumbnails.
 // It returns a slice of ThumnailInfo structures. In each ThumbailInfo, it
-// gives the thumbnail origin (either "Thumbnail" or "Maker Note Embedded"),
-// the size of the thumbnail data and the thumbnail compression type.
+// gives the thumbnail origin (either THUMBNAIL or an embedded IFD), the thumbnail
+// compression type, the size and offset of the thumbnail data, its pixel
+// dimensions if known and its MIME type. It is identical to GetPreviews.
 func (d *Desc)GetThumbnailInfo() (ti []ThumbnailInfo) {
-    ti = make( []ThumbnailInfo, 0, 2 )
-    tOffset, _ := d.global["thumbOffset"].(uint32)
-    if tOffset != 0 {
-        tLen, _ := d.global["thumbLen"].(uint32)
-        tType, _ := d.global["thumbType"].(Compression)
-        ti = append( ti, ThumbnailInfo{ THUMBNAIL, tType, tLen } )
-    }
-
-    // lookup for EMBEDDED IfID:
-    for id := IfdId(0); id < _IFD_N; id++ {
-        ifd := d.ifds[id]
-        if ifd != nil && ifd.id == EMBEDDED {
-            tOffset, _ = ifd.desc.global["thumbOffset"].(uint32)
-            if tOffset != 0 {
-                tLen, _ := ifd.desc.global["thumbLen"].(uint32)
-                tType, _ := ifd.desc.global["thumbType"].(Compression)
-                ti = append( ti, ThumbnailInfo{ EMBEDDED, tType, tLen } )
+    return d.GetPreviews( )
+}
+
+// Ifds returns information about all IFDs currently present in the metadata,
+// in IFD id order. The entry count and the size reflect the current metadata,
+// including modifications made after parsing. The size is an estimate of the
+// serialized IFD, including its data area and all IFDs embedded in it.
+func (d *Desc)Ifds( ) (ii []IfdInfo) {
+    ii = make( []IfdInfo, 0, d.ifdCount() )
+    for id := IfdId(0); id < d.ifdCount(); id++ {
+        ifd := d.getIfd( id )
+        if ifd == nil {
+            continue
+        }
+        var n uint
+        for _, v := range ifd.values {
+            if v != nil {
+                n++
             }
-            break
         }
+        ii = append( ii, IfdInfo{ id, d.IfdName( id ), n, ifd.layout( ) } )
     }
     return
 }
 
+// Stats returns the statistics collected while parsing the metadata. An empty
+// descriptor returns zero statistics.
+func (d *Desc)Stats( ) Stats {
+    return *d.stats
+}
+
+// getExifUnsignedInteger returns the first value of a short or long tag in the
+// Exif IFD, or false if the tag is absent.
+func (d *Desc) getExifUnsignedInteger( tag tTag ) (uint32, bool) {
+    if ifd := d.ifds[EXIF]; ifd != nil {
+        return ifd.getUnsignedInteger( tag )
+    }
+    return 0, false
+}
+
+// ISO returns the ISO sensitivity of the picture. The value is taken from the
+// tag indicated by SensitivityType: standard output sensitivity, recommended
+// exposure index or ISO speed, in that order of preference when several are
+// indicated. If SensitivityType is absent or unknown, or if the indicated tag
+// is missing, the PhotographicSensitivity tag (ISOSpeedRatings before Exif
+// 2.3) is used instead. It returns a non-nil error if no sensitivity is
+// available.
+func (d *Desc)ISO( ) (uint32, error) {
+    st, _ := d.getExifUnsignedInteger( _SensitivityType )
+    var tag tTag
+    switch st {
+    case 1, 4, 5, 7:    tag = _StandardOutputSensitivity
+    case 2, 6:          tag = _RecommendedExposureIndex
+    case 3:             tag = _ISOSpeed
+    }
+    if tag != 0 {
+        if iso, ok := d.getExifUnsignedInteger( tag ); ok {
+            return iso, nil
+        }
+    }
+    if iso, ok := d.getExifUnsignedInteger( _ISOSpeedRatings ); ok {
+        return iso, nil
+    }
+    return 0, fmt.Errorf( "ISO: no sensitivity information\n" )
+}
+
+// Endianness returns the byte order of the metadata, as given in the TIFF
+// header, which is also used when the metadata is serialized.
+func (d *Desc)Endianness( ) binary.ByteOrder {
+    return d.endian
+}
+
+// TiffHeader gives the location of the TIFF header and of the first IFD in
+// the original input, as found when the metadata was parsed.
+type TiffHeader struct {
+    Offset  uint32          // TIFF header offset in the original input
+    Ifd0    uint32          // IFD0 offset, relative to the TIFF header
+}
+
+// TiffHeader returns the location of the TIFF header in the original input,
+// so that the input can be patched directly at offsets relative to the TIFF
+// header, such as value offsets in TagEntry. For metadata created from scratch,
+// it returns the location the header would have when serialized.
+func (d *Desc)TiffHeader( ) TiffHeader {
+    if len(d.data) < _headerSize {
+        return TiffHeader{ _originOffset, _headerSize }
+    }
+    return TiffHeader{ d.base, d.getUnsignedLong( 4 ) }
+}
+
+// ExifVersionString returns the Exif version, in the form "2.32", as given
+// by the ExifVersion tag ("0232"). It returns a non-nil error if the tag is
+// not present or invalid.
+func (d *Desc)ExifVersionString( ) (string, error) {
+    var v string
+    var ok bool
+    if ifd := d.ifds[EXIF]; ifd != nil {
+        v, ok = ifd.getAsciiString( _ExifVersion )
+    }
+    if ! ok {
+        return "", fmt.Errorf( "ExifVersionString: no Exif version\n" )
+    }
+    if len(v) != 4 || strings.Trim( v, "0123456789" ) != "" {
+        return "", fmt.Errorf( "ExifVersionString: invalid Exif version (%s)\n", v )
+    }
+    major := strings.TrimLeft( v[:2], "0" )
+    if major == "" {
+        major = "0"
+    }
+    return major + "." + v[2:], nil
+}
+
+// cumulativeWriter is also the formatting context given to all formatters,
+// which retrieve the indentation unit and line width from their writer.
 type cumulativeWriter struct {
     w       io.Writer
     count   int
     err     error
+    indent  string          // indentation unit
+    width   int             // maximum line width for lists of values
+    vocabulary Vocabulary   // text for enumerated values, if not nil
+    codes   bool            // print enumerated value codes
+    dump    dumpFormat      // how raw data is dumped
 }
-func newCumulativeWriter( w io.Writer ) *cumulativeWriter {
+func newCumulativeWriter( w io.Writer, d *Desc ) *cumulativeWriter {
     cw := new( cumulativeWriter )
     cw.w = w
+    cw.indent = d.Indent
+    cw.width = d.Width
+    cw.vocabulary = d.Vocabulary
+    cw.codes = d.Codes
+    cw.dump = dumpFormat{ row: d.DumpRow, ascii: ! d.DumpNoASCII,
+                          threshold: d.DumpThreshold, max: d.MaxDump }
+    if d.DumpOffsets {
+        cw.dump.data, cw.dump.base = d.data, d.base
+    }
+    if cw.dump.row <= 0 {
+        cw.dump.row = _defaultDumpRow
+    }
+    if cw.dump.threshold <= 0 {
+        cw.dump.threshold = _defaultDumpThreshold
+    }
     return cw
 }
+
+const _defaultIndent = "  "
+
+// getIndentUnit returns the indentation unit of the formatting context w
+func getIndentUnit( w io.Writer ) string {
+    if cw, ok := w.(*cumulativeWriter); ok && cw.indent != "" {
+        return cw.indent
+    }
+    return _defaultIndent
+}
+
+// getFormatWidth returns the line width of the formatting context w, or 0 if
+// lines should not be wrapped.
+func getFormatWidth( w io.Writer ) int {
+    if cw, ok := w.(*cumulativeWriter); ok {
+        return cw.width
+    }
+    return 0
+}
+
+// getDumpFormat returns how raw data is dumped in the formatting context w
+func getDumpFormat( w io.Writer ) *dumpFormat {
+    if cw, ok := w.(*cumulativeWriter); ok {
+        return &cw.dump
+    }
+    return &defaultDumpFormat
+}
+
 func (cw *cumulativeWriter)format( f string, a ...interface{} ) {
     if cw.err != nil {
         return
@@ -979,12 +1821,12 @@ func (d *Desc)Format( w io.Writer) (n int, err error) {
     if w == nil {
         w = os.Stdout
     }
-    cw := newCumulativeWriter( w )
+    cw := newCumulativeWriter( w, d )
     cw.format( "------ Picture Metadata:\n\n" )
-    for id:= PRIMARY; id < _IFD_N; id++ {
-        ifd := d.ifds[id]
+    for id:= PRIMARY; id < d.ifdCount(); id++ {
+        ifd := d.getIfd( id )
         if ifd != nil {
-            cw.format( "--- %s IFD (id %d)\n", ifdNames[id], id )
+            cw.format( "--- %s IFD (id %d)\n", d.IfdName(id), id )
             ifd.format( cw )
         }
     }
@@ -996,7 +1838,8 @@ func (d *Desc)Format( w io.Writer) (n int, err error) {
 // Format IFDs.
 // The argument w is the io.Writer to use (e.g. os.File). If w is nil, os.Stdout
 // is used instead. The IFDs to format are given by their IDs in the slice argument
-// ifdIds. Possible ID values are: PRIMARY, THUMBNAIL, EXIF, GPS, IOP, MAKER & EMBEDDED
+// ifdIds. Possible ID values are: PRIMARY, THUMBNAIL, EXIF, GPS, IOP, MAKER and the
+// ids returned by EmbeddedIfds
 //
 // it returns a non-nil error if one ifd in the slice is not in the range of valid
 // IFD IDs. In an IFD is not present in the metadata it silently skips it, unless
@@ -1005,20 +1848,20 @@ func (d *Desc)FormatIfds( w io.Writer, ifdIds []IfdId ) (n int, err error) {
     if w == nil {
         w = os.Stdout
     }
-    cw := newCumulativeWriter( w )
+    cw := newCumulativeWriter( w, d )
     cw.format( "Picture Metadata:\n\n" )
     for _, id := range ifdIds {
-        if id >= _IFD_N {
+        if id >= d.ifdCount() {
             cw.setError( fmt.Errorf( "FormatIfds: id %d is not valid for an ifd\n", id ) )
             break
         }
-        ifd := d.ifds[id]
+        ifd := d.getIfd( id )
         if ifd != nil {
-            cw.format( "--- %s IFD (id %d)\n", ifdNames[id], id )
+            cw.format( "--- %s IFD (id %d)\n", d.IfdName(id), id )
             ifd.format( cw )
         } else {
             if d.Warn {
-                fmt.Printf( "--- %s IFD (id %d) is absent\n", ifdNames[id], id )
+                d.logf( LogWarning, "--- %s IFD (id %d) is absent\n", d.IfdName(id), id )
             }
         }
     }
@@ -1026,6 +1869,56 @@ func (d *Desc)FormatIfds( w io.Writer, ifdIds []IfdId ) (n int, err error) {
     return
 }
 
+// EntryInfo describes how a tag entry was stored in the original input data.
+// Offsets are given from the beginning of the input (file or data given to
+// Parse). They are -1 if the entry was not parsed but created or modified
+// by an update. ValueOffset is the offset of the value itself, which is the
+// offset of the entry value/offset field if the value fits in 4 bytes.
+type EntryInfo struct {
+    Tag         uint16
+    Type        uint16      // original TIFF type
+    TypeName    string
+    Count       uint32      // original count
+    Offset      int64       // entry offset
+    ValueOffset int64       // value offset
+}
+
+// GetIfdTagEntry returns the original entry information for the given tag in
+// the given ifd, or an error if the ifd or the tag is not present.
+func (d *Desc)GetIfdTagEntry( id IfdId, tag int ) (ei EntryInfo, err error) {
+    if id >= d.ifdCount() {
+        err = fmt.Errorf( "GetIfdTagEntry: id %d is not valid for an ifd\n", id )
+        return
+    }
+    ifd := d.getIfd( id )
+    if ifd == nil {
+        err = fmt.Errorf( "GetIfdTagEntry: %s %w\n", d.IfdName(id), ErrIfdNotPresent )
+        return
+    }
+    if  tag < 0 || tag > 0xffff {
+        err = fmt.Errorf( "GetIfdTagEntry: tag %d is out of range\n", tag )
+        return
+    }
+    for _, v := range ifd.values {
+        if v == nil || v.getTag() != tTag(tag) {
+            continue
+        }
+        ei.Tag = uint16(tag)
+        ei.Offset, ei.ValueOffset = -1, -1
+        src := v.getSource()
+        ei.Type, ei.Count = uint16(src.vType), src.vCount
+        if src.entry != 0 {
+            ei.Offset = int64(ifd.desc.base) + int64(src.entry)
+            ei.ValueOffset = int64(ifd.desc.base) + int64(src.value)
+        }
+        ei.TypeName = getTiffTString( tType(ei.Type) )
+        return
+    }
+    err = fmt.Errorf( "GetIfdTagEntry: tag %#04x is not present in %s\n",
+                      tag, d.IfdName(id) )
+    return
+}
+
 type SliceType uint8
 const (
     NoValue SliceType = iota    // Not a slice value
@@ -1033,25 +1926,31 @@ const (
     U8Slice                     // slice of uint8
     U16Slice                    // slice of uint16
     U32Slice                    // slice of uint32
-    URationalSlice              // slice of UnsignedRational
+    URationalSlice              // slice of Rational
 
     S8Slice                     // slice of int8
     S16Slice                    // slice of int16
     S32Slice                    // slice of int32
-    SRationalSlice              // slice of SignedRational
+    SRationalSlice              // slice of SRational
+
+    F32Slice                    // slice of float32
+    F64Slice                    // slice of float64
+
+    StringSlice                 // slice of strings, from an ASCII value made
+                                // of several NUL terminated strings
 )
 
 func (d *Desc)GetIfdTagValue( id IfdId,
                               tag int ) ( SliceType, interface{}, error) {
 // TODO
-    if id >= _IFD_N {
+    if id >= d.ifdCount() {
         return NoValue, nil,
             fmt.Errorf( "GetIfdTagValue: id %d is not valid for an ifd\n", id )
     }
-    ifd := d.ifds[id]
+    ifd := d.getIfd( id )
     if ifd == nil {
         return NoValue, nil,
-            fmt.Errorf( "GetIfdTagValue: id %d is absent\n", id )
+            fmt.Errorf( "GetIfdTagValue: %s %w\n", d.IfdName(id), ErrIfdNotPresent )
     }
     if  tag < 0 || tag > 0xffff {
         return NoValue, nil,
@@ -1064,8 +1963,14 @@ func (d *Desc)GetIfdTagValue( id IfdId,
                 switch v := v.(type) {
                 case * unsignedByteValue:
                     if v.s {
+                        if strs := splitAsciiStrings( v.v ); len(strs) > 1 {
+                            return StringSlice, strs, nil
+                        }
                         return String, string(v.v), nil
                     }
+                    if v.u {
+                        return String, decodeXPString( v.v ), nil
+                    }
                     return U8Slice, v.v, nil
                 case * signedByteValue:
                     return S8Slice, v.v, nil
@@ -1081,6 +1986,10 @@ func (d *Desc)GetIfdTagValue( id IfdId,
                     return URationalSlice, v.v, nil
                 case * signedRationalValue:
                     return SRationalSlice, v.v, nil
+                case * floatValue:
+                    return F32Slice, v.v, nil
+                case * doubleValue:
+                    return F64Slice, v.v, nil
                 default:
                     break
                 }
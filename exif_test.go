@@ -0,0 +1,192 @@
+package exif
+
+import (
+    "encoding/binary"
+    "testing"
+)
+
+// testMakerNoteTiff returns TIFF data with the maker note note in the Exif
+// IFD, after the Make make in IFD0.
+func testMakerNoteTiff( e binary.ByteOrder, make string, note []byte ) []byte {
+    ifd0 := []testEntry{
+        { _Make, uint16(_ASCIIString), uint32(len(make) + 1), testString( make ) },
+    }
+    exif := []testEntry{
+        { _MakerNote, uint16(_Undefined), uint32(len(note)), note },
+    }
+    return testTiff( e, ifd0, exif )
+}
+
+func TestNewMakerDesc( t *testing.T ) {
+    //            pad         signature   BOM         count
+    data := []byte( "\x00\x00\x00\x00" + "sig\x00" + "MM" + "\x00\x00" + "\x00\x00" )
+    d := newDesc( data, &Control{ } )
+    d.endian = binary.LittleEndian
+    ifd := &ifdd{ id: EXIF, desc: d }
+
+    mknd, err := ifd.newMakerDesc( 4, 10, 8, 4 )
+    if err != nil {
+        t.Fatalf( "newMakerDesc: %v", err )
+    }
+    if len(mknd.data) != 10 || mknd.data[0] != 's' {
+        t.Errorf( "maker note data %q does not start at the note", mknd.data )
+    }
+    if mknd.endian != binary.BigEndian {
+        t.Errorf( "maker note byte order %v", mknd.endian )
+    }
+    if mknd.stats != d.stats || mknd.ns != d.ns {
+        t.Errorf( "maker note does not share its parent statistics" )
+    }
+
+    for _, c := range []struct {
+        name                            string
+        offset, size, origin, endian    uint32
+    } {
+        { "out of bounds", 4, 20, 8, 4 },
+        { "no entry count", 4, 9, 8, 4 },
+        { "no byte order", 4, 5, 0, 4 },
+        { "invalid byte order", 4, 10, 8, 0 },
+        { "offset out of bounds", 100, 2, 0, 0 },
+    } {
+        if _, err := ifd.newMakerDesc( c.offset, c.size, c.origin,
+                                       c.endian ); err == nil {
+            t.Errorf( "%s: maker note accepted", c.name )
+        }
+    }
+}
+
+func TestMakerNoteTooShort( t *testing.T ) {
+    e := binary.BigEndian
+    for _, c := range []struct {
+        make    string
+        note    string
+    } {
+        { "Apple", _APPLE_MAKER_SIGNATURE + "\x00\x01" },
+        { "Apple", _APPLE_MAKER_SIGNATURE + "\x00\x01MM" },
+        { "Nikon", _NIKON_MAKER_SIGNATURE_3 + "MM" },
+        { "Nikon", _NIKON_MAKER_SIGNATURE_3 + "MM\x00\x2a" },
+    } {
+        data := append( []byte( "Exif\x00\x00" ),
+                        testMakerNoteTiff( e, c.make, []byte( c.note ) )... )
+        if _, err := Parse( data, 0, uint(len(data)), &Control{ } ); err == nil {
+            t.Errorf( "%s maker note %q accepted", c.make, c.note )
+        }
+    }
+}
+
+func TestMakerNoteOutOfBounds( t *testing.T ) {
+    e := binary.LittleEndian
+    note := []byte( _APPLE_MAKER_SIGNATURE + "\x00\x01MM\x00\x00" )
+    tiff := testMakerNoteTiff( e, "Apple", note )
+    // make the maker note count exceed the data: the MakerNote entry is the
+    // only entry of the Exif IFD, which is the last IFD in tiff
+    exifOffset := binary.LittleEndian.Uint32( tiff[8+2+12+8:] )
+    binary.LittleEndian.PutUint32( tiff[exifOffset+2+4:], uint32(len(tiff)) )
+
+    data := append( []byte( "Exif\x00\x00" ), tiff... )
+    d, err := Parse( data, 0, uint(len(data)), &Control{ } )
+    if err != nil {         // the entry is dropped, as any undecodable entry
+        t.Fatalf( "Parse: %v", err )
+    }
+    if d.stats.MakerNote != "" || d.ifds[MAKER] != nil {
+        t.Errorf( "maker note out of bounds parsed" )
+    }
+}
+
+func TestMakerNoteFixtures( t *testing.T ) {
+    for _, c := range []struct {
+        path, maker string
+    } {
+        { "testdata/apple.tif", "Apple" },
+        { "testdata/nikon.tif", "Nikon" },
+    } {
+        d, err := Read( c.path, 0, &Control{ } )
+        if err != nil {
+            t.Errorf( "%s: %v", c.path, err )
+            continue
+        }
+        if d.stats.MakerNote != c.maker || d.ifds[MAKER] == nil {
+            t.Errorf( "%s: maker note %q not parsed", c.path, d.stats.MakerNote )
+            continue
+        }
+        var entries int
+        for _, v := range d.ifds[MAKER].values {
+            if v != nil {
+                entries ++
+            }
+        }
+        if entries == 0 {
+            t.Errorf( "%s: empty maker note", c.path )
+        }
+    }
+}
+
+// testReplaceThumbnail replaces the thumbnail value in ifd with data
+func testReplaceThumbnail( t *testing.T, ifd *ifdd, data []byte ) {
+    t.Helper( )
+    for _, v := range ifd.values {
+        if tbn, ok := v.(*thumbnailValue); ok {
+            tbn.v = data
+            return
+        }
+    }
+    t.Fatalf( "no thumbnail in %s", ifd.desc.IfdName( ifd.id ) )
+}
+
+func TestNikonPreviewThumbnail( t *testing.T ) {
+    d, err := Read( "testdata/nikon-preview.tif", 0, &Control{ } )
+    if err != nil {
+        t.Fatalf( "Read: %v", err )
+    }
+    id, ok := d.EmbeddedIfdId( "NikonPreview" )
+    if ! ok {
+        t.Fatalf( "no Nikon preview IFD" )
+    }
+    for _, from := range []IfdId{ EMBEDDED, id, MAKER } {
+        data, err := d.GetThumbnailData( from )
+        if err != nil {
+            t.Errorf( "GetThumbnailData( %d ): %v", from, err )
+        } else if ! isJpeg( data, 0 ) {
+            t.Errorf( "GetThumbnailData( %d ): not a JPEG image", from )
+        }
+    }
+
+    // the thumbnail is read from its current value
+    testReplaceThumbnail( t, d.getIfd( id ), []byte( "new preview" ) )
+    if data, err := d.GetThumbnailData( EMBEDDED );
+       err != nil || string(data) != "new preview" {
+        t.Errorf( "updated preview: %q (%v)", data, err )
+    }
+    if err = d.Remove( id, -1 ); err != nil {
+        t.Fatalf( "Remove: %v", err )
+    }
+    if _, err := d.GetThumbnailData( EMBEDDED ); err == nil {
+        t.Errorf( "removed preview returned" )
+    }
+}
+
+func TestThumbnailCurrentValue( t *testing.T ) {
+    d, err := Read( "testdata/tiff.tif", 0, &Control{ } )
+    if err != nil {
+        t.Fatalf( "Read: %v", err )
+    }
+    if data, err := d.GetThumbnailData( PRIMARY ); err != nil || ! isJpeg( data, 0 ) {
+        t.Fatalf( "GetThumbnailData: %v", err )
+    }
+    testReplaceThumbnail( t, d.ifds[THUMBNAIL], []byte( "new thumbnail" ) )
+    for _, from := range []IfdId{ PRIMARY, THUMBNAIL, EXIF } {
+        if data, err := d.GetThumbnailData( from );
+           err != nil || string(data) != "new thumbnail" {
+            t.Errorf( "GetThumbnailData( %d ): %q (%v)", from, data, err )
+        }
+    }
+    if p := d.GetPreviews( ); len(p) != 1 || p[0].Size != 13 {
+        t.Errorf( "GetPreviews: %+v", p )
+    }
+    if err = d.Remove( THUMBNAIL, -1 ); err != nil {
+        t.Fatalf( "Remove: %v", err )
+    }
+    if _, err := d.GetThumbnailData( PRIMARY ); err == nil {
+        t.Errorf( "removed thumbnail returned" )
+    }
+}
@@ -0,0 +1,241 @@
+package exif
+
+// golden file tests: Format and JSON output of the fixture corpus
+
+import (
+    "bytes"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io/ioutil"
+    "math"
+    "os/exec"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+/*
+    Each file in testdata (*.jpg, *.tif) is read and rendered with Format and
+    as JSON (the TemplateData given to FormatTemplate: Summary and the text of
+    each tag value). Both renderings are compared with the versioned golden
+    files testdata/golden/<file>.txt and testdata/golden/<file>.json.
+
+    After an intended output change, regenerate the golden files with:
+
+        go test -run Golden -update
+
+    and review the golden file diff before committing it.
+
+    With -exiftool, each fixture is also decoded by a locally installed
+    exiftool, and the values of the TIFF, Exif and GPS tags are compared with
+    the values decoded by exiftool, in order to catch interpretation errors in
+    the store functions. The test is skipped if exiftool is not installed.
+
+        go test -run ExifTool -exiftool
+*/
+
+var updateGolden = flag.Bool( "update", false, "update golden files" )
+var useExifTool = flag.Bool( "exiftool", false, "compare with exiftool output" )
+
+// fixtures returns the fixture corpus in testdata
+func fixtures( t *testing.T ) []string {
+    var files []string
+    for _, pattern := range []string{ "*.jpg", "*.tif" } {
+        f, err := filepath.Glob( filepath.Join( "testdata", pattern ) )
+        if err != nil {
+            t.Fatal( err )
+        }
+        files = append( files, f... )
+    }
+    if len(files) == 0 {
+        t.Fatal( "no fixture in testdata" )
+    }
+    return files
+}
+
+// renderFormat returns the Format output for d
+func renderFormat( t *testing.T, d *Desc ) []byte {
+    var b bytes.Buffer
+    if _, err := d.Format( &b ); err != nil {
+        t.Fatalf( "Format: %v", err )
+    }
+    return b.Bytes( )
+}
+
+// renderJSON returns the JSON rendering of the template data for d
+func renderJSON( t *testing.T, d *Desc ) []byte {
+    b, err := json.MarshalIndent( d.getTemplateData( ), "", "  " )
+    if err != nil {
+        t.Fatalf( "json: %v", err )
+    }
+    return append( b, '\n' )
+}
+
+// compareGolden compares got with the golden file path, or updates it
+func compareGolden( t *testing.T, path string, got []byte ) {
+    if *updateGolden {
+        if err := ioutil.WriteFile( path, got, 0644 ); err != nil {
+            t.Fatal( err )
+        }
+        return
+    }
+    want, err := ioutil.ReadFile( path )
+    if err != nil {
+        t.Fatalf( "%v (run go test -update to create it)", err )
+    }
+    if ! bytes.Equal( got, want ) {
+        t.Errorf( "output differs from %s:\n%s", path, lineDiff( want, got ) )
+    }
+}
+
+// lineDiff returns the first lines that differ between want and got
+func lineDiff( want, got []byte ) string {
+    wl := strings.Split( string(want), "\n" )
+    gl := strings.Split( string(got), "\n" )
+    var b strings.Builder
+    n := 0
+    for i := 0; i < len(wl) || i < len(gl); i++ {
+        var w, g string
+        if i < len(wl) { w = wl[i] }
+        if i < len(gl) { g = gl[i] }
+        if w != g {
+            fmt.Fprintf( &b, "line %d:\n  want: %q\n  got:  %q\n", i+1, w, g )
+            if n++; n == 5 {
+                break
+            }
+        }
+    }
+    return b.String( )
+}
+
+func TestGolden( t *testing.T ) {
+    loc := time.Local                   // dates without offset are local
+    time.Local = time.UTC
+    defer func( ) { time.Local = loc }( )
+
+    for _, path := range fixtures( t ) {
+        path := path
+        t.Run( filepath.Base( path ), func( t *testing.T ) {
+            d, err := Read( path, 0, &Control{ } )
+            if err != nil {
+                t.Fatalf( "Read: %v", err )
+            }
+            golden := filepath.Join( "testdata", "golden", filepath.Base( path ) )
+            compareGolden( t, golden + ".txt", renderFormat( t, d ) )
+            compareGolden( t, golden + ".json", renderJSON( t, d ) )
+        } )
+    }
+}
+
+// exifToolGroups gives the exiftool group name of each standard IFD
+var exifToolGroups = map[IfdId]string{
+    PRIMARY: "IFD0", THUMBNAIL: "IFD1", EXIF: "ExifIFD", GPS: "GPS",
+    IOP: "InteropIFD",
+}
+
+// exifToolValue returns the value of tag in the ifd, as exiftool would print
+// it with option -n, and false if the value cannot be compared.
+func exifToolValue( ifd *ifdd, v serializer ) (interface{}, bool) {
+    switch v := v.(type) {
+    case *unsignedByteValue:
+        if v.s {
+            s, _ := ifd.getAsciiString( v.getTag( ) )
+            return strings.TrimSpace( s ), true
+        }
+    case *unsignedShortValue:
+        if len(v.v) == 1 {
+            return float64(v.v[0]), true
+        }
+    case *unsignedLongValue:
+        if len(v.v) == 1 {
+            return float64(v.v[0]), true
+        }
+    case *unsignedRationalValue:
+        if len(v.v) == 1 && v.v[0].IsValid( ) {
+            return v.v[0].Float( ), true
+        }
+    case *signedRationalValue:
+        if len(v.v) == 1 && v.v[0].IsValid( ) {
+            return v.v[0].Float( ), true
+        }
+    }
+    return nil, false
+}
+
+// sameExifToolValue compares our value with the exiftool value
+func sameExifToolValue( ours, theirs interface{} ) bool {
+    switch o := ours.(type) {
+    case string:
+        return o == strings.TrimSpace( fmt.Sprint( theirs ) )
+    case float64:
+        var f float64
+        switch t := theirs.(type) {
+        case float64:
+            f = t
+        case string:
+            var err error
+            if f, err = strconv.ParseFloat( t, 64 ); err != nil {
+                return false
+            }
+        default:
+            return false
+        }
+        return math.Abs( o - f ) <= 1e-4 * math.Max( 1, math.Abs( o ) )
+    }
+    return false
+}
+
+func TestExifTool( t *testing.T ) {
+    if ! *useExifTool {
+        t.Skip( "use -exiftool to compare with exiftool" )
+    }
+    exifTool, err := exec.LookPath( "exiftool" )
+    if err != nil {
+        t.Skip( "exiftool is not installed" )
+    }
+    for _, path := range fixtures( t ) {
+        path := path
+        t.Run( filepath.Base( path ), func( t *testing.T ) {
+            out, err := exec.Command( exifTool, "-j", "-n", "-G1",
+                                      path ).Output( )
+            if err != nil {
+                t.Fatalf( "exiftool: %v", err )
+            }
+            var tool []map[string]interface{}
+            if err = json.Unmarshal( out, &tool ); err != nil || len(tool) != 1 {
+                t.Fatalf( "exiftool output: %v", err )
+            }
+            d, err := Read( path, 0, &Control{ } )
+            if err != nil {
+                t.Fatalf( "Read: %v", err )
+            }
+            for id, group := range exifToolGroups {
+                ifd := d.ifds[id]
+                if ifd == nil {
+                    continue
+                }
+                for _, v := range ifd.values {
+                    if v == nil {
+                        continue
+                    }
+                    name, ok := d.getTagName( id, v.getTag( ) )
+                    if ! ok {
+                        continue
+                    }
+                    theirs, ok := tool[0][group + ":" + name]
+                    if ! ok {
+                        continue            // exiftool name differs
+                    }
+                    if ours, ok := exifToolValue( ifd, v ); ok &&
+                       ! sameExifToolValue( ours, theirs ) {
+                        t.Errorf( "%s:%s: %v, exiftool %v",
+                                  group, name, ours, theirs )
+                    }
+                }
+            }
+        } )
+    }
+}
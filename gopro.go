@@ -0,0 +1,146 @@
+package exif
+
+// support for GoPro Maker notes
+
+import (
+    "fmt"
+    "encoding/binary"
+    "io"
+    "math"
+    "strings"
+)
+
+/*
+    GoPro maker notes do not have any signature. They are recognized by the
+    camera make, "GoPro", and contain GPMF (GoPro Metadata Format) data, which
+    is a sequence of KLV (Key Length Value) items, always in big endian:
+
+      <key>                     4 ASCII characters (e.g. "DEVC")
+      <type>                    1 byte, 0 for nested KLV items
+      <size>                    1 byte, size of one sample
+      <repeat>                  2 bytes, number of samples
+      <data>                    size * repeat bytes, padded to 4 bytes
+
+    The maker note is kept as is and only decoded for display.
+*/
+
+const (
+    _GPMF_HEADER_SIZE = 8
+)
+
+// getGPMFDataSize returns the padded size of the data following the KLV
+// header at offset, or false if the header is not valid.
+func getGPMFDataSize( data []byte, offset int ) (int, bool) {
+    if offset + _GPMF_HEADER_SIZE > len(data) {
+        return 0, false
+    }
+    for _, c := range data[offset:offset+4] {
+        if ! ( (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') ||
+               (c >= '0' && c <= '9') ) {
+            return 0, false
+        }
+    }
+    size := int(data[offset+5]) *
+            int(binary.BigEndian.Uint16( data[offset+6:offset+8] ))
+    size = (size + 3) &^ 3
+    if offset + _GPMF_HEADER_SIZE + size > len(data) {
+        return 0, false
+    }
+    return size, true
+}
+
+func isGPMF( data []byte ) bool {
+    _, ok := getGPMFDataSize( data, 0 )
+    return ok
+}
+
+func getGPMFTypeSize( t byte ) int {
+    switch t {
+    case 'b', 'B', 'c':             return 1
+    case 's', 'S':                  return 2
+    case 'f', 'l', 'L', 'q', 'F':   return 4
+    case 'd', 'j', 'J', 'Q':        return 8
+    }
+    return 0
+}
+
+// formatGPMFSample prints one sample of the given type, or returns false if
+// the type cannot be printed.
+func formatGPMFSample( w io.Writer, t byte, b []byte ) bool {
+    be := binary.BigEndian
+    switch t {
+    case 'b': fmt.Fprintf( w, " %d", int8(b[0]) )
+    case 'B': fmt.Fprintf( w, " %d", b[0] )
+    case 's': fmt.Fprintf( w, " %d", int16(be.Uint16( b )) )
+    case 'S': fmt.Fprintf( w, " %d", be.Uint16( b ) )
+    case 'l': fmt.Fprintf( w, " %d", int32(be.Uint32( b )) )
+    case 'L': fmt.Fprintf( w, " %d", be.Uint32( b ) )
+    case 'j': fmt.Fprintf( w, " %d", int64(be.Uint64( b )) )
+    case 'J': fmt.Fprintf( w, " %d", be.Uint64( b ) )
+    case 'f': fmt.Fprintf( w, " %g", math.Float32frombits( be.Uint32( b ) ) )
+    case 'd': fmt.Fprintf( w, " %g", math.Float64frombits( be.Uint64( b ) ) )
+    case 'q': fmt.Fprintf( w, " %g", float64(int32(be.Uint32( b ))) / 65536 )
+    case 'Q': fmt.Fprintf( w, " %g", float64(int64(be.Uint64( b ))) / 4294967296 )
+    case 'F': fmt.Fprintf( w, " %s", string( b[:4] ) )
+    default:  return false
+    }
+    return true
+}
+
+const _GPMF_MAX_SAMPLES = 8     // display limit for each KLV item
+
+func formatGPMF( w io.Writer, data []byte, indent string ) {
+    for offset := 0; offset < len(data); {
+        size, ok := getGPMFDataSize( data, offset )
+        if ! ok {
+            break
+        }
+        key := string( data[offset:offset+4] )
+        t := data[offset+4]
+        sSize := int(data[offset+5])
+        repeat := int(binary.BigEndian.Uint16( data[offset+6:offset+8] ))
+        value := data[offset+_GPMF_HEADER_SIZE:offset+_GPMF_HEADER_SIZE+sSize*repeat]
+        offset += _GPMF_HEADER_SIZE + size
+
+        fmt.Fprintf( w, "\n%s%s:", indent, key )
+        switch t {
+        case 0:
+            formatGPMF( w, value, indent + getIndentUnit( w ) )
+            continue
+        case 'c', 'U':
+            fmt.Fprintf( w, " %s", strings.TrimRight( string( value ), "\x00 " ) )
+            continue
+        }
+        tSize := getGPMFTypeSize( t )
+        if tSize == 0 || sSize < tSize {
+            fmt.Fprintf( w, " type '%c', %d bytes", t, len(value) )
+            continue
+        }
+        n := len(value) / tSize
+        for i := 0; i < n && i < _GPMF_MAX_SAMPLES; i++ {
+            formatGPMFSample( w, t, value[i*tSize:] )
+        }
+        if n > _GPMF_MAX_SAMPLES {
+            fmt.Fprintf( w, " ... (%d values)", n )
+        }
+    }
+}
+
+func (ifd *ifdd) processGoProMakerNote( offset uint32 ) error {
+    fgpmf := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        io.WriteString( w, "GPMF data" )
+        formatGPMF( w, v.([]uint8), indent )
+    }
+    ifd.storeValue( ifd.newUnsignedByteValue( "GoPro Maker Note", fgpmf,
+                            ifd.desc.getUnsignedBytes( offset, ifd.fCount ) ) )
+    return nil
+}
+
+func tryGoProMakerNote( ifd *ifdd, offset uint32 ) ( func( uint32 ) error ) {
+    if strings.HasPrefix( ifd.desc.global.make, "GoPro" ) &&
+       isGPMF( ifd.desc.getUnsignedBytes( offset, ifd.fCount ) ) {
+//        fmt.Printf("    MakerNote: GoPro\n" )
+        return ifd.processGoProMakerNote
+    }
+    return nil
+}
@@ -0,0 +1,276 @@
+package exif
+
+// support for writing GPS coordinates and reading GPS speeds and bearings
+
+import (
+    "fmt"
+    "math"
+)
+
+/*
+    GPS latitude and longitude are stored as 3 unsigned rationals: degrees,
+    minutes and seconds, with the hemisphere given by a separate reference tag
+    ("N" or "S", "E" or "W"). Converting decimal degrees to rationals loses
+    precision, depending on which of the 3 rationals carries the fractional
+    part and on its denominator:
+
+      precision           rationals                    max error    at equator
+      GPSCentiSeconds     d/1 m/1 s*100/100            0.005"       ~15 cm
+      GPSMilliSeconds     d/1 m/1 s*1000/1000          0.0005"      ~1.5 cm
+      GPSDecimalMinutes   d/1 m*10000/10000 0/1        0.00005'     ~9 cm
+      GPSDecimalDegrees   d*10000000/10000000 0/1 0/1  0.00000005°  ~6 mm
+
+    Reading back a coordinate written by SetLocation therefore gives a value
+    that differs from the original by up to the maximum error, and coordinates
+    should be compared with a tolerance, as done by SameLocation.
+
+    GPS speeds and bearings are also qualified by a reference tag: GPSSpeedRef
+    gives the speed unit ("K" for km/h, "M" for mph or "N" for knots), and
+    GPSTrackRef, GPSImgDirectionRef and GPSDestBearingRef give the north the
+    bearing refers to ("T" for true north or "M" for magnetic north). When a
+    reference tag is absent, the Exif default ("K" or "T") is assumed. Speeds
+    are returned in a unit chosen by the caller. Magnetic bearings depend on
+    the magnetic declination at the location and at the time of capture, which
+    is not part of the metadata: it must be given by the caller to convert them
+    to true north.
+*/
+
+// GPSPrecision selects how decimal degrees are converted to rationals
+type GPSPrecision uint8
+
+const (
+    GPSCentiSeconds GPSPrecision = iota // seconds in 1/100 (most cameras)
+    GPSMilliSeconds                     // seconds in 1/1000
+    GPSDecimalMinutes                   // minutes in 1/10000, no seconds
+    GPSDecimalDegrees                   // degrees in 1/10000000 only
+)
+
+// toRationals returns the rationals for the absolute value of c in degrees
+func (p GPSPrecision) toRationals( c float64 ) ([]UnsignedRational, error) {
+    // work on an integer number of units to avoid carrying 60 seconds or
+    // 60 minutes after rounding
+    units := func( scale float64 ) uint64 {
+        return uint64(math.Round( math.Abs( c ) * scale ))
+    }
+    r := make( []UnsignedRational, 3 )
+    switch p {
+    case GPSCentiSeconds, GPSMilliSeconds:
+        den := uint64(100)
+        if p == GPSMilliSeconds {
+            den = 1000
+        }
+        u := units( 3600 * float64(den) )
+        r[0] = UnsignedRational{ uint32(u / (3600 * den)), 1 }
+        r[1] = UnsignedRational{ uint32(u / (60 * den) % 60), 1 }
+        r[2] = UnsignedRational{ uint32(u % (60 * den)), uint32(den) }
+    case GPSDecimalMinutes:
+        const den = 10000
+        u := units( 60 * den )
+        r[0] = UnsignedRational{ uint32(u / (60 * den)), 1 }
+        r[1] = UnsignedRational{ uint32(u % (60 * den)), den }
+        r[2] = UnsignedRational{ 0, 1 }
+    case GPSDecimalDegrees:
+        const den = 10000000
+        r[0] = UnsignedRational{ uint32(units( den )), den }
+        r[1] = UnsignedRational{ 0, 1 }
+        r[2] = UnsignedRational{ 0, 1 }
+    default:
+        return nil, fmt.Errorf( "invalid GPS precision (%d)\n", p )
+    }
+    return r, nil
+}
+
+// getGpsIfd returns the GPS IFD, creating it with a version ID 2.3.0.0 and
+// linking it to the primary IFD if it does not exist yet.
+func (d *Desc) getGpsIfd( ) (*ifdd, error) {
+    if gps := d.ifds[GPS]; gps != nil {
+        return gps, nil
+    }
+    primary := d.ifds[PRIMARY]
+    if primary == nil {
+        return nil, fmt.Errorf( "Primary %w\n", ErrIfdNotPresent )
+    }
+    gps := primary.newEmbeddedIfd( GPS, _GpsIFD )
+    gps.newEntry( _GPSVersionID, _UnsignedByte )
+    gps.setValue( gps.newUnsignedByteValue( "GPS Version ID", fmtGPSVersionID,
+                                            []byte{ 2, 3, 0, 0 } ) )
+    return gps, nil
+}
+
+// setGPSCoordinate sets the coordinate c in degrees and its reference, pos
+// if c is positive or neg otherwise.
+func (ifd *ifdd) setGPSCoordinate( tag tTag, name string, c float64,
+                                   ref tTag, pos, neg string,
+                                   p GPSPrecision ) error {
+    r, err := p.toRationals( c )
+    if err != nil {
+        return err
+    }
+    if c < 0 {
+        pos = neg
+    }
+    ifd.setAsciiString( ref, name + " Ref", pos )
+    ifd.newEntry( tag, _UnsignedRational )
+    ifd.setValue( ifd.newUnsignedRationalValue( name,
+                                                ifd.fmtGPSCoordinate( ref ), r ) )
+    return nil
+}
+
+// SetLocation sets the GPS latitude and longitude, given in decimal degrees
+// (negative in the southern hemisphere and west of Greenwich), with their
+// references. The GPS IFD is created if it is missing. The argument p selects
+// how degrees are converted to rationals, and therefore the precision of the
+// stored location: see GPSPrecision for the expected round-trip error.
+//
+// It returns a non-nil error if a coordinate is out of range, if p is not a
+// valid precision or if the primary IFD is not present.
+func (d *Desc) SetLocation( lat, lon float64, p GPSPrecision ) (err error) {
+    defer func ( ) {
+        if err != nil { err = fmt.Errorf( "SetLocation: %w", err ) }
+    }()
+    if math.IsNaN( lat ) || lat < -90 || lat > 90 {
+        return &ValidationError{ GPS, _GPSLatitude,
+                    fmt.Errorf( "latitude out of range (%g)\n", lat ) }
+    }
+    if math.IsNaN( lon ) || lon < -180 || lon > 180 {
+        return &ValidationError{ GPS, _GPSLongitude,
+                    fmt.Errorf( "longitude out of range (%g)\n", lon ) }
+    }
+    if p > GPSDecimalDegrees {
+        return fmt.Errorf( "invalid GPS precision (%d)\n", p )
+    }
+    gps, err := d.getGpsIfd( )
+    if err != nil {
+        return err
+    }
+    if err = gps.setGPSCoordinate( _GPSLatitude, "GPS Latitude", lat,
+                                   _GPSLatitudeRef, "N", "S", p ); err != nil {
+        return err
+    }
+    return gps.setGPSCoordinate( _GPSLongitude, "GPS Longitude", lon,
+                                 _GPSLongitudeRef, "E", "W", p )
+}
+
+const _earthRadius = 6371008.8      // mean earth radius in meters
+
+// LocationDistance returns the great circle distance in meters between two
+// locations given in decimal degrees.
+func LocationDistance( lat1, lon1, lat2, lon2 float64 ) float64 {
+    rad := func( deg float64 ) float64 { return deg * math.Pi / 180 }
+    dLat := rad( lat2 - lat1 )
+    dLon := rad( lon2 - lon1 )
+    h := math.Sin( dLat / 2 ) * math.Sin( dLat / 2 ) +
+         math.Cos( rad( lat1 ) ) * math.Cos( rad( lat2 ) ) *
+         math.Sin( dLon / 2 ) * math.Sin( dLon / 2 )
+    return 2 * _earthRadius * math.Asin( math.Sqrt( math.Min( h, 1 ) ) )
+}
+
+// SameLocation returns true if two locations given in decimal degrees are
+// within tolerance meters of each other. It is meant for comparing locations
+// after a round trip through rationals, for instance the location given to
+// SetLocation and the one returned by Summary.
+func SameLocation( lat1, lon1, lat2, lon2, tolerance float64 ) bool {
+    return LocationDistance( lat1, lon1, lat2, lon2 ) <= tolerance
+}
+
+// SpeedUnit selects the unit of the speed returned by GetGPSSpeed
+type SpeedUnit uint8
+
+const (
+    MetersPerSecond SpeedUnit = iota
+    KilometersPerHour
+)
+
+const (                             // speed unit conversions to m/s
+    _kmhToMps   = 1000.0 / 3600
+    _mphToMps   = 1609.344 / 3600
+    _knotToMps  = 1852.0 / 3600
+)
+
+// getGPSRational returns the first value of the GPS rational tag and its
+// reference, or false if tag is absent or its value is not valid.
+func (d *Desc) getGPSRational( tag, ref tTag ) (float64, string, bool) {
+    gps := d.ifds[GPS]
+    if gps == nil {
+        return 0, "", false
+    }
+    v, ok := gps.getValue( tag ).(*unsignedRationalValue)
+    if ! ok || len(v.v) == 0 || ! v.v[0].IsValid( ) {
+        return 0, "", false
+    }
+    return v.v[0].checkedFloat( ), gps.getGPSRef( ref ), true
+}
+
+// GetGPSSpeed returns the speed of the GPS receiver in the unit u, whatever
+// the unit it is stored in. It returns a non-nil error if there is no valid
+// GPS speed, if its unit is unknown or if u is not a valid unit.
+func (d *Desc) GetGPSSpeed( u SpeedUnit ) (float64, error) {
+    s, ref, ok := d.getGPSRational( _GPSSpeed, _GPSSpeedRef )
+    if ! ok {
+        return 0, fmt.Errorf( "GetGPSSpeed: no GPS speed\n" )
+    }
+    switch ref {
+    case "K", "": s *= _kmhToMps
+    case "M":     s *= _mphToMps
+    case "N":     s *= _knotToMps
+    default:
+        return 0, fmt.Errorf( "GetGPSSpeed: unknown speed unit %q\n", ref )
+    }
+    switch u {
+    case MetersPerSecond:
+        return s, nil
+    case KilometersPerHour:
+        return s / _kmhToMps, nil
+    }
+    return 0, fmt.Errorf( "GetGPSSpeed: invalid speed unit (%d)\n", u )
+}
+
+// GPSBearingKind selects one of the GPS bearings
+type GPSBearingKind uint8
+
+const (
+    GPSTrackBearing GPSBearingKind = iota   // direction of movement
+    GPSImageBearing                         // direction of the image
+    GPSDestinationBearing                   // bearing to the destination
+)
+
+var gpsBearings = [...]struct{
+    tag, ref    tTag
+    name        string
+}{
+    GPSTrackBearing:        { _GPSTrack, _GPSTrackRef, "track" },
+    GPSImageBearing:        { _GPSImgDirection, _GPSImgDirectionRef,
+                              "image direction" },
+    GPSDestinationBearing:  { _GPSDestBearing, _GPSDestBearingRef,
+                              "destination bearing" },
+}
+
+// GetGPSBearing returns the bearing of the given kind in degrees relative to
+// true north, from 0 to 360 excluded. If the bearing is given relative to
+// magnetic north, the magnetic declination at the location, in degrees
+// positive east of true north, is added to it; declination is ignored for
+// bearings relative to true north. It returns a non-nil error if the bearing
+// is absent or not valid, or if its reference is unknown.
+func (d *Desc) GetGPSBearing( k GPSBearingKind,
+                              declination float64 ) (float64, error) {
+    if int(k) >= len(gpsBearings) {
+        return 0, fmt.Errorf( "GetGPSBearing: invalid kind (%d)\n", k )
+    }
+    gb := gpsBearings[k]
+    b, ref, ok := d.getGPSRational( gb.tag, gb.ref )
+    if ! ok {
+        return 0, fmt.Errorf( "GetGPSBearing: no GPS %s\n", gb.name )
+    }
+    switch ref {
+    case "T", "":
+    case "M":
+        b += declination
+    default:
+        return 0, fmt.Errorf( "GetGPSBearing: unknown %s reference %q\n",
+                              gb.name, ref )
+    }
+    if b = math.Mod( b, 360 ); b < 0 {
+        b += 360
+    }
+    return b, nil
+}
@@ -0,0 +1,92 @@
+package exif
+
+import (
+    "encoding/binary"
+    "math"
+    "testing"
+)
+
+func TestSetLocationRoundTrip( t *testing.T ) {
+    carry := 10 + 59.0 / 60 + 59.9999999 / 3600     // 10°59'59.9999999"
+    locations := []struct {
+        lat, lon        float64
+        latRef, lonRef  string
+    } {
+        { 0, 0, "N", "E" },
+        { 48.8583701, 2.2944813, "N", "E" },
+        { -33.8567844, 151.2152967, "S", "E" },
+        { 40.6892494, -74.0445004, "N", "W" },
+        { -22.9519173, -43.2104942, "S", "W" },
+        { carry, -carry, "N", "W" },
+        { -carry, 179 + 59.0 / 60 + 59.9999999 / 3600, "S", "E" },
+        { 90, -180, "N", "W" },
+    }
+    for _, c := range []struct {
+        p       GPSPrecision
+        maxErr  float64             // degrees, as documented
+    } {
+        { GPSCentiSeconds, 0.005 / 3600 },
+        { GPSMilliSeconds, 0.0005 / 3600 },
+        { GPSDecimalMinutes, 0.00005 / 60 },
+        { GPSDecimalDegrees, 0.00000005 },
+    } {
+        // error at the equator, on both coordinates
+        tolerance := math.Sqrt2 * c.maxErr * math.Pi / 180 * _earthRadius
+        for _, l := range locations {
+            d := testParse( t, testTiff( binary.BigEndian, nil, nil ), &Control{ } )
+            if err := d.SetLocation( l.lat, l.lon, c.p ); err != nil {
+                t.Fatalf( "%d: SetLocation( %g, %g ): %v", c.p, l.lat, l.lon, err )
+            }
+            data, err := d.Bytes( )
+            if err != nil {
+                t.Fatalf( "%d: Bytes: %v", c.p, err )
+            }
+            r, err := Parse( data, 0, uint(len(data)), &Control{ } )
+            if err != nil {
+                t.Fatalf( "%d: Parse: %v", c.p, err )
+            }
+            gps := r.ifds[GPS]
+            latRef, _ := gps.getAsciiString( _GPSLatitudeRef )
+            lonRef, _ := gps.getAsciiString( _GPSLongitudeRef )
+            if latRef != l.latRef || lonRef != l.lonRef {
+                t.Errorf( "%d: %g, %g: references %s %s", c.p, l.lat, l.lon,
+                          latRef, lonRef )
+            }
+            for _, tag := range []tTag{ _GPSLatitude, _GPSLongitude } {
+                v := gps.getValue( tag ).(*unsignedRationalValue).v
+                if v[1].Numerator >= 60 * v[1].Denominator ||
+                   v[2].Numerator >= 60 * v[2].Denominator {
+                    t.Errorf( "%d: %g, %g: rationals %v not carried",
+                              c.p, l.lat, l.lon, v )
+                }
+            }
+            m := r.Summary( )
+            if math.Abs( m.Latitude - l.lat ) > c.maxErr ||
+               math.Abs( m.Longitude - l.lon ) > c.maxErr {
+                t.Errorf( "%d: %g, %g read back as %g, %g", c.p, l.lat, l.lon,
+                          m.Latitude, m.Longitude )
+            }
+            if ! SameLocation( l.lat, l.lon, m.Latitude, m.Longitude, tolerance ) {
+                t.Errorf( "%d: %g, %g is %g m away", c.p, l.lat, l.lon,
+                          LocationDistance( l.lat, l.lon, m.Latitude, m.Longitude ) )
+            }
+        }
+    }
+}
+
+func TestSetLocationInvalid( t *testing.T ) {
+    d := testParse( t, testTiff( binary.BigEndian, nil, nil ), &Control{ } )
+    for _, c := range []struct {
+        lat, lon    float64
+        p           GPSPrecision
+    } {
+        { 90.1, 0, GPSCentiSeconds },
+        { 0, -180.1, GPSCentiSeconds },
+        { math.NaN( ), 0, GPSCentiSeconds },
+        { 0, 0, GPSDecimalDegrees + 1 },
+    } {
+        if err := d.SetLocation( c.lat, c.lon, c.p ); err == nil {
+            t.Errorf( "%g, %g, %d accepted", c.lat, c.lon, c.p )
+        }
+    }
+}
@@ -0,0 +1,171 @@
+package exif
+
+// support for HDR gain map information
+
+import (
+    "bytes"
+    "strconv"
+)
+
+/*
+    HDR photos are made of a standard (SDR) primary image and of a gain map,
+    a secondary image giving, for each pixel, the gain to apply to the primary
+    image for display on HDR screens. In JPEG files, the gain map is appended
+    after the primary image and located by the Multi-Picture Format (MPF) APP2
+    segment, whose payload is:
+
+      "MPF\x00"                 MPF signature
+      TIFF header               byte order, 0x002a and offset to the MP Index
+                                IFD, which includes the tags:
+        0xb000 MPFVersion       4 _Undefined bytes
+        0xb001 NumberOfImages   1 _UnsignedLong
+        0xb002 MPEntry          16 _Undefined bytes per image: 4-byte image
+                                attribute, 4-byte size, 4-byte offset from the
+                                TIFF header (0 for the primary image) and two
+                                2-byte dependent image entries
+
+    A secondary image is a gain map if its XMP data uses the Adobe/Google gain
+    map namespace "hdrgm" (Ultra HDR), or declares an Apple HDR gain map
+    auxiliary image, or if it includes an ISO 21496-1 APP2 segment. The gain
+    map parameters GainMapMax and HDRCapacityMax, expressed as log2 values,
+    are taken from the hdrgm XMP properties when available.
+
+    Apple maker notes also give the HDR headroom (tag 0x0021) and gain (tag
+    0x0030) of the capture.
+*/
+
+// HDRInfo gives the HDR information found in the metadata and in the image
+type HDRInfo struct {
+    Headroom        float64 // Apple HDR headroom, 0 if not given
+    Gain            float64 // Apple HDR gain, 0 if not given
+
+    GainMap         bool    // true if a gain map image is present
+    GainMapOffset   uint    // gain map image offset in the file
+    GainMapSize     uint    // gain map image size
+    GainMapMax      float64 // log2 of the maximum gain, 0 if not given
+    HDRCapacityMax  float64 // log2 of the maximum HDR capacity, 0 if not given
+    ISO21496        bool    // true if the gain map follows ISO 21496-1
+}
+
+const (
+    _mpfSignature       = "MPF\x00"
+    _mpfEntry           = 0xb002
+    _mpfEntrySize       = 16
+    _iso21496Signature  = "urn:iso:std:iso:ts:21496:-1"
+)
+
+// mpfImage is the location of an image in the file, as given by MPF
+type mpfImage struct {
+    offset  uint
+    size    uint
+}
+
+// getJpegMpfImages returns the location of the secondary images listed in
+// the MPF APP2 segment of the JPEG data starting at start, or nil if there is
+// no valid MPF segment.
+func getJpegMpfImages( data []byte, start uint ) (images []mpfImage) {
+    segments, _ := getJpegSegments( data, start )
+    for _, s := range segments {
+        p := data[s.payload:s.end]
+        if s.marker != _APP2 || ! bytes.HasPrefix( p, []byte( _mpfSignature ) ) {
+            continue
+        }
+        base := s.payload + uint(len(_mpfSignature))   // TIFF header
+        tiff := data[base:s.end]
+        if len(tiff) < _headerSize {
+            return nil
+        }
+        endian, err := getEndianess( tiff )
+        if err != nil {
+            return nil
+        }
+        pr := prober{ data: tiff, endian: endian }
+        pr.entries( endian.Uint32( tiff[4:] ),
+            func( tag tTag, typ tType, count, vo uint32 ) {
+                if tag != _mpfEntry || typ != _Undefined || count <= _valOffSize {
+                    return
+                }
+                eo := uint64(endian.Uint32( tiff[vo:] ))
+                if eo + uint64(count) > uint64(len(tiff)) {
+                    return
+                }
+                entries := tiff[eo:eo+uint64(count)]
+                for i := _mpfEntrySize;                 // skip primary image
+                    i + _mpfEntrySize <= len(entries); i += _mpfEntrySize {
+                    size := uint(endian.Uint32( entries[i+4:] ))
+                    offset := uint(endian.Uint32( entries[i+8:] ))
+                    if offset == 0 || base + offset + size > uint(len(data)) {
+                        continue
+                    }
+                    images = append( images, mpfImage{ base + offset, size } )
+                }
+            } )
+        return
+    }
+    return nil
+}
+
+func getXmpFloat( xmp []byte, name string ) float64 {
+    if s, ok := getXmpValue( xmp, name ); ok {
+        if f, err := strconv.ParseFloat( s, 64 ); err == nil {
+            return f
+        }
+    }
+    return 0
+}
+
+// getJpegGainMap looks for a gain map among the secondary images of the JPEG
+// data starting at start, and returns its description or false if none is
+// found.
+func getJpegGainMap( data []byte, start uint ) (h HDRInfo, ok bool) {
+    for _, img := range getJpegMpfImages( data, start ) {
+        image := data[:img.offset+img.size]
+        if ! isJpeg( image, img.offset ) {
+            continue
+        }
+        segments, _ := getJpegSegments( image, img.offset )
+        for _, s := range segments {
+            if s.marker == _APP2 && bytes.HasPrefix( image[s.payload:s.end],
+                                                     []byte( _iso21496Signature ) ) {
+                h.ISO21496 = true
+            }
+        }
+        xmp := findJpegXmp( image, img.offset )
+        if bytes.Contains( xmp, []byte( "hdrgm:" ) ) {
+            h.GainMapMax = getXmpFloat( xmp, "hdrgm:GainMapMax" )
+            h.HDRCapacityMax = getXmpFloat( xmp, "hdrgm:HDRCapacityMax" )
+        } else if ! h.ISO21496 &&
+                  ! bytes.Contains( bytes.ToLower( xmp ), []byte( "hdrgainmap" ) ) {
+            continue
+        }
+        h.GainMap, h.GainMapOffset, h.GainMapSize = true, img.offset, img.size
+        return h, true
+    }
+    return
+}
+
+// getAppleHDRValue returns the value of an Apple maker note HDR tag, or 0
+func (d *Desc) getAppleHDRValue( tag tTag ) float64 {
+    if d.stats.MakerNote != "Apple" || d.ifds[MAKER] == nil {
+        return 0
+    }
+    if sr, ok := d.ifds[MAKER].getValue( tag ).(*signedRationalValue);
+       ok && len(sr.v) > 0 {
+        return sr.v[0].checkedFloat( )
+    }
+    return 0
+}
+
+// HDRInfo returns the HDR information available: the Apple HDR headroom and
+// gain from the maker note, and the gain map image location and parameters.
+// The gain map is only found if the metadata was read from a JPEG file by
+// Read, since it is located outside the exif metadata.
+//
+// It returns false if no HDR information is available.
+func (d *Desc)HDRInfo( ) (HDRInfo, bool) {
+    h, ok := d.global.gainMap, d.global.hasGainMap
+    h.Headroom = d.getAppleHDRValue( _AppleHDRHeadroom )
+    h.Gain = d.getAppleHDRValue( _AppleHDRGain )
+    return h, ok || h.Headroom != 0 || h.Gain != 0
+}
+
@@ -0,0 +1,361 @@
+package exif
+
+// support for locating EXIF metadata in JPEG files
+
+import (
+    "fmt"
+    "errors"
+    "io"
+    "bytes"
+)
+
+/*
+    JPEG file layout (only the part relevant to EXIF metadata):
+
+      0xFFD8                    SOI (Start Of Image) marker
+      { segment } * n           APP0 (JFIF), APP1 (Exif or XMP), APP2 (ICC,
+                                MPF), ... in any order, followed by tables,
+                                frame header and SOS (start of scan)
+
+    Each segment before SOS is:
+      0xFF <marker>             2-byte segment marker
+      <length>                  2-byte big endian length, including itself
+      <payload>                 (length - 2) bytes
+
+    The EXIF segment is an APP1 segment whose payload starts with the 6-byte
+    EXIF header "Exif\x00\x00". Its size is limited to 64KB by the 2-byte
+    segment length.
+
+    Each SOS segment is followed by entropy-coded data, in which 0xFF bytes
+    are followed by 0x00 (stuffing) or by a standalone RSTn marker. Any other
+    marker ends the scan: either another table or scan segment (progressive
+    JPEG), or the EOI marker 0xFFD9 that ends the image.
+
+    Some devices append extra data after EOI, such as a video in motion photos,
+    a second image or vendor specific data. This trailer is not part of the
+    image and is ignored by decoders, but it may carry personal information.
+*/
+
+const (
+    _SOI    = 0xd8              // Start Of Image
+    _EOI    = 0xd9              // End Of Image
+    _SOS    = 0xda              // Start Of Scan
+    _TEM    = 0x01              // TEMporary, standalone marker
+    _RST0   = 0xd0              // first ReSTart marker, standalone
+    _RST7   = 0xd7              // last ReSTart marker, standalone
+    _APP0   = 0xe0
+    _APP1   = 0xe1
+    _APP2   = 0xe2
+)
+
+// jpegSegment describes a segment found in a JPEG file
+type jpegSegment struct {
+    marker  byte            // segment marker (e.g. _APP1)
+    start   uint            // offset of 0xFF marker prefix in data
+    payload uint            // offset of the payload (after length)
+    end     uint            // offset immediately following the segment
+}
+
+// isJpeg returns true if data starts with a JPEG SOI marker at offset start
+func isJpeg( data []byte, start uint ) bool {
+    return uint(len(data)) >= start + 2 &&
+           data[start] == 0xff && data[start+1] == _SOI
+}
+
+// getJpegSegments walks the JPEG segments from the SOI marker at offset start
+// up to, but not including, the SOS segment. It returns the list of segments
+// found or an error if the segment structure is not valid.
+func getJpegSegments( data []byte, start uint ) ([]jpegSegment, error) {
+    if ! isJpeg( data, start ) {
+        return nil, fmt.Errorf( "getJpegSegments: missing SOI marker @%#08x\n", start )
+    }
+    return walkJpegSegments( data, start + 2 )
+}
+
+// walkJpegSegments walks the JPEG segments starting at offset, as described
+// in getJpegSegments.
+func walkJpegSegments( data []byte, offset uint ) ([]jpegSegment, error) {
+    dLen := uint(len(data))
+    segments := make( []jpegSegment, 0, 8 )
+    for {
+        if offset + 2 > dLen {
+            return segments, fmt.Errorf( "walkJpegSegments: truncated data @%#08x\n",
+                                         offset )
+        }
+        if data[offset] != 0xff {
+            return segments, fmt.Errorf( "walkJpegSegments: invalid marker @%#08x\n",
+                                         offset )
+        }
+        marker := data[offset+1]
+        switch {
+        case marker == 0xff:            // fill byte, skip it
+            offset ++
+            continue
+        case marker == _SOS || marker == _EOI:
+            return segments, nil        // no more metadata after this point
+        case marker == _TEM || (marker >= _RST0 && marker <= _RST7):
+            offset += 2                 // standalone marker without length
+            continue
+        }
+        if offset + 4 > dLen {
+            return segments, fmt.Errorf( "walkJpegSegments: truncated segment @%#08x\n",
+                                         offset )
+        }
+        sLen := uint(data[offset+2]) << 8 + uint(data[offset+3])
+        if sLen < 2 || offset + 2 + sLen > dLen {
+            return segments, fmt.Errorf(
+                "walkJpegSegments: invalid segment length %d @%#08x\n", sLen, offset )
+        }
+        segments = append( segments,
+                           jpegSegment{ marker, offset, offset+4, offset+2+sLen } )
+        offset += 2 + sLen
+    }
+}
+
+// findJpegExif looks up the EXIF APP1 segment in a JPEG file starting at the
+// offset start, with the SOI marker. It returns the offset of the EXIF header
+// in data and the size of the EXIF metadata, including the EXIF header, or a
+// non-nil error if the data is not JPEG or if EXIF metadata is not found, in
+// which case the error wraps ErrNoExif.
+func findJpegExif( data []byte, start uint ) (uint, uint, error) {
+    segments, err := getJpegSegments( data, start )
+    for _, s := range segments {
+        if s.marker == _APP1 && s.end - s.payload >= _originOffset &&
+           bytes.Equal( data[s.payload:s.payload+_originOffset],
+                        []byte( "Exif\x00\x00" ) ) {
+            return s.payload, s.end - s.payload, nil
+        }
+    }
+    if err == nil {
+        err = fmt.Errorf( "findJpegExif: %w\n", ErrNoExif )
+    }
+    return 0, 0, err
+}
+
+// getJpegDimensions returns the image width and height given in the frame
+// header (SOFn segment) of the JPEG data, or false if no frame header is found.
+func getJpegDimensions( data []byte ) (w, h uint32, ok bool) {
+    segments, _ := getJpegSegments( data, 0 )
+    for _, s := range segments {
+        if s.marker < 0xc0 || s.marker > 0xcf ||        // not SOFn or
+           s.marker == 0xc4 || s.marker == 0xc8 ||      // DHT, JPG and DAC
+           s.marker == 0xcc || s.end - s.payload < 5 {
+            continue
+        }
+        h = uint32(data[s.payload+1]) << 8 + uint32(data[s.payload+2])
+        w = uint32(data[s.payload+3]) << 8 + uint32(data[s.payload+4])
+        return w, h, true
+    }
+    return
+}
+
+// findJpegEnd returns the offset immediately following the EOI marker of the
+// JPEG image starting at offset start, or an error if EOI cannot be found.
+func findJpegEnd( data []byte, start uint ) (uint, error) {
+    if ! isJpeg( data, start ) {
+        return 0, fmt.Errorf( "findJpegEnd: missing SOI marker @%#08x\n", start )
+    }
+    dLen := uint(len(data))
+    offset := start + 2
+    for {
+        if offset + 2 > dLen {
+            return 0, fmt.Errorf( "findJpegEnd: truncated data @%#08x\n", offset )
+        }
+        if data[offset] != 0xff {
+            return 0, fmt.Errorf( "findJpegEnd: invalid marker @%#08x\n", offset )
+        }
+        marker := data[offset+1]
+        switch {
+        case marker == 0xff:
+            offset ++
+            continue
+        case marker == _EOI:
+            return offset + 2, nil
+        case marker == _TEM || (marker >= _RST0 && marker <= _RST7):
+            offset += 2
+            continue
+        }
+        if offset + 4 > dLen {
+            return 0, fmt.Errorf( "findJpegEnd: truncated segment @%#08x\n", offset )
+        }
+        sLen := uint(data[offset+2]) << 8 + uint(data[offset+3])
+        if sLen < 2 || offset + 2 + sLen > dLen {
+            return 0, fmt.Errorf( "findJpegEnd: invalid segment length %d @%#08x\n",
+                                  sLen, offset )
+        }
+        offset += 2 + sLen
+        if marker != _SOS {
+            continue
+        }
+        for {                           // skip entropy-coded data
+            i := bytes.IndexByte( data[offset:], 0xff )
+            if i == -1 || offset + uint(i) + 1 >= dLen {
+                return 0, fmt.Errorf( "findJpegEnd: missing EOI marker\n" )
+            }
+            offset += uint(i)
+            m := data[offset+1]
+            if m != 0x00 && ( m < _RST0 || m > _RST7 ) {
+                break                   // end of scan
+            }
+            offset += 2
+        }
+    }
+}
+
+// TrailerKind identifies the data found after the end of a JPEG image
+type TrailerKind uint8
+const (
+    UnknownTrailer  TrailerKind = iota  // unidentified data
+    PaddingTrailer                      // only 0x00 or 0xFF bytes
+    JpegTrailer                         // another JPEG image (e.g. MPF)
+    VideoTrailer                        // ISO BMFF video (e.g. motion photo)
+    SamsungTrailer                      // Samsung SEFH/SEFT tagged data
+)
+
+var trailerKindNames = [...]string {
+    "unknown", "padding", "JPEG image", "video", "Samsung data",
+}
+
+// String returns the name of the trailer kind
+func (k TrailerKind)String( ) string {
+    if int(k) < len(trailerKindNames) {
+        return trailerKindNames[k]
+    }
+    return fmt.Sprintf( "trailer kind %d", k )
+}
+
+// Trailer describes the data appended after the EOI marker of a JPEG image
+type Trailer struct {
+    Offset  uint            // offset of the trailer in the file
+    Size    uint            // trailer size in bytes
+    Kind    TrailerKind     // what the trailer seems to be
+}
+
+func getTrailerKind( t []byte ) TrailerKind {
+    switch {
+    case isJpeg( t, 0 ):
+        return JpegTrailer
+    case len(t) >= 8 && bytes.Equal( t[4:8], []byte( "ftyp" ) ):
+        return VideoTrailer
+    case len(t) >= 8 && bytes.Equal( t[len(t)-4:], []byte( "SEFT" ) ):
+        return SamsungTrailer
+    }
+    for _, b := range t {
+        if b != 0x00 && b != 0xff {
+            return UnknownTrailer
+        }
+    }
+    return PaddingTrailer
+}
+
+// FindJpegTrailer looks for data appended after the end of the JPEG image
+// starting at the offset start in data. It returns the trailer description
+// and true if a trailer is found, or false if the image ends the data.
+//
+// It returns a non-nil error if the data is not a valid JPEG image.
+func FindJpegTrailer( data []byte, start uint ) (Trailer, bool, error) {
+    end, err := findJpegEnd( data, start )
+    if err != nil {
+        return Trailer{}, false, fmt.Errorf( "FindJpegTrailer: %w", err )
+    }
+    if end == uint(len(data)) {
+        return Trailer{}, false, nil
+    }
+    return Trailer{ end, uint(len(data)) - end, getTrailerKind( data[end:] ) },
+           true, nil
+}
+
+// GetTrailer returns the description of the data found after the end of the
+// JPEG image the metadata was read from, and true if such data was found. It
+// returns false if the metadata was not read from a JPEG file by Read, or if
+// no data follows the image.
+func (d *Desc)GetTrailer( ) (Trailer, bool) {
+    return d.global.trailer, d.global.hasTrailer
+}
+
+// UpdateJpeg writes the JPEG image given in data, with its EXIF metadata
+// replaced by the current metadata. If the metadata is empty, the EXIF APP1
+// segment is removed.
+//
+// If the image does not include an EXIF APP1 segment, a new segment is
+// inserted right after the SOI marker, or after the JFIF APP0 segment if it
+// immediately follows SOI. This allows adding metadata created from scratch
+// (see Control.Empty) to an image that never had any.
+//
+// If keepTrailer is false, any data following the end of the image (see
+// FindJpegTrailer) is not written. This is recommended when metadata is
+// removed for privacy, since the trailer may include a video or a copy of
+// the image with its original metadata.
+//
+// As with Write, the Control Software identity is stamped into the written
+// metadata, unless the metadata is empty.
+//
+// It returns the number of bytes written in case of success or a non-nil error
+// in case of failure.
+func (d *Desc)UpdateJpeg( w io.Writer, data []byte,
+                          keepTrailer bool ) (n int, err error) {
+    defer func ( ) {
+        if err != nil { err = fmt.Errorf( "UpdateJpeg: %w", err ) }
+    }()
+
+    var before, after uint              // EXIF APP1 segment to replace
+    offset, size, err := findJpegExif( data, 0 )
+    if err == nil {
+        before, after = offset - 4, offset + size
+    } else if errors.Is( err, ErrNoExif ) {
+        before, err = getJpegExifInsertion( data )
+        after = before
+    }
+    if err != nil {
+        return
+    }
+    end := uint(len(data))
+    if ! keepTrailer {
+        if end, err = findJpegEnd( data, 0 ); err != nil {
+            return
+        }
+    }
+    var s *Desc
+    if s, err = d.stamped( ); err != nil {
+        return
+    }
+    var exif []byte
+    if exif, err = s.Bytes( ); err != nil {
+        return
+    }
+    if len(exif) + 2 > 0xffff {
+        err = fmt.Errorf( "metadata size %d %w\n", len(exif),
+                          ErrSegmentTooLarge )
+        return
+    }
+
+    var written int
+    write := func( b []byte ) {
+        if err == nil {
+            written, err = w.Write( b )
+            n += written
+        }
+    }
+    write( data[:before] )              // up to the EXIF APP1 marker
+    if len(exif) > 0 {
+        sLen := len(exif) + 2
+        write( []byte{ 0xff, _APP1, byte(sLen >> 8), byte(sLen) } )
+        write( exif )
+    }
+    write( data[after:end] )
+    return
+}
+
+// getJpegExifInsertion returns the offset where a new EXIF APP1 segment must
+// be inserted in the JPEG data: after the JFIF APP0 segment if it immediately
+// follows SOI, otherwise right after SOI.
+func getJpegExifInsertion( data []byte ) (uint, error) {
+    segments, err := getJpegSegments( data, 0 )
+    if err != nil {
+        return 0, err
+    }
+    if len(segments) > 0 && segments[0].marker == _APP0 {
+        return segments[0].end, nil
+    }
+    return 2, nil
+}
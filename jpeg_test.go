@@ -0,0 +1,166 @@
+package exif
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "testing"
+)
+
+// testJpegSegment returns a JPEG segment made of marker and payload
+func testJpegSegment( marker byte, payload []byte ) []byte {
+    sLen := len(payload) + 2
+    return append( []byte{ 0xff, marker, byte(sLen >> 8), byte(sLen) },
+                   payload... )
+}
+
+// testJpegWith returns the JPEG image img with segments inserted after SOI
+func testJpegWith( img []byte, segments ...[]byte ) []byte {
+    data := []byte{ 0xff, _SOI }
+    for _, s := range segments {
+        data = append( data, s... )
+    }
+    return append( data, img[2:]... )
+}
+
+// testExifSegment returns an EXIF APP1 segment with the Make "Nikon"
+func testExifSegment( ) []byte {
+    e := binary.BigEndian
+    ifd0 := []testEntry{ { _Make, uint16(_ASCIIString), 6, testString( "Nikon" ) } }
+    tiff := testTiff( e, ifd0, nil )
+    return testJpegSegment( _APP1, append( []byte( "Exif\x00\x00" ), tiff... ) )
+}
+
+var (
+    testJfifSegment = testJpegSegment( _APP0,
+                        []byte( "JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00" ) )
+    testIccSegment  = testJpegSegment( _APP2,
+                        []byte( "ICC_PROFILE\x00\x01\x01profile" ) )
+    testXmpSegment  = testJpegSegment( _APP1,
+                        []byte( "http://ns.adobe.com/xap/1.0/\x00<x/>" ) )
+)
+
+func TestFindJpegExifLayouts( t *testing.T ) {
+    img := testJpegImage( t, 8, 8 )
+    exif := testExifSegment( )
+    for _, c := range []struct {
+        name        string
+        before      [][]byte        // segments before the EXIF segment
+    } {
+        { "EXIF only", nil },
+        { "JFIF+EXIF", [][]byte{ testJfifSegment } },
+        { "EXIF after APP2", [][]byte{ testIccSegment } },
+        { "EXIF after JFIF, XMP and APP2",
+          [][]byte{ testJfifSegment, testXmpSegment, testIccSegment } },
+    } {
+        data := testJpegWith( img, append( c.before, exif )... )
+        offset, size, err := findJpegExif( data, 0 )
+        if err != nil {
+            t.Errorf( "%s: %v", c.name, err )
+            continue
+        }
+        want := uint(2 + 4)             // SOI, EXIF segment marker and length
+        for _, s := range c.before {
+            want += uint(len(s))
+        }
+        if offset != want || size != uint(len(exif) - 4) {
+            t.Errorf( "%s: EXIF @%d size %d instead of @%d size %d",
+                      c.name, offset, size, want, len(exif) - 4 )
+        }
+        d, err := parseJpeg( data, 0, &Control{ } )
+        if err != nil {
+            t.Errorf( "%s: parseJpeg: %v", c.name, err )
+        } else if m, _ := d.ifds[PRIMARY].getAsciiString( _Make ); m != "Nikon" {
+            t.Errorf( "%s: Make %q", c.name, m )
+        }
+    }
+}
+
+func TestFindJpegExifMissing( t *testing.T ) {
+    img := testJpegImage( t, 8, 8 )
+    for _, data := range [][]byte{
+        img,
+        testJpegWith( img, testJfifSegment, testXmpSegment, testIccSegment ),
+    } {
+        if _, _, err := findJpegExif( data, 0 ); ! errors.Is( err, ErrNoExif ) {
+            t.Errorf( "no EXIF segment: %v instead of ErrNoExif", err )
+        }
+        _, err := ParseSidecar( data, &Control{ } )
+        if ! errors.Is( err, ErrNoExif ) ||
+           err.Error( ) != "ParseSidecar: no exif metadata\n" {
+            t.Errorf( "no EXIF segment: ParseSidecar %q", err )
+        }
+    }
+    truncated := testJpegWith( img, testJfifSegment )[:10]
+    if _, _, err := findJpegExif( truncated, 0 ); err == nil ||
+       errors.Is( err, ErrNoExif ) {
+        t.Errorf( "truncated segment: %v", err )
+    }
+}
+
+func TestGetJpegSegments( t *testing.T ) {
+    img := testJpegImage( t, 8, 8 )
+    exif := testExifSegment( )
+    data := testJpegWith( img, testJfifSegment, testIccSegment, exif )
+    segments, err := getJpegSegments( data, 0 )
+    if err != nil {
+        t.Fatalf( "getJpegSegments: %v", err )
+    }
+    if len(segments) < 3 {
+        t.Fatalf( "%d segments", len(segments) )
+    }
+    offset := uint(2)
+    for i, s := range [][]byte{ testJfifSegment, testIccSegment, exif } {
+        g := segments[i]
+        if g.marker != s[1] || g.start != offset || g.payload != offset + 4 ||
+           g.end != offset + uint(len(s)) {
+            t.Errorf( "segment %d: %+v", i, g )
+        }
+        offset += uint(len(s))
+    }
+}
+
+func TestUpdateJpegLayouts( t *testing.T ) {
+    img := testJpegImage( t, 8, 8 )
+    exif := testExifSegment( )
+    d := testParse( t, testTiff( binary.BigEndian, []testEntry{
+                        { _Make, uint16(_ASCIIString), 6, testString( "Canon" ) },
+                    }, nil ), &Control{ } )
+    for _, c := range []struct {
+        name        string
+        in          []byte
+        before      [][]byte        // segments expected before the EXIF one
+    } {
+        { "insert in JFIF", testJpegWith( img, testJfifSegment ),
+          [][]byte{ testJfifSegment } },
+        { "insert without JFIF", testJpegWith( img, testIccSegment ), nil },
+        { "replace after APP2", testJpegWith( img, testIccSegment, exif ),
+          [][]byte{ testIccSegment } },
+    } {
+        var b bytes.Buffer
+        if _, err := d.UpdateJpeg( &b, c.in, true ); err != nil {
+            t.Errorf( "%s: %v", c.name, err )
+            continue
+        }
+        out := b.Bytes( )
+        want := uint(2 + 4)
+        for _, s := range c.before {
+            want += uint(len(s))
+        }
+        offset, _, err := findJpegExif( out, 0 )
+        if err != nil || offset != want {
+            t.Errorf( "%s: EXIF @%d instead of @%d (%v)", c.name, offset, want, err )
+            continue
+        }
+        if ! bytes.Contains( out, testIccSegment ) &&
+           bytes.Contains( c.in, testIccSegment ) {
+            t.Errorf( "%s: APP2 segment lost", c.name )
+        }
+        u, err := parseJpeg( out, 0, &Control{ } )
+        if err != nil {
+            t.Errorf( "%s: parseJpeg: %v", c.name, err )
+        } else if m, _ := u.ifds[PRIMARY].getAsciiString( _Make ); m != "Canon" {
+            t.Errorf( "%s: Make %q", c.name, m )
+        }
+    }
+}
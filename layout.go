@@ -0,0 +1,87 @@
+package exif
+
+// support for describing the serialized metadata layout
+
+import (
+    "io"
+    "sort"
+)
+
+/*
+    Layout serializes the metadata without keeping the result, and records
+    where each part is written in the output stream: the headers, the entry
+    block of each IFD (entry count, entries and next IFD offset) and the data
+    area of each entry that does not fit in the entry itself.
+
+    Offsets are given from the start of the output, i.e. from the EXIF header
+    "Exif\x00\x00" written by Serialize. TIFF offsets found in the metadata are
+    relative to the TIFF header, which starts 6 bytes later.
+*/
+
+// SegmentKind gives the kind of a Segment
+type SegmentKind uint8
+const (
+    HeaderSegment SegmentKind = iota    // EXIF and TIFF headers
+    EntriesSegment                      // IFD entry block
+    DataSegment                         // entry data, including maker notes
+)
+
+// Segment describes a region of the serialized metadata
+type Segment struct {
+    Kind    SegmentKind // region kind
+    Ifd     IfdId       // IFD the region belongs to
+    Tag     uint16      // entry tag for DataSegment, 0 otherwise
+    Offset  int64       // region offset in the serialized output
+    Size    int64       // region size in bytes
+}
+
+// layoutWriter counts the bytes written and collects segments while
+// serializing. It is recognized by the serializing functions.
+type layoutWriter struct {
+    w           io.Writer
+    n           int64
+    segments    []Segment
+}
+
+func (lw *layoutWriter) Write( p []byte ) (int, error) {
+    n, err := lw.w.Write( p )
+    lw.n += int64(n)
+    return n, err
+}
+
+// addSegment records a segment if w is a layoutWriter
+func addSegment( w io.Writer, kind SegmentKind, id IfdId, tag tTag,
+                 offset, size int64 ) {
+    if lw, ok := w.(*layoutWriter); ok && size > 0 {
+        lw.segments = append( lw.segments,
+                              Segment{ kind, id, uint16(tag), offset, size } )
+    }
+}
+
+// getWriteOffset returns the current output offset if w is a layoutWriter
+func getWriteOffset( w io.Writer ) int64 {
+    if lw, ok := w.(*layoutWriter); ok {
+        return lw.n
+    }
+    return 0
+}
+
+// Layout returns the list of segments that Serialize would write from the
+// current metadata, in increasing offset order. A maker note DataSegment
+// encloses the segments of the maker note IFDs, and comes before them.
+//
+// It returns a non-nil error if the metadata cannot be serialized.
+func (d *Desc)Layout( ) ([]Segment, error) {
+    lw := &layoutWriter{ w: io.Discard }
+    if _, err := d.Serialize( lw ); err != nil {
+        return nil, err
+    }
+    sort.SliceStable( lw.segments, func( i, j int ) bool {
+        si, sj := &lw.segments[i], &lw.segments[j]
+        if si.Offset != sj.Offset {
+            return si.Offset < sj.Offset
+        }
+        return si.Size > sj.Size            // enclosing segment first
+    } )
+    return lw.segments, nil
+}
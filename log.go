@@ -0,0 +1,54 @@
+package exif
+
+// support for diagnostic output
+
+import (
+    "fmt"
+)
+
+/*
+    Warnings and debug traces are printed on stdout by default. Applications
+    that cannot use stdout, such as servers, can give a Logger in Control to
+    receive them instead. The Control flags Warn, ParsDbg and SrlzDbg still
+    decide which messages are produced; the Logger only decides where they go.
+    Without a Logger, nothing is printed on stdout unless enabled by those
+    flags: Warn for warnings and errors, ParsDbg or SrlzDbg for debug traces.
+*/
+
+// LogLevel is the level of a diagnostic message
+type LogLevel int
+
+const (
+    LogDebug    LogLevel = iota // parse or serialize debug traces
+    LogWarning                  // non-fatal issues found in metadata
+    LogError                    // errors that caused some metadata to be lost
+)
+
+func (l LogLevel) String( ) string {
+    switch l {
+    case LogDebug:      return "debug"
+    case LogWarning:    return "warning"
+    case LogError:      return "error"
+    }
+    return fmt.Sprintf( "level %d", int(l) )
+}
+
+// Logger receives diagnostic messages. Messages are complete lines, with their
+// trailing newline.
+type Logger interface {
+    Log( level LogLevel, msg string )
+}
+
+// logf formats and sends a diagnostic message to the logger given in Control,
+// or prints it on stdout if there is none and its level is enabled.
+func (c *Control) logf( level LogLevel, format string, a ...interface{} ) {
+    if c.Logger != nil {
+        c.Logger.Log( level, fmt.Sprintf( format, a... ) )
+        return
+    }
+    if level == LogDebug && ! c.ParsDbg && ! c.SrlzDbg ||
+       level != LogDebug && ! c.Warn {
+        return
+    }
+    fmt.Printf( format, a... )
+}
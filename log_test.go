@@ -0,0 +1,78 @@
+package exif
+
+import (
+    "encoding/binary"
+    "io/ioutil"
+    "os"
+    "testing"
+)
+
+// testStdout returns what f prints on stdout
+func testStdout( t *testing.T, f func( ) ) string {
+    t.Helper( )
+    r, w, err := os.Pipe( )
+    if err != nil {
+        t.Fatal( err )
+    }
+    stdout := os.Stdout
+    os.Stdout = w
+    f( )
+    os.Stdout = stdout
+    w.Close( )
+    out, err := ioutil.ReadAll( r )
+    if err != nil {
+        t.Fatal( err )
+    }
+    return string(out)
+}
+
+func TestLogfStdout( t *testing.T ) {
+    for _, c := range []struct {
+        ec      Control
+        level   LogLevel
+        printed bool
+    } {
+        { Control{ }, LogError, false },
+        { Control{ }, LogWarning, false },
+        { Control{ }, LogDebug, false },
+        { Control{ Warn: true }, LogError, true },
+        { Control{ Warn: true }, LogWarning, true },
+        { Control{ Warn: true }, LogDebug, false },
+        { Control{ ParsDbg: true }, LogDebug, true },
+        { Control{ SrlzDbg: true }, LogDebug, true },
+        { Control{ ParsDbg: true }, LogWarning, false },
+    } {
+        out := testStdout( t, func( ) { c.ec.logf( c.level, "message\n" ) } )
+        if (out != "") != c.printed {
+            t.Errorf( "Warn %v ParsDbg %v SrlzDbg %v %s: printed %q",
+                      c.ec.Warn, c.ec.ParsDbg, c.ec.SrlzDbg, c.level, out )
+        }
+    }
+}
+
+// testLogs records the messages sent to a Logger
+type testLogs []string
+
+func (l *testLogs) Log( level LogLevel, msg string ) {
+    *l = append( *l, level.String( ) + ": " + msg )
+}
+
+func TestNikonErrorNotLogged( t *testing.T ) {
+    e := binary.BigEndian
+    note := []byte( _NIKON_MAKER_SIGNATURE_3 + _NIKON_TIFF_HEADER )
+    note = append( note, testShorts( binary.BigEndian, 5 )... )    // truncated
+    tiff := append( []byte( "Exif\x00\x00" ), testMakerNoteTiff( e, "NIKON", note )... )
+
+    var logs testLogs
+    _, err := Parse( tiff, 0, uint(len(tiff)), &Control{ Logger: &logs } )
+    if err == nil {
+        t.Errorf( "truncated Nikon maker note accepted" )
+    }
+    if len(logs) != 0 {
+        t.Errorf( "error reported twice: %q", logs )
+    }
+    out := testStdout( t, func( ) { Parse( tiff, 0, uint(len(tiff)), &Control{ } ) } )
+    if out != "" {
+        t.Errorf( "printed on stdout: %q", out )
+    }
+}
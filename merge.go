@@ -0,0 +1,205 @@
+package exif
+
+// support for merging metadata from two sources
+
+import (
+    "bytes"
+    "fmt"
+    "strings"
+)
+
+/*
+    Merge combines the metadata of a source descriptor into a destination
+    descriptor, for instance when recombining metadata edited in a sidecar
+    file with the metadata found in the image file.
+
+    Only the primary, Exif, GPS and Interoperability namespaces are merged.
+    For each source value, a MergePolicy decides what to do according to its
+    namespace and tag:
+
+        PreferDestination   keep the destination value if it exists, copy the
+                            source value otherwise (the default).
+        PreferSource        replace the destination value with the source one.
+        PreferNewest        take the value from the descriptor that was
+                            modified last, according to their Modified date.
+                            If the source date is missing or not after the
+                            destination date, it is like PreferDestination.
+        Concatenate         join keyword lists, such as XPKeywords or ASCII
+                            strings, keeping each keyword once. Values that
+                            are not strings are treated as PreferDestination.
+        IgnoreSource        never copy the source value.
+
+    Missing Exif, GPS or Interoperability IFDs are created in the destination
+    as needed. Embedded IFD pointers, maker notes, thumbnails and image data
+    offsets and sizes are never merged, since they refer to the source file
+    layout. Undefined values are copied as they are, and are assumed to be in
+    the same byte order in both descriptors.
+*/
+
+// MergeAction is the action taken for a source value during Merge
+type MergeAction uint8
+
+const (
+    PreferDestination MergeAction = iota    // copy only if absent
+    PreferSource                            // always copy
+    PreferNewest                            // copy if the source is newer
+    Concatenate                             // join keywords
+    IgnoreSource                            // never copy
+)
+
+// MergePolicy returns the MergeAction for a tag in the namespace id
+type MergePolicy func( id IfdId, tag uint16 ) MergeAction
+
+// getMergeIfd returns the ifd id in d, creating it and its parent if needed
+func (d *Desc) getMergeIfd( id IfdId ) *ifdd {
+    if ifd := d.ifds[id]; ifd != nil {
+        return ifd
+    }
+    switch id {
+    case EXIF:
+        return d.ifds[PRIMARY].newEmbeddedIfd( EXIF, _ExifIFD )
+    case GPS:
+        return d.ifds[PRIMARY].newEmbeddedIfd( GPS, _GpsIFD )
+    case IOP:
+        return d.getMergeIfd( EXIF ).newEmbeddedIfd( IOP, _InteroperabilityIFD )
+    }
+    return nil
+}
+
+// isMergeable returns true if v in the namespace id does not depend on the
+// layout of its file
+func isMergeable( id IfdId, v serializer ) bool {
+    switch v.(type) {
+    case *ifdValue, *descValue, *thumbnailValue:
+        return false
+    }
+    tag := v.getTag( )
+    if id == EXIF && tag == _MakerNote {
+        return false
+    }
+    for _, group := range linkedTags[id] {
+        for _, t := range group {
+            if t == tag {
+                return false
+            }
+        }
+    }
+    return true
+}
+
+// joinKeywords returns the ';' separated keywords of a, followed by those of
+// b that are not in a, separated with sep.
+func joinKeywords( a, b, sep string ) string {
+    seen := make( map[string]bool )
+    var keywords []string
+    for _, s := range []string{ a, b } {
+        for _, k := range strings.Split( s, ";" ) {
+            if k = strings.TrimSpace( k ); k != "" && ! seen[k] {
+                seen[k] = true
+                keywords = append( keywords, k )
+            }
+        }
+    }
+    return strings.Join( keywords, sep )
+}
+
+// concatenate returns a new value for the ifd, joining the keywords of the
+// current value cur and of v, or nil if they are not strings of the same kind.
+func (ifd *ifdd) concatenate( cur, v serializer ) serializer {
+    cs, ok := cur.(*unsignedByteValue)
+    if ! ok {
+        return nil
+    }
+    vs, ok := v.(*unsignedByteValue)
+    if ! ok || cs.s != vs.s || cs.u != vs.u {
+        return nil
+    }
+    ifd.newEntry( cs.vTag, cs.vType )
+    switch {
+    case cs.u:
+        s := joinKeywords( decodeXPString( cs.v ), decodeXPString( vs.v ), ";" )
+        return ifd.newXPStringValue( cs.name, encodeXPString( s ) )
+    case cs.s && ! ifd.isMultiString( ):
+        s := joinKeywords( string( bytes.TrimRight( cs.v, "\x00" ) ),
+                           string( bytes.TrimRight( vs.v, "\x00" ) ),
+                           _historySeparator )
+        return ifd.newAsciiStringValue( cs.name, append( []byte(s), 0 ) )
+    }
+    return nil
+}
+
+// Merge merges the metadata of src into dst, according to policy. If policy
+// is nil, PreferDestination is used for all tags. The source descriptor is
+// not modified and does not share any value with the destination afterwards.
+//
+// It returns a non-nil error if a descriptor is nil, if the destination has no
+// primary IFD or if policy returns an invalid action.
+func Merge( dst, src *Desc, policy MergePolicy ) (err error) {
+    defer func ( ) {
+        if err != nil { err = fmt.Errorf( "Merge: %w", err ) }
+    }()
+
+    if dst == nil || src == nil {
+        return fmt.Errorf( "nil metadata\n" )
+    }
+    if dst.ifds[PRIMARY] == nil {
+        return fmt.Errorf( "Primary %w\n", ErrIfdNotPresent )
+    }
+    srcNewer := false
+    if st, err := src.GetDateTime( Modified ); err == nil {
+        dt, err := dst.GetDateTime( Modified )
+        srcNewer = err != nil || st.After( dt )
+    }
+
+    c := &cloner{ descs: make( map[*Desc]*Desc ),
+                  ifds: make( map[*ifdd]*ifdd ) }
+    for _, id := range []IfdId{ PRIMARY, EXIF, GPS, IOP } {
+        from := src.ifds[id]
+        if from == nil {
+            continue
+        }
+        for _, v := range from.values {
+            if v == nil || ! isMergeable( id, v ) {
+                continue
+            }
+            tag := v.getTag( )
+            action := PreferDestination
+            if policy != nil {
+                action = policy( id, uint16(tag) )
+            }
+            to := dst.ifds[id]
+            var cur serializer
+            if to != nil {
+                cur = to.getValue( tag )
+            }
+            switch action {
+            case PreferDestination:
+                if cur != nil {
+                    continue
+                }
+            case PreferSource:
+            case PreferNewest:
+                if cur != nil && ! srcNewer {
+                    continue
+                }
+            case Concatenate:
+                if cur != nil {
+                    if joined := to.concatenate( cur, v ); joined != nil {
+                        to.setValue( joined )
+                    }
+                    continue
+                }
+            case IgnoreSource:
+                continue
+            default:
+                return fmt.Errorf( "invalid action %d for %s tag %#04x\n",
+                                   action, GetIfdName( id ), tag )
+            }
+            if to == nil {
+                to = dst.getMergeIfd( id )
+            }
+            to.setValue( c.value( v, to ) )
+        }
+    }
+    return nil
+}
@@ -0,0 +1,39 @@
+package exif
+
+import (
+    "encoding/binary"
+    "strings"
+    "testing"
+)
+
+func TestMergeFormatUsesDestination( t *testing.T ) {
+    e := binary.LittleEndian
+    for _, pooled := range []bool{ false, true } {
+        dst := testParse( t, testGPSTiff( e, []testEntry{
+            { _GPSLatitudeRef, uint16(_ASCIIString), 2, testString( "N" ) },
+            { _GPSLatitude, uint16(_UnsignedRational), 3,
+                            testLongs( e, 48, 1, 51, 1, 0, 1 ) },
+        } ), &Control{ } )
+        src := testParse( t, testGPSTiff( e, testGPSPosition( e ) ),
+                          &Control{ Pooled: pooled } )
+        policy := func( id IfdId, tag uint16 ) MergeAction {
+            if id == GPS && tag == _GPSLatitude {
+                return PreferSource
+            }
+            return PreferDestination
+        }
+        if err := Merge( dst, src, policy ); err != nil {
+            t.Fatalf( "Merge: %v", err )
+        }
+        src.Release( )                      // must not affect dst
+
+        f := testFormat( t, dst, GPS )
+        if ! strings.Contains( f, "33° 30' 0.00\" N" ) {
+            t.Errorf( "pooled %v: merged latitude not formatted with the destination ref:\n%s",
+                      pooled, f )
+        }
+        if ! strings.Contains( f, "bearing 90.0° T, 12.0 km" ) {
+            t.Errorf( "pooled %v: merged bearing not formatted:\n%s", pooled, f )
+        }
+    }
+}
@@ -0,0 +1,141 @@
+package exif
+
+// support for locating the video in motion photos
+
+import (
+    "fmt"
+    "bytes"
+    "strconv"
+)
+
+/*
+    A motion photo is a JPEG image followed by a short MP4 video, appended
+    after the EOI marker. The video location is advertised in the XMP APP1
+    segment, whose payload starts with "http://ns.adobe.com/xap/1.0/\x00":
+
+    - Google Motion Photo v1 (Micro Video) gives the video offset from the end
+      of the file in the attribute GCamera:MicroVideoOffset.
+    - Google Motion Photo v2 lists the file components in a container directory,
+      each as a Container:Item with Item:Semantic and Item:Length attributes.
+      The components follow the primary image in the order they are listed,
+      and the video is the item with the semantic "MotionPhoto".
+
+    Samsung motion photos do not use XMP for that. Instead, the video follows
+    the marker "MotionPhoto_Data" in the trailer.
+
+    If none of those is found, a trailer that is an MP4 video is taken as the
+    motion photo video.
+*/
+
+const _xmpSignature = "http://ns.adobe.com/xap/1.0/\x00"
+
+// findJpegXmp returns the XMP packet found in the JPEG data or nil
+func findJpegXmp( data []byte, start uint ) []byte {
+    segments, _ := getJpegSegments( data, start )
+    for _, s := range segments {
+        if s.marker == _APP1 &&
+           bytes.HasPrefix( data[s.payload:s.end], []byte( _xmpSignature ) ) {
+            return data[s.payload+uint(len(_xmpSignature)):s.end]
+        }
+    }
+    return nil
+}
+
+// getXmpValue returns the value of the XMP property name, given either as
+// an attribute name="value" or as an element <name>value</name>, in xmp.
+func getXmpValue( xmp []byte, name string ) (string, bool) {
+    if i := bytes.Index( xmp, []byte( name + "=\"" ) ); i != -1 {
+        v := xmp[i+len(name)+2:]
+        if j := bytes.IndexByte( v, '"' ); j != -1 {
+            return string(v[:j]), true
+        }
+    }
+    if i := bytes.Index( xmp, []byte( "<" + name + ">" ) ); i != -1 {
+        v := xmp[i+len(name)+2:]
+        if j := bytes.IndexByte( v, '<' ); j != -1 {
+            return string(bytes.TrimSpace( v[:j] )), true
+        }
+    }
+    return "", false
+}
+
+func getXmpUint( xmp []byte, name string ) (uint, bool) {
+    if s, ok := getXmpValue( xmp, name ); ok {
+        if v, err := strconv.ParseUint( s, 10, 64 ); err == nil {
+            return uint(v), true
+        }
+    }
+    return 0, false
+}
+
+// getContainerVideo returns the size of the motion photo video and the size
+// of all items following it in the container directory, or false if the XMP
+// data does not include any container directory with a video.
+func getContainerVideo( xmp []byte ) (size, after uint, ok bool) {
+    items := bytes.Split( xmp, []byte( "<Container:Item" ) )
+    for _, item := range items[1:] {
+        length, _ := getXmpUint( item, "Item:Length" )
+        if ok {
+            after += length
+            continue
+        }
+        if s, _ := getXmpValue( item, "Item:Semantic" ); s == "MotionPhoto" {
+            size, ok = length, length > 0
+        }
+    }
+    return
+}
+
+func isMp4( data []byte ) bool {
+    return len(data) >= 8 && bytes.Equal( data[4:8], []byte( "ftyp" ) )
+}
+
+// FindMotionPhotoVideo locates the video embedded in a motion photo, given
+// as the whole JPEG file data, with the SOI marker at offset start. It returns
+// the video offset and size in data in case of success, or a non-nil error if
+// no video can be found.
+func FindMotionPhotoVideo( data []byte, start uint ) (offset, size uint,
+                                                          err error) {
+    trailer, ok, err := FindJpegTrailer( data, start )
+    if err != nil {
+        return 0, 0, fmt.Errorf( "FindMotionPhotoVideo: %w", err )
+    }
+    if ! ok {
+        return 0, 0, fmt.Errorf( "FindMotionPhotoVideo: no data after image\n" )
+    }
+    dLen := uint(len(data))
+    check := func( o, s uint ) (uint, uint, error) {
+        if o < trailer.Offset || s > dLen - o || ! isMp4( data[o:] ) {
+            return 0, 0, fmt.Errorf(
+                "FindMotionPhotoVideo: invalid video location %d (size %d)\n",
+                o, s )
+        }
+        return o, s, nil
+    }
+
+    if xmp := findJpegXmp( data, start ); xmp != nil {
+        if vo, ok := getXmpUint( xmp, "GCamera:MicroVideoOffset" );
+           ok && vo > 0 && vo <= dLen {
+            return check( dLen - vo, vo )
+        }
+        if vs, after, ok := getContainerVideo( xmp ); ok &&
+           vs + after <= dLen {
+            return check( dLen - after - vs, vs )
+        }
+    }
+    t := data[trailer.Offset:]
+    if i := bytes.Index( t, []byte( "MotionPhoto_Data" ) ); i != -1 {
+        o := trailer.Offset + uint(i) + 16
+        end := dLen
+        if trailer.Kind == SamsungTrailer {     // video is followed by SEF data
+            if j := bytes.Index( data[o:], []byte( "SEFH" ) ); j != -1 {
+                end = o + uint(j)
+            }
+        }
+        return check( o, end - o )
+    }
+    if trailer.Kind == VideoTrailer {
+        return trailer.Offset, trailer.Size, nil
+    }
+    return 0, 0, fmt.Errorf( "FindMotionPhotoVideo: no motion photo video\n" )
+}
@@ -0,0 +1,243 @@
+package exif
+
+// support for exif metadata in MP4 and QuickTime video files
+
+import (
+    "bytes"
+    "fmt"
+    "encoding/binary"
+)
+
+/*
+    MP4 and QuickTime files are made of nested boxes (also called atoms), each
+    starting with a 4-byte big endian size, including the header, and a 4-byte
+    type. A size of 1 means that a 8-byte size follows the type, a size of 0
+    that the box extends to the end of the file.
+
+    Some phones and cameras store exif metadata in an "Exif" or "exif" box,
+    usually in the moov/udta or moov/meta boxes. Its payload is a TIFF header
+    and IFDs, optionally preceded either by the "Exif\x00\x00" signature or by
+    a 4-byte offset to the TIFF header (as in HEIF files).
+
+    QuickTime metadata is stored in a meta box, which includes:
+
+      keys      a full box (4-byte version & flags) with a 4-byte entry count,
+                followed by the key entries: 4-byte size, 4-byte namespace
+                (usually "mdta") and key name (e.g. "com.apple.quicktime.make")
+      ilst      a list of item boxes, whose type is the 1-based key index and
+                which contain a "data" box: 4-byte type (1 for UTF-8 text),
+                4-byte locale and value
+
+    In ISO MP4 files, the meta box is a full box, whereas in QuickTime files
+    it is a simple container. Older files also store the location in a
+    moov/udta/"\xa9xyz" box: 2-byte text size, 2-byte language and text.
+*/
+
+type mp4Box struct {
+    typ     string          // box type
+    start   uint            // offset of the box header in data
+    payload uint            // offset of the payload (after header)
+    end     uint            // offset immediately following the box
+}
+
+// boxes that contain other boxes
+var mp4Containers = map[string]bool{
+    "moov": true, "trak": true, "mdia": true, "minf": true,
+    "udta": true, "meta": true,
+}
+
+// walkMp4Boxes calls f for each box found in data between start and end,
+// going down into container boxes, until f returns false. It stops at the
+// first invalid box, and returns false if f did.
+func walkMp4Boxes( data []byte, start, end uint,
+                   f func( b mp4Box ) bool ) bool {
+    for o := start; o + 8 <= end; {
+        size := uint64(binary.BigEndian.Uint32( data[o:] ))
+        b := mp4Box{ typ: string(data[o+4:o+8]), start: o, payload: o + 8 }
+        switch size {
+        case 0:
+            size = uint64(end - o)
+        case 1:
+            if o + 16 > end {
+                return true
+            }
+            size = binary.BigEndian.Uint64( data[o+8:] )
+            b.payload += 8
+        }
+        if size < uint64(b.payload - o) || size > uint64(end - o) {
+            return true
+        }
+        b.end = o + uint(size)
+        if ! f( b ) {
+            return false
+        }
+        if mp4Containers[b.typ] {
+            p := b.payload          // ISO meta is a full box, QuickTime's is not
+            if b.typ == "meta" &&
+               ! ( p + 8 <= b.end && string(data[p+4:p+8]) == "hdlr" ) {
+                p += 4
+            }
+            if ! walkMp4Boxes( data, p, b.end, f ) {
+                return false
+            }
+        }
+        o = b.end
+    }
+    return true
+}
+
+func isTiffHeader( data []byte ) bool {
+    return len(data) >= _headerSize &&
+           ( bytes.HasPrefix( data, []byte( "II\x2a\x00" ) ) ||
+             bytes.HasPrefix( data, []byte( "MM\x00\x2a" ) ) )
+}
+
+// findMp4Exif returns the offset and size of the TIFF data in the first exif
+// box found in the MP4 data starting at start, or false if there is none.
+func findMp4Exif( data []byte, start uint ) (offset, size uint, ok bool) {
+    walkMp4Boxes( data, start, uint(len(data)), func( b mp4Box ) bool {
+        if b.typ != "Exif" && b.typ != "exif" {
+            return true
+        }
+        p := data[b.payload:b.end]
+        t := uint(0)
+        if ! isTiffHeader( p ) && ! bytes.HasPrefix( p, []byte( "Exif\x00\x00" ) ) &&
+           len(p) >= 4 {                            // HEIF style offset
+            t = 4 + uint(binary.BigEndian.Uint32( p ))
+        }
+        if t < uint(len(p)) && bytes.HasPrefix( p[t:], []byte( "Exif\x00\x00" ) ) {
+            t += _originOffset
+        }
+        if t > uint(len(p)) || ! isTiffHeader( p[t:] ) {
+            return true
+        }
+        offset, size, ok = b.payload + t, uint(len(p)) - t, true
+        return false
+    } )
+    return
+}
+
+// getMp4DataValue returns the text value of an ilst item box, or false if it
+// has no UTF-8 text value.
+func getMp4DataValue( data []byte, item mp4Box ) (value string, ok bool) {
+    walkMp4Boxes( data, item.payload, item.end, func( b mp4Box ) bool {
+        if b.typ != "data" {
+            return true
+        }
+        if b.end - b.payload >= 8 &&
+           binary.BigEndian.Uint32( data[b.payload:] ) == 1 {
+            value, ok = string(data[b.payload+8:b.end]), true
+        }
+        return false
+    } )
+    return
+}
+
+// getMp4Keys returns the QuickTime keys found in the MP4 data starting at
+// start, with their text values.
+func getMp4Keys( data []byte, start uint ) map[string]string {
+    values := make( map[string]string )
+    var keys []string
+    walkMp4Boxes( data, start, uint(len(data)), func( b mp4Box ) bool {
+        switch b.typ {
+        case "keys":
+            keys = keys[:0]
+            if b.end - b.payload < 8 {
+                break
+            }
+            for o := b.payload + 8; o + 8 <= b.end; {
+                size := uint(binary.BigEndian.Uint32( data[o:] ))
+                if size < 8 || size > b.end - o {
+                    break
+                }
+                keys = append( keys, string(data[o+8:o+size]) )
+                o += size
+            }
+        case "ilst":
+            for o := b.payload; o + 8 <= b.end; {
+                size := uint(binary.BigEndian.Uint32( data[o:] ))
+                if size < 8 || size > b.end - o {
+                    break
+                }
+                item := mp4Box{ string(data[o+4:o+8]), o, o + 8, o + size }
+                index := uint(binary.BigEndian.Uint32( data[o+4:] ))
+                if index > 0 && index <= uint(len(keys)) {
+                    if v, ok := getMp4DataValue( data, item ); ok {
+                        values[keys[index-1]] = v
+                    }
+                }
+                o += size
+            }
+        case "\xa9xyz":
+            if b.end - b.payload >= 4 {
+                n := uint(binary.BigEndian.Uint16( data[b.payload:] ))
+                if n <= b.end - b.payload - 4 {
+                    values["©xyz"] = string(data[b.payload+4:b.payload+4+n])
+                }
+            }
+        }
+        return true
+    } )
+    return values
+}
+
+// GetQuickTimeKeys returns the QuickTime metadata keys found in the MP4 or
+// QuickTime data starting at start, with their text values, such as
+// "com.apple.quicktime.location.ISO6709" or "com.apple.quicktime.make".
+// The location from an older "\xa9xyz" box is returned with the key "©xyz".
+// Keys with non-text values are ignored.
+//
+// It returns a non-nil error if data is not an MP4 or QuickTime file, or if
+// it does not contain any text key.
+func GetQuickTimeKeys( data []byte, start uint ) (map[string]string, error) {
+    if uint(len(data)) < start || ! isMp4( data[start:] ) {
+        return nil, fmt.Errorf( "GetQuickTimeKeys: not an MP4 file\n" )
+    }
+    keys := getMp4Keys( data, start )
+    if len(keys) == 0 {
+        return nil, fmt.Errorf( "GetQuickTimeKeys: no QuickTime keys\n" )
+    }
+    return keys, nil
+}
+
+// ParseMp4 parses the exif metadata embedded in the MP4 or QuickTime data
+// starting at start. The QuickTime text keys found in data are kept in the
+// returned descriptor and are available from QuickTimeKeys.
+//
+// It returns the descriptor in case of success or a non-nil error in case of
+// failure. If data does not contain exif metadata, the error wraps ErrNoExif.
+func ParseMp4( data []byte, start uint, ec *Control ) (d *Desc, err error) {
+    defer func ( ) {
+        if err != nil { err = fmt.Errorf( "ParseMp4: %w", err ) }
+    }()
+    if uint(len(data)) < start || ! isMp4( data[start:] ) {
+        return nil, fmt.Errorf( "not an MP4 file\n" )
+    }
+    offset, size, ok := findMp4Exif( data, start )
+    if ! ok {
+        return nil, fmt.Errorf( "%w\n", ErrNoExif )
+    }
+    d, err = parseTiff( data[offset:offset+size], uint32(offset),
+                        data[offset:], ec )
+    if err == nil {
+        if keys := getMp4Keys( data, start ); len(keys) > 0 {
+            d.global.quickTimeKeys = keys
+        }
+    }
+    return
+}
+
+// QuickTimeKeys returns a copy of the QuickTime text keys found in the file
+// the metadata was read from, as given by GetQuickTimeKeys, or nil if the
+// metadata was not read from an MP4 or QuickTime file.
+func (d *Desc)QuickTimeKeys( ) map[string]string {
+    keys := d.global.quickTimeKeys
+    if keys == nil {
+        return nil
+    }
+    c := make( map[string]string, len(keys) )
+    for k, v := range keys {
+        c[k] = v
+    }
+    return c
+}
@@ -0,0 +1,145 @@
+package exif
+
+// support for multi-page TIFF metadata
+
+import (
+    "fmt"
+    "io"
+    "math"
+)
+
+/*
+    In a multi-page TIFF file, such as a multi-page scan or fax, IFD0 is
+    followed by a chain of IFDs, one per page, each one linked to the next one
+    by its next IFD offset. Each page IFD may have its own Exif, GPS or other
+    embedded IFDs. Parse and Read take the second IFD as a thumbnail IFD and
+    ignore the following ones.
+
+    ParseTiffAll parses each IFD of the chain as the primary IFD of a separate
+    descriptor, so that the metadata of each page can be read or modified with
+    the usual Desc methods. SerializeTiffPages writes them back as a single
+    TIFF stream, chaining the page IFDs in the given order.
+
+    As with SerializeTiff, only metadata is written: image data referred to by
+    StripOffsets or TileOffsets is not copied, and those offsets are written
+    as they are.
+*/
+
+// TiffPage is the metadata of one page in a multi-page TIFF
+type TiffPage struct {
+    *Desc               // page metadata, with the page IFD as primary IFD
+    Index   int         // page number, starting from 0
+    Offset  uint32      // page IFD offset in the TIFF data
+}
+
+// ParseTiffAll parses all IFDs chained from IFD0 in a TIFF stream, such as a
+// multi-page TIFF file, and returns one TiffPage per IFD, in chain order.
+//
+// It takes the TIFF data, starting with the TIFF header (without EXIF header)
+// and the same control as Parse. It returns a non-nil error if the TIFF header
+// is not valid, if the chain loops or if any page cannot be parsed.
+func ParseTiffAll( data []byte, ec *Control ) (pages []TiffPage, err error) {
+    defer func ( ) {
+        if err != nil {
+            for _, p := range pages {
+                p.Release( )
+            }
+            pages, err = nil, fmt.Errorf( "ParseTiffAll: %w", err )
+        }
+    }()
+
+    if len(data) < _headerSize {
+        return nil, fmt.Errorf( "%w (too short: %d bytes)\n",
+                                ErrInvalidTiffHeader, len(data) )
+    }
+    d := newDesc( data, ec )
+    if d.endian, err = getEndianess( data ); err != nil {
+        return
+    }
+    var offset uint32
+    if offset, err = d.checkValidTiff( ); err != nil {
+        return
+    }
+
+    seen := make( map[uint32]bool )
+    for offset != 0 {
+        if seen[offset] {
+            return pages, fmt.Errorf( "page %d: IFD loop at offset %#08x\n",
+                                      len(pages), offset )
+        }
+        seen[offset] = true
+        var next uint32
+        if d, next, err = parseTiffIfd( data, 0, nil, ec, offset ); err != nil {
+            return pages, fmt.Errorf( "page %d: %w", len(pages), err )
+        }
+        pages = append( pages, TiffPage{ d, len(pages), offset } )
+        offset = next
+    }
+    if len(pages) == 0 {
+        err = fmt.Errorf( "no IFD\n" )
+    }
+    return
+}
+
+// SerializeTiffPages writes the metadata of pages as a single TIFF stream, as
+// SerializeTiff does for one descriptor, with one IFD per page chained in the
+// order of pages. Individual pages can therefore be modified, removed or
+// reordered before writing them back.
+//
+// All pages must have the same byte order and no thumbnail IFD, as returned
+// by ParseTiffAll. As with Serialize, values set by the application in any
+// page must be within spec, unless Control Force is set for that page.
+//
+// It returns the number of bytes written in case of success
+// or a non-nil error in case of failure.
+func SerializeTiffPages( w io.Writer, pages []TiffPage ) (written int, err error) {
+    defer func ( ) {
+        if err != nil { err = fmt.Errorf( "SerializeTiffPages: %w", err ) }
+    }()
+
+    if len(pages) == 0 {
+        return 0, fmt.Errorf( "no page\n" )
+    }
+    total := uint(_headerSize)
+    for i, p := range pages {
+        switch {
+        case p.Desc == nil || p.root == nil:
+            return 0, fmt.Errorf( "page %d: empty metadata\n", i )
+        case p.endian != pages[0].endian:
+            return 0, fmt.Errorf( "page %d: different byte order\n", i )
+        case p.root.next != nil:
+            return 0, fmt.Errorf( "page %d: thumbnail IFD not supported\n", i )
+        }
+        if err = p.checkWrite( ); err != nil {
+            return 0, fmt.Errorf( "page %d: %w", i, err )
+        }
+        total += uint(p.root.layout( ))
+    }
+    if total > math.MaxUint32 {
+        return 0, fmt.Errorf( "metadata size %d exceeds TIFF capacity\n", total )
+    }
+
+    if written, err = pages[0].serializeTiffHeader( w, 0 ); err != nil {
+        return
+    }
+    offset := uint32(_headerSize)
+    for i, p := range pages {
+        root := p.root
+        if i + 1 < len(pages) {     // link to the next page while writing
+            root.next = pages[i+1].root
+        }
+        var ns uint32
+        ns, err = root.serializeEntries( w, offset )
+        root.next = nil
+        if err != nil {
+            return
+        }
+        written += int(ns)
+        if ns, err = root.serializeDataArea( w, offset ); err != nil {
+            return
+        }
+        written += int(ns)
+        offset = root.dOffset
+    }
+    return
+}
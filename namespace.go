@@ -0,0 +1,153 @@
+package exif
+
+// support for dynamic IFD namespaces
+
+import (
+    "fmt"
+)
+
+/*
+    IFD namespaces PRIMARY to EMBEDDED are fixed and index arrays of _IFD_N
+    entries. Some IFDs do not fit those namespaces, for example maker notes
+    made of several sub-IFDs, each with its own tags. Such IFDs are given
+    dynamic namespaces, allocated while parsing from _IFD_N on.
+
+    A dynamic IfdId is a stable handle that can be given to all functions
+    taking an IfdId, as long as the descriptor exists. Dynamic namespaces are
+    shared by a descriptor and its maker note descriptors, so that maker note
+    IFDs are accessible from the main descriptor. Their parse statistics are
+    in Stats.Dynamic.
+
+    Maker notes may include IFDs embedded in their own IFD, such as the Nikon
+    preview image IFD. Those were initially all given the single EMBEDDED
+    namespace, which cannot hold several embedded IFDs, as defined by some
+    vendors. They are now given vendor-scoped dynamic namespaces, named after
+    the vendor and the IFD purpose, e.g. "NikonPreview". The namespace name is
+    reused if the same embedded IFD is parsed again.
+    EmbeddedIfds lists the embedded IFDs present in the metadata.
+*/
+
+// namespaces holds the dynamic namespaces, indexed by IfdId - _IFD_N
+type namespaces struct {
+    names   []string        // namespace names
+    ifds    []*ifdd         // namespace ifds, nil if not present or removed
+    embedded []bool         // true for vendor-scoped embedded namespaces
+}
+
+// newNamespace allocates a new dynamic namespace with the given name and
+// returns its id.
+func (d *Desc) newNamespace( name string ) IfdId {
+    d.ns.names = append( d.ns.names, name )
+    d.ns.ifds = append( d.ns.ifds, nil )
+    d.ns.embedded = append( d.ns.embedded, false )
+    return _IFD_N + IfdId(len(d.ns.ifds) - 1)
+}
+
+// embeddedNamespace returns the id of the vendor-scoped embedded namespace
+// with the given name, allocating it if it does not exist yet.
+func (d *Desc) embeddedNamespace( name string ) IfdId {
+    for i, n := range d.ns.names {
+        if n == name && d.ns.embedded[i] {
+            return _IFD_N + IfdId(i)
+        }
+    }
+    id := d.newNamespace( name )
+    d.ns.embedded[id - _IFD_N] = true
+    return id
+}
+
+// isEmbedded returns true if id is a vendor-scoped embedded namespace, or
+// the former EMBEDDED namespace.
+func (d *Desc) isEmbedded( id IfdId ) bool {
+    if id < _IFD_N {
+        return id == EMBEDDED
+    }
+    i := int(id - _IFD_N)
+    return i < len(d.ns.embedded) && d.ns.embedded[i]
+}
+
+// ifdCount returns the number of namespaces, fixed and dynamic: valid ids
+// are in [PRIMARY, ifdCount()).
+func (d *Desc) ifdCount( ) IfdId {
+    return _IFD_N + IfdId(len(d.ns.ifds))
+}
+
+// getIfd returns the ifd in namespace id or nil if it is not present
+func (d *Desc) getIfd( id IfdId ) *ifdd {
+    if id < _IFD_N {
+        return d.ifds[id]
+    }
+    if i := int(id - _IFD_N); i < len(d.ns.ifds) {
+        return d.ns.ifds[i]
+    }
+    return nil
+}
+
+// setIfd stores ifd in namespace id, which must be valid
+func (d *Desc) setIfd( id IfdId, ifd *ifdd ) {
+    if id < _IFD_N {
+        d.ifds[id] = ifd
+    } else {
+        d.ns.ifds[id - _IFD_N] = ifd
+    }
+}
+
+// getIfd returns the statistics for namespace id, allocating them for a new
+// dynamic namespace.
+func (s *Stats) getIfd( id IfdId ) *IfdStats {
+    if id < _IFD_N {
+        return &s.Ifds[id]
+    }
+    for int(id - _IFD_N) >= len(s.Dynamic) {
+        s.Dynamic = append( s.Dynamic, IfdStats{} )
+    }
+    return &s.Dynamic[id - _IFD_N]
+}
+
+// IfdName returns the name of the namespace id, fixed as given by GetIfdName
+// or dynamic as allocated while parsing.
+func (d *Desc)IfdName( id IfdId ) string {
+    if id < _IFD_N {
+        return GetIfdName( id )
+    }
+    if i := int(id - _IFD_N); i < len(d.ns.names) {
+        return d.ns.names[i]
+    }
+    return fmt.Sprintf( "Unknown Ifd (%d)", id )
+}
+
+// EmbeddedIfds returns information about the IFDs embedded in maker notes
+// that are present in the metadata, in IFD id order. Each one has its own
+// vendor-scoped namespace, whose Name identifies the vendor and the IFD
+// purpose, e.g. "NikonPreview". The Id can be given to all functions taking
+// an IfdId.
+func (d *Desc)EmbeddedIfds( ) (ii []IfdInfo) {
+    for _, info := range d.Ifds( ) {
+        if d.isEmbedded( info.Id ) {
+            ii = append( ii, info )
+        }
+    }
+    return
+}
+
+// firstEmbeddedIfd returns the first embedded IFD present, which stands for
+// the former EMBEDDED namespace, or nil if there is none.
+func (d *Desc) firstEmbeddedIfd( ) *ifdd {
+    for i, ifd := range d.ns.ifds {
+        if ifd != nil && d.ns.embedded[i] {
+            return ifd
+        }
+    }
+    return nil
+}
+
+// EmbeddedIfdId returns the id of the embedded IFD with the given name, as
+// given by EmbeddedIfds, or false if that IFD is not present.
+func (d *Desc)EmbeddedIfdId( name string ) (IfdId, bool) {
+    for i, n := range d.ns.names {
+        if n == name && d.ns.embedded[i] && d.ns.ifds[i] != nil {
+            return _IFD_N + IfdId(i), true
+        }
+    }
+    return 0, false
+}
@@ -0,0 +1,231 @@
+package exif
+
+// support for Nikon NEF raw compression metadata
+
+import (
+    "encoding/binary"
+    "fmt"
+    "io"
+)
+
+/*
+    Decoding a Nikon NEF raw image requires 2 maker note tags, besides the
+    raw image IFD itself: NEFCompression, which gives the compression method,
+    and NikonLinearizationTable, which gives the parameters of the compressed
+    data. The linearization table is laid out as follows, in the byte order
+    of the maker note:
+
+      offset  size
+        0       1   version, first byte (e.g. 0x44, 0x46 or 0x49)
+        1       1   version, second byte
+        2       8   vertical predictors: 2 x 2 _UnsignedShort, the initial
+                    values of the 2 first columns, for even and odd rows
+       10       2   curve size: number of points in the curve
+       12    2 x n  curve points, _UnsignedShort
+      562       2   split row, for version 0x44 0x20 only: the row from
+                    which the second Huffman table is used
+
+    For version 0x44 0x20 (lossy), the curve points are evenly spaced samples
+    of a curve of 2^BitsPerSample entries, which must be interpolated. For
+    other versions, except 0x46 (lossless, no curve), the curve is given in
+    full. Version 0x46 uses the lossless Huffman tables, the others the lossy
+    tables, and all switch to the 14-bit tables if BitsPerSample is 14.
+
+    If the first version byte is 0x49 or the second one is 0x58, 2110 more
+    bytes come before the predictors, and all following offsets but the split
+    row offset are shifted accordingly.
+*/
+
+// NEFCompression is the compression method of a NEF raw image, as given by
+// the Nikon maker note NEFCompression tag
+type NEFCompression uint16
+
+const (
+    NEFLossyType1 NEFCompression = 1 + iota
+    NEFUncompressed
+    NEFLossless
+    NEFLossyType2
+    NEFStripedPacked12
+    NEFUncompressedReduced12
+    NEFUnpacked12
+    NEFSmall
+    NEFPacked12
+    NEFPacked14
+    NEFHighEfficiency = 13
+    NEFHighEfficiencyStar = 14
+)
+
+func (c NEFCompression) String( ) string {
+    switch c {
+    case NEFLossyType1:             return "Lossy (type 1)"
+    case NEFUncompressed:           return "Uncompressed"
+    case NEFLossless:               return "Lossless"
+    case NEFLossyType2:             return "Lossy (type 2)"
+    case NEFStripedPacked12:        return "Striped Packed 12 bits"
+    case NEFUncompressedReduced12:  return "Uncompressed (reduced to 12 bit)"
+    case NEFUnpacked12:             return "Unpacked 12 bits"
+    case NEFSmall:                  return "Small"
+    case NEFPacked12:               return "Packed 12 bits"
+    case NEFPacked14:               return "Packed 14 bits"
+    case NEFHighEfficiency:         return "High Efficiency"
+    case NEFHighEfficiencyStar:     return "High Efficiency*"
+    }
+    return fmt.Sprintf( "Unknown (%d)", uint16(c) )
+}
+
+func (ifd *ifdd) storeNikon3NEFCompression() error {
+    fnc := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        io.WriteString( w, NEFCompression(v.([]uint16)[0]).String() )
+    }
+    return ifd.storeUnsignedShorts( "NEF Compression", 1, fnc )
+}
+
+// NikonLinearization gives the content of the Nikon linearization table
+type NikonLinearization struct {
+    Version     [2]byte         // table version
+    VPredictors [2][2]uint16    // initial vertical predictors
+    Curve       []uint16        // curve points, as stored
+    Split       uint16          // split row (version 0x44 0x20), or 0
+}
+
+const (
+    _nikonLinExtraSize  = 2110  // extra bytes in versions 0x49 & 0x58
+    _nikonLinCurve      = 12    // curve offset, after predictors & size
+    _nikonLinSplit      = 562   // split row offset (version 0x44 0x20)
+    _nikonLinMaxCurve   = 0x4001
+)
+
+// decodeNikonLinearization returns the linearization table encoded in data
+// with the given byte order, or an error if data is too short.
+func decodeNikonLinearization( data []byte,
+                               endian binary.ByteOrder ) (*NikonLinearization,
+                                                          error) {
+    if len(data) < _nikonLinCurve {
+        return nil, fmt.Errorf( "linearization table too short (%d bytes)\n",
+                                len(data) )
+    }
+    l := new( NikonLinearization )
+    l.Version[0], l.Version[1] = data[0], data[1]
+    p := data[2:]
+    if l.Version[0] == 0x49 || l.Version[1] == 0x58 {
+        if len(data) < _nikonLinExtraSize + _nikonLinCurve {
+            return nil, fmt.Errorf( "linearization table too short (%d bytes)\n",
+                                    len(data) )
+        }
+        p = data[2+_nikonLinExtraSize:]
+    }
+    for i := 0; i < 4; i++ {
+        l.VPredictors[i/2][i%2] = endian.Uint16( p[2*i:] )
+    }
+    n := int(endian.Uint16( p[8:] ))
+    if l.Version[0] != 0x46 && n <= _nikonLinMaxCurve {
+        if len(p) < 10 + 2 * n {
+            return nil, fmt.Errorf( "linearization curve too short (%d points)\n",
+                                    n )
+        }
+        l.Curve = make( []uint16, n )
+        decodeUint16s( l.Curve, p[10:], endian )
+    }
+    if l.IsLossySplit() && len(data) >= _nikonLinSplit + _ShortSize {
+        l.Split = endian.Uint16( data[_nikonLinSplit:] )
+    }
+    return l, nil
+}
+
+// IsLossySplit returns true for version 0x44 0x20, in which curve points are
+// samples to interpolate and the Huffman table changes at the split row.
+func (l *NikonLinearization) IsLossySplit( ) bool {
+    return l.Version[0] == 0x44 && l.Version[1] == 0x20
+}
+
+// IsLossless returns true if the lossless Huffman tables must be used
+func (l *NikonLinearization) IsLossless( ) bool {
+    return l.Version[0] == 0x46
+}
+
+// Expand returns the full linearization curve for the given number of bits
+// per sample (as given by the raw image BitsPerSample), with 2^bitsPerSample
+// entries, interpolating the curve points for version 0x44 0x20. For other
+// versions, the curve is returned as stored, or nil for version 0x46.
+func (l *NikonLinearization) Expand( bitsPerSample uint ) []uint16 {
+    if ! l.IsLossySplit() {
+        return l.Curve
+    }
+    max := (1 << bitsPerSample) & 0x7fff
+    n := len(l.Curve)
+    if n < 2 || max == 0 {
+        return l.Curve
+    }
+    step := max / (n - 1)
+    if step == 0 {
+        return l.Curve
+    }
+    curve := make( []uint16, max + step )
+    for i, v := range l.Curve {
+        curve[i*step] = v
+    }
+    for i := 0; i < max; i++ {
+        r := i % step
+        b := i - r
+        curve[i] = uint16( (int(curve[b]) * (step - r) +
+                            int(curve[b+step]) * r) / step )
+    }
+    return curve[:max]
+}
+
+func fmtNikonLinearization( ifd *ifdd, w io.Writer, v interface{},
+                             indent string ) {
+    l, err := decodeNikonLinearization( v.([]byte), ifd.desc.endian )
+    if err != nil {
+        fmt.Fprintf( w, "Invalid table (%d bytes)", len(v.([]byte)) )
+        return
+    }
+    fmt.Fprintf( w, "Version %#02x %#02x\n%sVertical predictors %d %d %d %d\n",
+                 l.Version[0], l.Version[1], indent,
+                 l.VPredictors[0][0], l.VPredictors[0][1],
+                 l.VPredictors[1][0], l.VPredictors[1][1] )
+    fmt.Fprintf( w, "%sCurve %d points", indent, len(l.Curve) )
+    if l.IsLossySplit() {
+        fmt.Fprintf( w, "\n%sSplit row %d", indent, l.Split )
+    }
+}
+
+func (ifd *ifdd) storeNikonLinearizationTable( ) error {
+    return ifd.storeUndefinedAsUnsignedBytes( "Linearization Table", 0,
+                                              fmtNikonLinearization )
+}
+
+// getNikonMaker returns the Nikon maker note ifd, or nil if there is none
+func (d *Desc) getNikonMaker( ) *ifdd {
+    if d.stats.MakerNote == "Nikon" {
+        return d.ifds[MAKER]
+    }
+    return nil
+}
+
+// GetNEFCompression returns the compression method given in the Nikon maker
+// note, or a non-nil error if there is no Nikon NEFCompression tag.
+func (d *Desc)GetNEFCompression( ) (NEFCompression, error) {
+    if maker := d.getNikonMaker( ); maker != nil {
+        if c, ok := maker.getUnsignedInteger( _Nikon3NEFCompression ); ok {
+            return NEFCompression(c), nil
+        }
+    }
+    return 0, fmt.Errorf( "GetNEFCompression: no NEF compression\n" )
+}
+
+// GetNikonLinearization returns the linearization table given in the Nikon
+// maker note, or a non-nil error if there is no Nikon linearization table or
+// if it cannot be decoded.
+func (d *Desc)GetNikonLinearization( ) (*NikonLinearization, error) {
+    if maker := d.getNikonMaker( ); maker != nil {
+        if lt, ok := maker.getValue( _NikonLinearizationTable ).(*unsignedByteValue); ok {
+            l, err := decodeNikonLinearization( lt.v, maker.desc.endian )
+            if err != nil {
+                return nil, fmt.Errorf( "GetNikonLinearization: %w", err )
+            }
+            return l, nil
+        }
+    }
+    return nil, fmt.Errorf( "GetNikonLinearization: no linearization table\n" )
+}
@@ -35,7 +35,6 @@ func checkNikon3Preview( ifd *ifdd ) error {
     default:
         return ifd.processUnknownTag( )
     }
-    return nil
 }
 
 const (             // Nikon Type 3 Maker note tags
@@ -53,8 +52,8 @@ const (             // Nikon Type 3 Maker note tags
     _Nikon3WhiteBalanceRBLevels      = 0x000c  // 4 _UnsignedRational
     _Nikon3ProgramShift              = 0x000d  // 4 _Undefined (bytes)
     _Nikon3ExposureDiff              = 0x000e  // 4 _Undefined (bytes)
-    _Nikon3ISOSelection                      = 0x000f  // _ASCIIString
-    _Nikon3DataDump                          = 0x0010  // n _Undefined (byte)
+    _Nikon3ISOSelection              = 0x000f  // _ASCIIString
+    _Nikon3DataDump                  = 0x0010  // n _Undefined (byte)
     _Nikon3Preview                   = 0x0011  // 1 _undefined -> embedded IFD
     _Nikon3FlashExposureCompensation = 0x0012  // 1 _SignedByte (-128,+127)
     _Nikon3ISOSpeedRequested         = 0x0013  // 2 _SignedShort (0, speed)
@@ -64,7 +63,7 @@ const (             // Nikon Type 3 Maker note tags
     _Nikon3ExtFlashExposureComp      = 0x0017  // 4 __Undefined (bytes)
     _Nikon3AEBracketCompensation     = 0x0018  // 4 _Undefined (bytes)
     _Nikon3ExposureBracketValue      = 0x0019  // 1 _SignedRational
-    _Nikon3ImageProcessing                   = 0x001a  // string
+    _Nikon3ImageProcessing           = 0x001a  // _ASCIIString
     _Nikon3CropHiSpeed               = 0x001b  // 7 _UnsignedShort
     _Nikon3ExposureTuning            = 0x001c  // 3 _Undefined (bytes)
     _Nikon3SerialNumber              = 0x001d  // string
@@ -79,29 +78,29 @@ const (             // Nikon Type 3 Maker note tags
     _Nikon3DistortInfo               = 0x002b  // 16 _Undefined
     _Nikon302c                       = 0x002c  // 94 _Undefined
 
-    _Nikon3ImageAdjustment                   = 0x0080  // _ASCIIString
-    _Nikon3ToneCompensation                  = 0x0081  // _ASCIIString
-    _Nikon3AuxillaryLens                     = 0x0082  // _ASCIIString
+    _Nikon3ImageAdjustment           = 0x0080  // _ASCIIString
+    _Nikon3ToneCompensation          = 0x0081  // _ASCIIString
+    _Nikon3AuxillaryLens             = 0x0082  // _ASCIIString
     _Nikon3LensType                  = 0x0083  // _UnsignedByte
     _Nikon3LensInfo                  = 0x0084  // 1 _UnsignedRational 
-    _Nikon3ManualFocusDistance               = 0x0085  // 1 _SignedByte
-    _Nikon3DigitalZoomFactor                 = 0x0086  // 1 _SignedByte
+    _Nikon3ManualFocusDistance       = 0x0085  // 1 _UnsignedRational
+    _Nikon3DigitalZoomFactor         = 0x0086  // 1 _UnsignedRational
     _Nikon3FlashMode                 = 0x0087  // 1 _UnsignedByte
-    _Nikon3AutoFocusArea                     = 0x0088  // 3 _SignedByte
+    _Nikon3AutoFocusArea             = 0x0088  // 4 _Undefined
     _Nikon3ShootingMode              = 0x0089  // 1 _UnsignedShort
     _Nikon308a                       = 0x008a  // 1 _UnsignedShort
     _Nikon3LensFStops                = 0x008b  // 4 _Undefined
-    _Nikon3ContrastCurve                     = 0x008c  // ? _Undefined
-    _Nikon3ColorHue                          = 0x008d  // string
+    _Nikon3ContrastCurve             = 0x008c  // n _Undefined
+    _Nikon3ColorHue                  = 0x008d  // _ASCIIString
 
-    _Nikon3SceneMode                         = 0x008f  // 1 _UnsignedByte
-    _Nikon3LightSource                       = 0x0090  // 1 string
+    _Nikon3SceneMode                 = 0x008f  // _ASCIIString
+    _Nikon3LightSource               = 0x0090  // _ASCIIString
     _Nikon3ShotInfo                  = 0x0091  // n _Undefined
-    _Nikon3HueAdjustment                     = 0x0092  // 1 _UnsignedByte
-    _Nikon3NEFCompression                    = 0x0093  // 1 _UnsignedShort
-    _Nikon3Saturation                        = 0x0094  // 1 _SignedByte
+    _Nikon3HueAdjustment             = 0x0092  // 1 _SignedShort
+    _Nikon3NEFCompression            = 0x0093  // 1 _UnsignedShort
+    _Nikon3Saturation                = 0x0094  // 1 _SignedShort
     _Nikon3NoiseReduction            = 0x0095  // _ASCIIString
-    _NikonLinearizationTable                 = 0x0096  // ? _Undefined
+    _NikonLinearizationTable         = 0x0096  // n _Undefined
     _Nikon3ColorBalance              = 0x0097  // 1302 _Undefined
     _Nikon3LensData                  = 0x0098  // 33 _Undefined
 
@@ -113,9 +112,9 @@ const (             // Nikon Type 3 Maker note tags
 
     _Nikon3ShutterCount              = 0x00a7  // 1 _UnsignedLong
     _Nikon3FlashInfo                 = 0x00a8  // 2 _undefined
-    _Nikon3ImageOptimization                 = 0x00a9  // string
+    _Nikon3ImageOptimization         = 0x00a9  // _ASCIIString
 
-    _Nikon3Saturation2                       = 0x00aa  // string
+    _Nikon3Saturation2               = 0x00aa  // _ASCIIString
     _Nikon3DigitalVariProgram        = 0x00ab  // _ASCIIString
 
     _Nikon3MultiExposure             = 0x00b0  // 16 _Undefined
@@ -133,17 +132,33 @@ func (ifd *ifdd)storeNikon3Version( ) error {
         return fmt.Errorf( "storeNikon3Version: incorrect type (%s)\n",
                             getTiffTString( ifd.fType ) )
     }
-    if ifd.fCount != 4 {
-        return fmt.Errorf( "storeNikon3Version: incorrect count (%s)\n",
-                           ifd.fCount )
+    if err := ifd.validateCount( "storeNikon3Version", 4, 4 ); err != nil {
+        return err
     }
     text := ifd.getUnsignedBytes()
     ifd.storeValue( ifd.newAsciiStringValue( "Nikon maker note type 3 version", text ) )
+    if ! isNikon3Version( text ) {
+        ifd.makerWarning( "Nikon", "unexpected version %q", text )
+    }
     return nil
 }
 
+// isNikon3Version returns true if version is made of 4 digits starting with
+// "02", as in all type 3 maker notes.
+func isNikon3Version( version []byte ) bool {
+    if len(version) != 4 || version[0] != '0' || version[1] != '2' {
+        return false
+    }
+    for _, c := range version[2:] {
+        if c < '0' || c > '9' {
+            return false
+        }
+    }
+    return true
+}
+
 func (ifd *ifdd) storeNikon3ISOSpeed( name string ) error {
-    fnis := func ( w io.Writer, v interface{}, indent string ) {
+    fnis := func ( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         is := v.([]uint16)
         var hi string
         if is[0] == 1 {
@@ -159,7 +174,7 @@ func (ifd *ifdd) storeNikon3UndefinedFraction( name string, count uint32,
     if count < 3 {
         panic("storeNikon3UndefinedFraction: too few bytes\n")
     }
-    ff := func( w io.Writer, v interface{}, indent string ) {
+    ff := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         f := v.([]int8)
 //        fmt.Printf( "%d, %d, %d, %d\n", f[0], f[1], f[2], f[3] )
         if f[2] == 0 {
@@ -174,7 +189,7 @@ func (ifd *ifdd) storeNikon3UndefinedFraction( name string, count uint32,
 }
 
 func (ifd *ifdd) storeNikon3ImageBoundary( ) error {
-    fib := func( w io.Writer, v interface{}, indent string ) {
+    fib := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         ib := v.([]uint16)
         fmt.Fprintf( w, "top-left: %d,%d bottom-right %d,%d",
                     ib[0], ib[1], ib[2], ib[3] )
@@ -190,7 +205,7 @@ var cropCodes = [...]string{
             "", "1:1 Crop" }
 
 func (ifd *ifdd) storeNikon3CropHiSpeed( ) error {
-    fchs := func( w io.Writer, v interface{}, indent string ) {
+    fchs := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         chs := v.([]uint16)
         if chs[0] < 18 {
             code := cropCodes[chs[0]]
@@ -200,13 +215,13 @@ func (ifd *ifdd) storeNikon3CropHiSpeed( ) error {
             }
         }
         fmt.Fprintf( w, "%dx%d cropped to %dx%d at pixel %d,%d",
-                    chs[0], chs[1], chs[2], chs[3], chs[4], chs[5], chs[6] )
+                    chs[1], chs[2], chs[3], chs[4], chs[5], chs[6] )
     }
     return ifd.storeUnsignedShorts( "Crop High Speed", 7, fchs )
 }
 
 func (ifd *ifdd) storeNikon3ColorSpace( ) error {
-    fcs := func( w io.Writer, v interface{}, indent string ) {
+    fcs := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         cs := v.([]uint16)
         var csString string
         switch cs[0] {
@@ -220,7 +235,7 @@ func (ifd *ifdd) storeNikon3ColorSpace( ) error {
 }
 
 func (ifd *ifdd) storeNikon3VRInfo( ) error {
-    fvr := func( w io.Writer, v interface{}, indent string ) {
+    fvr := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         cs := v.([]uint8)
         version := string(cs[0:4])
         var state string
@@ -243,7 +258,7 @@ func (ifd *ifdd) storeNikon3VRInfo( ) error {
 }
 
 func (ifd *ifdd) storeNikon3ActiveSLighting( ) error {
-    fal := func( w io.Writer, v interface{}, indent string ) {
+    fal := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         al := v.([]uint16)
         var als string
         switch al[0] {
@@ -265,7 +280,7 @@ func (ifd *ifdd) storeNikon3ActiveSLighting( ) error {
 }
 
 func (ifd *ifdd) storeNikon3PictureControlData( ) error {
-    fpcd := func( w io.Writer, v interface{}, indent string ) {
+    fpcd := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         pcd := v.([]uint8)
 //        dumpData( w, "Picture Control Data", "     ", false, pcd )
         var version = string(pcd[0:4])
@@ -307,7 +322,7 @@ func (ifd *ifdd) storeNikon3PictureControlData( ) error {
 }
 
 func (ifd *ifdd) storeNikon3WorldTime( ) error {
-    fwt := func( w io.Writer, v interface{}, indent string ) {
+    fwt := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         wt := v.([]uint8)
         tz := int16(ifd.desc.endian.Uint16( wt ))
         var sign string
@@ -345,7 +360,7 @@ func (ifd *ifdd) storeNikon3WorldTime( ) error {
 }
 
 func (ifd *ifdd) storeNikon3ISOInfo( ) error {
-    fiso := func( w io.Writer, v interface{}, indent string ) {
+    fiso := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         iso := v.([]uint8)
 //        dumpData( w, "ISO", "     ", false, iso )
         val := 100  * (1 << ((uint16(iso[0])/12)-5))
@@ -405,7 +420,7 @@ func (ifd *ifdd) storeNikon3ISOInfo( ) error {
 }
 
 func (ifd *ifdd) storeNikon3DistortInfo( ) error {
-    fdi := func( w io.Writer, v interface{}, indent string ) {
+    fdi := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         di := v.([]uint8)
 //        dumpData( w, "Distortion", "     ", false, di )
         version := string(di[:4])
@@ -431,7 +446,7 @@ func makeStringFromBits( v uint16, sa[]string ) string {
 }
 
 func (ifd *ifdd) storeNikon3LensType( ) error {
-    flt := func( w io.Writer, v interface{}, indent string ) {
+    flt := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         lt := v.([]uint8)
         s := makeStringFromBits( uint16(lt[0]),
                                  []string{ "MF ", "D ", "G ", "VR ", 
@@ -442,7 +457,7 @@ func (ifd *ifdd) storeNikon3LensType( ) error {
 }
 
 func (ifd *ifdd) storeNikon3LensInfo( ) error {
-    fli := func( w io.Writer, v interface{}, indent string ) {
+    fli := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         li := v.([]UnsignedRational)
 // TODO
         fmt.Fprintf( w, "Hex %v", li )
@@ -451,7 +466,7 @@ func (ifd *ifdd) storeNikon3LensInfo( ) error {
 }
 
 func (ifd *ifdd) storeNikon3FlashMode() error {
-    ffm := func( w io.Writer, v interface{}, indent string ) {
+    ffm := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         fm := v.([]uint8)
         var m string
         switch fm[0] {
@@ -470,7 +485,7 @@ func (ifd *ifdd) storeNikon3FlashMode() error {
 }
 
 func (ifd *ifdd) storeNikon3ShootingMode() error {
-    fsm := func( w io.Writer, v interface{}, indent string ) {
+    fsm := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         sm := v.([]uint16)
         //fmt.Printf( "%#04x\n", sm[0] )
         var sf string
@@ -527,19 +542,38 @@ var xlat1 = [256]byte {
 0x3b,0x2d,0xeb,0x25,0x49,0xfa,0xa3,0xaa,0x39,0xa7,0xc5,0xa7,0x50,0x11,0x36,0xfb,
 0xc6,0x67,0x4a,0xf5,0xa5,0x12,0x65,0x7e,0xb0,0xdf,0xaf,0x4e,0xb3,0x61,0x7f,0x2f }
 
+// getNikon3Keys returns the descrambling keys, which are given by the serial
+// number and the shutter count. Those values are stored in the same maker note
+// IFD as the scrambled data, in any order, so that keys are only looked for
+// when scrambled data is formatted or accessed, after the whole IFD is parsed.
+func (ifd *ifdd) getNikon3Keys( ) (serial, count uint32, err error) {
+    s, ok := ifd.getAsciiString( _Nikon3SerialNumber )
+    if ! ok || len(s) < 7 {
+        return 0, 0, fmt.Errorf( "getNikon3Keys: missing serial key\n" )
+    }
+    n, err := strconv.Atoi( s[:7] )
+    if err != nil {
+        return 0, 0, fmt.Errorf( "getNikon3Keys: invalid serial key: %w", err )
+    }
+    count, ok = ifd.getUnsignedInteger( _Nikon3ShutterCount )
+    if ! ok {
+        return 0, 0, fmt.Errorf( "getNikon3Keys: missing count key\n" )
+    }
+    return uint32(n), count, nil
+}
+
 // descramble creates a descrambled copy of the received data: it does not modify
 // the original data, which can then be stored. This is appropriate since those
 // data can be preserved or removed but not modified after parsing. If we were to
 // allow modifying the scrambled data we would need a function to re-scramble them
 // after modification. This is doable but not necessary in this version.
 func (ifd *ifdd) descramble( data []byte ) ([]byte, error) {
-    serial, ok := ifd.desc.global["serialKey"].(uint32)
-    if ! ok {
-        return []byte{}, fmt.Errorf( "descramble: missing serial key\n" )
+    if ifd.desc.NoDescramble {
+        return []byte{}, fmt.Errorf( "descramble: descrambling is disabled\n" )
     }
-    count, ok := ifd.desc.global["countKey"].(uint32)
-    if ! ok {
-        return []byte{}, fmt.Errorf( "descramble: missing count key\n" )
+    serial, count, err := ifd.getNikon3Keys( )
+    if err != nil {
+        return []byte{}, fmt.Errorf( "descramble: %w", err )
     }
 //fmt.Printf("Serial: %#08x count: %#08x\n", serial, count )
     sKey := byte(serial & 0xff)
@@ -564,40 +598,103 @@ func (ifd *ifdd) descramble( data []byte ) ([]byte, error) {
     return dsc, nil
 }
 
+// Layouts of some Nikon scrambled data depend on the camera model. They are
+// given by nikonLayouts, a registry mapping the camera model, as found in the
+// primary IFD Model tag, to the offsets to use for that model.
+type nikonLayout struct {
+    shotInfoVersion     string  // expected ShotInfo version
+    shotInfoSize        int     // expected ShotInfo size
+    shotInfoScrambled   int     // end of scrambled data (starting at 4)
+    firmwareOffset      int     // firmware version (5 chars) in scrambled data
+
+    colorBalanceVersion string  // expected ColorBalance version
+    wbLevelsOffset      int     // offset of scrambled data with WB levels
+    wbLevelsSize        int     // scrambled data size
+    wbGRBGOffset        int     // WB_GRBGLevels in scrambled data
+}
+
+var nikonLayouts = map[string]*nikonLayout {
+    "NIKON D5000": &nikonLayout{
+        shotInfoVersion: "0215", shotInfoSize: 6745,
+        shotInfoScrambled: 0x39a-4, firmwareOffset: 0,
+        colorBalanceVersion: "0211",
+        wbLevelsOffset: 284, wbLevelsSize: 24, wbGRBGOffset: 16,
+    },
+}
+
+// getNikonLayout returns the layout corresponding to the camera model, and the
+// model itself, or nil if the model is unknown.
+func (ifd *ifdd) getNikonLayout( ) (*nikonLayout, string) {
+    model := ifd.desc.global.model
+    return nikonLayouts[model], strings.TrimPrefix( model, "NIKON " )
+}
+
 func (ifd *ifdd) storeNikon3ShotInfo( ) error {
-    fu := func( w io.Writer, v interface{}, indent string ) {
+    fu := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         d := v.([]uint8)
-        if string(d[0:4]) == "0215" && len(d) == 6745 {
-            dsc, err := ifd.descramble( d[4:0x39a-4] )
+        l, model := ifd.getNikonLayout( )
+        if l != nil && string(d[0:4]) == l.shotInfoVersion &&
+           len(d) == l.shotInfoSize {
+            dsc, err := ifd.descramble( d[4:l.shotInfoScrambled] )
             if err == nil {
                 fmt.Fprintf( w, "Version: %s (%s) Firmware: %s",
-                        string(d[0:4]), "D5000", string(dsc[0:5]) )
+                        string(d[0:4]), model,
+                        string(dsc[l.firmwareOffset:l.firmwareOffset+5]) )
                 return
             }
         }
         fmt.Fprintf( w, "Version %s", string(d[0:4]) )
     }
-    return ifd.storeUndefinedAsUnsignedBytes( "Shot Info", 0, fu )
+    if err := ifd.storeUndefinedAsUnsignedBytes( "Shot Info", 0, fu ); err != nil {
+        return err
+    }
+    if l, _ := ifd.getNikonLayout( ); l != nil {
+        if ifd.fCount < 4 || string(ifd.getUnsignedBytes()[0:4]) != l.shotInfoVersion {
+            ifd.makerWarning( "Nikon", "unexpected ShotInfo version, expected %s",
+                              l.shotInfoVersion )
+        } else if ifd.fCount != uint32(l.shotInfoSize) {
+            ifd.makerWarning( "Nikon", "unexpected ShotInfo size %d, expected %d",
+                              ifd.fCount, l.shotInfoSize )
+        }
+    }
+    return nil
 }
 
 func (ifd *ifdd) storeNikon3ColorBalance( ) error {
-    fu := func( w io.Writer, v interface{}, indent string ) {
+    fu := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         d := v.([]uint8)
-        if string(d[0:4]) == "0211" {
-            dsc, err := ifd.descramble( d[284:284+24] )
+        l, model := ifd.getNikonLayout( )
+        if l != nil && string(d[0:4]) == l.colorBalanceVersion &&
+           len(d) >= l.wbLevelsOffset + l.wbLevelsSize {
+            dsc, err := ifd.descramble(
+                            d[l.wbLevelsOffset:l.wbLevelsOffset+l.wbLevelsSize] )
             if err == nil {
-                wbL0 := ifd.desc.endian.Uint16(dsc[16:])
-                wbL1 := ifd.desc.endian.Uint16(dsc[18:])
-                wbL2 := ifd.desc.endian.Uint16(dsc[20:])
-                wbL3 := ifd.desc.endian.Uint16(dsc[22:])
+                wb := dsc[l.wbGRBGOffset:]
+                wbL0 := ifd.desc.endian.Uint16(wb[0:])
+                wbL1 := ifd.desc.endian.Uint16(wb[2:])
+                wbL2 := ifd.desc.endian.Uint16(wb[4:])
+                wbL3 := ifd.desc.endian.Uint16(wb[6:])
                 fmt.Fprintf( w, "Version: %s (%s) WB_GRBGLevels: %d %d %d %d",
-                        string(d[0:4]), "D5000", wbL0, wbL1, wbL2, wbL3 )
+                        string(d[0:4]), model, wbL0, wbL1, wbL2, wbL3 )
                 return
             }
         }
         fmt.Fprintf( w, "Version %s", string(d[0:4]) )
     }
-    return ifd.storeUndefinedAsUnsignedBytes( "Color Balance", 0, fu )
+    if err := ifd.storeUndefinedAsUnsignedBytes( "Color Balance", 0, fu ); err != nil {
+        return err
+    }
+    if l, _ := ifd.getNikonLayout( ); l != nil {
+        if ifd.fCount < 4 ||
+           string(ifd.getUnsignedBytes()[0:4]) != l.colorBalanceVersion {
+            ifd.makerWarning( "Nikon", "unexpected ColorBalance version, expected %s",
+                              l.colorBalanceVersion )
+        } else if ifd.fCount < uint32(l.wbLevelsOffset + l.wbLevelsSize) {
+            ifd.makerWarning( "Nikon", "ColorBalance too short (%d bytes)",
+                              ifd.fCount )
+        }
+    }
+    return nil
 }
 
 func getNikonAperture( v uint8 ) float64 { return math.Exp2(float64(v)/24) }
@@ -616,7 +713,7 @@ func getNikonFocusDistanceString( v uint8 ) string {
 }
 
 func (ifd *ifdd) storeNikon3LensData( ) error {
-    fld := func( w io.Writer, v interface{}, indent string ) {
+    fld := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         d := v.([]uint8)
         if string(d[0:4]) == "0204" {
             dsc, err := ifd.descramble( d[4:] )
@@ -656,7 +753,7 @@ func (ifd *ifdd) storeNikon3LensData( ) error {
 }
 
 func (ifd *ifdd) storeNikon3DateStampMode() error {
-    fds := func( w io.Writer, v interface{}, indent string ) {
+    fds := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         ds := v.([]uint16)
         var dss string
         switch ds[0] {
@@ -718,7 +815,7 @@ var nikonRetouchValues = [...]string{
  "Super Vivid",         "High-contrast Monochrome", "High Key",     "Low Key" }
 
 func (ifd *ifdd) storeNikon3RetouchHistory() error {
-    frh := func( w io.Writer, v interface{}, indent string ) {
+    frh := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         rh := v.([]uint16)
         fmt.Fprintf( w, "%s", getNikonRetouchString( rh ) )
     }
@@ -726,7 +823,7 @@ func (ifd *ifdd) storeNikon3RetouchHistory() error {
 }
 
 func (ifd *ifdd) storeNikon3ImageSize() error {
-    fis := func( w io.Writer, v interface{}, indent string ) {
+    fis := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         is := v.([]uint32)
         fmt.Fprintf( w, "%d", is[0] )
     }
@@ -734,7 +831,7 @@ func (ifd *ifdd) storeNikon3ImageSize() error {
 }
 
 func (ifd *ifdd) storeNikon3ShutterCount() error {
-    fsc := func( w io.Writer, v interface{}, indent string ) {
+    fsc := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         sc := v.([]uint32)
         fmt.Fprintf( w, "%d", sc[0] )
     }
@@ -798,7 +895,7 @@ func getFlashControlMode( code uint8 ) (m string) {
 }
 
 func (ifd *ifdd) storeNikon3FlashInfo() error {
-    ffi := func( w io.Writer, v interface{}, indent string ) {
+    ffi := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         fi := v.([]uint8)
 //        dumpData( w, "Raw data", "     ", false, fi )
         fmt.Fprintf( w, "Version %s", string(fi[0:4]) )
@@ -841,17 +938,15 @@ func getNikonOnOff( b bool ) string {
     return "Off"
 }
 
+// multi exposure version "0101" is always little endian
+var nikonMultiExposureEndian = blobEndian{ 3, []byte{ 0x31 }, binary.LittleEndian }
+
 func (ifd *ifdd) storeNikon3MultiExposure() error {
-    fme := func( w io.Writer, v interface{}, indent string ) {
+    fme := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         me := v.([]uint8)
 //        dumpData( os.Stdout, "Raw data", "     ", false, me )
         fmt.Fprintf( w, "Version %s", string(me[0:4]) )
-        var endian binary.ByteOrder
-        if me[3] == 0x31 {
-            endian = binary.LittleEndian
-        } else {
-            endian = ifd.desc.endian
-        }
+        endian := nikonMultiExposureEndian.get( me, ifd.desc.endian )
         shots := endian.Uint32(me[8:12])
         fmt.Fprintf( w, " Mode %s (%d shots)",
                     getNikonMultiExposureMode(endian.Uint32(me[4:8])), shots )
@@ -876,7 +971,7 @@ func getNikon3HignISONoiseReduction( hnr uint16 ) (s string) {
 }
 
 func (ifd *ifdd) storeNikon3HighISONoiseReduction() error {
-    fhnr := func( w io.Writer, v interface{}, indent string ) {
+    fhnr := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         hnr := v.([]uint16)
         fmt.Fprintf( w, "%s", getNikon3HignISONoiseReduction( hnr[0] ) )
     }
@@ -884,7 +979,7 @@ func (ifd *ifdd) storeNikon3HighISONoiseReduction() error {
 }
 
 func (ifd *ifdd) storeNikon3PowerUpTime() error {
-    fpu := func( w io.Writer, v interface{}, indent string ) {
+    fpu := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         pu := v.([]uint8)
 //        dumpData( w, "Raw data", "     ", false, pu )
 // 0x0000: 07 e5 06 0d 0e 1a 31 00 
@@ -1004,7 +1099,7 @@ func getNikon3AFPointsUsed( e binary.ByteOrder, v []uint8 ) string {
 }
 
 func (ifd *ifdd) storeNikon3AFInfo2() error {
-    fafi := func( w io.Writer, v interface{}, indent string ) {
+    fafi := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         afi := v.([]uint8)
 //        dumpData( w, "Raw data", "     ", false, afi )
 // 0x0000: 30 31 30 30 00 00 02 0b 00 04 00 00 00 00 00 00 0100............
@@ -1037,7 +1132,7 @@ func (ifd *ifdd) storeNikon3AFInfo2() error {
 }
 
 func (ifd *ifdd) storeNikon3FileInfo() error {
-    ffi := func( w io.Writer, v interface{}, indent string ) {
+    ffi := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         fi := v.([]uint8)
         fmt.Fprintf( w, "Version %s Memory card %d Directory # %d file # %d",
                      string(fi[0:4]), ifd.desc.endian.Uint16(fi[4:6]),
@@ -1048,7 +1143,7 @@ func (ifd *ifdd) storeNikon3FileInfo() error {
 }
 
 func (ifd *ifdd) storeNikon3RetouchInfo() error {
-    fri := func( w io.Writer, v interface{}, indent string ) {
+    fri := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         ri := v.([]uint8)
 //        dumpData( q, "Raw data", "     ", false, ri )
 //      0x0000: 30 31 30 30 ff 00                               0100..
@@ -1060,15 +1155,92 @@ func (ifd *ifdd) storeNikon3RetouchInfo() error {
     return ifd.storeUndefinedAsUnsignedBytes( "Retouch Info", 0, fri )
 }
 
-func getRationalString( v UnsignedRational) string {
-    if v.Denominator == 0 {
-        return "Inf"
+func (ifd *ifdd) storeNikon3ManualFocusDistance() error {
+    fmf := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        mf := v.([]UnsignedRational)[0]
+        if mf.Numerator == 0 || ! mf.IsValid( ) {
+            io.WriteString( w, "n/a" )
+            return
+        }
+        fmt.Fprintf( w, "%s m", getRationalString( mf ) )
+    }
+    return ifd.storeUnsignedRationals( "Manual Focus Distance", 1, fmf )
+}
+
+func (ifd *ifdd) storeNikon3DigitalZoom() error {
+    fdz := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        dz := v.([]UnsignedRational)[0]
+        if ! dz.IsValid( ) || dz.Numerator <= dz.Denominator {
+            io.WriteString( w, "None" )
+            return
+        }
+        fmt.Fprintf( w, "%sx", getRationalString( dz ) )
+    }
+    return ifd.storeUnsignedRationals( "Digital Zoom", 1, fdz )
+}
+
+var nikon3AFPoints = [...]string{
+            "Center", "Top", "Bottom", "Mid-left", "Mid-right", "Upper-left",
+            "Upper-right", "Lower-left", "Lower-right", "Far Left", "Far Right" }
+
+func getNikon3AFPoint( v uint8 ) string {
+    if int(v) < len(nikon3AFPoints) {
+        return nikon3AFPoints[v]
+    }
+    return fmt.Sprintf( "Unknown (%d)", v )
+}
+
+func (ifd *ifdd) storeNikon3AFInfo() error {
+    fai := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        ai := v.([]uint8)
+        var m string
+        switch ai[0] {
+        case 0: m = "Single Area"
+        case 1: m = "Dynamic Area"
+        case 2: m = "Dynamic Area (closest subject)"
+        case 3: m = "Group Dynamic"
+        case 4: m = "Single Area (wide)"
+        case 5: m = "Dynamic Area (wide)"
+        default: m = fmt.Sprintf( "Unknown (%d)", ai[0] )
+        }
+        fmt.Fprintf( w, "AF Area Mode: %s\n%sAF Point: %s\n%sAF Points In Focus: ",
+                     m, indent, getNikon3AFPoint( ai[1] ), indent )
+        inFocus := ifd.desc.endian.Uint16( ai[2:] )
+        if inFocus == 0 {
+            io.WriteString( w, "(none)" )
+            return
+        }
+        var points []string
+        for i := range nikon3AFPoints {
+            if inFocus & (1 << uint(i)) != 0 {
+                points = append( points, nikon3AFPoints[i] )
+            }
+        }
+        io.WriteString( w, strings.Join( points, ", " ) )
     }
-    return fmt.Sprintf( "%.3f", float32(v.Numerator)/float32(v.Denominator) )
+    return ifd.storeUndefinedAsUnsignedBytes( "AF Info", 4, fai )
+}
+
+func (ifd *ifdd) storeNikon3HueAdjustment() error {
+    fha := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        fmt.Fprintf( w, "%d degrees", v.([]int16)[0] )
+    }
+    return ifd.storeSignedShorts( "Hue Adjustment", 1, fha )
+}
+
+func (ifd *ifdd) storeNikon3Saturation() error {
+    fsa := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        fmt.Fprintf( w, "%+d", v.([]int16)[0] )
+    }
+    return ifd.storeSignedShorts( "Saturation Adjustment", 1, fsa )
+}
+
+func getRationalString( v UnsignedRational) string {
+    return v.format( "%.3f" )
 }
 
 func (ifd *ifdd) storeNikom3WhiteBalanceRBLevels() error {
-    fwb := func( w io.Writer, v interface{}, indent string ) {
+    fwb := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         wb := v.([]UnsignedRational)
         fmt.Fprintf( w, "%s %s %s %s",
                      getRationalString(wb[0]), getRationalString(wb[1]),
@@ -1107,8 +1279,14 @@ func storeNikon3Tags( ifd *ifdd ) error {
         return ifd.storeNikon3UndefinedFraction( "Nikon Program Shift", 4, "" )
     case _Nikon3ExposureDiff:
         return ifd.storeNikon3UndefinedFraction( "Nikon Exposure Difference", 4, "" )
+    case _Nikon3ISOSelection:
+        return ifd.storeAsciiString( "Nikon ISO Selection" )
+    case _Nikon3DataDump:
+        return ifd.storeUndefinedAsUnsignedBytes( "Nikon Data Dump", 0, nil )
     case _Nikon3Preview:
-        return ifd.storeEmbeddedIfd( "Nikon Preview", EMBEDDED, checkNikon3Preview )
+        return ifd.storeEmbeddedIfd( "Nikon Preview",
+                                     ifd.desc.embeddedNamespace( "NikonPreview" ),
+                                     checkNikon3Preview )
     case _Nikon3FlashExposureCompensation:
         return ifd.storeNikon3UndefinedFraction( "Nikon Flash Exposure Compensation",
                                            4, " EV" )
@@ -1123,6 +1301,8 @@ func storeNikon3Tags( ifd *ifdd ) error {
         return ifd.storeNikon3UndefinedFraction( "Nikon AE Bracket Compensation", 4, " EV" )
     case _Nikon3ExposureBracketValue:
         return ifd.storeSignedRationals( "Nikon Exposure Bracket Value", 1, nil )
+    case _Nikon3ImageProcessing:
+        return ifd.storeAsciiString( "Image Processing" )
     case _Nikon3CropHiSpeed:
         return ifd.storeNikon3CropHiSpeed( )
     case _Nikon3ExposureTuning:
@@ -1144,21 +1324,49 @@ func storeNikon3Tags( ifd *ifdd ) error {
     case _Nikon3DistortInfo:
         return ifd.storeNikon3DistortInfo( )
 
+    case _Nikon3ImageAdjustment:
+        return ifd.storeAsciiString( "Image Adjustment" )
+    case _Nikon3ToneCompensation:
+        return ifd.storeAsciiString( "Tone Compensation" )
+    case _Nikon3AuxillaryLens:
+        return ifd.storeAsciiString( "Auxiliary Lens" )
     case _Nikon3LensType:
         return ifd.storeNikon3LensType( )
     case _Nikon3LensInfo:
         return ifd.storeExifLensSpecification( )
+    case _Nikon3ManualFocusDistance:
+        return ifd.storeNikon3ManualFocusDistance( )
+    case _Nikon3DigitalZoomFactor:
+        return ifd.storeNikon3DigitalZoom( )
     case _Nikon3FlashMode:
         return ifd.storeNikon3FlashMode( )
+    case _Nikon3AutoFocusArea:
+        return ifd.storeNikon3AFInfo( )
     case _Nikon3ShootingMode:
         return ifd.storeNikon3ShootingMode( )
 
     case _Nikon3LensFStops:
         return ifd.storeNikon3UndefinedFraction( "Lens F Stops", 4, "" )
+    case _Nikon3ContrastCurve:
+        return ifd.storeUndefinedAsUnsignedBytes( "Contrast Curve", 0, nil )
+    case _Nikon3ColorHue:
+        return ifd.storeAsciiString( "Color Hue" )
+    case _Nikon3SceneMode:
+        return ifd.storeAsciiString( "Scene Mode" )
+    case _Nikon3LightSource:
+        return ifd.storeAsciiString( "Light Source" )
     case _Nikon3ShotInfo:
         return ifd.storeNikon3ShotInfo( )
+    case _Nikon3HueAdjustment:
+        return ifd.storeNikon3HueAdjustment( )
+    case _Nikon3NEFCompression:
+        return ifd.storeNikon3NEFCompression( )
+    case _Nikon3Saturation:
+        return ifd.storeNikon3Saturation( )
     case _Nikon3NoiseReduction:
         return ifd.storeAsciiString( "Noise Reduction" )
+    case _NikonLinearizationTable:
+        return ifd.storeNikonLinearizationTable( )
     case _Nikon3ColorBalance:
         return ifd.storeNikon3ColorBalance( )
     case _Nikon3LensData:
@@ -1174,6 +1382,10 @@ func storeNikon3Tags( ifd *ifdd ) error {
         return ifd.storeNikon3ShutterCount( )
     case _Nikon3FlashInfo:
         return ifd.storeNikon3FlashInfo( )
+    case _Nikon3ImageOptimization:
+        return ifd.storeAsciiString( "Image Optimization" )
+    case _Nikon3Saturation2:
+        return ifd.storeAsciiString( "Saturation" )
     case _Nikon3DigitalVariProgram:
         return ifd.storeAsciiString( "Digital VariProgram" )
     case _Nikon3MultiExposure:
@@ -1191,31 +1403,6 @@ func storeNikon3Tags( ifd *ifdd ) error {
     default:
         return ifd.processUnknownTag( )
     }
-
-    return nil
-}
-
-func preProcessNikon3Tags( ifd *ifdd ) error {
-    switch ifd.fTag {
-    case _Nikon3SerialNumber:
-        text, err := ifd.checkTiffAsciiString( )
-        if err == nil {
-            var n int
-            n, err = strconv.Atoi( string(text[:7]) )
-            if err == nil {
-                ifd.desc.global["serialKey"] = uint32(n)
-            }
-        }
-        return err
-    case _Nikon3ShutterCount:
-        count, err := ifd.checkUnsignedLongs( 1 )
-//        fmt.Printf("found _Nikon3ShutterCount: %d, error %v\n", count, err )
-        if err == nil {
-            ifd.desc.global["countKey"] = count[0]
-        }
-        return err
-    }
-    return nil
 }
 
 const (
@@ -1247,69 +1434,42 @@ func (ifd *ifdd)processNikonMakerNote3( offset uint32 ) error {
     offset += _NIKON_MAKER_SIGNATURE_3_SIZE
     count := ifd.fCount - _NIKON_MAKER_SIGNATURE_3_SIZE
 
-//    mknd := new(Desc)
-//    mknd.data = ifd.desc.data[offset:offset+count] // starts @TIFF header
-
-    mknd := newDesc( ifd.desc.data[offset:offset+count], &ifd.desc.Control )
-
-    var err error
-    mknd.endian, err = getEndianess( mknd.data )
+    mknd, err := ifd.newMakerDesc( offset, count, _NIKON_TIFF_HEADER_SIZE, 0 )
     if err != nil {
         return err
     }
-    mknd.Control = ifd.desc.Control     // propagate original control
     offset, err = mknd.checkValidTiff( )
     if err != nil {
         return err
     }
 
-
-    // collect decryption keys first
-    if mknd.ParsDbg {
-        fmt.Printf( "processNikonMakerNote3: First pass to collect SerialNumber and ShutterCount\n" )
-    }
-    _, _, err = mknd.storeIFD( MAKER, offset, preProcessNikon3Tags )
-    if err != nil {
-        return err
-    }
-    if mknd.ParsDbg {
-        fmt.Printf( "processNikonMakerNote3: Serial %d count %d\n",
-                     mknd.global["serialKey"], mknd.global["countKey"] )
-        fmt.Printf( "processNikonMakerNote3: Second pass to process all tags\n")
-    }
+    // scrambled data is stored as is and descrambled only when formatted,
+    // once the keys found anywhere in the same IFD are available.
     var nikon *ifdd
     _, nikon, err = mknd.storeIFD( MAKER, offset, storeNikon3Tags )
     if err != nil {
-        fmt.Printf("Nikon maker note error: %v", err )
         return err
     }
 
-    // transfer EMBEDDED IFD info to the parent ifd desc 
-    ifd.desc.ifds[EMBEDDED] = mknd.ifds[EMBEDDED]
-
     mknd.root = nikon
     // TODO: check the endianess for \x00\x2a\x00\x00\x00\x08
     ifd.storeValue( ifd.newDescValue( mknd,
-                _NIKON_MAKER_SIGNATURE_3+_NIKON_TIFF_HEADER,
-                _NIKON_TIFF_HEADER_SIZE ) )
+                _NIKON_MAKER_SIGNATURE_3+_NIKON_TIFF_HEADER ) )
     ifd.desc.ifds[MAKER] = nikon
     return err
 }
 
 func tryNikonMakerNote( ifd *ifdd, offset uint32 ) ( func( uint32 ) error ) {
-    if bytes.Equal( ifd.desc.data[offset:offset+_NIKON_MAKER_SIGNATURE_1_SIZE],
-                    []byte( _NIKON_MAKER_SIGNATURE_1 ) ) {
-        fmt.Printf("    MakerNote: Nikon type 1\n" )
+    if ifd.hasMakerNoteSignature( offset, _NIKON_MAKER_SIGNATURE_1 ) {
+        ifd.makerWarning( "Nikon", "type 1 is not supported" )
 //        return ifd.processNikonMakerNote1
     }
-    if bytes.Equal( ifd.desc.data[offset:offset+_NIKON_MAKER_SIGNATURE_3_SIZE],
-                    []byte( _NIKON_MAKER_SIGNATURE_3 ) ) {
+    if ifd.hasMakerNoteSignature( offset, _NIKON_MAKER_SIGNATURE_3 ) {
 //        fmt.Printf("    MakerNote: Nikon type 3\n" )
         return ifd.processNikonMakerNote3
     }
-    if bytes.Equal( ifd.desc.data[offset:offset+_NIKON_MAKER_SIGNATURE_4_SIZE],
-                    []byte( _NIKON_MAKER_SIGNATURE_4 ) ) {
-        fmt.Printf("    MakerNote: Nikon type 4\n" )
+    if ifd.hasMakerNoteSignature( offset, _NIKON_MAKER_SIGNATURE_4 ) {
+        ifd.makerWarning( "Nikon", "type 4 is not supported" )
 //        return ifd.processNikonMakerNote3 // common to type 3 & 4
     }
     return nil
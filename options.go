@@ -0,0 +1,105 @@
+package exif
+
+// support for functional options
+
+/*
+    Control gathers many unrelated settings, and more are added as features
+    are implemented. Instead of filling a Control literal, applications can
+    build one with NewControl and a list of options, which keeps their code
+    unchanged when new settings are added to Control:
+
+        ec := exif.NewControl( exif.WithWarnings( ), exif.WithRecover( ),
+                               exif.WithLimits( exif.Limits{ MaxEntries: 512 } ) )
+        d, err := exif.Read( path, 0, ec )
+
+    Options are applied in order, so that a later option overrides an earlier
+    one for the same setting. Settings without an option keep their zero value
+    and can still be set directly in the returned Control.
+*/
+
+// Option changes one setting of a Control, see NewControl
+type Option func( c *Control )
+
+// NewControl returns a new Control with opts applied in order
+func NewControl( opts ...Option ) *Control {
+    c := new( Control )
+    c.Apply( opts... )
+    return c
+}
+
+// Apply applies opts in order to an existing Control
+func (c *Control) Apply( opts ...Option ) {
+    for _, opt := range opts {
+        opt( c )
+    }
+}
+
+// WithWarnings turns on warnings (Control Warn)
+func WithWarnings( ) Option {
+    return func( c *Control ) { c.Warn = true }
+}
+
+// WithRecover recovers from common metadata mistakes instead of failing
+// (Control Lenient)
+func WithRecover( ) Option {
+    return func( c *Control ) { c.Lenient = true }
+}
+
+// WithStrict rejects metadata with a suspicious layout or with invalid
+// rationals (Control Strict)
+func WithStrict( ) Option {
+    return func( c *Control ) { c.Strict = true }
+}
+
+// WithForce writes out-of-spec values set by the application (Control Force)
+func WithForce( ) Option {
+    return func( c *Control ) { c.Force = true }
+}
+
+// WithLimits bounds the resources used for parsing (Control Limits)
+func WithLimits( l Limits ) Option {
+    return func( c *Control ) { c.Limits = l }
+}
+
+// WithLogger sends warnings and debug traces to l (Control Logger)
+func WithLogger( l Logger ) Option {
+    return func( c *Control ) { c.Logger = l }
+}
+
+// WithUnknown sets how to deal with unknown tags (Control Unknown)
+func WithUnknown( u ConUnTag ) Option {
+    return func( c *Control ) { c.Unknown = u }
+}
+
+// WithOnUnknown calls f to decide what to do with each unknown tag (Control
+// OnUnknown)
+func WithOnUnknown( f func( id IfdId, tag, typ uint16, count uint32,
+                            raw []byte ) UnknownAction ) Option {
+    return func( c *Control ) { c.OnUnknown = f }
+}
+
+// WithProgress calls f to report parse and serialize progress (Control
+// OnProgress)
+func WithProgress( f func( stage ProgressStage, done, total uint ) ) Option {
+    return func( c *Control ) { c.OnProgress = f }
+}
+
+// WithSoftware stamps identity at each Write (Control Software)
+func WithSoftware( identity string ) Option {
+    return func( c *Control ) { c.Software = identity }
+}
+
+// WithCreateExif lets setters create a missing Exif IFD (Control CreateExif)
+func WithCreateExif( ) Option {
+    return func( c *Control ) { c.CreateExif = true }
+}
+
+// WithParallel parses independent IFDs in parallel (Control Parallel)
+func WithParallel( ) Option {
+    return func( c *Control ) { c.Parallel = true }
+}
+
+// WithPooled allocates values from a pool (Control Pooled)
+func WithPooled( ) Option {
+    return func( c *Control ) { c.Pooled = true }
+}
@@ -0,0 +1,144 @@
+package exif
+
+// support for applying the image orientation
+
+import (
+    "bytes"
+    "errors"
+    "image"
+    "image/draw"
+    "image/jpeg"
+)
+
+/*
+    Cameras store images as captured by the sensor, and record in Orientation
+    (IFD0) how to transform them for display:
+
+        1   none                        5   transpose (mirror along the
+        2   mirror horizontally             top-left to bottom-right diagonal)
+        3   rotate 180°                 6   rotate 90° clockwise
+        4   mirror vertically           7   transverse (mirror along the
+                                            top-right to bottom-left diagonal)
+                                        8   rotate 90° counterclockwise
+
+    Many viewers and browsers ignore Orientation, so web backends usually
+    apply the transformation to the pixels and reset Orientation to 1 before
+    serving an image. NormalizeOrientation does that on a decoded image, and
+    updates the metadata accordingly: Orientation, pixel dimensions and the
+    JPEG thumbnail, which is stored with the same orientation as the image.
+*/
+
+// orientedAt returns the source coordinates of the destination pixel x, y
+// (relative to the destination origin) for orientation o, in an image of
+// width w and height h (relative to the source origin).
+func orientedAt( o uint32, x, y, w, h int ) (int, int) {
+    switch o {
+    case 2:     return w - 1 - x, y
+    case 3:     return w - 1 - x, h - 1 - y
+    case 4:     return x, h - 1 - y
+    case 5:     return y, x
+    case 6:     return y, h - 1 - x
+    case 7:     return w - 1 - y, h - 1 - x
+    case 8:     return w - 1 - y, x
+    }
+    return x, y
+}
+
+// orient returns a new image with the orientation o applied to img
+func orient( img image.Image, o uint32 ) image.Image {
+    b := img.Bounds( )
+    w, h := b.Dx( ), b.Dy( )
+    r := image.Rect( 0, 0, w, h )
+    if o >= 5 {
+        r = image.Rect( 0, 0, h, w )
+    }
+    var dst draw.Image
+    switch img.(type) {
+    case *image.Gray:
+        dst = image.NewGray( r )
+    case *image.Gray16:
+        dst = image.NewGray16( r )
+    case *image.RGBA64, *image.NRGBA64:
+        dst = image.NewRGBA64( r )
+    default:
+        dst = image.NewRGBA( r )
+    }
+    for y := 0; y < r.Dy( ); y++ {
+        for x := 0; x < r.Dx( ); x++ {
+            sx, sy := orientedAt( o, x, y, w, h )
+            dst.Set( x, y, img.At( b.Min.X + sx, b.Min.Y + sy ) )
+        }
+    }
+    return dst
+}
+
+// setOrientation sets Orientation to o in the ifd
+func (ifd *ifdd) setOrientation( o uint16 ) {
+    ifd.newEntry( _Orientation, _UnsignedShort )
+    ifd.setValue( ifd.newUnsignedShortValue( "Orientation",
+                            ifd.fmtEnum( _Orientation, "orientation" ),
+                            []uint16{ o } ) )
+}
+
+// orientThumbnail applies the orientation o to the JPEG thumbnail, if any
+func (d *Desc) orientThumbnail( o uint32 ) {
+    ifd := d.ifds[THUMBNAIL]
+    if ifd == nil {
+        return
+    }
+    if data, err := d.GetThumbnailData( THUMBNAIL ); err == nil && isJpeg( data, 0 ) {
+        tbn, err := jpeg.Decode( bytes.NewReader( data ) )
+        if err == nil {
+            var b bytes.Buffer
+            tbn = orient( tbn, o )
+            if err = jpeg.Encode( &b, tbn, nil ); err == nil {
+                ifd.setThumbnail( b.Bytes( ) )
+                size := tbn.Bounds( ).Size( )
+                if ifd.getValue( _ImageWidth ) != nil {
+                    ifd.setDimension( _ImageWidth, "Image Width",
+                                      fmtImageSize, uint32(size.X) )
+                }
+                if ifd.getValue( _ImageLength ) != nil {
+                    ifd.setDimension( _ImageLength, "Image Length",
+                                      fmtImageSize, uint32(size.Y) )
+                }
+            }
+        }
+        if err != nil && d.Warn {
+            d.logf( LogWarning, "NormalizeOrientation: Warning: thumbnail not oriented: %v\n", err )
+        }
+    }
+    if ifd.getValue( _Orientation ) != nil {
+        ifd.setOrientation( 1 )
+    }
+}
+
+// NormalizeOrientation returns img transformed according to the Orientation
+// given in d, so that it can be displayed as is, and updates d to match: the
+// Orientation is reset to 1, the pixel dimensions are swapped if the image
+// was rotated by 90°, and the JPEG thumbnail is transformed as well.
+//
+// If d is nil, or if the Orientation is absent, invalid or already 1, img is
+// returned unchanged. The returned image is a new image, and img is not
+// modified.
+func NormalizeOrientation( img image.Image, d *Desc ) image.Image {
+    if d == nil || d.ifds[PRIMARY] == nil {
+        return img
+    }
+    primary := d.ifds[PRIMARY]
+    o, ok := primary.getUnsignedInteger( _Orientation )
+    if ! ok || o <= 1 || o > 8 {
+        return img
+    }
+    img = orient( img, o )
+    primary.setOrientation( 1 )
+    if o >= 5 {
+        size := img.Bounds( ).Size( )
+        err := d.SetPixelDimensions( uint32(size.X), uint32(size.Y) )
+        if err != nil && ! errors.Is( err, ErrIfdNotPresent ) && d.Warn {
+            d.logf( LogWarning, "NormalizeOrientation: Warning: %v", err )
+        }
+    }
+    d.orientThumbnail( o )
+    return img
+}
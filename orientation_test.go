@@ -0,0 +1,94 @@
+package exif
+
+import (
+    "bytes"
+    "image"
+    "image/jpeg"
+    "testing"
+)
+
+func TestNormalizeOrientation( t *testing.T ) {
+    //  1 2 3
+    //  4 5 6   as stored, with its origin not at 0, 0
+    src := image.NewGray( image.Rect( 10, 20, 13, 22 ) )
+    for i := 0; i < 6; i++ {
+        src.Pix[i] = uint8(i + 1)
+    }
+    for _, c := range []struct {
+        o       uint16
+        want    [][]uint8           // rows, as displayed
+    } {
+        { 2, [][]uint8{ { 3, 2, 1 }, { 6, 5, 4 } } },
+        { 3, [][]uint8{ { 6, 5, 4 }, { 3, 2, 1 } } },
+        { 4, [][]uint8{ { 4, 5, 6 }, { 1, 2, 3 } } },
+        { 5, [][]uint8{ { 1, 4 }, { 2, 5 }, { 3, 6 } } },
+        { 6, [][]uint8{ { 4, 1 }, { 5, 2 }, { 6, 3 } } },
+        { 7, [][]uint8{ { 6, 3 }, { 5, 2 }, { 4, 1 } } },
+        { 8, [][]uint8{ { 3, 6 }, { 2, 5 }, { 1, 4 } } },
+    } {
+        d, err := Read( "testdata/tiff.tif", 0, &Control{ } )
+        if err != nil {
+            t.Fatalf( "Read: %v", err )
+        }
+        d.ifds[PRIMARY].setOrientation( c.o )
+        if err = d.SetPixelDimensions( 3, 2 ); err != nil {
+            t.Fatalf( "SetPixelDimensions: %v", err )
+        }
+        testReplaceThumbnail( t, d.ifds[THUMBNAIL], testJpegImage( t, 8, 4 ) )
+
+        img := NormalizeOrientation( src, d )
+        b := img.Bounds( )
+        if b.Dx( ) != len(c.want[0]) || b.Dy( ) != len(c.want) {
+            t.Errorf( "%d: size %v", c.o, b.Size( ) )
+            continue
+        }
+        for y, row := range c.want {
+            for x, v := range row {
+                if g := img.(*image.Gray).GrayAt( b.Min.X + x, b.Min.Y + y ).Y; g != v {
+                    t.Errorf( "%d: pixel %d, %d is %d instead of %d", c.o, x, y, g, v )
+                }
+            }
+        }
+        if o, _ := d.ifds[PRIMARY].getUnsignedInteger( _Orientation ); o != 1 {
+            t.Errorf( "%d: Orientation %d", c.o, o )
+        }
+        w, _ := d.ifds[EXIF].getUnsignedInteger( _PixelXDimension )
+        h, _ := d.ifds[EXIF].getUnsignedInteger( _PixelYDimension )
+        if int(w) != b.Dx( ) || int(h) != b.Dy( ) {
+            t.Errorf( "%d: pixel dimensions %dx%d", c.o, w, h )
+        }
+
+        data, err := d.GetThumbnailData( THUMBNAIL )
+        if err != nil {
+            t.Fatalf( "%d: GetThumbnailData: %v", c.o, err )
+        }
+        tbn, err := jpeg.Decode( bytes.NewReader( data ) )
+        if err != nil {
+            t.Fatalf( "%d: thumbnail: %v", c.o, err )
+        }
+        want := image.Pt( 8, 4 )
+        if c.o >= 5 {
+            want = image.Pt( 4, 8 )
+        }
+        if s := tbn.Bounds( ).Size( ); s != want {
+            t.Errorf( "%d: thumbnail size %v instead of %v", c.o, s, want )
+        }
+    }
+}
+
+func TestNormalizeOrientationUnchanged( t *testing.T ) {
+    src := testImage( 3, 2 )
+    if NormalizeOrientation( src, nil ) != src {
+        t.Errorf( "nil metadata: image transformed" )
+    }
+    for _, o := range []uint16{ 1, 0, 9 } {
+        d, err := Read( "testdata/tiff.tif", 0, &Control{ } )
+        if err != nil {
+            t.Fatalf( "Read: %v", err )
+        }
+        d.ifds[PRIMARY].setOrientation( o )
+        if NormalizeOrientation( src, d ) != src {
+            t.Errorf( "orientation %d: image transformed", o )
+        }
+    }
+}
@@ -0,0 +1,222 @@
+package exif
+
+// support for parsing independent IFDs in parallel
+
+import (
+    "fmt"
+    "sync"
+)
+
+/*
+    Once their offset is known, the Exif, GPS and Interoperability IFDs and
+    the maker note do not depend on each other. If Control Parallel is set,
+    they are parsed in separate goroutines while the IFD that includes them
+    goes on with its next entries, which reduces the latency for files with
+    large maker notes.
+
+    Each goroutine parses its entry with a worker descriptor, which shares
+    the data with its parent descriptor but has its own statistics, global
+    information and logger, so that nothing is shared while parsing. The
+    entry is given a copy of the parent ifd (shadow), and a nil value is kept
+    in its place in the parent ifd. Warnings and debug traces are buffered by
+    each worker.
+
+    When the parent is done, it waits for its workers in entry order, replays
+    their buffered messages, and adopts the values they parsed: each value
+    replaces its nil placeholder, and all ifds and maker notes created by
+    the worker are given back to the parent descriptor, along with their
+    statistics and global information. The first error found in entry order
+    is returned, as it would be while parsing sequentially. A panic in a
+    worker, for instance in an OnUnknown callback, is returned as an error
+    instead of terminating the program.
+
+    Dynamic namespaces are shared, since only maker notes allocate them and
+    there is at most one maker note. OnProgress calls are serialized, but
+    OnUnknown may be called concurrently from several goroutines.
+*/
+
+// parallelParse is shared by a descriptor and all its workers
+type parallelParse struct {
+    sync.Mutex          // serializes progress reports
+    parsed      uint    // entries parsed by all workers and the descriptor
+}
+
+// logBuffer keeps the messages of a worker until its parent replays them
+type logBuffer struct {
+    levels      []LogLevel
+    msgs        []string
+}
+
+func (b *logBuffer) Log( level LogLevel, msg string ) {
+    b.levels = append( b.levels, level )
+    b.msgs = append( b.msgs, msg )
+}
+
+func (b *logBuffer) replay( c *Control ) {
+    for i, msg := range b.msgs {
+        c.logf( b.levels[i], "%s", msg )
+    }
+}
+
+// parseJob is an entry parsed in parallel
+type parseJob struct {
+    parent      *ifdd           // ifd including the entry
+    slot        int             // index of the entry value in parent values
+    tag         tTag            // entry tag
+    shadow      *ifdd           // copy of parent used by the worker
+    w           *Desc           // worker descriptor
+    logs        logBuffer       // worker messages
+    err         error           // worker result
+    done        chan struct{}   // closed when the worker is done
+}
+
+// isParallel returns true if the embedded IFD id or the maker note, if id is
+// MAKER, must be parsed in parallel.
+func (ifd *ifdd) isParallel( id IfdId ) bool {
+    if ifd.desc.parallel == nil {
+        return false
+    }
+    switch id {
+    case EXIF, GPS:
+        return ifd.id == PRIMARY
+    case IOP, MAKER:
+        return ifd.id == EXIF
+    }
+    return false
+}
+
+// newWorker returns a worker descriptor for parsing an entry of d
+func (d *Desc) newWorker( logs *logBuffer ) *Desc {
+    w := newDesc( d.data, &d.Control )
+    w.Logger = logs
+    w.base = d.base
+    w.source = d.source
+    w.origin = d.origin
+    w.dataEnd = d.dataEnd
+    w.endian = d.endian
+    w.global = d.global
+    w.ns = d.ns
+    w.parallel = d.parallel
+    return w                    // values are never pooled in workers
+}
+
+// parseInParallel starts parsing the current entry of ifd with store in a
+// new goroutine, and keeps a nil value in its place until joinWorkers.
+func (ifd *ifdd) parseInParallel( store func( shadow *ifdd ) error ) {
+    job := &parseJob{ parent: ifd, slot: len(ifd.values), tag: ifd.fTag,
+                      done: make( chan struct{} ) }
+    job.w = ifd.desc.newWorker( &job.logs )
+    job.shadow = new( ifdd )
+    *job.shadow = *ifd
+    job.shadow.desc = job.w
+    job.shadow.values = make( []serializer, 0, 1 )  // for this entry only
+    ifd.values = append( ifd.values, nil )
+    ifd.desc.jobs = append( ifd.desc.jobs, job )
+
+    go func( ) {
+        defer func( ) {
+            if r := recover( ); r != nil {
+                job.err = fmt.Errorf( "parseInParallel: worker panic: %v\n", r )
+            }
+            close( job.done )
+        }()
+        job.err = store( job.shadow )
+        if err := job.w.joinWorkers( ); job.err == nil {
+            job.err = err
+        }
+    }()
+}
+
+// joinWorkers waits for all workers started by d, in entry order, and adopts
+// what they parsed. It returns the first error found.
+func (d *Desc) joinWorkers( ) (err error) {
+    for _, job := range d.jobs {
+        <-job.done
+        job.logs.replay( &d.Control )
+        if err != nil {
+            continue
+        }
+        if job.err != nil {
+            err = getEntryError( job.parent.id, job.tag, job.err )
+            continue
+        }
+        d.adopt( job )
+    }
+    d.jobs = nil
+    return
+}
+
+// adopt gives back to d the values, ifds, statistics and global information
+// parsed by a worker
+func (d *Desc) adopt( job *parseJob ) {
+    w := job.w
+    for _, v := range job.shadow.values {
+        v.setIfd( job.parent )
+        job.parent.values[job.slot] = v
+    }
+    job.shadow.desc = d         // in case a formatter refers to it
+    d.adoptValues( w, job.shadow.values )
+
+    for id, ifd := range w.ifds {
+        if ifd != nil {
+            d.ifds[id] = ifd
+        }
+    }
+    d.global.adopt( &w.global )
+    for _, p := range w.global.previews {  // not linked to any value
+        if ifd := d.getIfd( p.id ); ifd != nil && ifd.desc == w {
+            ifd.desc = d
+        }
+    }
+    if w.dataEnd > d.dataEnd {
+        d.dataEnd = w.dataEnd
+    }
+    d.stats.add( w.stats )
+}
+
+// adoptValues gives back to d the ifds created by the worker w and the maker
+// note descriptors sharing its statistics and control, found in values.
+func (d *Desc) adoptValues( w *Desc, values []serializer ) {
+    for _, v := range values {
+        switch v := v.(type) {
+        case *ifdValue:
+            if v.v.desc == w {
+                v.v.desc = d
+            }
+            d.adoptValues( w, v.v.values )
+        case *descValue:
+            if v.v.stats == w.stats {
+                v.v.stats = d.stats
+                v.v.Control = d.Control
+                v.v.parallel = d.parallel
+            }
+            if v.v.root != nil {
+                d.adoptValues( w, v.v.root.values )
+            }
+        }
+    }
+}
+
+// add adds the statistics of a worker
+func (s *Stats) add( ws *Stats ) {
+    addIfd := func( is *IfdStats, ws IfdStats ) {
+        is.Entries += ws.Entries
+        is.Unknown += ws.Unknown
+        is.Unsupported += ws.Unsupported
+        is.Removed += ws.Removed
+        is.DataSize += ws.DataSize
+        is.Coerced += ws.Coerced
+        is.Normalized += ws.Normalized
+    }
+    for id := range ws.Ifds {
+        addIfd( &s.Ifds[id], ws.Ifds[id] )
+    }
+    for i := range ws.Dynamic {
+        addIfd( s.getIfd( _IFD_N + IfdId(i) ), ws.Dynamic[i] )
+    }
+    if ws.MakerNote != "" {
+        s.MakerNote = ws.MakerNote
+    }
+    s.Warnings = append( s.Warnings, ws.Warnings... )
+    s.RemovedEntries = append( s.RemovedEntries, ws.RemovedEntries... )
+}
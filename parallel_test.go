@@ -0,0 +1,53 @@
+package exif
+
+import (
+    "bytes"
+    "encoding/binary"
+    "testing"
+)
+
+func TestParallelSameOutput( t *testing.T ) {
+    for _, path := range fixtures( t ) {
+        d, err := Read( path, 0, &Control{ } )
+        if err != nil {
+            t.Fatalf( "%s: Read: %v", path, err )
+        }
+        p, err := Read( path, 0, &Control{ Parallel: true } )
+        if err != nil {
+            t.Fatalf( "%s: parallel Read: %v", path, err )
+        }
+        if want, got := renderFormat( t, d ), renderFormat( t, p ); ! bytes.Equal( got, want ) {
+            t.Errorf( "%s: parallel Format differs:\n%s", path, lineDiff( want, got ) )
+        }
+        want, err := d.Bytes( )
+        if err != nil {
+            t.Fatalf( "%s: Bytes: %v", path, err )
+        }
+        got, err := p.Bytes( )
+        if err != nil {
+            t.Fatalf( "%s: parallel Bytes: %v", path, err )
+        }
+        if ! bytes.Equal( got, want ) {
+            t.Errorf( "%s: parallel serialization differs", path )
+        }
+        if d.stats.MakerNote != p.stats.MakerNote ||
+           d.stats.Ifds != p.stats.Ifds {
+            t.Errorf( "%s: parallel statistics %+v instead of %+v",
+                      path, p.stats.Ifds, d.stats.Ifds )
+        }
+    }
+}
+
+func TestParallelWorkerPanic( t *testing.T ) {
+    e := binary.LittleEndian
+    exif := []testEntry{ { 0x9999, uint16(_UnsignedShort), 1, testShorts( e, 1 ) } }
+    tiff := append( []byte( "Exif\x00\x00" ), testTiff( e, nil, exif )... )
+    ec := &Control{ Parallel: true }
+    ec.OnUnknown = func( id IfdId, tag, typ uint16, count uint32,
+                         raw []byte ) UnknownAction {
+        panic( "OnUnknown" )
+    }
+    if _, err := Parse( tiff, 0, uint(len(tiff)), ec ); err == nil {
+        t.Errorf( "worker panic not reported" )
+    }
+}
@@ -3,6 +3,7 @@ package exif
 
 import (
     "fmt"
+    "errors"
     "bytes"
     "strings"
     "io"
@@ -95,27 +96,44 @@ const (                                     // PRIMARY & THUMBNAIL IFD tags
     _YCbCrPositioning           = 0x213
     _ReferenceBlackWhite        = 0x214
 
+    _Rating                     = 0x4746    // Windows, 0 to 5 stars
+    _RatingPercent              = 0x4749    // Windows, 0 to 100
+
     _Copyright                  = 0x8298
 
     _ExifIFD                    = 0x8769
 
     _GpsIFD                     = 0x8825
 
+    _SecurityClassification    = 0x9212    // TIFF/EP
+    _ImageHistory               = 0x9213    // TIFF/EP
+
+    _XPTitle                    = 0x9c9b    // Windows, UTF-16LE strings
+    _XPComment                  = 0x9c9c
+    _XPAuthor                   = 0x9c9d
+    _XPKeywords                 = 0x9c9e    // keywords separated by ';'
+    _XPSubject                  = 0x9c9f
+
+    _PrintIM                    = 0xc4a5    // Epson Print Image Matching
+
     _Padding                    = 0xea1c    // May be used in IFD0, IFD1 and Exif IFD?
 )
 
+func fmtImageSize( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+    switch iw := v.(type) {
+    case []uint16:
+        fmt.Fprintf( w, "%d Pixels", iw[0] )
+    case []uint32:
+        fmt.Fprintf( w, "%d Pixels", iw[0] )
+    }
+}
+
 func (ifd *ifdd) storeTiffImageSize( name string ) error {
     switch ifd.fType {
         case _UnsignedShort:
-            return ifd.storeUnsignedShorts( name, 1,
-                    func ( w io.Writer, v interface{}, indent string ) {
-                        iw := v.([]uint16)
-                        fmt.Fprintf( w, "%d Pixels", iw[0] ) } )
+            return ifd.storeUnsignedShorts( name, 1, fmtImageSize )
         case _UnsignedLong:
-            return ifd.storeUnsignedLongs( name, 1,
-                    func ( w io.Writer, v interface{}, indent string ) {
-                        iw := v.([]uint32)
-                        fmt.Fprintf( w, "%d Pixels", iw[0] ) } )
+            return ifd.storeUnsignedLongs( name, 1, fmtImageSize )
     }
     return fmt.Errorf( "Illegal Image Width type %s\n", getTiffTString( ifd.fType ) )
 }
@@ -148,143 +166,74 @@ When thumbnails use JPEG compression, this tag value is set to 6.
         if ifd.id == PRIMARY {
             if ifd.desc.Warn {
                 if cType != JPEG {
-                    fmt.Printf("Warning: non-JPEG compression specified in a JPEG file\n" )
+                    ifd.desc.logf( LogWarning, "Warning: non-JPEG compression specified in a JPEG file\n" )
                 } else {
-                    fmt.Printf("Warning: Exif2-2 specifies that in case of JPEG picture compression be omited\n")
+                    ifd.desc.logf( LogWarning, "Warning: Exif2-2 specifies that in case of JPEG picture compression be omited\n")
                 }
             }
         } else {    // _THUMBNAIL
-            ifd.desc.global["thumbType"] = cType // remember compression type
+            ifd.desc.global.thumbType = cType // remember compression type
         }
 
-        fmtCompression := func( w io.Writer, v interface{}, indent string ) {
-            c := v.([]uint16)
-            var cString string
-            switch( c[0] ) {
-            case 1: cString = "No compression"
-            case 2: cString = "CCITT 1D modified Huffman RLE"
-            case 3: cString = "CCITT Group 3 fax encoding"
-            case 4: cString = "CCITT Group 4 fax encoding"
-            case 5: cString = "LZW"
-            case 6: cString = "JPEG"
-            case 7: cString = "JPEG (Technote2)"
-            case 8: cString = "Deflate"
-            case 9: cString = "RFC 2301 (black and white JBIG)."
-            case 10: cString = "RFC 2301 (color JBIG)."
-            case 32773: cString = "PackBits compression (Macintosh RLE)"
-            }
-            io.WriteString( w, cString )
-        }
-        ifd.storeValue( ifd.newUnsignedShortValue( "Compression", fmtCompression, c ) )
+        ifd.storeValue( ifd.newUnsignedShortValue( "Compression",
+                                ifd.fmtEnum( _Compression, "compression" ), c ) )
     }
     return err
 }
 
 func (ifd *ifdd) storeTiffPhotometricInterpretation( ) error {
-    fpi := func( w io.Writer, v interface{}, indent string ) {
-        pi := v.([]uint16)
-        var iType string
-        switch pi[0]  {
-        case 0:
-            iType = "Bilevel or Gray-scale, white is 0"
-        case 1:
-            iType = "Bilevel or Gray-scale, black is 0"
-        case 2:
-            iType = "RGB"
-        case 3:
-            iType = "Palette"
-        default:
-            iType = "Unknown color type"
-        }
-        fmt.Fprintf( w, "Image color is %s", iType )
+    return ifd.storeUnsignedShorts( "Photometric Interpretation", 1, ifd.fmtEnum( _PhotometricInterpretation, "color type" ) )
+}
+
+// TIFF/EP security classification is a single letter or free text
+func formatSecurityClassification( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+    sc := string( bytes.TrimRight( v.([]byte), "\x00" ) )
+    switch sc {
+    case "T":   io.WriteString( w, "Top Secret" )
+    case "S":   io.WriteString( w, "Secret" )
+    case "C":   io.WriteString( w, "Confidential" )
+    case "R":   io.WriteString( w, "Restricted" )
+    case "U":   io.WriteString( w, "Unclassified" )
+    default:    formatString( ifd, w, v, indent )
     }
-    return ifd.storeUnsignedShorts( "Photometric Interpretation", 1, fpi )
 }
 
-func (ifd *ifdd) storeTiffFillOrder( ) error {
-    ffo := func( w io.Writer, v interface{}, indent string ) {
-        fo := v.([]uint16)
-        var fos string
-        switch fo[0] {
-        case 1:
-            fos = "lower column values in higher-order bits of bytes"
-        case 2:
-            fos = "lower column values in lower-order bits of bytes"
-        default:
-            fos = "Unknown bit ordering"
-        }
-        fmt.Fprintf( w, fos )
+func (ifd *ifdd) storeSecurityClassification( ) error {
+    text, err := ifd.checkTiffAsciiString( )
+    if err == nil {
+        sc := ifd.newAsciiStringValue( "Security Classification", text )
+        sc.fpr = formatSecurityClassification
+        ifd.storeValue( sc )
     }
-    return ifd.storeUnsignedShorts( "Fill order", 1, ffo )
+    return err
+}
+
+func (ifd *ifdd) storeTiffFillOrder( ) error {
+    return ifd.storeUnsignedShorts( "Fill order", 1, ifd.fmtEnum( _FillOrder, "bit ordering" ) )
 }
 
 func (ifd *ifdd) storeTiffPlanarConfiguration( ) error {
-    fpc := func( w io.Writer, v interface{}, indent string ) {
-        pc := v.([]uint16)
-        var pcs string
-        switch pc[0] {
-        case 1:
-            pcs = "Chunky format (contiguous component values)"
-        case 2:
-            pcs = "Planar format (separate component planes)"
-        default:
-            pcs = "Unknown planar configuration"
-        }
-        fmt.Fprintf( w, pcs )
-    }
-    return ifd.storeUnsignedShorts( "Fill order", 1, fpc )
+    return ifd.storeUnsignedShorts( "Planar Configuration", 1, ifd.fmtEnum( _PlanarConfiguration, "planar configuration" ) )
 }
 
 func (ifd *ifdd) store1Fraction1Decimal( name string ) error {
-    f1f1d := func( w io.Writer, v interface{}, indent string ) {
+    f1f1d := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         f := v.([]UnsignedRational)
-        fmt.Fprintf( w, "%.1f", float32(f[0].Numerator)/float32(f[0].Denominator) )
+        io.WriteString( w, f[0].format( "%.1f" ) )
     }
     return ifd.storeUnsignedRationals( name, 1, f1f1d )
 }
 
 func (ifd *ifdd) storeTiffOrientation( ) error {
-
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        o := v.([]uint16)
-        var oString string
-        switch( o[0] ) {
-        case 1: oString = "Row #0 Top, Col #0 Left"
-        case 2: oString = "Row #0 Top, Col #0 Right"
-        case 3: oString = "Row #0 Bottom, Col #0 Right"
-        case 4: oString = "Row #0 Bottom, Col #0 Left"
-        case 5: oString = "Row #0 Left, Col #0 Top"
-        case 6: oString = "Row #0 Right, Col #0 Top"
-        case 7: oString = "Row #0 Right, Col #0 Bottom"
-        case 8: oString = "Row #0 Left, Col #0 Bottom"
-        default:
-            oString = fmt.Sprintf( "Illegal orientation (%d)", o[0] )
-        }
-        io.WriteString( w, oString )
-    }
-
-    return ifd.storeUnsignedShorts( "Orientation", 1, fmtv )
+    return ifd.storeUnsignedShorts( "Orientation", 1, ifd.fmtEnum( _Orientation, "orientation" ) )
 }
 
 func (ifd *ifdd) storeTiffResolutionUnit( ) error {
-
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        ru := v.([]uint16)
-        var ruString string
-        switch( ru[0] ) {
-        case 1 : ruString = "Dots per Arbitrary unit"
-        case 2 : ruString = "Dots per Inch"
-        case 3 : ruString = "Dots per Cm"
-        default:
-            ruString = fmt.Sprintf( "Illegal resolution unit (%d)", ru[0] )
-        }
-        io.WriteString( w, ruString )
-    }
-    return ifd.storeUnsignedShorts( "Resolution Unit", 1, fmtv )
+    return ifd.storeUnsignedShorts( "Resolution Unit", 1, ifd.fmtEnum( _ResolutionUnit, "resolution unit" ) )
 }
 
 func (ifd *ifdd) storeTiffPageNumber( ) error {
-    fpn := func( w io.Writer, v interface{}, indent string ) {
+    fpn := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         pn := v.([]uint16)
         if pn[1] == 0 {     // number of pages not available
             fmt.Fprintf( w, "%d", pn[0] )
@@ -296,51 +245,88 @@ func (ifd *ifdd) storeTiffPageNumber( ) error {
 }
 
 func (ifd *ifdd) storeTiffYCbCrPositioning( ) error {
-
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        pos := v.([]uint16)
-        var posString string
-        switch( pos[0] ) {
-        case 1 : posString = "Centered"
-        case 2 : posString = "Cosited"
-        default:
-            posString = fmt.Sprintf( "Illegal positioning (%d)", pos[0] )
-        }
-        io.WriteString( w, posString )
-    }
-    return ifd.storeUnsignedShorts( "YCbCr Positioning", 1, fmtv )
+    return ifd.storeUnsignedShorts( "YCbCr Positioning", 1, ifd.fmtEnum( _YCbCrPositioning, "positioning" ) )
 }
 
 func (ifd *ifdd) storePrimaryChromacities( ) error {
 
-    fpc := func( w io.Writer, v interface{}, indent string ) {
+    fpc := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         pc := v.([]UnsignedRational)
-        fmt.Fprintf( w, " RED(x) %f (%d/%d) RED(y) %f (%d/%d)\n",
-                     float32(pc[0].Numerator)/float32(pc[0].Denominator),
-                     pc[0].Numerator, pc[0].Denominator,
-                     float32(pc[1].Numerator)/float32(pc[1].Denominator),
-                     pc[1].Numerator, pc[1].Denominator )
-        fmt.Fprintf( w, "%s GREEN(x) %f (%d/%d) GREEN(y) %f (%d/%d)\n",
-                     indent,
-                     float32(pc[2].Numerator)/float32(pc[2].Denominator),
-                     pc[2].Numerator, pc[2].Denominator,
-                     float32(pc[3].Numerator)/float32(pc[3].Denominator),
-                     pc[3].Numerator, pc[3].Denominator )
-        fmt.Fprintf( w, "%s BLUE(x) %f (%d/%d) BLUE(y) %f (%d/%d)",
-                     indent,
-                     float32(pc[4].Numerator)/float32(pc[4].Denominator),
-                     pc[4].Numerator, pc[4].Denominator,
-                     float32(pc[5].Numerator)/float32(pc[5].Denominator),
-                     pc[5].Numerator, pc[5].Denominator )
+        fmt.Fprintf( w, "RED(x) %s RED(y) %s\n",
+                     pc[0].formatFraction( ), pc[1].formatFraction( ) )
+        fmt.Fprintf( w, "%sGREEN(x) %s GREEN(y) %s\n", indent,
+                     pc[2].formatFraction( ), pc[3].formatFraction( ) )
+        fmt.Fprintf( w, "%sBLUE(x) %s BLUE(y) %s", indent,
+                     pc[4].formatFraction( ), pc[5].formatFraction( ) )
     }
     return ifd.storeUnsignedRationals( "Primary Chromacities", 6, fpc )
 }
 
+func (ifd *ifdd) storeTiffTransferFunction( ) error {
+    ftf := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        tf := v.([]uint16)
+        fmt.Fprintf( w, "%d values", len(tf) )
+    }
+    return ifd.storeUnsignedShorts( "Transfer Function", 0, ftf )
+}
+
+func (ifd *ifdd) storeTiffTileSize( name string ) error {
+    switch ifd.fType {
+        case _UnsignedShort:
+            return ifd.storeUnsignedShorts( name, 1, fmtImageSize )
+        case _UnsignedLong:
+            return ifd.storeUnsignedLongs( name, 1, fmtImageSize )
+    }
+    return fmt.Errorf( "Illegal %s type %s\n", name, getTiffTString( ifd.fType ) )
+}
+
+func (ifd *ifdd) storeYCbCrCoefficients( ) error {
+    fcc := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        cc := v.([]UnsignedRational)
+        fmt.Fprintf( w, "Red %s, Green %s, Blue %s", cc[0].format( "%.3f" ),
+                     cc[1].format( "%.3f" ), cc[2].format( "%.3f" ) )
+    }
+    return ifd.storeUnsignedRationals( "YCbCr Coefficients", 3, fcc )
+}
+
+func (ifd *ifdd) storeTiffYCbCrSubSampling( ) error {
+    fss := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        ss := v.([]uint16)
+        var ssString string
+        switch {
+        case ss[0] == 1 && ss[1] == 1: ssString = "YCbCr4:4:4"
+        case ss[0] == 2 && ss[1] == 1: ssString = "YCbCr4:2:2"
+        case ss[0] == 2 && ss[1] == 2: ssString = "YCbCr4:2:0"
+        case ss[0] == 4 && ss[1] == 1: ssString = "YCbCr4:1:1"
+        default:
+            ssString = fmt.Sprintf( "Horizontal %d, Vertical %d", ss[0], ss[1] )
+        }
+        io.WriteString( w, ssString )
+    }
+    return ifd.storeUnsignedShorts( "YCbCr Sub-Sampling", 2, fss )
+}
+
+func (ifd *ifdd) storeReferenceBlackWhite( ) error {
+    frbw := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        rbw := v.([]UnsignedRational)
+        for i := 0; i < 6; i += 2 {
+            if i > 0 {
+                io.WriteString( w, ", " )
+            }
+            fmt.Fprintf( w, "[%s %s]", rbw[i].format( "%.1f" ),
+                         rbw[i+1].format( "%.1f" ) )
+        }
+    }
+    return ifd.storeUnsignedRationals( "Reference Black White", 6, frbw )
+}
 
 func (ifd *ifdd) storeJPEGInterchangeFormat( ) error {
     offset, err := ifd.checkUnsignedLongs( 1 )
     if err == nil {
-        ifd.desc.global["thumbOffset"] = offset[0]
+        g := &ifd.desc.global
+        g.thumbOffset, g.hasThumbOffset = offset[0], true
+        g.thumbSource = ifd.getSource( )
+        g.thumbIfd, g.hasThumbIfd = ifd.id, true
 //        fmt.Printf( "JPEGInterchangeFormat: offset %#08x\n", offset[0] )
 //        ifd.storeValue( ifd.newUnsignedLongValue( "", nil, offset ) )
     }
@@ -350,11 +336,22 @@ func (ifd *ifdd) storeJPEGInterchangeFormat( ) error {
 func (ifd *ifdd) storeJPEGInterchangeFormatLength( ) error {
     length, err := ifd.checkUnsignedLongs( 1 )
     if err == nil {
-        offset := ifd.desc.global["thumbOffset"].(uint32)
+        offset := ifd.desc.global.thumbOffset
         if offset == 0 {
             return fmt.Errorf("JPEGInterchangeFormatLength without JPEGInterchangeFormat\n")
         }
-        ifd.desc.global["thumbLen"] = length[0]
+        if uint64(offset) + uint64(length[0]) > uint64(len(ifd.desc.data)) {
+            if ifd.desc.isEmbedded( ifd.id ) {  // maker note preview, ignore it
+                if ifd.desc.Warn {
+                    ifd.desc.logf( LogWarning, "JPEGInterchangeFormatLength: Warning: preview out of bounds, ignored\n" )
+                }
+                ifd.desc.global.hasThumbIfd = false
+                ifd.removeEntry( )
+                return nil
+            }
+            return fmt.Errorf("JPEGInterchangeFormatLength: thumbnail out of bounds\n")
+        }
+        ifd.desc.global.thumbLen, ifd.desc.global.hasThumbLen = length[0], true
 
         // Special case where the normal calculation of dataEnd fails
         end := offset + length[0]
@@ -369,6 +366,53 @@ func (ifd *ifdd) storeJPEGInterchangeFormatLength( ) error {
     return err
 }
 
+// the camera make is kept in global information, for maker notes that do not
+// have their own signature.
+func (ifd *ifdd) storeTiffMake( ) error {
+    text, err := ifd.checkTiffAsciiString( )
+    if err == nil {
+        if ifd.id == PRIMARY {
+            maker := strings.TrimSpace( string( bytes.TrimRight( text, "\x00" ) ) )
+            ifd.desc.global.make = maker
+        }
+        ifd.storeValue( ifd.newAsciiStringValue( "Make", text ) )
+    }
+    return err
+}
+
+// the camera model is also kept in global information, for maker notes whose
+// layout depends on the camera model.
+func (ifd *ifdd) storeTiffModel( ) error {
+    text, err := ifd.checkTiffAsciiString( )
+    if err == nil {
+        if ifd.id == PRIMARY {
+            model := strings.TrimSpace( string( bytes.TrimRight( text, "\x00" ) ) )
+            ifd.desc.global.model = model
+        }
+        ifd.storeValue( ifd.newAsciiStringValue( "Model", text ) )
+    }
+    return err
+}
+
+// the software is kept in global information as well, for quirks that depend
+// on the software that wrote the metadata.
+func (ifd *ifdd) storeTiffSoftware( ) error {
+    text, err := ifd.checkTiffAsciiString( )
+    if err == nil {
+        if ifd.id == PRIMARY {
+            software := strings.TrimSpace( string( bytes.TrimRight( text, "\x00" ) ) )
+            ifd.desc.global.software = software
+        }
+        ifd.storeValue( ifd.newAsciiStringValue( "Software", text ) )
+    }
+    return err
+}
+
+// All store<ifd>Tags functions end with their tag switch, without any return
+// statement after it, so that a case left empty by mistake does not compile
+// instead of silently dropping the entry. Entries that are not stored must go
+// through processUnknownTag or processPadding, which account for them in the
+// statistics.
 func storeTiffTags( ifd *ifdd ) error {
 //    fmt.Printf( "storeTiffTags: tag (%#04x) @offset %#04x type %s count %d\n",
 //                 ifd.fTag, ifd.sOffset-8, getTiffTString( ifd.fType ), ifd.fCount )
@@ -388,9 +432,9 @@ func storeTiffTags( ifd *ifdd ) error {
     case _ImageDescription:
         return ifd.storeAsciiString( "Image Description" )
     case _Make:
-        return ifd.storeAsciiString( "Make" )
+        return ifd.storeTiffMake( )
     case _Model:
-        return ifd.storeAsciiString( "Model" )
+        return ifd.storeTiffModel( )
     case _StripOffsets:
         return ifd.storeUnsignedShortsOrLongs( "Strip Offsets", 0, nil )
     case _Orientation:
@@ -400,7 +444,7 @@ func storeTiffTags( ifd *ifdd ) error {
     case _RowsPerStrip:
         return ifd.storeUnsignedShortsOrLongs( "Rows per Strip", 1, nil )
     case _StripByteCounts:
-        return ifd.storeUnsignedShortsOrLongs( "Strip Byte Count", 1, nil )
+        return ifd.storeUnsignedShortsOrLongs( "Strip Byte Counts", 0, nil )
     case _XResolution:
         return ifd.store1Fraction1Decimal( "XResolution " )
     case _YResolution:
@@ -413,12 +457,17 @@ func storeTiffTags( ifd *ifdd ) error {
     case _PageNumber:
         return ifd.storeTiffPageNumber( )
 
+    case _TransferFunction:
+        return ifd.storeTiffTransferFunction( )
+
     case _Software:
-        return ifd.storeAsciiString( "Software" )
+        return ifd.storeTiffSoftware( )
     case _DateTime:
         return ifd.storeAsciiString( "Date" )
     case _Artist:
         return ifd.storeAsciiString( "Artist" )
+    case _InkNames:
+        return ifd.storeAsciiString( "Ink Names" )
     case _HostComputer:
         return ifd.storeAsciiString( "HostComputer" )
 
@@ -427,13 +476,33 @@ func storeTiffTags( ifd *ifdd ) error {
     case _PrimaryChromaticities:
         return ifd.storePrimaryChromacities( )
 
+    case _TileWidth:
+        return ifd.storeTiffTileSize( "Tile Width" )
+    case _TileLength:
+        return ifd.storeTiffTileSize( "Tile Length" )
+    case _TileOffsets:
+        return ifd.storeUnsignedLongs( "Tile Offsets", 0, nil )
+    case _TileByteCounts:
+        return ifd.storeUnsignedShortsOrLongs( "Tile Byte Counts", 0, nil )
+
     case _JPEGInterchangeFormat:
         return ifd.storeJPEGInterchangeFormat( )
     case _JPEGInterchangeFormatLength:
         return ifd.storeJPEGInterchangeFormatLength( )
 
+    case _YCbCrCoefficients:
+        return ifd.storeYCbCrCoefficients( )
+    case _YCbCrSubSampling:
+        return ifd.storeTiffYCbCrSubSampling( )
     case _YCbCrPositioning:
         return ifd.storeTiffYCbCrPositioning( )
+    case _ReferenceBlackWhite:
+        return ifd.storeReferenceBlackWhite( )
+
+    case _Rating:
+        return ifd.storeUnsignedShorts( "Rating", 1, nil )
+    case _RatingPercent:
+        return ifd.storeUnsignedShorts( "Rating Percent", 1, nil )
 
     case _Copyright:
         return ifd.storeAsciiString( "Copyright" )
@@ -443,12 +512,40 @@ func storeTiffTags( ifd *ifdd ) error {
     case  _GpsIFD:
         return ifd.storeEmbeddedIfd( "GPS IFD", GPS, storeGpsTags )
 
+    case _SecurityClassification:
+        return ifd.storeSecurityClassification( )
+    case _ImageHistory:
+        return ifd.storeAsciiString( "Image History" )
+
+    case _XPTitle:
+        return ifd.storeXPString( "XP Title" )
+    case _XPComment:
+        return ifd.storeXPString( "XP Comment" )
+    case _XPAuthor:
+        return ifd.storeXPString( "XP Author" )
+    case _XPKeywords:
+        return ifd.storeXPString( "XP Keywords" )
+    case _XPSubject:
+        return ifd.storeXPString( "XP Subject" )
+
+    case _PrintIM:
+        return ifd.storePrintIM( )
+
     case _Padding:
         return ifd.processPadding( )
+
+    // TIFF/EP tags also defined by Exif, decoded as in the Exif IFD
+    case _ExposureTime, _FNumber, _ExposureProgram, _ISOSpeedRatings,
+         _DateTimeOriginal, _ShutterSpeedValue, _ApertureValue,
+         _BrightnessValue, _ExposureBiasValue, _MaxApertureValue,
+         _SubjectDistance, _MeteringMode, _LightSource, _Flash, _FocalLength:
+        if ifd.id == PRIMARY {
+            return storeExifTags( ifd )
+        }
+        return ifd.processUnknownTag( )
     default:
         return ifd.processUnknownTag( )
     }
-    return nil
 }
 
 const (                                     // EXIF IFD specific tags
@@ -458,16 +555,23 @@ const (                                     // EXIF IFD specific tags
 
     _ExposureProgram            = 0x8822
 
-    _ISOSpeedRatings            = 0x8827
+    _ISOSpeedRatings            = 0x8827    // PhotographicSensitivity
+
+    _SensitivityType            = 0x8830
+    _StandardOutputSensitivity  = 0x8831
+    _RecommendedExposureIndex   = 0x8832
+    _ISOSpeed                   = 0x8833
+    _ISOSpeedLatitudeyyy        = 0x8834
+    _ISOSpeedLatitudezzz        = 0x8835
 
     _ExifVersion                = 0x9000
 
     _DateTimeOriginal           = 0x9003
     _DateTimeDigitized          = 0x9004
 
-    _OffsetTime                 = 0x9010    // perhaps obsolete - not in standard
-    _OffsetTimeOriginal         = 0x9011    // perhaps obsolete - not in standard
-    _OffsetTimeDigitized        = 0x9012    // perhaps obsolete - not in standard
+    _OffsetTime                 = 0x9010    // Exif 2.31, "+hh:mm" or "-hh:mm"
+    _OffsetTimeOriginal         = 0x9011
+    _OffsetTimeDigitized        = 0x9012
 
     _ComponentsConfiguration    = 0x9101
     _CompressedBitsPerPixel     = 0x9102
@@ -525,6 +629,10 @@ const (                                     // EXIF IFD specific tags
     _LensSpecification          = 0xa432
     _LensMake                   = 0xa433
     _LensModel                  = 0xa434
+
+    _CompositeImage                         = 0xa460
+    _SourceImageNumberOfCompositeImage      = 0xa461
+    _SourceExposureTimesOfCompositeImage    = 0xa462
 )
 
 func (ifd *ifdd) storeExifVersion( ) error {
@@ -538,38 +646,33 @@ func (ifd *ifdd) storeExifVersion( ) error {
 }
 
 func (ifd *ifdd) storeExifExposureTime( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
+    fmtv := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         et := v.([]UnsignedRational)
-        fmt.Fprintf( w, "%f seconds", float32(et[0].Numerator)/float32(et[0].Denominator) )
+        fmt.Fprintf( w, "%s seconds", et[0].format( "%f" ) )
     }
     return ifd.storeUnsignedRationals( "Exposure Time", 1, fmtv )
 }
 
 func (ifd *ifdd) storeExifExposureProgram( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        ep := v.([]uint16)
-        var epString string
-        switch ep[0] {
-        case 0 : epString = "Undefined"
-        case 1 : epString = "Manual"
-        case 2 : epString = "Normal program"
-        case 3 : epString = "Aperture priority"
-        case 4 : epString = "Shutter priority"
-        case 5 : epString = "Creative program (biased toward depth of field)"
-        case 6 : epString = "Action program (biased toward fast shutter speed)"
-        case 7 : epString = "Portrait mode (for closeup photos with the background out of focus)"
-        case 8 : epString = "Landscape mode (for landscape photos with the background in focus) "
-        default:
-            epString = fmt.Sprintf( "Illegal Exposure Program (%d)", ep[0] )
+    return ifd.storeUnsignedShorts( "Exposure Program", 1, ifd.fmtEnum( _ExposureProgram, "Exposure Program" ) )
+}
+
+// offset times are ASCII strings of 7 characters, including the terminating
+// NUL. Unknown offsets are given as spaces.
+func (ifd *ifdd) storeExifOffsetTime( name string ) error {
+    text, err := ifd.checkTiffAsciiString( )
+    if err == nil {
+        if cErr := ifd.validateCount( name, 7, 7 ); cErr != nil && ifd.desc.Warn {
+            ifd.desc.logf( LogWarning, "Warning: %v", cErr )
         }
-        io.WriteString( w, epString )
+        ifd.storeValue( ifd.newAsciiStringValue( name, text ) )
     }
-    return ifd.storeUnsignedShorts( "Exposure Program", 1, fmtv )
+    return err
 }
 
 func (ifd *ifdd) storeExifComponentsConfiguration( ) error {
 
-    p := func( w io.Writer, v interface{}, indent string ) {
+    p := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         bSlice := v.([]byte)
         var config strings.Builder
         for _, b := range bSlice {
@@ -591,115 +694,37 @@ func (ifd *ifdd) storeExifComponentsConfiguration( ) error {
 }
 
 func (ifd *ifdd) storeExifSubjectDistance( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
+    fmtv := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         sd := v.([]UnsignedRational)
         if sd[0].Numerator == 0 {
             fmt.Fprintf( w, "Unknown" )
         } else if sd[0].Numerator == 0xffffffff {
             fmt.Fprintf( w, "Infinity" )
         } else {
-            fmt.Fprintf( w, "%f meters",
-                         float32(sd[0].Numerator)/float32(sd[0].Denominator) )
+            fmt.Fprintf( w, "%s meters", sd[0].format( "%f" ) )
         }
     }
     return ifd.storeUnsignedRationals( "Subject Distance", 1, fmtv )
 }
 
 func (ifd *ifdd) storeExifMeteringMode( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        mm := v.([]uint16)
-        var mmString string
-        switch mm[0] {
-        case 0 : mmString = "Unknown"
-        case 1 : mmString = "Average"
-        case 2 : mmString = "CenterWeightedAverage program"
-        case 3 : mmString = "Spot"
-        case 4 : mmString = "MultiSpot"
-        case 5 : mmString = "Pattern"
-        case 6 : mmString = "Partial"
-        case 255: mmString = "Other"
-        default:
-            mmString = fmt.Sprintf( "Illegal Metering Mode (%d)", mm[0] )
-        }
-        io.WriteString( w, mmString )
-    }
-    return ifd.storeUnsignedShorts( "Metering Mode", 1, fmtv )
+    return ifd.storeUnsignedShorts( "Metering Mode", 1, ifd.fmtEnum( _MeteringMode, "Metering Mode" ) )
 }
 
 func (ifd *ifdd) storeExifLightSource( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        ls := v.([]uint16)
-        var lsString string
-        switch ls[0] {
-        case 0 : lsString = "Unknown"
-        case 1 : lsString = "Daylight"
-        case 2 : lsString = "Fluorescent"
-        case 3 : lsString = "Tungsten (incandescent light)"
-        case 4 : lsString = "Flash"
-        case 9 : lsString = "Fine weather"
-        case 10 : lsString = "Cloudy weather"
-        case 11 : lsString = "Shade"
-        case 12 : lsString = "Daylight fluorescent (D 5700 - 7100K)"
-        case 13 : lsString = "Day white fluorescent (N 4600 - 5400K)"
-        case 14 : lsString = "Cool white fluorescent (W 3900 - 4500K)"
-        case 15 : lsString = "White fluorescent (WW 3200 - 3700K)"
-        case 17 : lsString = "Standard light A"
-        case 18 : lsString = "Standard light B"
-        case 19 : lsString = "Standard light C"
-        case 20 : lsString = "D55"
-        case 21 : lsString = "D65"
-        case 22 : lsString = "D75"
-        case 23 : lsString = "D50"
-        case 24 : lsString = "ISO studio tungsten"
-        case 255: lsString = "Other light source"
-        default:
-            lsString = fmt.Sprintf( "Illegal light source (%d)", ls[0] )
-        }
-        io.WriteString( w, lsString )
-    }
-    return ifd.storeUnsignedShorts( "Light Source", 1, fmtv )
+    return ifd.storeUnsignedShorts( "Light Source", 1, ifd.fmtEnum( _LightSource, "light source" ) )
 }
 
 func (ifd *ifdd) storeExifFlash( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        f := v.([]uint16)
-        var fString string
-        switch f[0] {
-        case 0x00 : fString = "Flash did not fire"
-        case 0x01 : fString = "Flash fired"
-        case 0x05 : fString = "Flash fired, strobe return light not detected"
-        case 0x07 : fString = "Flash fired, strobe return light detected"
-        case 0x09 : fString = "Flash fired, compulsory flash mode, return light not detected"
-        case 0x0F : fString = "Flash fired, compulsory flash mode, return light detected"
-        case 0x10 : fString = "Flash did not fire, compulsory flash mode"
-        case 0x18 : fString = "Flash did not fire, auto mode"
-        case 0x19 : fString = "Flash fired, auto mode"
-        case 0x1D : fString = "Flash fired, auto mode, return light not detected"
-        case 0x1F : fString = "Flash fired, auto mode, return light detected"
-        case 0x20 : fString = "No flash function"
-        case 0x41 : fString = "Flash fired, red-eye reduction mode"
-        case 0x45 : fString = "Flash fired, red-eye reduction mode, return light not detected"
-        case 0x47 : fString = "Flash fired, red-eye reduction mode, return light detected"
-        case 0x49 : fString = "Flash fired, compulsory flash mode, red-eye reduction mode"
-        case 0x4D : fString = "Flash fired, compulsory flash mode, red-eye reduction mode, return light not detected"
-        case 0x4F : fString = "Flash fired, compulsory flash mode, red-eye reduction mode, return light detected"
-        case 0x59 : fString = "Flash fired, auto mode, red-eye reduction mode"
-        case 0x5D : fString = "Flash fired, auto mode, return light not detected, red-eye reduction mode"
-        case 0x5F : fString = "Flash fired, auto mode, return light detected, red-eye reduction mode"
-        default:
-            fString = fmt.Sprintf( "Illegal Flash (%#02x)", f[0] )
-        }
-        io.WriteString( w, fString )
-    }
-    return ifd.storeUnsignedShorts( "Flash", 1, fmtv )
+    return ifd.storeUnsignedShorts( "Flash", 1, ifd.fmtEnum( _Flash, "Flash" ) )
 }
 
 func (ifd *ifdd) storeExifSubjectArea( ) error {
-    if ifd.fCount < 2 && ifd.fCount > 4 {
-        return fmt.Errorf( "Subject Area: invalid count (%d)\n", ifd.fCount )
+    if err := ifd.validateCount( "Subject Area", 2, 4 ); err != nil {
+        return err
     }
 
-    fmsa := func( w io.Writer, v interface{}, indent string ) {
+    fmsa := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         loc := v.([]uint16)
         switch len(loc) {
         case 2:
@@ -716,23 +741,46 @@ func (ifd *ifdd) storeExifSubjectArea( ) error {
 }
 
 func (ifd *ifdd) storeExifMakerNote( ) error {
+    if ifd.isParallel( MAKER ) {
+        ifd.parseInParallel( (*ifdd).parseExifMakerNote )
+        return nil
+    }
+    return ifd.parseExifMakerNote( )
+}
+
+func (ifd *ifdd) parseExifMakerNote( ) error {
     if ifd.fType != _Undefined {
         return fmt.Errorf( "MakerNote: invalid type (%s)\n", getTiffTString( ifd.fType ) )
     }
     if ifd.fCount > 4 {
         offset := ifd.desc.getUnsignedLong( ifd.sOffset )
+        if uint64(offset) + uint64(ifd.fCount) > uint64(len(ifd.desc.data)) {
+            if uint64(offset) + uint64(ifd.fCount) > uint64(len(ifd.desc.source)) {
+                return fmt.Errorf( "storeExifMakerNote: maker note out of bounds\n" )
+            }
+            if ifd.desc.Warn {
+                ifd.desc.logf( LogWarning, "storeExifMakerNote: Warning: maker note beyond metadata, read from source\n" )
+            }
+            data := ifd.desc.data       // read maker note from the source
+            ifd.desc.data = ifd.desc.source
+            defer func( ) { ifd.desc.data = data }( )
+        }
+        ifd.desc.global.makerNote = ifd.desc.data[offset:offset+ifd.fCount]
         for _, mn := range makerNotes {
             p := mn.try( ifd, offset )
             if p != nil {
+                ifd.desc.stats.MakerNote = mn.name
                 return p( offset )
             }
         }
+        ifd.storeMakerPreview( offset )
         if ifd.desc.Unknown != Stop {
             if ifd.desc.Warn {
-                fmt.Printf( "storeExifMakerNote: Warning: unknown maker note\n")
+                ifd.desc.logf( LogWarning, "storeExifMakerNote: Warning: unknown maker note\n")
             }
             return nil      // unknown maker notes cannot be stored
         }
+        return fmt.Errorf( "storeExifMakerNote: %w\n", ErrUnsupportedMakerNote )
     }
     return fmt.Errorf( "storeExifMakerNote: invalid maker note\n")
 }
@@ -741,34 +789,38 @@ func (ifd *ifdd) storeExifUserComment( ) error {
     if ifd.fType != _Undefined {
         return fmt.Errorf( "UserComment: invalid type (%s)\n", getTiffTString( ifd.fType ) )
     }
-    if ifd.fCount < 8 {
-        return fmt.Errorf( "UserComment: invalid count (%s)\n", ifd.fCount )
+    if err := ifd.validateCount( "UserComment", 8, 0 ); err != nil {
+        return err
     }
     //  first 8 Bytes are the encoding
     offset := ifd.desc.getUnsignedLong( ifd.sOffset )
     ud := ifd.desc.data[offset:offset+ifd.fCount]
 
-    p := func( w io.Writer, v interface{}, indent string ) {
+    p := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         ud := v.([]byte)
         encoding := ud[0:8]
         switch encoding[0] {
         case 0x41:  // ASCII?
             if bytes.Equal( encoding, []byte{ 'A', 'S', 'C', 'I', 'I', 0, 0, 0 } ) {
-                fmt.Fprintf( w, " ITU-T T.50 IA5 (ASCII)\n" )
+                fmt.Fprintf( w, "ITU-T T.50 IA5 (ASCII)\n" )
                 comment := bytes.Trim( ud[8:], " " )
-                fmt.Fprintf( w, "%s%q", indent + "  ", comment )
+                fmt.Fprintf( w, "%s%q", indent + getIndentUnit( w ), comment )
             }
         case 0x4a: // JIS?
             if bytes.Equal( encoding, []byte{ 'J', 'I', 'S', 0, 0, 0, 0, 0 } ) {
-                dumpData( w, "JIS X208-1990 (JIS)", indent + "  ", true, ud[8:] )
+                fmt.Fprintf( w, "JIS X208-1990 (JIS)\n" )
+                _, comment := decodeUserComment( ud, ifd.desc.endian )
+                fmt.Fprintf( w, "%s%q", indent + getIndentUnit( w ), comment )
             }
         case 0x55:  // UNICODE?
             if bytes.Equal( encoding, []byte{ 'U', 'N', 'I', 'C', 'O', 'D', 'E', 0 } ) {
-                dumpData( w, "Unicode Standard", indent + "  ", true, ud[8:] )
+                fmt.Fprintf( w, "Unicode Standard\n" )
+                _, comment := decodeUserComment( ud, ifd.desc.endian )
+                fmt.Fprintf( w, "%s%q", indent + getIndentUnit( w ), comment )
             }
         case 0x00:  // Undefined
             if bytes.Equal( encoding, []byte{ 0, 0, 0, 0, 0, 0, 0, 0 } ) {
-                dumpData( w, "Undefined encoding", indent + "  ", true, ud[8:] )
+                dumpData( w, "Undefined encoding", indent + getIndentUnit( w ), true, ud[8:] )
             }
         default:
             fmt.Fprintf( w, "Invalid encoding\n" )
@@ -782,8 +834,8 @@ func (ifd *ifdd) storeExifFlashpixVersion( ) error {
     if ifd.fType != _Undefined {
         return fmt.Errorf( "FlashpixVersion: invalid type (%s)\n", getTiffTString( ifd.fType ) )
     }
-    if ifd.fCount != 4 {
-        return fmt.Errorf( "FlashpixVersion: incorrect count (%d)\n", ifd.fCount )
+    if err := ifd.validateCount( "FlashpixVersion", 4, 4 ); err != nil {
+        return err
     }
     text := ifd.getUnsignedBytes( )
     ifd.storeValue( ifd.newAsciiStringValue( "Flashpix Version", text ) )
@@ -791,18 +843,7 @@ func (ifd *ifdd) storeExifFlashpixVersion( ) error {
 }
 
 func (ifd *ifdd) storeExifColorSpace( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        cs := v.([]uint16)
-        var csString string
-        switch cs[0] {
-        case 1 : csString = "sRGB"
-        case 65535: csString = "Uncalibrated"
-        default:
-            csString = fmt.Sprintf( "Illegal color space (%d)", cs[0] )
-        }
-        io.WriteString( w, csString )
-    }
-    return ifd.storeUnsignedShorts( "Color Space", 1, fmtv )
+    return ifd.storeUnsignedShorts( "Color Space", 1, ifd.fmtEnum( _ColorSpace, "color space" ) )
 }
 
 func (ifd *ifdd) storeExifDimension( name string ) error {
@@ -815,27 +856,11 @@ func (ifd *ifdd) storeExifDimension( name string ) error {
 }
 
 func (ifd *ifdd) storeExifSensingMethod( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        sm := v.([]uint16)
-        var smString string
-        switch sm[0] {
-        case 1 : smString = "Undefined"
-        case 2 : smString = "One-chip color area sensor"
-        case 3 : smString = "Two-chip color area sensor"
-        case 4 : smString = "Three-chip color area sensor"
-        case 5 : smString = "Color sequential area sensor"
-        case 7 : smString = "Trilinear sensor"
-        case 8 : smString = "Color sequential linear sensor"
-        default:
-            smString = fmt.Sprintf( "Illegal sensing method (%d)", sm[0] )
-        }
-        io.WriteString( w, smString )
-    }
-    return ifd.storeUnsignedShorts( "Sensing Method", 1, fmtv )
+    return ifd.storeUnsignedShorts( "Sensing Method", 1, ifd.fmtEnum( _SensingMethod, "sensing method" ) )
 }
 
 func (ifd *ifdd) storeExifFileSource( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {  // undfined but expect byte
+    fmtv := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {  // undfined but expect byte
         bs := v.([]byte)
         if bs[0] != 3 {
             fmt.Fprintf( w, "Illegal file source (%d)", bs[0] )
@@ -847,7 +872,7 @@ func (ifd *ifdd) storeExifFileSource( ) error {
 }
 
 func (ifd *ifdd) storeExifSceneType( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {  // undefined but expect byte
+    fmtv := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {  // undefined but expect byte
         bs := v.([]byte)
         if bs[0] != 1 {
             fmt.Fprintf( w, "Illegal scene type (%d)", bs[0] )
@@ -858,214 +883,52 @@ func (ifd *ifdd) storeExifSceneType( ) error {
     return ifd.storeUndefinedAsUnsignedBytes( "Scene Type", 1, fmtv )
 }
 
-func (ifd *ifdd) storeExifCFAPattern( ) error {
-    if ifd.fType != _Undefined {
-        return fmt.Errorf( "CFAPattern: invalid type (%s)\n", getTiffTString( ifd.fType ) )
-    }
-    // Since the structure cannot fit in 4 bytes, its location is indicated by an offset
-    offset := ifd.desc.getUnsignedLong( ifd.sOffset )
-    bSlice := ifd.desc.getUnsignedBytes( offset, ifd.fCount )
-
-    // structure describing the color filter array (CFA)
-    // 2 short words: horizontal repeat pixel unit (h), vertical repeat pixel unit (v)
-    // followed by h*v bytes, each byte value indicating a color:
-    // 0 RED, 1 GREEN, 2 BLUE, 3 CYAN, 4 MAGENTA, 5 YELLOW, 6 WHITE
-
-    hz := ifd.desc.getUnsignedShort( offset )
-    vt := ifd.desc.getUnsignedShort( offset + 2 )
-    // however, it seems that older microsoft tools do not use the proper endianess,
-    // so check here if the values are consistent with the total count:
-    if uint32(hz) * uint32(vt) != ifd.fCount - 4 { // if not try changing endianess
-        h1 := ((hz & 0xff) << 8) + (hz >> 8)
-        v1 := ((vt & 0xff) << 8) + (vt >> 8)
-        if ( uint32(h1) * uint32(v1) != ifd.fCount - 4 ) {
-            return fmt.Errorf( "CFAPattern: Invalid repeat patterns(%d,%d) @%#08x\n", hz, vt, ifd.sOffset )
-        }
-        hz, vt = h1, v1
-        if ifd.desc.Warn {
-            fmt.Printf("CFAPattern: Warning: incorrect endianess\n")
-        }
-    }
-//fmt.Printf( "hz %d, vt %d\n", hz, vt )
-    // current hz and vt will still be accessible from f
-    p := func( w io.Writer, v interface{}, indent string ) {
-        c := v.([]byte)[4:] // skip first 4 bytes (use hz & vt from enclosing block)
-        for i := uint16(0); i < vt; i++ {
-            if i > 0 {  // indent if not the first line
-                io.WriteString( w, "\n" + indent )
-            }
-            fmt.Fprintf( w, "Row %d:", i )
-            for j := uint16(0); j < hz; j++ {
-                var s string
-                switch c[(i*hz)+j] {
-                case 0: s = " RED"
-                case 1: s = " GREEN"
-                case 2: s = " BLUE"
-                case 3: s = " CYAN"
-                case 4: s = " MAGENTA"
-                case 5: s = " YELLOW"
-                case 6: s = " WHITE"
-                default:
-                    fmt.Fprintf( w, " Invalid color (%d)", c[(i*hz)+j] )
-                    return
-                }
-                io.WriteString( w, s )
-            }
-        }
-    }
-    ifd.storeValue( ifd.newUnsignedByteValue( "Color Filter Array Pattern", p, bSlice ) )
-    return nil
-}
-
 func (ifd *ifdd) storeExifCustomRendered( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        cr := v.([]uint16)
-        switch cr[0] {
-        case 0 : fmt.Fprintf( w, "Normal process" )
-        case 1 : fmt.Fprintf( w, "Custom process" )
-        default: fmt.Fprintf( w, "Illegal rendering process (%d)", cr[0] )
-        }
-    }
-    return ifd.storeUnsignedShorts( "Custom Rendered", 1, fmtv )
+    return ifd.storeUnsignedShorts( "Custom Rendered", 1, ifd.fmtEnum( _CustomRendered, "rendering process" ) )
 }
 
 func (ifd *ifdd) storeExifExposureMode( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        em := v.([]uint16)
-        var emString string
-        switch em[0] {
-        case 0 : emString = "Auto exposure"
-        case 1 : emString = "Manual exposure"
-        case 3 : emString = "Auto bracket"
-        default: emString = fmt.Sprintf( "Illegal Exposure mode (%d)", em[0] )
-        }
-        fmt.Fprintf( w, "%s", emString )
-    }
-    return ifd.storeUnsignedShorts( "Exposure Mode", 1, fmtv )
+    return ifd.storeUnsignedShorts( "Exposure Mode", 1, ifd.fmtEnum( _ExposureMode, "Exposure mode" ) )
 }
 
 func (ifd *ifdd) storeExifWhiteBalance( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        wb := v.([]uint16)
-        var wbString string
-        switch wb[0] {
-        case 0 : wbString = "Auto white balance"
-        case 1 : wbString = "Manual white balance"
-        default: wbString = fmt.Sprintf( "Illegal white balance (%d)", wb[0] )
-        }
-        io.WriteString( w, wbString )
-    }
-    return ifd.storeUnsignedShorts( "White Balance", 1, fmtv )
+    return ifd.storeUnsignedShorts( "White Balance", 1, ifd.fmtEnum( _WhiteBalance, "white balance" ) )
 }
 
 func (ifd *ifdd) storeExifDigitalZoomRatio( ) error {
-    fmv := func( w io.Writer, v interface{}, indent string ) {
+    fmv := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         dzr := v.([]UnsignedRational)
         if dzr[0].Numerator == 0 {
             fmt.Fprintf( w, "not used" )
-        } else if dzr[0].Denominator == 0 {
-            fmt.Fprintf( w, "invalid ratio Denominator (0)" )
         } else {
-            fmt.Fprintf( w, "%f",
-                         float32(dzr[0].Numerator)/float32(dzr[0].Denominator) )
+            io.WriteString( w, dzr[0].format( "%f" ) )
         }
     }
     return ifd.storeUnsignedRationals( "Digital-Zoom Ratio", 1, fmv )
 }
 
 func (ifd *ifdd) storeExifSceneCaptureType( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        ct := v.([]uint16)
-        var sctString string
-        switch ct[0] {
-        case 0 : sctString = "Standard"
-        case 1 : sctString = "Landscape"
-        case 2 : sctString = "Portrait"
-        case 3 : sctString = "Night scene"
-        default:
-            sctString = fmt.Sprintf( "Illegal scene capture type (%d)", ct[0] )
-        }
-        io.WriteString( w, sctString )
-    }
-    return ifd.storeUnsignedShorts( "Scene-Capture Type", 1, fmtv )
+    return ifd.storeUnsignedShorts( "Scene-Capture Type", 1, ifd.fmtEnum( _SceneCaptureType, "scene capture type" ) )
 }
 
 func (ifd *ifdd) storeExifGainControl( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        gc := v.([]uint16)
-        var gcString string
-        switch gc[0] {
-        case 0 : gcString = "none"
-        case 1 : gcString = "Low gain up"
-        case 2 : gcString = "high gain up"
-        case 3 : gcString = "low gain down"
-        case 4 : gcString = "high gain down"
-        default: gcString = fmt.Sprintf( "Illegal gain control (%d)", gc[0] )
-        }
-        io.WriteString( w, gcString )
-    }
-    return ifd.storeUnsignedShorts( "Gain Control", 1, fmtv )
+    return ifd.storeUnsignedShorts( "Gain Control", 1, ifd.fmtEnum( _GainControl, "gain control" ) )
 }
 
 func (ifd *ifdd) storeExifContrast( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        c := v.([]uint16)
-        var cString string
-        switch c[0] {
-        case 0 : cString = "Normal"
-        case 1 : cString = "Soft"
-        case 2 : cString = "Hard"
-        default: cString = fmt.Sprintf( "Illegal contrast (%d)", c[0] )
-        }
-        io.WriteString( w, cString )
-    }
-    return ifd.storeUnsignedShorts( "Contrast", 1, fmtv )
+    return ifd.storeUnsignedShorts( "Contrast", 1, ifd.fmtEnum( _Contrast, "contrast" ) )
 }
 
 func (ifd *ifdd) storeExifSaturation( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        s := v.([]uint16)
-        var sString string
-        switch s[0] {
-        case 0 : sString = "Normal"
-        case 1 : sString = "Low saturation"
-        case 2 : sString = "High saturation"
-        default: sString = fmt.Sprintf( "Illegal Saturation (%d)", s[0] )
-        }
-        io.WriteString( w, sString )
-    }
-    return ifd.storeUnsignedShorts( "Saturation", 1, fmtv )
+    return ifd.storeUnsignedShorts( "Saturation", 1, ifd.fmtEnum( _Saturation, "Saturation" ) )
 }
 
 func (ifd *ifdd) storeExifSharpness( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        s := v.([]uint16)
-        var sString string
-        switch s[0] {
-        case 0 : sString = "Normal"
-        case 1 : sString = "Soft"
-        case 2 : sString = "Hard"
-        default: sString = fmt.Sprintf( "Illegal Sharpness (%d)", s[0] )
-        }
-        io.WriteString( w, sString )
-    }
-    return ifd.storeUnsignedShorts( "Sharpness", 1, fmtv )
+    return ifd.storeUnsignedShorts( "Sharpness", 1, ifd.fmtEnum( _Sharpness, "Sharpness" ) )
 }
 
 func (ifd *ifdd) storeExifDistanceRange( ) error {
-    fmtv := func( w io.Writer, v interface{}, indent string ) {
-        dr := v.([]uint16)
-        var drString string
-        switch dr[0] {
-        case 0 : drString = "Unknown"
-        case 1 : drString = "Macro"
-        case 2 : drString = "Close View"
-        case 3 : drString = "Distant View"
-        default: drString = fmt.Sprintf( "Illegal Distance Range (%d)", dr[0] )
-        }
-        io.WriteString( w, drString )
-    }
-    return ifd.storeUnsignedShorts( "Distance Range", 1, fmtv )
+    return ifd.storeUnsignedShorts( "Distance Range", 1, ifd.fmtEnum( _SubjectDistanceRange, "Distance Range" ) )
 }
 
 func (ifd *ifdd) storeExifLensSpecification( ) error {
@@ -1077,17 +940,16 @@ func (ifd *ifdd) storeExifLensSpecification( ) error {
 //  which are specification information for the lens that was used in photography.
 //  When the minimum F number is unknown, the notation is 0/0.
 
-    fmls := func( w io.Writer, v interface{}, indent string ) {
+    fmls := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         ls := v.([]UnsignedRational)
 
-        fmt.Fprintf( w, "minimum focal length: %.1f\n",
-                    float32(ls[0].Numerator)/float32(ls[0].Denominator) )
-        fmt.Fprintf( w, "%smaximum focal length: %.1f\n", indent,
-                    float32(ls[1].Numerator)/float32(ls[1].Denominator) )
-        fmt.Fprintf( w, "%sminimum F number: %.1f\n", indent,
-                    float32(ls[2].Numerator)/float32(ls[2].Denominator) )
-        fmt.Fprintf( w, "%smaximum F number: %.1f", indent,
-                    float32(ls[3].Numerator)/float32(ls[3].Denominator) )
+        fmt.Fprintf( w, "minimum focal length: %s\n", ls[0].format( "%.1f" ) )
+        fmt.Fprintf( w, "%smaximum focal length: %s\n", indent,
+                     ls[1].format( "%.1f" ) )
+        fmt.Fprintf( w, "%sminimum F number: %s\n", indent,
+                     ls[2].format( "%.1f" ) )
+        fmt.Fprintf( w, "%smaximum F number: %s", indent,
+                     ls[3].format( "%.1f" ) )
     }
     return ifd.storeUnsignedRationals( "Lens Specification", 4, fmls )
 }
@@ -1104,7 +966,20 @@ func storeExifTags( ifd *ifdd ) error {
         return ifd.storeExifExposureProgram( )
 
     case _ISOSpeedRatings:
-        return ifd.storeUnsignedShorts( "ISO Speed Ratings", 1, nil )
+        return ifd.storeUnsignedShorts( "ISO Speed Ratings", 0, nil )
+    case _SensitivityType:
+        return ifd.storeUnsignedShorts( "Sensitivity Type", 1,
+                            ifd.fmtEnum( _SensitivityType, "sensitivity type" ) )
+    case _StandardOutputSensitivity:
+        return ifd.storeUnsignedLongs( "Standard Output Sensitivity", 1, nil )
+    case _RecommendedExposureIndex:
+        return ifd.storeUnsignedLongs( "Recommended Exposure Index", 1, nil )
+    case _ISOSpeed:
+        return ifd.storeUnsignedLongs( "ISO Speed", 1, nil )
+    case _ISOSpeedLatitudeyyy:
+        return ifd.storeUnsignedLongs( "ISO Speed Latitude yyy", 1, nil )
+    case _ISOSpeedLatitudezzz:
+        return ifd.storeUnsignedLongs( "ISO Speed Latitude zzz", 1, nil )
     case _ExifVersion:
         return ifd.storeExifVersion( )
 
@@ -1114,11 +989,11 @@ func storeExifTags( ifd *ifdd ) error {
         return ifd.storeAsciiString( "DateTime Digitized" )
 
     case _OffsetTime:
-        return ifd.storeAsciiString( "Offset Time" )
+        return ifd.storeExifOffsetTime( "Offset Time" )
     case _OffsetTimeOriginal:
-        return ifd.storeAsciiString( "Offset Time Original" )
+        return ifd.storeExifOffsetTime( "Offset Time Original" )
     case _OffsetTimeDigitized:
-        return ifd.storeAsciiString( "Offset Time Digitized" )
+        return ifd.storeExifOffsetTime( "Offset Time Digitized" )
 
     case _ComponentsConfiguration:
         return ifd.storeExifComponentsConfiguration( )
@@ -1146,6 +1021,10 @@ func storeExifTags( ifd *ifdd ) error {
         return ifd.storeUnsignedRationals( "Focal Length", 1, nil )
     case _SubjectArea:
         return ifd.storeExifSubjectArea( )
+    case _SecurityClassification:   // TIFF/EP tags, sometimes in Exif IFD
+        return ifd.storeSecurityClassification( )
+    case _ImageHistory:
+        return ifd.storeAsciiString( "Image History" )
 
     case _MakerNote:
         return ifd.storeExifMakerNote( )
@@ -1206,6 +1085,13 @@ func storeExifTags( ifd *ifdd ) error {
     case _LensModel:
         return ifd.storeAsciiString( "Lens Model" )
 
+    case _CompositeImage:
+        return ifd.storeExifCompositeImage( )
+    case _SourceImageNumberOfCompositeImage:
+        return ifd.storeExifSourceImageNumber( )
+    case _SourceExposureTimesOfCompositeImage:
+        return ifd.storeExifSourceExposureTimes( )
+
     case _InteroperabilityIFD:
         return ifd.storeEmbeddedIfd( "IOP IFD", IOP, storeIopTags )
 
@@ -1214,7 +1100,6 @@ func storeExifTags( ifd *ifdd ) error {
     default:
         return ifd.processUnknownTag( )
     }
-    return nil
 }
 
 const (                                     // _GPS IFD specific tags
@@ -1251,18 +1136,163 @@ const (                                     // _GPS IFD specific tags
     _GPSDifferential        = 0x1e
 )
 
+func fmtGPSVersionID( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+    vid := v.([]byte)
+    fmt.Fprintf( w, "%d.%d.%d.%d", vid[0], vid[1], vid[2], vid[3] )
+}
+
 func (ifd *ifdd) storeGPSVersionID( ) error {
-    p := func( w io.Writer, v interface{}, indent string ) {
-        vid := v.([]byte)
-        fmt.Fprintf( w, "%d.%d.%d.%d", vid[0], vid[1], vid[2], vid[3] )
+    return ifd.storeUnsignedBytes( "GPS Version ID", 4, fmtGPSVersionID )
+}
+
+// GPS reference tags are ASCII strings of 1 character, followed by a NUL.
+// They precede the tag they qualify and are looked up in the ifd when the
+// qualified value is formatted, so that updates are taken into account.
+func (ifd *ifdd) getGPSRef( tag tTag ) string {
+    ref, _ := ifd.getAsciiString( tag )
+    return ref
+}
+
+func (ifd *ifdd) storeGPSRef( name string ) error {
+    text, err := ifd.checkTiffAsciiString( )
+    if err == nil {
+        err = ifd.validateCount( name, 2, 2 )
     }
-    return ifd.storeUnsignedBytes( "GPS Version ID", 4, p )
+    if err == nil {
+        ifd.storeValue( ifd.newAsciiStringValue( name, text ) )
+    }
+    return err
+}
+
+// fmtGPSCoordinate returns a formatter for coordinates made of degrees,
+// minutes and seconds, followed by the reference given by tag ref. Degrees
+// and minutes may have a fractional part, as written by some devices.
+func (ifd *ifdd) fmtGPSCoordinate( ref tTag ) tFormatter {
+    return func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        c := v.([]UnsignedRational)
+        fmt.Fprintf( w, "%g° %g' %.2f\" %s", c[0].checkedFloat( ),
+                     c[1].checkedFloat( ), c[2].checkedFloat( ),
+                     ifd.getGPSRef( ref ) )
+    }
+}
+
+func (ifd *ifdd) storeGPSCoordinate( name string, ref tTag ) error {
+    return ifd.storeUnsignedRationals( name, 3, ifd.fmtGPSCoordinate( ref ) )
+}
+
+func fmtGPSDistance( w io.Writer, d float64, ref string ) {
+    var unit string
+    switch ref {
+    case "K": unit = "km"
+    case "M": unit = "mi"
+    case "N": unit = "nmi"
+    default:  unit = "(unknown unit)"
+    }
+    fmt.Fprintf( w, "%.1f %s", d, unit )
+}
+
+func (ifd *ifdd) storeGPSSpeed( ) error {
+    fs := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        var unit string
+        switch ifd.getGPSRef( _GPSSpeedRef ) {
+        case "K", "": unit = "km/h"
+        case "M": unit = "mph"
+        case "N": unit = "knots"
+        default:  unit = "(unknown unit)"
+        }
+        fmt.Fprintf( w, "%.1f %s", v.([]UnsignedRational)[0].checkedFloat( ),
+                     unit )
+    }
+    return ifd.storeUnsignedRationals( "GPS Speed", 1, fs )
+}
+
+// fmtGPSBearing returns a formatter for a bearing in degrees, followed by
+// its reference given by tag ref (T for true north, M for magnetic north).
+func (ifd *ifdd) fmtGPSBearing( ref tTag ) tFormatter {
+    return func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        fmt.Fprintf( w, "%.1f° %s", v.([]UnsignedRational)[0].checkedFloat( ),
+                     ifd.getGPSRef( ref ) )
+    }
+}
+
+func (ifd *ifdd) storeGPSDestBearing( ) error {
+    fb := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        b := v.([]UnsignedRational)
+        fmt.Fprintf( w, "bearing %.1f° %s", b[0].checkedFloat( ),
+                     ifd.getGPSRef( _GPSDestBearingRef ) )
+        if d, ok := ifd.getValue( _GPSDestDistance ).(*unsignedRationalValue);
+           ok && len(d.v) == 1 {
+            io.WriteString( w, ", " )
+            fmtGPSDistance( w, d.v[0].checkedFloat( ),
+                            ifd.getGPSRef( _GPSDestDistanceRef ) )
+        }
+    }
+    return ifd.storeUnsignedRationals( "GPS Destination Bearing", 1, fb )
+}
+
+func (ifd *ifdd) storeGPSDestDistance( ) error {
+    fd := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        d := v.([]UnsignedRational)
+        fmtGPSDistance( w, d[0].checkedFloat( ),
+                        ifd.getGPSRef( _GPSDestDistanceRef ) )
+    }
+    return ifd.storeUnsignedRationals( "GPS Destination Distance", 1, fd )
+}
+
+func (ifd *ifdd) storeGPSDifferential( ) error {
+    return ifd.storeUnsignedShorts( "GPS Differential", 1, ifd.fmtEnum( _GPSDifferential, "differential correction" ) )
 }
 
 func storeGpsTags( ifd *ifdd ) error {
     switch ifd.fTag {
     case _GPSVersionID:
         return ifd.storeGPSVersionID( )
+
+    case _GPSLatitudeRef:
+        return ifd.storeGPSRef( "GPS Latitude Ref" )
+    case _GPSLatitude:
+        return ifd.storeGPSCoordinate( "GPS Latitude", _GPSLatitudeRef )
+    case _GPSLongitudeRef:
+        return ifd.storeGPSRef( "GPS Longitude Ref" )
+    case _GPSLongitude:
+        return ifd.storeGPSCoordinate( "GPS Longitude", _GPSLongitudeRef )
+
+    case _GPSSpeedRef:
+        return ifd.storeGPSRef( "GPS Speed Ref" )
+    case _GPSSpeed:
+        return ifd.storeGPSSpeed( )
+    case _GPSTrackRef:
+        return ifd.storeGPSRef( "GPS Track Ref" )
+    case _GPSTrack:
+        return ifd.storeUnsignedRationals( "GPS Track", 1,
+                                           ifd.fmtGPSBearing( _GPSTrackRef ) )
+    case _GPSImgDirectionRef:
+        return ifd.storeGPSRef( "GPS Image Direction Ref" )
+    case _GPSImgDirection:
+        return ifd.storeUnsignedRationals( "GPS Image Direction", 1,
+                                           ifd.fmtGPSBearing( _GPSImgDirectionRef ) )
+
+    case _GPSDestLatitudeRef:
+        return ifd.storeGPSRef( "GPS Destination Latitude Ref" )
+    case _GPSDestLatitude:
+        return ifd.storeGPSCoordinate( "GPS Destination Latitude",
+                                       _GPSDestLatitudeRef )
+    case _GPSDestLongitudeRef:
+        return ifd.storeGPSRef( "GPS Destination Longitude Ref" )
+    case _GPSDestLongitude:
+        return ifd.storeGPSCoordinate( "GPS Destination Longitude",
+                                       _GPSDestLongitudeRef )
+    case _GPSDestBearingRef:
+        return ifd.storeGPSRef( "GPS Destination Bearing Ref" )
+    case _GPSDestBearing:
+        return ifd.storeGPSDestBearing( )
+    case _GPSDestDistanceRef:
+        return ifd.storeGPSRef( "GPS Destination Distance Ref" )
+    case _GPSDestDistance:
+        return ifd.storeGPSDestDistance( )
+
+    case _GPSDifferential:
+        return ifd.storeGPSDifferential( )
     default:
         return ifd.processUnknownTag( )
     }
@@ -1274,7 +1304,7 @@ const (                                     // _IOP IFD tags
 )
 
 func (ifd *ifdd) storeInteroperabilityVersion( ) error {
-    p := func( w io.Writer, v interface{}, indent string ) {
+    p := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
         bs := v.([]byte)
         fmt.Fprintf( w, "%c.%c.%c.%c",
                      bs[0], bs[1], bs[2], bs[3] )
@@ -1298,16 +1328,52 @@ func storeIopTags( ifd *ifdd ) error {
 // This does not work for thumbnails where the size is given by a separate tag,
 // i.e. storeJPEGInterchangeFormat & storeJPEGInterchangeFormatLength.
 // This is treated as a special case in storeJPEGInterchangeFormatLength
-func (ifd *ifdd)setDataAreaHighWaterMark( ) {
-    size := getTiffTypeSize( ifd.fType ) * ifd.fCount
+func (ifd *ifdd)setDataAreaHighWaterMark( size uint32 ) {
     if size > 4 {
         offset := ifd.desc.getUnsignedLong( ifd.sOffset ) + size
-        if offset > ifd.desc.dataEnd {
+        if offset > ifd.desc.dataEnd && offset <= uint32(len(ifd.desc.data)) {
             ifd.desc.dataEnd = offset
         }
     }
 }
 
+// checkEntryData returns the size of the current entry value, or an error if
+// the entry type is unknown or if the value does not fit in the data.
+func (ifd *ifdd)checkEntryData( ) (uint32, error) {
+    tSize, err := getTiffTypeSize( ifd.fType )
+    if err != nil {
+        return 0, err
+    }
+    size := uint64(tSize) * uint64(ifd.fCount)
+    if size > _valOffSize {
+        offset := ifd.desc.getUnsignedLong( ifd.sOffset )
+        if uint64(offset) + size > uint64(len(ifd.desc.data)) &&
+           ! ifd.isInSource( uint64(offset) + size ) {
+            return 0, fmt.Errorf( "checkEntryData: value out of bounds (%d bytes @%#08x)\n",
+                                  size, offset )
+        }
+    }
+    return uint32(size), nil
+}
+
+// isInSource returns true if the current entry is a maker note whose value,
+// ending at end, is beyond the data but within the secondary data source.
+func (ifd *ifdd)isInSource( end uint64 ) bool {
+    return ifd.id == EXIF && ifd.fTag == _MakerNote &&
+           end <= uint64(len(ifd.desc.source))
+}
+
+// getEntryError returns the error reported by storeIFD when the entry tag in
+// the ifd id could not be stored because of err, keeping the innermost invalid
+// field if err is already a ValidationError.
+func getEntryError( id IfdId, tag tTag, err error ) error {
+    var ve *ValidationError
+    if errors.As( err, &ve ) {
+        return fmt.Errorf( "storeIFD: invalid field: %w", err )
+    }
+    return fmt.Errorf( "storeIFD: %w", &ValidationError{ id, uint16(tag), err } )
+}
+
 // storeIfd makes a new ifdd, checks all entries and store the corresponding
 // values in the ifdd. It returns the offset of the next ifd in list (0 if
 // none), the newly created ifdd and an error if it failed.
@@ -1323,13 +1389,50 @@ func (d *Desc) storeIFD( id IfdId, start uint32,
     ifd.id = id
     ifd.desc = d
 
+    dLen := uint64(len(d.data))
+    if uint64(start) + _ShortSize > dLen {
+        return 0, nil, fmt.Errorf( "storeIFD: %s IFD out of bounds @%#08x\n",
+                                   d.IfdName(id), start )
+    }
+    // check that the whole entry table, including the next IFD offset, is
+    // within data before allocating anything. In lenient mode, a bogus number
+    // of entries is clamped to the entries that fit, without next IFD.
     nIfdEntries := d.getUnsignedShort( start )
+    clamped := false
+    if uint64(start) + _ShortSize + uint64(nIfdEntries) * _IfdEntrySize +
+       _LongSize > dLen {
+        if ! d.Lenient {
+            return 0, nil, fmt.Errorf( "storeIFD: %s IFD entries out of bounds @%#08x (%d entries)\n",
+                                       d.IfdName(id), start, nIfdEntries )
+        }
+        fit := (dLen - uint64(start) - _ShortSize) / _IfdEntrySize
+        if fit < uint64(nIfdEntries) {
+            d.stats.getIfd( id ).Coerced ++
+            if d.Warn {
+                d.logf( LogWarning, "%s: Warning: %d entries out of bounds @%#08x, clamped to %d\n",
+                        d.IfdName(id), nIfdEntries, start, fit )
+            }
+            nIfdEntries, clamped = uint16(fit), true
+        }
+    }
+    if max := d.Limits.MaxEntries; max != 0 && nIfdEntries > max {
+        if ! d.Lenient {
+            return 0, nil, fmt.Errorf( "storeIFD: %s IFD @%#08x: %d entries exceed limit %d\n",
+                                       d.IfdName(id), start, nIfdEntries, max )
+        }
+        d.stats.getIfd( id ).Coerced ++
+        if d.Warn {
+            d.logf( LogWarning, "%s: Warning: %d entries @%#08x exceed limit, clamped to %d\n",
+                    d.IfdName(id), nIfdEntries, start, max )
+        }
+        nIfdEntries, clamped = max, true
+    }
     ifd.sOffset = start + _ShortSize
     ifd.values = make( []serializer, 0, nIfdEntries )
 
     if d.ParsDbg {
-        fmt.Printf( "storeIFD %s IFD (%d): %d entries\n",
-                    GetIfdName(id), id, nIfdEntries )
+        d.logf( LogDebug, "storeIFD %s IFD (%d): %d entries\n",
+                d.IfdName(id), id, nIfdEntries )
     }
 
     for i := uint16(0); i < nIfdEntries; i++ {
@@ -1338,30 +1441,60 @@ func (d *Desc) storeIFD( id IfdId, start uint32,
         ifd.fCount = d.getUnsignedLong( ifd.sOffset + 4 )
 
         if d.ParsDbg {
-            fmt.Printf( "storeIFD %s IFD (%d): entry %d @%#08x: tag %#04x, %d %s\n",
-                        GetIfdName(id), id, i, ifd.sOffset, ifd.fTag,
-                        ifd.fCount, getTiffTString( ifd.fType ) )
+            d.logf( LogDebug, "storeIFD %s IFD (%d): entry %d @%#08x: tag %#04x, %d %s\n",
+                    d.IfdName(id), id, i, ifd.sOffset, ifd.fTag,
+                    ifd.fCount, getTiffTString( ifd.fType ) )
         }
 
         ifd.sOffset += 8
-        ifd.setDataAreaHighWaterMark()
-
-        err := storeTags( ifd )
+        var err error
+        if size, dErr := ifd.checkEntryData( ); dErr != nil {
+            if d.stats.MakerNote != "" && (id == MAKER || d.isEmbedded( id )) {
+                ifd.makerWarning( d.stats.MakerNote,
+                                  "entry %d cannot be decoded: %v", i, dErr )
+            } else if d.Warn {
+                d.logf( LogWarning, "%s: entry %d (tag %#02x) cannot be decoded: %v",
+                        d.IfdName(id), i, ifd.fTag, dErr )
+            }
+            err = ifd.processUnknownTag( )
+        } else if max := d.Limits.MaxValueSize; max != 0 && size > max {
+            if ! d.Lenient {
+                return 0, nil, getEntryError( id, ifd.fTag,
+                            fmt.Errorf( "value size %d exceeds limit %d\n",
+                                        size, max ) )
+            }
+            if d.Warn {
+                d.logf( LogWarning, "%s: Warning: entry %d (tag %#02x) size %d exceeds limit, removed\n",
+                        d.IfdName(id), i, ifd.fTag, size )
+            }
+            ifd.removeEntry( )
+        } else {
+            if size > _valOffSize {
+                d.stats.getIfd( id ).DataSize += size
+            }
+            ifd.setDataAreaHighWaterMark( size )
+            err = storeTags( ifd )
+        }
+        d.stats.getIfd( id ).Entries ++
+        d.reportParsed( )
         if err != nil {
-            return 0, nil, fmt.Errorf( "storeIFD: invalid field: %v", err )
+            return 0, nil, getEntryError( id, ifd.fTag, err )
         }
         ifd.sOffset += 4
     }
-    d.ifds[id] = ifd                            // store in flat ifd array
-    offset := d.getUnsignedLong( ifd.sOffset )  // next IFD offset in list
+    d.setIfd( id, ifd )                         // store in flat ifd array
+    var offset uint32                           // next IFD offset in list
+    if ! clamped && uint64(ifd.sOffset) + _LongSize <= dLen {
+        offset = d.getUnsignedLong( ifd.sOffset )
+    }
 
     if d.ParsDbg {
         if offset == 0 {
-            fmt.Printf( "storeIFD %s IFD (%d): no next IFD in list\n",
-                        GetIfdName(id), id )
+            d.logf( LogDebug, "storeIFD %s IFD (%d): no next IFD in list\n",
+                    d.IfdName(id), id )
         } else {
-            fmt.Printf( "storeIFD %s IFD (%d): next ifd @offset %#08x\n",
-                        GetIfdName(id), id, offset )
+            d.logf( LogDebug, "storeIFD %s IFD (%d): next ifd @offset %#08x\n",
+                    d.IfdName(id), id, offset )
         }
     }
     return offset, ifd, nil
@@ -0,0 +1,199 @@
+package exif
+
+import (
+    "bytes"
+    "encoding/binary"
+    "strings"
+    "testing"
+)
+
+// testStoreIFD calls storeIFD on data at offset 0, counting the entries
+// given to storeTags
+func testStoreIFD( data []byte, ec *Control ) (next uint32, entries int,
+                                               d *Desc, err error) {
+    d = newDesc( data, ec )
+    d.endian = binary.BigEndian
+    next, _, err = d.storeIFD( PRIMARY, 0, func( *ifdd ) error {
+        entries ++
+        return nil
+    } )
+    return
+}
+
+func TestStoreIFDMalformed( t *testing.T ) {
+    e := binary.BigEndian
+    entries := []testEntry{
+        { _Make, uint16(_ASCIIString), 4, testString( "abc" ) },
+        { _Model, uint16(_ASCIIString), 4, testString( "def" ) },
+        { _Orientation, uint16(_UnsignedShort), 1, testShorts( e, 1 ) },
+    }
+    ifd := testIfd( e, 0, entries, 0x1234 )     // 2 + 3*12 + 4 bytes
+    bogus := append( testShorts( e, 0xffff ), ifd[2:]... )
+
+    for _, c := range []struct {
+        name        string
+        data        []byte
+        limit       uint16
+        fail        bool        // in strict mode
+        entries     int         // in lenient mode
+        next        uint32      // in lenient mode
+        coerced     uint        // in lenient mode
+    } {
+        { "valid", ifd, 0, false, 3, 0x1234, 0 },
+        { "truncated count", ifd[:1], 0, true, -1, 0, 0 },
+        { "empty without next", testShorts( e, 0 ), 0, true, 0, 0, 0 },
+        { "0xffff entries", bogus, 0, true, 3, 0, 1 },
+        { "missing next", ifd[:2+3*12], 0, true, 3, 0, 0 },
+        { "partial next", ifd[:2+3*12+2], 0, true, 3, 0, 0 },
+        { "partial entry", ifd[:2+2*12+6], 0, true, 2, 0, 1 },
+        { "entry limit", ifd, 2, true, 2, 0, 1 },
+    } {
+        limits := Limits{ MaxEntries: c.limit }
+        next, n, _, err := testStoreIFD( c.data, &Control{ Limits: limits } )
+        if c.fail != (err != nil) {
+            t.Errorf( "%s: strict error %v", c.name, err )
+        } else if ! c.fail && (n != c.entries || next != c.next) {
+            t.Errorf( "%s: %d entries, next %#x", c.name, n, next )
+        }
+
+        next, n, d, err := testStoreIFD( c.data,
+                                         &Control{ Lenient: true, Limits: limits } )
+        if c.entries < 0 {          // no entry count: always an error
+            if err == nil {
+                t.Errorf( "%s: lenient mode accepted the IFD", c.name )
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf( "%s: lenient error %v", c.name, err )
+            continue
+        }
+        if n != c.entries || next != c.next {
+            t.Errorf( "%s: lenient %d entries, next %#x instead of %d, %#x",
+                      c.name, n, next, c.entries, c.next )
+        }
+        if coerced := d.stats.Ifds[PRIMARY].Coerced; coerced != c.coerced {
+            t.Errorf( "%s: %d coerced instead of %d", c.name, coerced, c.coerced )
+        }
+    }
+}
+
+func TestStoreIFDOutOfBounds( t *testing.T ) {
+    e := binary.LittleEndian
+    data := append( testTiffHeader( e ), 0 )    // IFD0 at offset 8, 1 byte
+    d := newDesc( data, &Control{ Lenient: true } )
+    d.endian = e
+    if _, _, err := d.storeIFD( PRIMARY, 8, nil ); err == nil {
+        t.Errorf( "truncated IFD accepted" )
+    }
+    if _, _, err := d.storeIFD( PRIMARY, 100, nil ); err == nil {
+        t.Errorf( "IFD out of data accepted" )
+    }
+}
+
+func TestSubjectAreaCount( t *testing.T ) {
+    e := binary.LittleEndian
+    for _, c := range []struct {
+        count   uint32
+        want    string          // empty if the count is invalid
+    } {
+        { 1, "" },
+        { 2, "Point x=10, y=20" },
+        { 3, "Circle center x=10, y=20 diameter=30" },
+        { 4, "Rectangle center x=10, y=20 width=30 height=40" },
+        { 5, "" },
+    } {
+        area := testShorts( e, 10, 20, 30, 40, 50 )[:2*c.count]
+        exif := []testEntry{
+            { _SubjectArea, uint16(_UnsignedShort), c.count, area },
+        }
+        data := append( []byte( "Exif\x00\x00" ), testTiff( e, nil, exif )... )
+        d, err := Parse( data, 0, uint(len(data)), &Control{ } )
+        if c.want == "" {
+            if err == nil {
+                t.Errorf( "count %d accepted", c.count )
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf( "count %d: %v", c.count, err )
+            continue
+        }
+        if f := testFormat( t, d, EXIF ); ! strings.Contains( f, c.want ) {
+            t.Errorf( "count %d: %q not found in:\n%s", c.count, c.want, f )
+        }
+    }
+}
+
+func TestUnknownEntryRoundTrip( t *testing.T ) {
+    e := binary.BigEndian
+    ifd0 := []testEntry{
+        { _Make, uint16(_ASCIIString), 6, testString( "Nikon" ) },
+        { 0x9998, 0x77, 3, []byte{ 1, 2, 3, 4 } },                  // unknown type
+        { 0x9999, uint16(_UnsignedLong), 1000, testLongs( e, 0x7fff0000 ) },
+    }
+    d := testParse( t, testTiff( e, ifd0, nil ), &Control{ } )
+    if len(d.stats.RemovedEntries) != 1 ||
+       d.stats.RemovedEntries[0] != (RemovedEntry{ PRIMARY, 0x9999,
+                                                   uint16(_UnsignedLong), 1000 }) {
+        t.Errorf( "removed entries %v", d.stats.RemovedEntries )
+    }
+    data, err := d.Bytes( )
+    if err != nil {
+        t.Fatalf( "Bytes: %v", err )
+    }
+    r, err := Parse( data, 0, uint(len(data)), &Control{ } )
+    if err != nil {
+        t.Fatalf( "Parse serialized: %v", err )
+    }
+    if _, err := r.GetIfdTagEntry( PRIMARY, 0x9999 ); err == nil {
+        t.Errorf( "out of bounds entry serialized" )
+    }
+    ei, err := r.GetIfdTagEntry( PRIMARY, 0x9998 )
+    if err != nil || ei.Type != uint16(_Undefined) || ei.Count != 4 {
+        t.Errorf( "unknown type entry %+v (%v)", ei, err )
+    }
+    v := r.ifds[PRIMARY].getValue( 0x9998 )
+    if ub, ok := v.(*unsignedByteValue); ! ok ||
+       ! bytes.Equal( ub.v, []byte{ 1, 2, 3, 4 } ) {
+        t.Errorf( "unknown type entry value %#v", v )
+    }
+}
+
+func TestNormalizeAsciiString( t *testing.T ) {
+    e := binary.LittleEndian
+    for _, c := range []struct {
+        name        string
+        tag         uint16
+        data        []byte
+        want        string
+        normalized  uint
+    } {
+        { "exact count", _Model, []byte( "D70\x00" ), "D70\x00", 0 },
+        { "empty", _Model, nil, "\x00", 1 },
+        { "short count", _Model, []byte( "D70s" ), "D70s\x00", 1 },
+        { "NUL padding", _Model, []byte( "D70\x00\x00\x00" ), "D70\x00\x00\x00", 0 },
+        { "long count", _Model, []byte( "D70\x00xyz\x00" ), "D70\x00", 1 },
+        { "embedded NUL", _Model, []byte( "ab\x00cd" ), "ab\x00", 1 },
+        { "InkNames", _InkNames, []byte( "cyan\x00magenta\x00" ),
+                                 "cyan\x00magenta\x00", 0 },
+        { "InkNames short count", _InkNames, []byte( "cyan\x00mag" ),
+                                            "cyan\x00mag\x00", 1 },
+    } {
+        ifd0 := []testEntry{
+            { c.tag, uint16(_ASCIIString), uint32(len(c.data)), c.data },
+        }
+        d := testParse( t, testTiff( e, ifd0, nil ), &Control{ } )
+        ub, ok := d.ifds[PRIMARY].getValue( tTag(c.tag) ).(*unsignedByteValue)
+        if ! ok {
+            t.Errorf( "%s: no string", c.name )
+            continue
+        }
+        if string(ub.v) != c.want {
+            t.Errorf( "%s: %q instead of %q", c.name, ub.v, c.want )
+        }
+        if n := d.stats.Ifds[PRIMARY].Normalized; n != c.normalized {
+            t.Errorf( "%s: %d normalized instead of %d", c.name, n, c.normalized )
+        }
+    }
+}
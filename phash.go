@@ -0,0 +1,209 @@
+package exif
+
+// support for comparing the thumbnail with the primary image
+
+import (
+    "bytes"
+    "fmt"
+    "image"
+    "image/color"
+    "image/jpeg"
+    "io"
+    "math"
+    "math/bits"
+    "sort"
+)
+
+/*
+    A thumbnail left unchanged while the image was replaced, or a thumbnail
+    taken from another image, shows a different picture than the image it is
+    attached to. This is detected by comparing perceptual hashes of both
+    images, which stay close when an image is resized or recompressed.
+
+    The perceptual hash is the usual DCT based hash: the luminance of the
+    image is averaged down to 32x32 pixels, transformed with a 2-D DCT, and
+    each of the 64 lowest frequency coefficients gives one bit of the hash,
+    set if the coefficient is above their median. The distance between 2
+    hashes is the number of different bits: 0 for identical pictures, about
+    32 for unrelated pictures.
+
+    Thumbnails are often padded to a fixed size, such as the 160x120 DCF
+    thumbnails. Before hashing, the thumbnail is cropped to the centered area
+    matching the aspect ratio of the primary image. Both images are stored
+    in the same orientation, so that no rotation is needed.
+
+    The primary image is not part of the metadata: it is given by the caller
+    as JPEG data. Only JPEG thumbnails can be compared. Decoding a large image
+    is costly, this is why this check is not part of Anomalies.
+*/
+
+const (
+    _hashSize = 32                  // downsampled image size
+    _hashBits = 8                   // lowest frequencies kept in each direction
+
+// SwappedThumbnailDistance is the perceptual hash distance above which the
+// thumbnail is considered as showing another picture than the primary image.
+    SwappedThumbnailDistance = 12
+)
+
+// getLuminance returns the luminance of the pixel at x, y in img
+func getLuminance( img image.Image, x, y int ) uint8 {
+    switch img := img.(type) {
+    case *image.YCbCr:
+        return img.Y[img.YOffset( x, y )]
+    case *image.Gray:
+        return img.Pix[img.PixOffset( x, y )]
+    }
+    return color.GrayModel.Convert( img.At( x, y ) ).(color.Gray).Y
+}
+
+// cellRange returns the range of pixels averaged in cell i of a grid of
+// _hashSize cells over n pixels, with at least one pixel per cell.
+func cellRange( i, n int ) (start, end int) {
+    start = i * n / _hashSize
+    end = (i + 1) * n / _hashSize
+    if end <= start {
+        end = start + 1
+    }
+    return
+}
+
+// downsample returns the average luminance of area r of img, in a grid of
+// _hashSize x _hashSize cells. If r is smaller than the grid, pixels are
+// repeated in several cells.
+func downsample( img image.Image, r image.Rectangle ) (g [_hashSize][_hashSize]float64) {
+    w, h := r.Dx(), r.Dy()
+    for i := range g {
+        y0, y1 := cellRange( i, h )
+        for j := range g[i] {
+            x0, x1 := cellRange( j, w )
+            var s float64
+            for y := y0; y < y1; y++ {
+                for x := x0; x < x1; x++ {
+                    s += float64(getLuminance( img, r.Min.X + x, r.Min.Y + y ))
+                }
+            }
+            g[i][j] = s / float64((y1 - y0) * (x1 - x0))
+        }
+    }
+    return
+}
+
+// dctCoefficients returns the _hashBits lowest frequency DCT coefficients of
+// a _hashSize vector.
+func dctCoefficients( v []float64 ) (c [_hashBits]float64) {
+    for k := range c {
+        var s float64
+        for n, x := range v {
+            s += x * math.Cos( math.Pi / _hashSize * (float64(n) + 0.5) * float64(k) )
+        }
+        c[k] = s
+    }
+    return
+}
+
+// hashArea returns the perceptual hash of area r of img
+func hashArea( img image.Image, r image.Rectangle ) uint64 {
+    if r.Empty() {
+        return 0
+    }
+    g := downsample( img, r )
+    var rows [_hashSize][_hashBits]float64       // DCT of each row
+    for i := range g {
+        rows[i] = dctCoefficients( g[i][:] )
+    }
+    var coefs [_hashBits * _hashBits]float64
+    col := make( []float64, _hashSize )
+    for k := 0; k < _hashBits; k++ {             // DCT of each column
+        for i := range rows {
+            col[i] = rows[i][k]
+        }
+        c := dctCoefficients( col )
+        for l := range c {
+            coefs[l * _hashBits + k] = c[l]
+        }
+    }
+
+    sorted := coefs
+    sort.Float64s( sorted[:] )
+    median := (sorted[len(sorted)/2 - 1] + sorted[len(sorted)/2]) / 2
+    var hash uint64
+    for i, c := range coefs {
+        if c > median {
+            hash |= 1 << uint(i)
+        }
+    }
+    return hash
+}
+
+// PerceptualHash returns the 64-bit perceptual hash of img. Images showing
+// the same picture, even at different sizes or compression levels, have
+// hashes at a small distance, as returned by HashDistance.
+func PerceptualHash( img image.Image ) uint64 {
+    return hashArea( img, img.Bounds() )
+}
+
+// HashDistance returns the number of different bits between 2 perceptual
+// hashes, from 0 to 64.
+func HashDistance( h1, h2 uint64 ) int {
+    return bits.OnesCount64( h1 ^ h2 )
+}
+
+// cropToAspect returns the centered area of r with the aspect ratio w/h
+func cropToAspect( r image.Rectangle, w, h int ) image.Rectangle {
+    rw, rh := r.Dx(), r.Dy()
+    if rw * h > rh * w {                         // r is wider
+        cw := rh * w / h
+        x := r.Min.X + (rw - cw) / 2
+        return image.Rect( x, r.Min.Y, x + cw, r.Max.Y )
+    }
+    ch := rw * h / w
+    y := r.Min.Y + (rh - ch) / 2
+    return image.Rect( r.Min.X, y, r.Max.X, y + ch )
+}
+
+// ThumbnailDistance returns the perceptual hash distance between the exif
+// thumbnail and the primary image, given as JPEG data in primary. A distance
+// above SwappedThumbnailDistance means that the thumbnail shows another
+// picture.
+//
+// It returns an error if there is no JPEG thumbnail or if the thumbnail or
+// the primary image cannot be decoded.
+func (d *Desc)ThumbnailDistance( primary io.Reader ) (dist int, err error) {
+    defer func ( ) {
+        if err != nil { err = fmt.Errorf( "ThumbnailDistance: %w", err ) }
+    }()
+
+    var tData []byte
+    tData, err = d.GetThumbnailData( THUMBNAIL )
+    if err != nil {
+        return
+    }
+    if ! isJpeg( tData, 0 ) {
+        return 0, fmt.Errorf( "thumbnail is not a JPEG image\n" )
+    }
+    var img, tbn image.Image
+    if img, err = jpeg.Decode( primary ); err != nil {
+        return 0, fmt.Errorf( "primary image: %w\n", err )
+    }
+    if tbn, err = jpeg.Decode( bytes.NewReader( tData ) ); err != nil {
+        return 0, fmt.Errorf( "thumbnail: %w\n", err )
+    }
+    ib := img.Bounds()
+    if ib.Empty() {
+        return 0, fmt.Errorf( "empty primary image\n" )
+    }
+    tArea := cropToAspect( tbn.Bounds(), ib.Dx(), ib.Dy() )
+    return HashDistance( PerceptualHash( img ), hashArea( tbn, tArea ) ), nil
+}
+
+// ThumbnailSwapped returns true if the exif thumbnail shows another picture
+// than the primary image, given as JPEG data in primary, i.e. if their
+// distance as returned by ThumbnailDistance is above SwappedThumbnailDistance.
+func (d *Desc)ThumbnailSwapped( primary io.Reader ) (bool, error) {
+    dist, err := d.ThumbnailDistance( primary )
+    if err != nil {
+        return false, err
+    }
+    return dist > SwappedThumbnailDistance, nil
+}
@@ -0,0 +1,105 @@
+package exif
+
+import (
+    "bytes"
+    "encoding/binary"
+    "image"
+    "image/color"
+    "image/jpeg"
+    "strings"
+    "testing"
+)
+
+// testScene returns an image of size w, h showing a bright disc on a dark
+// background, with a diagonal band
+func testScene( w, h int ) image.Image {
+    img := image.NewRGBA( image.Rect( 0, 0, w, h ) )
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            c := color.RGBA{ 30, 40, 60, 255 }
+            dx, dy := 3 * x - w, 3 * y - h       // disc at w/3, h/3
+            if dx * dx + dy * dy < w * w / 4 {
+                c = color.RGBA{ 240, 220, 180, 255 }
+            } else if d := x * h - y * w; d > 0 && d < w * h / 4 {
+                c = color.RGBA{ 120, 160, 90, 255 }
+            }
+            img.Set( x, y, c )
+        }
+    }
+    return img
+}
+
+// testScaled returns img scaled down by f, by sampling
+func testScaled( img image.Image, f int ) image.Image {
+    b := img.Bounds( )
+    s := image.NewRGBA( image.Rect( 0, 0, b.Dx( ) / f, b.Dy( ) / f ) )
+    for y := 0; y < b.Dy( ) / f; y++ {
+        for x := 0; x < b.Dx( ) / f; x++ {
+            s.Set( x, y, img.At( b.Min.X + x * f, b.Min.Y + y * f ) )
+        }
+    }
+    return s
+}
+
+func testEncodeJpeg( t *testing.T, img image.Image ) []byte {
+    t.Helper( )
+    var b bytes.Buffer
+    if err := jpeg.Encode( &b, img, nil ); err != nil {
+        t.Fatal( err )
+    }
+    return b.Bytes( )
+}
+
+// testStripes returns an image of size w, h made of horizontal stripes
+func testStripes( w, h int ) image.Image {
+    img := image.NewGray( image.Rect( 0, 0, w, h ) )
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            img.SetGray( x, y, color.Gray{ uint8(y * 8 / h % 2 * 200 + 20) } )
+        }
+    }
+    return img
+}
+
+func TestThumbnailSwapped( t *testing.T ) {
+    primary := testScene( 320, 240 )
+    data := testEncodeJpeg( t, primary )
+    for _, c := range []struct {
+        name        string
+        thumbnail   image.Image
+        swapped     bool
+    } {
+        { "same picture", testScaled( primary, 4 ), false },
+        { "unrelated picture", testStripes( 80, 60 ), true },
+    } {
+        d, err := Read( "testdata/tiff.tif", 0, &Control{ } )
+        if err != nil {
+            t.Fatalf( "Read: %v", err )
+        }
+        testReplaceThumbnail( t, d.ifds[THUMBNAIL], testEncodeJpeg( t, c.thumbnail ) )
+        dist, err := d.ThumbnailDistance( bytes.NewReader( data ) )
+        if err != nil {
+            t.Fatalf( "%s: ThumbnailDistance: %v", c.name, err )
+        }
+        if (dist > SwappedThumbnailDistance) != c.swapped {
+            t.Errorf( "%s: distance %d", c.name, dist )
+        }
+        swapped, err := d.ThumbnailSwapped( bytes.NewReader( data ) )
+        if err != nil || swapped != c.swapped {
+            t.Errorf( "%s: ThumbnailSwapped %v (%v)", c.name, swapped, err )
+        }
+    }
+}
+
+func TestThumbnailSwappedError( t *testing.T ) {
+    d := testParse( t, testTiff( binary.BigEndian, nil, nil ), &Control{ } )
+    data := testJpegImage( t, 8, 8 )
+    _, err := d.ThumbnailSwapped( bytes.NewReader( data ) )
+    if err == nil {
+        t.Fatalf( "no thumbnail accepted" )
+    }
+    if msg := err.Error( ); ! strings.HasPrefix( msg, "ThumbnailDistance: " ) ||
+       strings.Contains( msg, "ThumbnailSwapped" ) {
+        t.Errorf( "error %q", msg )
+    }
+}
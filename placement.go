@@ -0,0 +1,82 @@
+package exif
+
+// support for TIFF/EP tag placement
+
+import (
+    "fmt"
+)
+
+/*
+    TIFF/EP (ISO 12234-2) defines a number of tags that Exif also defines, with
+    the same tag values. TIFF/EP stores them in IFD0, whereas Exif stores them
+    in the Exif IFD. Some writers follow TIFF/EP, and some readers only look
+    for those tags in IFD0 or only in the Exif IFD.
+
+    While parsing, those tags are accepted in IFD0 as well as in the Exif IFD.
+    Once parsed, they are placed according to Control.Placement, which also
+    determines where they are serialized. SetPlacement can be used to change
+    the placement afterwards.
+*/
+
+// Placement selects where the tags shared by TIFF/EP and Exif are stored
+type Placement uint8
+const (
+    ExifPlacement Placement = iota  // in the Exif IFD, as required by Exif
+    KeepPlacement                   // where they were found while parsing
+    TiffEPPlacement                 // in IFD0, as required by TIFF/EP
+)
+
+// tags defined identically by TIFF/EP (in IFD0) and Exif (in the Exif IFD)
+var tiffEPTags = map[tTag]bool {
+    _ExposureTime: true, _FNumber: true, _ExposureProgram: true,
+    _ISOSpeedRatings: true, _DateTimeOriginal: true,
+    _ShutterSpeedValue: true, _ApertureValue: true, _BrightnessValue: true,
+    _ExposureBiasValue: true, _MaxApertureValue: true,
+    _SubjectDistance: true, _MeteringMode: true, _LightSource: true,
+    _Flash: true, _FocalLength: true,
+}
+
+// moveTiffEPTags moves all TIFF/EP tags from the ifd from to the ifd to. A tag
+// already present in the destination ifd is kept and the one in the source
+// ifd is dropped.
+func moveTiffEPTags( from, to *ifdd ) {
+    for i, v := range from.values {
+        if v == nil || ! tiffEPTags[v.getTag()] {
+            continue
+        }
+        from.values[i] = nil
+        if to.getValue( v.getTag() ) == nil {
+            v.setIfd( to )
+            to.setValue( v )
+        }
+    }
+}
+
+// placeTiffEPTags stores TIFF/EP tags according to the placement p
+func (d *Desc)placeTiffEPTags( p Placement ) {
+    primary, exif := d.ifds[PRIMARY], d.ifds[EXIF]
+    if primary == nil || exif == nil {
+        return                  // nowhere else to go
+    }
+    switch p {
+    case ExifPlacement:
+        moveTiffEPTags( primary, exif )
+    case TiffEPPlacement:
+        moveTiffEPTags( exif, primary )
+    }
+}
+
+// SetPlacement moves the tags defined both by TIFF/EP and Exif, such as
+// ExposureTime or FNumber, to the IFD given by the placement p: the Exif IFD
+// for ExifPlacement or IFD0 for TiffEPPlacement. If the tag is already in the
+// destination IFD, the one in the other IFD is removed. Tags are not moved if
+// the Exif IFD does not exist.
+//
+// It returns an error if the placement is not valid.
+func (d *Desc)SetPlacement( p Placement ) error {
+    if p > TiffEPPlacement {
+        return fmt.Errorf( "SetPlacement: invalid placement (%d)\n", p )
+    }
+    d.placeTiffEPTags( p )
+    return nil
+}
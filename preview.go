@@ -0,0 +1,223 @@
+package exif
+
+// support for preview images in maker notes
+
+import (
+    "encoding/binary"
+    "strings"
+)
+
+/*
+    Besides the Exif thumbnail in IFD1, most cameras store a larger JPEG
+    preview image in their maker note. The way it is stored depends on the
+    vendor:
+
+      - Nikon stores it in an IFD embedded in its maker note (Nikon Preview
+        tag), with the standard JPEGInterchangeFormat tags. It is parsed with
+        the rest of the Nikon maker note.
+
+      - Canon, Olympus, Pentax and Sony maker notes are not parsed, but their
+        preview image is located with a few vendor specific tags:
+
+        Canon       PreviewImageInfo (0x00b6) LONG array, giving the preview
+                    length (index 1) and start (index 4), relative to the
+                    TIFF header.
+        Olympus     PreviewImageStart/Length (0x0101/0x0102) in the
+                    CameraSettings sub-IFD (0x2020), relative to the maker
+                    note, or (0x0088/0x0089) in the main maker note IFD,
+                    relative to the TIFF header, for the older format.
+        Pentax      PreviewImageStart/Length (0x0004/0x0003), relative to the
+                    TIFF header.
+        Sony        PreviewImage (0x2001), UNDEFINED value holding the
+                    preview image.
+
+    A preview found in an unsupported maker note is given a vendor-scoped
+    embedded namespace, e.g. "SonyPreview", with a single JPEGInterchangeFormat
+    value holding the preview data. GetPreviews reports it along with the Exif
+    thumbnail and the Nikon preview, and its id can be given to
+    GetThumbnailData or WriteThumbnail. Since unsupported maker notes are not
+    kept when metadata is serialized, those previews are not serialized either.
+*/
+
+const _IFDOffset tType = 13     // TIFF IFD type, a LONG offset to an IFD
+
+// makerPreview locates the preview image in a maker note that is not parsed
+type makerPreview struct {
+    vendor  string      // vendor name, prefix of the namespace name
+                        // locate returns the preview start and length in the
+                        // ifd desc data, given the maker note offset
+    locate  func( ifd *ifdd, offset uint32 ) (start, length uint32, ok bool)
+}
+
+var makerPreviews = [...]makerPreview{
+    { "Canon", locateCanonPreview },
+    { "Olympus", locateOlympusPreview },
+    { "Pentax", locatePentaxPreview },
+    { "Sony", locateSonyPreview },
+}
+
+// makerPreviewInfo gives a preview found in an unsupported maker note
+type makerPreviewInfo struct {
+    id      IfdId       // preview namespace
+    offset  uint32      // preview offset in desc data
+}
+
+// findMakerEntry returns the type, count and value (or value offset) of tag in
+// the IFD at start in data, or false if the tag is not found or if the IFD is
+// out of bounds.
+func findMakerEntry( data []byte, e binary.ByteOrder, start uint32,
+                     tag tTag ) (typ tType, count, value uint32, ok bool) {
+    if uint64(start) + _ShortSize > uint64(len(data)) {
+        return
+    }
+    n := uint64(e.Uint16( data[start:] ))
+    if uint64(start) + _ShortSize + n * _IfdEntrySize > uint64(len(data)) {
+        return
+    }
+    for i := uint64(0); i < n; i++ {
+        p := uint64(start) + _ShortSize + i * _IfdEntrySize
+        if tTag(e.Uint16( data[p:] )) == tag {
+            return tType(e.Uint16( data[p+2:] )), e.Uint32( data[p+4:] ),
+                   e.Uint32( data[p+8:] ), true
+        }
+    }
+    return
+}
+
+// findMakerLong returns the single LONG value of tag in the IFD at start
+func findMakerLong( data []byte, e binary.ByteOrder,
+                    start uint32, tag tTag ) (uint32, bool) {
+    typ, count, value, ok := findMakerEntry( data, e, start, tag )
+    return value, ok && typ == _UnsignedLong && count == 1
+}
+
+// getMakerEndian returns the byte order given by "II" or "MM" at offset in
+// data, or def if there is none.
+func getMakerEndian( data []byte, offset uint32,
+                     def binary.ByteOrder ) binary.ByteOrder {
+    if e, err := getEndianess( data[offset:] ); err == nil {
+        return e
+    }
+    return def
+}
+
+func locateCanonPreview( ifd *ifdd, offset uint32 ) (uint32, uint32, bool) {
+    d := ifd.desc
+    if ! strings.HasPrefix( d.global.make, "Canon" ) {
+        return 0, 0, false
+    }
+    typ, count, value, ok := findMakerEntry( d.data, d.endian, offset, 0x00b6 )
+    if ! ok || typ != _UnsignedLong || count < 5 ||
+       uint64(value) + 20 > uint64(len(d.data)) {
+        return 0, 0, false
+    }
+    return d.endian.Uint32( d.data[value+16:] ),
+           d.endian.Uint32( d.data[value+4:] ), true
+}
+
+func locateOlympusPreview( ifd *ifdd, offset uint32 ) (uint32, uint32, bool) {
+    d := ifd.desc
+    switch {
+    case ifd.hasMakerNoteSignature( offset, "OLYMPUS\x00" ) && ifd.fCount >= 12:
+        e := getMakerEndian( d.data, offset + 8, d.endian )
+        typ, count, value, ok := findMakerEntry( d.data, e, offset + 12, 0x2020 )
+        if ! ok || count != 1 || (typ != _UnsignedLong && typ != _IFDOffset) {
+            break
+        }
+        start, ok1 := findMakerLong( d.data, e, offset + value, 0x0101 )
+        length, ok2 := findMakerLong( d.data, e, offset + value, 0x0102 )
+        return offset + start, length, ok1 && ok2
+    case ifd.hasMakerNoteSignature( offset, "OLYMP\x00" ):
+        start, ok1 := findMakerLong( d.data, d.endian, offset + 8, 0x0088 )
+        length, ok2 := findMakerLong( d.data, d.endian, offset + 8, 0x0089 )
+        return start, length, ok1 && ok2
+    }
+    return 0, 0, false
+}
+
+func locatePentaxPreview( ifd *ifdd, offset uint32 ) (uint32, uint32, bool) {
+    d := ifd.desc
+    if ! ifd.hasMakerNoteSignature( offset, "AOC\x00" ) || ifd.fCount < 6 {
+        return 0, 0, false
+    }
+    e := getMakerEndian( d.data, offset + 4, d.endian )
+    start, ok1 := findMakerLong( d.data, e, offset + 6, 0x0004 )
+    length, ok2 := findMakerLong( d.data, e, offset + 6, 0x0003 )
+    return start, length, ok1 && ok2
+}
+
+func locateSonyPreview( ifd *ifdd, offset uint32 ) (uint32, uint32, bool) {
+    d := ifd.desc
+    if ! ifd.hasMakerNoteSignature( offset, "SONY DSC \x00\x00\x00" ) {
+        return 0, 0, false
+    }
+    typ, count, value, ok := findMakerEntry( d.data, d.endian, offset + 12, 0x2001 )
+    return value, count, ok && typ == _Undefined && count > _valOffSize
+}
+
+// storeMakerPreview looks for a preview image in the unsupported maker note
+// at offset and stores it in its own namespace. It returns false if no preview
+// is found.
+func (ifd *ifdd) storeMakerPreview( offset uint32 ) bool {
+    d := ifd.desc
+    for _, mp := range makerPreviews {
+        start, length, ok := mp.locate( ifd, offset )
+        if ! ok || length == 0 ||
+           uint64(start) + uint64(length) > uint64(len(d.data)) ||
+           ! isJpeg( d.data, uint(start) ) {
+            continue
+        }
+        id := d.embeddedNamespace( mp.vendor + "Preview" )
+        p := &ifdd{ id: id, desc: d }
+        p.newEntry( _JPEGInterchangeFormat, _UnsignedLong )
+        tbn := p.newThumbnailValue( _JPEGInterchangeFormat,
+                                    d.data[start:start+length] )
+        tbn.src, tbn.vCount = tSource{ }, 1
+        p.values = []serializer{ tbn }
+        d.setIfd( id, p )
+        d.global.previews = append( d.global.previews,
+                                    makerPreviewInfo{ id, start } )
+        if d.Warn {
+            d.logf( LogWarning, "storeExifMakerNote: Warning: %s preview image found in unsupported maker note\n",
+                    mp.vendor )
+        }
+        return true
+    }
+    return false
+}
+
+// isMakerPreview returns true if id is the namespace of a preview found in an
+// unsupported maker note.
+func (d *Desc) isMakerPreview( id IfdId ) bool {
+    for _, p := range d.global.previews {
+        if p.id == id {
+            return true
+        }
+    }
+    return false
+}
+
+// getMakerPreviewInfo returns information about the previews found in
+// unsupported maker notes, as long as the Exif IFD is present.
+func (d *Desc) getMakerPreviewInfo( ) (ti []ThumbnailInfo) {
+    if d.ifds[EXIF] == nil {
+        return
+    }
+    for _, p := range d.global.previews {
+        ifd := d.getIfd( p.id )
+        if ifd == nil {
+            continue
+        }
+        data := ifd.getThumbnail( )
+        if data == nil {
+            continue
+        }
+        info := ThumbnailInfo{ Origin: p.id, Comp: JPEG,
+                               Size: uint32(len(data)),
+                               Offset: int64(d.base) + int64(p.offset),
+                               MIME: "image/jpeg" }
+        info.Width, info.Height, _ = getJpegDimensions( data )
+        ti = append( ti, info )
+    }
+    return
+}
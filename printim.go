@@ -0,0 +1,104 @@
+package exif
+
+// support for Epson Print Image Matching (PrintIM) information
+
+import (
+    "fmt"
+    "bytes"
+    "encoding/binary"
+    "io"
+)
+
+/*
+    PrintIM information is stored in IFD0 as a single _Undefined tag (0xc4a5):
+
+      "PrintIM\x00"             8-byte identifier
+      <version>                 4 ASCII digits (e.g. "0300")
+      <reserved>                2 bytes
+      <count>                   2-byte number of following entries
+      { <tag> <value> } * count 2-byte tag and 4-byte value
+
+    It normally follows the TIFF byte order, but some cameras use the opposite
+    byte order. As in exiftool, the byte order is switched if the number of
+    entries does not fit in the data.
+*/
+
+const (
+    _PrintIMHeaderSize = 16
+    _PrintIMEntrySize  = 6
+)
+
+// PrintIMEntry is a single PrintIM entry. Entry tags are not documented and
+// their values are given as is.
+type PrintIMEntry struct {
+    Tag     uint16
+    Value   uint32
+}
+
+// parsePrintIM returns the version and the entries found in the PrintIM data,
+// or an error if the data is not valid.
+func parsePrintIM( data []byte,
+                   endian binary.ByteOrder ) (string, []PrintIMEntry, error) {
+    if len(data) < _PrintIMHeaderSize ||
+       ! bytes.Equal( data[:8], []byte( "PrintIM\x00" ) ) {
+        return "", nil, fmt.Errorf( "parsePrintIM: invalid PrintIM header\n" )
+    }
+    version := string( data[8:12] )
+    count := uint( endian.Uint16( data[14:16] ) )
+    if _PrintIMHeaderSize + count * _PrintIMEntrySize > uint(len(data)) {
+        endian = swapEndian( endian )
+        count = uint( endian.Uint16( data[14:16] ) )
+        if _PrintIMHeaderSize + count * _PrintIMEntrySize > uint(len(data)) {
+            return "", nil, fmt.Errorf( "parsePrintIM: invalid count (%d)\n",
+                                        count )
+        }
+    }
+    entries := make( []PrintIMEntry, count )
+    offset := uint(_PrintIMHeaderSize)
+    for i := uint(0); i < count; i++ {
+        entries[i].Tag = endian.Uint16( data[offset:] )
+        entries[i].Value = endian.Uint32( data[offset+2:] )
+        offset += _PrintIMEntrySize
+    }
+    return version, entries, nil
+}
+
+func (ifd *ifdd) storePrintIM( ) error {
+    if ifd.fType != _Undefined {
+        return fmt.Errorf( "PrintIM: invalid type (%s)\n",
+                           getTiffTString( ifd.fType ) )
+    }
+    data := ifd.getUnsignedBytes( )
+    endian := ifd.desc.endian
+    if _, _, err := parsePrintIM( data, endian ); err != nil {
+        if ifd.desc.Warn {
+            ifd.desc.logf( LogWarning, "storePrintIM: Warning: %v", err )
+        }
+        return ifd.storeAnyUnknownSilently( )
+    }
+
+    fpim := func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        version, entries, _ := parsePrintIM( v.([]uint8), endian )
+        fmt.Fprintf( w, "Version %s, %d entries", version, len(entries) )
+        for _, e := range entries {
+            fmt.Fprintf( w, "\n%s%s%#04x: %#08x", indent, getIndentUnit( w ),
+                         e.Tag, e.Value )
+        }
+    }
+    ifd.storeValue( ifd.newUnsignedByteValue( "PrintIM", fpim, data ) )
+    return nil
+}
+
+// GetPrintIM returns the PrintIM version and entries found in the primary
+// IFD, or a non-nil error if no valid PrintIM information is present.
+func (d *Desc) GetPrintIM( ) (version string, entries []PrintIMEntry, err error) {
+    ifd := d.ifds[PRIMARY]
+    if ifd != nil {
+        for _, v := range ifd.values {
+            if ub, ok := v.(*unsignedByteValue); ok && ub.vTag == _PrintIM {
+                return parsePrintIM( ub.v, d.endian )
+            }
+        }
+    }
+    return "", nil, fmt.Errorf( "GetPrintIM: no PrintIM information\n" )
+}
@@ -0,0 +1,159 @@
+package exif
+
+// support for probing metadata without parsing it
+
+import (
+    "fmt"
+    "bytes"
+    "time"
+    "encoding/binary"
+)
+
+/*
+    Probe reads only the few entries needed for indexing, directly from the
+    IFD entry tables in IFD0, IFD1 and the Exif IFD, without decoding maker
+    notes nor building any value. Entries are checked for bounds but not for
+    consistency: the result is a hint, and Parse or Read must be used to get
+    validated metadata.
+*/
+
+// Summary gives the main information returned by Probe
+type Summary struct {
+    Make        string      // camera make, "" if unknown
+    Model       string      // camera model, "" if unknown
+    Width       uint32      // image width in pixels, 0 if unknown
+    Height      uint32      // image height in pixels, 0 if unknown
+    DateTimeOriginal time.Time  // original date, zero time if unknown
+    HasGPS      bool        // true if a GPS IFD is present
+    HasThumbnail bool       // true if a thumbnail is present (IFD1)
+}
+
+// prober reads IFD entries directly from TIFF data
+type prober struct {
+    data    []byte
+    endian  binary.ByteOrder
+}
+
+// entries calls f for each entry in the ifd at offset, with the entry tag,
+// type, count and the offset of its value or offset field. It returns the
+// next ifd offset.
+func (p *prober) entries( offset uint32,
+                          f func( tag tTag, typ tType, count, vo uint32 ) ) uint32 {
+    dLen := uint64(len(p.data))
+    if uint64(offset) + _ShortSize > dLen {
+        return 0
+    }
+    n := uint64(p.endian.Uint16( p.data[offset:] ))
+    start := uint64(offset) + _ShortSize
+    if start + n * _IfdEntrySize > dLen {
+        return 0
+    }
+    for i := uint64(0); i < n; i++ {
+        e := start + i * _IfdEntrySize
+        f( tTag(p.endian.Uint16( p.data[e:] )), tType(p.endian.Uint16( p.data[e+2:] )),
+           p.endian.Uint32( p.data[e+4:] ), uint32(e + 8) )
+    }
+    if next := start + n * _IfdEntrySize; next + _LongSize <= dLen {
+        return p.endian.Uint32( p.data[next:] )
+    }
+    return 0
+}
+
+// integer returns a short or long value, or 0 if the type is not integer
+func (p *prober) integer( typ tType, vo uint32 ) uint32 {
+    switch typ {
+    case _UnsignedShort:    return uint32(p.endian.Uint16( p.data[vo:] ))
+    case _UnsignedLong:     return p.endian.Uint32( p.data[vo:] )
+    }
+    return 0
+}
+
+// ascii returns an ASCII value, or "" if it is not valid
+func (p *prober) ascii( typ tType, count, vo uint32 ) string {
+    if typ != _ASCIIString || count == 0 {
+        return ""
+    }
+    if count > _valOffSize {
+        vo = p.endian.Uint32( p.data[vo:] )
+    }
+    if uint64(vo) + uint64(count) > uint64(len(p.data)) {
+        return ""
+    }
+    v := p.data[vo:vo+count]
+    if i := bytes.IndexByte( v, 0 ); i != -1 {
+        v = v[:i]
+    }
+    return string( bytes.TrimSpace( v ) )
+}
+
+// Probe quickly extracts a summary of the metadata in data, which can be a
+// JPEG file, TIFF data or exif metadata starting with the EXIF header. It is
+// much cheaper than Parse, since it does not decode the metadata, and it is
+// intended for indexing large numbers of files. The summary is not validated.
+//
+// It returns a non-nil error, wrapping ErrNoExif, if no metadata is found.
+func Probe( data []byte ) (s Summary, err error) {
+    jpeg := isJpeg( data, 0 )
+    tiff := data
+    switch {
+    case jpeg:
+        offset, size, jErr := findJpegExif( data, 0 )
+        if jErr != nil {
+            return s, fmt.Errorf( "Probe: %w", jErr )
+        }
+        tiff = data[offset+_originOffset:offset+size]
+    case bytes.HasPrefix( data, []byte( "Exif\x00\x00" ) ):
+        tiff = data[_originOffset:]
+    }
+    if len(tiff) < _headerSize {
+        return s, fmt.Errorf( "Probe: %w\n", ErrNoExif )
+    }
+    p := prober{ data: tiff }
+    if p.endian, err = getEndianess( tiff ); err != nil ||
+       p.endian.Uint16( tiff[2:] ) != 0x2a {
+        return s, fmt.Errorf( "Probe: %w\n", ErrNoExif )
+    }
+
+    var exif uint32
+    var date, offset string
+    next := p.entries( p.endian.Uint32( tiff[4:] ),
+        func( tag tTag, typ tType, count, vo uint32 ) {
+            switch tag {
+            case _Make:         s.Make = p.ascii( typ, count, vo )
+            case _Model:        s.Model = p.ascii( typ, count, vo )
+            case _ImageWidth:   s.Width = p.integer( typ, vo )
+            case _ImageLength:  s.Height = p.integer( typ, vo )
+            case _ExifIFD:      exif = p.integer( typ, vo )
+            case _GpsIFD:       s.HasGPS = true
+            }
+        } )
+    if next != 0 {
+        p.entries( next, func( tag tTag, typ tType, count, vo uint32 ) {
+            switch tag {
+            case _JPEGInterchangeFormat, _StripOffsets:
+                s.HasThumbnail = true
+            }
+        } )
+    }
+    if exif != 0 {
+        p.entries( exif, func( tag tTag, typ tType, count, vo uint32 ) {
+            switch tag {
+            case _DateTimeOriginal:     date = p.ascii( typ, count, vo )
+            case _OffsetTimeOriginal:   offset = p.ascii( typ, count, vo )
+            case _PixelXDimension:      s.Width = p.integer( typ, vo )
+            case _PixelYDimension:      s.Height = p.integer( typ, vo )
+            }
+        } )
+    }
+    if jpeg && ( s.Width == 0 || s.Height == 0 ) {
+        s.Width, s.Height, _ = getJpegDimensions( data )
+    }
+
+    loc := time.Local
+    if o, oErr := time.Parse( _exifOffsetFormat, offset ); oErr == nil {
+        _, secs := o.Zone( )
+        loc = time.FixedZone( offset, secs )
+    }
+    s.DateTimeOriginal, _ = time.ParseInLocation( _exifDateTimeFormat, date, loc )
+    return s, nil
+}
@@ -0,0 +1,117 @@
+package exif
+
+// support for serializing a subset of the metadata
+
+import (
+    "fmt"
+    "io"
+)
+
+/*
+    A profile is a keep-list of tags, per IFD namespace, applied when
+    serializing. Tags not in the list are not written, and IFDs left without
+    any entry are not written either, including their pointer in the parent
+    IFD. The descriptor is not modified, so that the same parsed metadata can
+    be exported with different profiles.
+*/
+
+// Profile selects the tags to keep when serializing with SerializeProfile
+type Profile uint8
+const (
+    FullProfile Profile = iota  // all current tags
+    WebSafeProfile              // orientation, color space and dimensions only
+    AttributionProfile          // same as WebSafeProfile, plus artist and copyright
+)
+
+var webSafeTags = map[IfdId][]tTag {
+    PRIMARY:    { _ImageWidth, _ImageLength, _Orientation },
+    EXIF:       { _ExifVersion, _ColorSpace, _PixelXDimension, _PixelYDimension },
+}
+
+var attributionTags = map[IfdId][]tTag {
+    PRIMARY:    { _ImageWidth, _ImageLength, _Orientation, _Artist, _Copyright },
+    EXIF:       { _ExifVersion, _ColorSpace, _PixelXDimension, _PixelYDimension },
+}
+
+// getProfileTags returns the keep-list for profile p, nil for FullProfile
+func getProfileTags( p Profile ) (map[IfdId][]tTag, error) {
+    switch p {
+    case FullProfile:
+        return nil, nil
+    case WebSafeProfile:
+        return webSafeTags, nil
+    case AttributionProfile:
+        return attributionTags, nil
+    }
+    return nil, fmt.Errorf( "invalid profile (%d)\n", p )
+}
+
+func containsTag( tags []tTag, tag tTag ) bool {
+    for _, t := range tags {
+        if t == tag {
+            return true
+        }
+    }
+    return false
+}
+
+// applyKeepList temporarily removes from all ifds the values that are not
+// in keep, as well as the ifds left empty. It returns the function restoring
+// the original ifds.
+func (d *Desc) applyKeepList( keep map[IfdId][]tTag ) (restore func( )) {
+    saved := make( [][]serializer, d.ifdCount() )
+    next := d.root.next
+
+    for id := d.ifdCount() - 1; ; id-- {    // embedded ifds first
+        if ifd := d.getIfd( id ); ifd != nil {
+            saved[id] = ifd.values
+            values := make( []serializer, 0, len(ifd.values) )
+            for _, v := range ifd.values {
+                if v == nil {
+                    continue
+                }
+                if iv, ok := v.(*ifdValue); ok {
+                    if len(iv.v.values) > 0 {   // already filtered
+                        values = append( values, v )
+                    }
+                } else if containsTag( keep[getEnumNamespace( id )], v.getTag() ) {
+                    values = append( values, v )
+                }
+            }
+            ifd.values = values
+        }
+        if id == PRIMARY {
+            break
+        }
+    }
+    if next != nil && len(next.values) == 0 {
+        d.root.next = nil
+    }
+
+    return func( ) {
+        for id := PRIMARY; id < IfdId(len(saved)); id++ {
+            if ifd := d.getIfd( id ); ifd != nil {
+                ifd.values = saved[id]
+            }
+        }
+        d.root.next = next
+    }
+}
+
+// SerializeProfile serializes the metadata as Serialize does, but keeping only
+// the tags selected by the profile p. The descriptor itself is not modified,
+// but it must not be accessed concurrently while it is serialized.
+//
+// It returns the number of bytes written in case of success or a non-nil error
+// in case of failure.
+func (d *Desc) SerializeProfile( w io.Writer, p Profile ) (int, error) {
+    keep, err := getProfileTags( p )
+    if err != nil {
+        return 0, fmt.Errorf( "SerializeProfile: %w", err )
+    }
+    if keep != nil && d.root != nil {
+        restore := d.applyKeepList( keep )
+        defer restore( )
+    }
+    return d.Serialize( w )
+}
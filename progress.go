@@ -0,0 +1,68 @@
+package exif
+
+// support for progress reporting
+
+import (
+    "io"
+)
+
+/*
+    Parsing or serializing very large TIFF or raw files, or many files in a
+    batch, can take some time. Applications can follow the progress by giving
+    an OnProgress function in Control, which is called:
+
+      - while parsing, after each IFD entry, including maker note entries, with
+        the number of entries parsed so far. The total number of entries is not
+        known in advance and is given as 0.
+      - while serializing, after each write, with the number of bytes written
+        so far and the total number of bytes expected.
+*/
+
+// ProgressStage is the operation reporting progress
+type ProgressStage int
+
+const (
+    ParseProgress       ProgressStage = iota    // done is a number of entries
+    SerializeProgress                           // done is a number of bytes
+)
+
+// reportParsed reports one more entry parsed, if progress is requested. When
+// parsing in parallel, the count is shared by all workers and reports are
+// serialized.
+func (d *Desc) reportParsed( ) {
+    if d.OnProgress == nil {
+        return
+    }
+    if pp := d.parallel; pp != nil {
+        pp.Lock()
+        pp.parsed ++
+        d.OnProgress( ParseProgress, pp.parsed, 0 )
+        pp.Unlock()
+        return
+    }
+    d.stats.parsed ++
+    d.OnProgress( ParseProgress, d.stats.parsed, 0 )
+}
+
+// progressWriter reports the bytes written to w
+type progressWriter struct {
+    w           io.Writer
+    n, total    uint
+    f           func( stage ProgressStage, done, total uint )
+}
+
+func (pw *progressWriter) Write( p []byte ) (int, error) {
+    n, err := pw.w.Write( p )
+    pw.n += uint(n)
+    pw.f( SerializeProgress, pw.n, pw.total )
+    return n, err
+}
+
+// getProgressWriter returns a writer reporting progress on w, or w itself
+// if progress is not requested or if w is used for computing the layout.
+func (d *Desc) getProgressWriter( w io.Writer, total uint ) io.Writer {
+    if _, ok := w.(*layoutWriter); ok || d.OnProgress == nil {
+        return w
+    }
+    return &progressWriter{ w: w, total: total, f: d.OnProgress }
+}
@@ -0,0 +1,65 @@
+package exif
+
+// support for known firmware and software bugs
+
+import (
+    "strings"
+)
+
+/*
+    Some camera firmware and some software are known to write specific fields
+    incorrectly. Instead of scattering special cases in the parser, the known
+    bugs are kept in quirkRegistry, keyed by the Make, Model and Software tags
+    in the primary IFD, and each bug is given a quirk flag. The store function
+    for an affected field asks whether its quirk applies to the current
+    metadata with hasQuirk, and if so applies its targeted workaround.
+
+    Make, Model and Software are stored before any embedded IFD is parsed,
+    since entries are in increasing tag order and their tags are smaller than
+    the Exif and GPS IFD pointer tags.
+
+    Known quirks:
+
+      quirkCFASwapped   CFAPattern repeat values written in the wrong byte
+                        order, by older Microsoft tools. The pattern is
+                        rewritten in the metadata byte order while parsing.
+                        Without a matching entry, a swapped pattern is still
+                        accepted as is, with a warning.
+*/
+
+type quirkFlags uint
+
+const (
+    quirkCFASwapped quirkFlags = 1 << iota  // CFAPattern in wrong byte order
+)
+
+// quirk gives the bugs of some firmware or software. Each key is a prefix of
+// the corresponding tag (without leading or trailing spaces), an empty key
+// matches anything.
+type quirk struct {
+    make, model, software   string
+    flags                   quirkFlags
+}
+
+var quirkRegistry = [...]quirk{
+    { software: "Microsoft", flags: quirkCFASwapped },
+}
+
+// matchQuirks returns the quirks known for the given make, model and software
+func matchQuirks( make, model, software string ) (flags quirkFlags) {
+    for _, q := range quirkRegistry {
+        if strings.HasPrefix( make, q.make ) &&
+           strings.HasPrefix( model, q.model ) &&
+           strings.HasPrefix( software, q.software ) {
+            flags |= q.flags
+        }
+    }
+    return
+}
+
+// hasQuirk returns true if the metadata comes from a camera or a software
+// known to have the quirk q.
+func (d *Desc) hasQuirk( q quirkFlags ) bool {
+    g := &d.global
+    return matchQuirks( g.make, g.model, g.software ) & q != 0
+}
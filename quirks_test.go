@@ -0,0 +1,76 @@
+package exif
+
+import (
+    "bytes"
+    "encoding/binary"
+    "testing"
+)
+
+func TestMatchQuirks( t *testing.T ) {
+    for _, c := range []struct {
+        make, model, software   string
+        want                    quirkFlags
+    } {
+        { "", "", "", 0 },
+        { "Canon", "EOS 5D", "Firmware 1.1.1", 0 },
+        { "", "", "Microsoft Windows Photo Viewer 6.1", quirkCFASwapped },
+        { "Nikon", "D70", "Microsoft", quirkCFASwapped },
+        { "Microsoft", "", "", 0 },             // keys are per tag
+        { "", "", "microsoft", 0 },             // case sensitive
+        { "", "", "Photo Microsoft", 0 },       // prefix only
+    } {
+        if got := matchQuirks( c.make, c.model, c.software ); got != c.want {
+            t.Errorf( "matchQuirks( %q, %q, %q ): %#x instead of %#x",
+                      c.make, c.model, c.software, got, c.want )
+        }
+    }
+}
+
+// testCFATiff returns TIFF data in big endian with the given software and a
+// 2x2 CFA pattern written in little endian, as done by older Microsoft tools
+func testCFATiff( software string ) []byte {
+    e := binary.BigEndian
+    ifd0 := []testEntry{
+        { _Make, uint16(_ASCIIString), 6, testString( "Canon" ) },
+        { _Software, uint16(_ASCIIString), uint32(len(software) + 1),
+                     testString( software ) },
+    }
+    exif := []testEntry{
+        { _CFAPattern, uint16(_Undefined), 8,
+                       []byte{ 2, 0, 2, 0, 0, 1, 1, 2 } },
+    }
+    return testTiff( e, ifd0, exif )
+}
+
+func TestCFASwappedQuirk( t *testing.T ) {
+    for _, c := range []struct {
+        software    string
+        want        []byte          // CFAPattern bytes after parsing
+    } {
+        { "Microsoft Windows Photo Viewer 6.1", []byte{ 0, 2, 0, 2, 0, 1, 1, 2 } },
+        { "Firmware 1.0", []byte{ 2, 0, 2, 0, 0, 1, 1, 2 } },   // kept as is
+    } {
+        d := testParse( t, testCFATiff( c.software ), &Control{ } )
+        ub, ok := d.ifds[EXIF].getValue( _CFAPattern ).(*unsignedByteValue)
+        if ! ok {
+            t.Fatalf( "%s: no CFAPattern", c.software )
+        }
+        if ! bytes.Equal( ub.v, c.want ) {
+            t.Errorf( "%s: CFAPattern % x instead of % x", c.software, ub.v, c.want )
+        }
+        p, err := d.GetCFAPattern( )
+        if err != nil || p.Rows != 2 || p.Cols != 2 ||
+           p.Colors[0][0] != 0 || p.Colors[1][1] != 2 {
+            t.Errorf( "%s: GetCFAPattern %+v (%v)", c.software, p, err )
+        }
+
+        // the rewritten pattern is serialized in the metadata byte order
+        data, err := d.Bytes( )
+        if err != nil {
+            t.Fatalf( "%s: Bytes: %v", c.software, err )
+        }
+        if ! bytes.Contains( data, c.want ) {
+            t.Errorf( "%s: serialized CFAPattern is not % x", c.software, c.want )
+        }
+    }
+}
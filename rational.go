@@ -0,0 +1,336 @@
+package exif
+
+// support for rational values
+
+import (
+    "fmt"
+    "math"
+    "math/bits"
+)
+
+/*
+    TIFF RATIONAL and SRATIONAL values are fractions made of two 32-bit
+    integers, mapped to Rational and SRational. Their former names,
+    UnsignedRational and SignedRational, are kept as aliases.
+
+    Arithmetic results are reduced. If a reduced result does not fit in 32-bit
+    terms, it is approximated by the last convergent of its continued fraction
+    that fits, or clamped to the largest value if it is too large.
+
+    A zero denominator is invalid but found in some files. Float returns +Inf,
+    -Inf or NaN for it, and any arithmetic involving it, as well as a division
+    by zero, returns the invalid value 0/0.
+
+    Some tags use 0/0 for an unknown value, e.g. the unknown F number of a
+    zoom lens in LensSpecification. When formatting, 0/0 is rendered as
+    "unknown (0/0)" and any other zero denominator as "invalid (n/0)", and
+    when a value is used in a computation, it is taken as 0 (checkedFloat). In
+    strict mode (Control Strict), rationals with a zero denominator and a
+    non-zero numerator are rejected while parsing.
+*/
+
+// Rational maps the TIFF RATIONAL type
+type Rational struct {
+    Numerator, Denominator  uint32
+}
+
+// SRational maps the TIFF SRATIONAL type
+type SRational struct {
+    Numerator, Denominator  int32
+}
+
+func gcd( a, b uint64 ) uint64 {
+    for b != 0 {
+        a, b = b, a % b
+    }
+    return a
+}
+
+// fitFraction returns n/d reduced, with both terms less than or equal to max,
+// approximated if needed. It returns 0/0 if d is 0.
+func fitFraction( n, d, max uint64 ) (uint64, uint64) {
+    if d == 0 {
+        return 0, 0
+    }
+    g := gcd( n, d )
+    n, d = n / g, d / g
+    if n <= max && d <= max {
+        return n, d
+    }
+    // convergents h/k of the continued fraction of n/d
+    h0, h1, k0, k1 := uint64(0), uint64(1), uint64(1), uint64(0)
+    for d != 0 {
+        a := n / d
+        if (h1 != 0 && a > (max - h0) / h1) ||
+           (k1 != 0 && a > (max - k0) / k1) {
+            break
+        }
+        h0, h1 = h1, a * h1 + h0
+        k0, k1 = k1, a * k1 + k0
+        n, d = d, n - a * d
+    }
+    if k1 == 0 {                // integer part is already too large
+        return max, 1
+    }
+    return h1, k1
+}
+
+// addFractions returns n1/d1 + n2/d2, not reduced, halving the result terms
+// if the numerator overflows.
+func addFractions( n1, d1, n2, d2 uint64 ) (uint64, uint64) {
+    g := gcd( d1, d2 )
+    hi1, lo1 := bits.Mul64( n1, d2 / g )
+    hi2, lo2 := bits.Mul64( n2, d1 / g )
+    d := d1 / g * d2
+    n, carry := bits.Add64( lo1, lo2, 0 )
+    for hi := hi1 + hi2 + carry; hi != 0; hi >>= 1 {
+        n = n >> 1 | hi << 63
+        d >>= 1
+    }
+    if d == 0 {
+        return math.MaxUint64, 1
+    }
+    return n, d
+}
+
+// IsValid returns true if the denominator is not 0
+func (r Rational) IsValid( ) bool {
+    return r.Denominator != 0
+}
+
+// Float returns the value of r
+func (r Rational) Float( ) float64 {
+    return float64(r.Numerator) / float64(r.Denominator)
+}
+
+// checkedFloat returns the value of r, or 0 if its denominator is 0
+func (r Rational) checkedFloat( ) float64 {
+    if r.Denominator == 0 {
+        return 0
+    }
+    return r.Float( )
+}
+
+// String returns r as numerator/denominator
+func (r Rational) String( ) string {
+    return fmt.Sprintf( "%d/%d", r.Numerator, r.Denominator )
+}
+
+// zeroDenominator returns the text for a fraction with a zero denominator
+func zeroDenominator( n int64 ) string {
+    if n == 0 {
+        return "unknown (0/0)"
+    }
+    return fmt.Sprintf( "invalid (%d/0)", n )
+}
+
+// format returns the value of r formatted with f, e.g. "%.1f", or the text
+// for a zero denominator.
+func (r Rational) format( f string ) string {
+    if r.Denominator == 0 {
+        return zeroDenominator( int64(r.Numerator) )
+    }
+    return fmt.Sprintf( f, float32(r.Numerator)/float32(r.Denominator) )
+}
+
+// formatFraction returns the value of r followed by the fraction itself, or
+// the text for a zero denominator.
+func (r Rational) formatFraction( ) string {
+    if r.Denominator == 0 {
+        return zeroDenominator( int64(r.Numerator) )
+    }
+    return fmt.Sprintf( "%f (%d/%d)", float32(r.Numerator)/float32(r.Denominator),
+                        r.Numerator, r.Denominator )
+}
+
+func newRational( n, d uint64 ) Rational {
+    n, d = fitFraction( n, d, math.MaxUint32 )
+    return Rational{ uint32(n), uint32(d) }
+}
+
+// Reduce returns r with its terms divided by their greatest common divisor
+func (r Rational) Reduce( ) Rational {
+    return newRational( uint64(r.Numerator), uint64(r.Denominator) )
+}
+
+// Add returns r + s
+func (r Rational) Add( s Rational ) Rational {
+    if ! r.IsValid( ) || ! s.IsValid( ) {
+        return Rational{ }
+    }
+    return newRational( addFractions( uint64(r.Numerator), uint64(r.Denominator),
+                                      uint64(s.Numerator), uint64(s.Denominator) ) )
+}
+
+// Mul returns r * s
+func (r Rational) Mul( s Rational ) Rational {
+    return newRational( uint64(r.Numerator) * uint64(s.Numerator),
+                        uint64(r.Denominator) * uint64(s.Denominator) )
+}
+
+// Div returns r / s
+func (r Rational) Div( s Rational ) Rational {
+    if ! r.IsValid( ) || ! s.IsValid( ) {
+        return Rational{ }
+    }
+    return newRational( uint64(r.Numerator) * uint64(s.Denominator),
+                        uint64(r.Denominator) * uint64(s.Numerator) )
+}
+
+// magnitudes returns the sign and the absolute values of the terms of r
+func (r SRational) magnitudes( ) (neg bool, n, d uint64) {
+    abs := func( v int32 ) uint64 {
+        if v < 0 {
+            return uint64(-int64(v))
+        }
+        return uint64(v)
+    }
+    return (r.Numerator < 0) != (r.Denominator < 0),
+           abs( r.Numerator ), abs( r.Denominator )
+}
+
+func newSRational( neg bool, n, d uint64 ) SRational {
+    n, d = fitFraction( n, d, math.MaxInt32 )
+    if neg {
+        return SRational{ -int32(n), int32(d) }
+    }
+    return SRational{ int32(n), int32(d) }
+}
+
+// IsValid returns true if the denominator is not 0
+func (r SRational) IsValid( ) bool {
+    return r.Denominator != 0
+}
+
+// Float returns the value of r
+func (r SRational) Float( ) float64 {
+    return float64(r.Numerator) / float64(r.Denominator)
+}
+
+// checkedFloat returns the value of r, or 0 if its denominator is 0
+func (r SRational) checkedFloat( ) float64 {
+    if r.Denominator == 0 {
+        return 0
+    }
+    return r.Float( )
+}
+
+// String returns r as numerator/denominator
+func (r SRational) String( ) string {
+    return fmt.Sprintf( "%d/%d", r.Numerator, r.Denominator )
+}
+
+// format returns the value of r formatted with f, e.g. "%.1f", or the text
+// for a zero denominator.
+func (r SRational) format( f string ) string {
+    if r.Denominator == 0 {
+        return zeroDenominator( int64(r.Numerator) )
+    }
+    return fmt.Sprintf( f, float32(r.Numerator)/float32(r.Denominator) )
+}
+
+// formatFraction returns the value of r followed by the fraction itself, or
+// the text for a zero denominator.
+func (r SRational) formatFraction( ) string {
+    if r.Denominator == 0 {
+        return zeroDenominator( int64(r.Numerator) )
+    }
+    return fmt.Sprintf( "%f (%d/%d)", float32(r.Numerator)/float32(r.Denominator),
+                        r.Numerator, r.Denominator )
+}
+
+// Reduce returns r with its terms divided by their greatest common divisor,
+// and a positive denominator
+func (r SRational) Reduce( ) SRational {
+    return newSRational( r.magnitudes( ) )
+}
+
+// Neg returns -r
+func (r SRational) Neg( ) SRational {
+    neg, n, d := r.magnitudes( )
+    return newSRational( ! neg, n, d )
+}
+
+// Add returns r + s
+func (r SRational) Add( s SRational ) SRational {
+    if ! r.IsValid( ) || ! s.IsValid( ) {
+        return SRational{ }
+    }
+    rneg, rn, rd := r.magnitudes( )
+    sneg, sn, sd := s.magnitudes( )
+    if rneg == sneg {
+        n, d := addFractions( rn, rd, sn, sd )
+        return newSRational( rneg, n, d )
+    }
+    // different signs: subtract the smaller magnitude from the larger one,
+    // all products fit in 64 bits.
+    a, b := rn * sd, sn * rd
+    if a >= b {
+        return newSRational( rneg, a - b, rd * sd )
+    }
+    return newSRational( sneg, b - a, rd * sd )
+}
+
+// Sub returns r - s
+func (r SRational) Sub( s SRational ) SRational {
+    return r.Add( s.Neg( ) )
+}
+
+// Mul returns r * s
+func (r SRational) Mul( s SRational ) SRational {
+    rneg, rn, rd := r.magnitudes( )
+    sneg, sn, sd := s.magnitudes( )
+    return newSRational( rneg != sneg, rn * sn, rd * sd )
+}
+
+// Div returns r / s
+func (r SRational) Div( s SRational ) SRational {
+    if ! r.IsValid( ) || ! s.IsValid( ) {
+        return SRational{ }
+    }
+    rneg, rn, rd := r.magnitudes( )
+    sneg, sn, sd := s.magnitudes( )
+    return newSRational( rneg != sneg, rn * sd, rd * sn )
+}
+
+// getRationalValue returns the value of tag in the namespace id
+func (d *Desc) getRationalValue( id IfdId, tag uint16 ) (serializer, error) {
+    ifd := d.getIfd( id )
+    if ifd == nil {
+        return nil, fmt.Errorf( "%s %w\n", d.IfdName(id), ErrIfdNotPresent )
+    }
+    v := ifd.getValue( tTag(tag) )
+    if v == nil {
+        return nil, fmt.Errorf( "tag %#04x is not present in %s\n",
+                                tag, d.IfdName(id) )
+    }
+    return v, nil
+}
+
+// GetRationals returns a copy of the RATIONAL values of tag in the namespace
+// id. It returns an error if the tag is absent or is not RATIONAL.
+func (d *Desc) GetRationals( id IfdId, tag uint16 ) ([]Rational, error) {
+    v, err := d.getRationalValue( id, tag )
+    if err != nil {
+        return nil, fmt.Errorf( "GetRationals: %w", err )
+    }
+    r, ok := v.(*unsignedRationalValue)
+    if ! ok {
+        return nil, fmt.Errorf( "GetRationals: tag %#04x is not RATIONAL\n", tag )
+    }
+    return append( []Rational(nil), r.v... ), nil
+}
+
+// GetSRationals returns a copy of the SRATIONAL values of tag in the namespace
+// id. It returns an error if the tag is absent or is not SRATIONAL.
+func (d *Desc) GetSRationals( id IfdId, tag uint16 ) ([]SRational, error) {
+    v, err := d.getRationalValue( id, tag )
+    if err != nil {
+        return nil, fmt.Errorf( "GetSRationals: %w", err )
+    }
+    r, ok := v.(*signedRationalValue)
+    if ! ok {
+        return nil, fmt.Errorf( "GetSRationals: tag %#04x is not SRATIONAL\n", tag )
+    }
+    return append( []SRational(nil), r.v... ), nil
+}
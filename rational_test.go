@@ -0,0 +1,54 @@
+package exif
+
+import (
+    "encoding/binary"
+    "strings"
+    "testing"
+)
+
+func TestCheckedFloat( t *testing.T ) {
+    for _, c := range []struct {
+        r       Rational
+        want    float64
+    } {
+        { Rational{ 1, 4 }, 0.25 },
+        { Rational{ 0, 0 }, 0 },
+        { Rational{ 5, 0 }, 0 },
+    } {
+        if f := c.r.checkedFloat( ); f != c.want {
+            t.Errorf( "%v.checkedFloat: %g instead of %g", c.r, f, c.want )
+        }
+    }
+    for _, c := range []struct {
+        r       SRational
+        want    float64
+    } {
+        { SRational{ -1, 4 }, -0.25 },
+        { SRational{ 0, 0 }, 0 },
+        { SRational{ -5, 0 }, 0 },
+    } {
+        if f := c.r.checkedFloat( ); f != c.want {
+            t.Errorf( "%v.checkedFloat: %g instead of %g", c.r, f, c.want )
+        }
+    }
+}
+
+func TestZeroDenominatorFormat( t *testing.T ) {
+    var b strings.Builder
+    fmtExposure( &b, Rational{ 0, 0 } )
+    if b.String( ) != "unknown (0/0)" {
+        t.Errorf( "fmtExposure: %q", b.String( ) )
+    }
+    if s := getRationalString( Rational{ 3, 0 } ); s != "invalid (3/0)" {
+        t.Errorf( "getRationalString: %q", s )
+    }
+
+    e := binary.LittleEndian
+    exif := []testEntry{
+        { _DigitalZoomRatio, uint16(_UnsignedRational), 1, testLongs( e, 5, 0 ) },
+    }
+    d := testParse( t, testTiff( e, nil, exif ), &Control{ } )
+    if f := testFormat( t, d, EXIF ); ! strings.Contains( f, "invalid (5/0)" ) {
+        t.Errorf( "Digital-Zoom Ratio:\n%s", f )
+    }
+}
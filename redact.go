@@ -0,0 +1,149 @@
+package exif
+
+// support for redacting tag values
+
+import (
+    "fmt"
+)
+
+/*
+    Redacting a tag overwrites its value instead of removing the tag, so that
+    the metadata structure is preserved: the absence of a tag that is expected,
+    such as GPS coordinates or a camera serial number, can itself reveal that
+    the metadata was edited.
+
+    A neutral value keeps the value type and count, with all numbers set to 0
+    (rationals to 0/1) and all bytes, including ASCII characters, set to 0.
+    Embedded IFDs, maker notes and thumbnails cannot be redacted: they must be
+    removed or redacted tag by tag instead.
+*/
+
+// redactValue overwrites the value v with a neutral value if replacement is
+// nil, or with the replacement. The current value is not modified in place,
+// since it may share its storage with the parsed data. Once overwritten, v is
+// considered as set by the application, so that it is checked when written.
+func (d *Desc) redactValue( v serializer, replacement interface{} ) (err error) {
+    defer func ( ) { if err == nil { v.setModified( ) } }()
+    if replacement != nil {
+        return d.replaceValue( v, replacement )
+    }
+    switch v := v.(type) {
+    case *unsignedByteValue:    v.v = make( []uint8, len(v.v) )
+    case *signedByteValue:      v.v = make( []int8, len(v.v) )
+    case *unsignedShortValue:   v.v = make( []uint16, len(v.v) )
+    case *signedShortValue:     v.v = make( []int16, len(v.v) )
+    case *unsignedLongValue:    v.v = make( []uint32, len(v.v) )
+    case *signedLongValue:      v.v = make( []int32, len(v.v) )
+    case *unsignedLong8Value:   v.v = make( []uint64, len(v.v) )
+    case *signedLong8Value:     v.v = make( []int64, len(v.v) )
+    case *floatValue:           v.v = make( []float32, len(v.v) )
+    case *doubleValue:          v.v = make( []float64, len(v.v) )
+    case *rawValue:             v.v = make( []byte, len(v.v) )
+    case *unsignedRationalValue:
+        r := make( []UnsignedRational, len(v.v) )
+        for i := range r {
+            r[i].Denominator = 1
+        }
+        v.v = r
+    case *signedRationalValue:
+        r := make( []SignedRational, len(v.v) )
+        for i := range r {
+            r[i].Denominator = 1
+        }
+        v.v = r
+    default:
+        return fmt.Errorf( "tag %#04x cannot be redacted\n", v.getTag() )
+    }
+    return nil
+}
+
+// replaceValue overwrites the value v with replacement, which must be a
+// string for ASCII values or a byte slice for other byte values. A byte slice
+// replacing an undecoded value must have the same size as the value.
+func (d *Desc) replaceValue( v serializer, replacement interface{} ) error {
+    switch r := replacement.(type) {
+    case string:
+        if ub, ok := v.(*unsignedByteValue); ok && ub.s {
+            if err := d.checkAsciiString( r ); err != nil {
+                return err
+            }
+            ub.v = append( []byte(r), 0 )
+            ub.vCount = uint32(len(ub.v))
+            return nil
+        }
+    case []byte:
+        switch bv := v.(type) {
+        case *unsignedByteValue:
+            if ! bv.s {
+                bv.v = append( []byte{}, r... )
+                bv.vCount = uint32(len(bv.v))
+                return nil
+            }
+        case *rawValue:
+            if len(r) == len(bv.v) {
+                bv.v = append( []byte{}, r... )
+                return nil
+            }
+        }
+    }
+    return fmt.Errorf( "invalid replacement %T for tag %#04x\n",
+                       replacement, v.getTag() )
+}
+
+// Redact overwrites the value of a tag in the specified ifd, instead of
+// removing it, so that the structure of the metadata is preserved. This is
+// useful for privacy, for example to hide the GPS coordinates or the camera
+// serial number without revealing that they were present.
+//
+// The argument id indicates the enclosing ifd and the argument tag specifies
+// the tag to redact. If replacement is nil, the value is overwritten with a
+// neutral value of the same type and count: all numbers and bytes are set to
+// 0 (rationals to 0/1). Otherwise, replacement must be a string for an ASCII
+// value or a byte slice for a byte value. ASCII strings follow the same rules
+// as in SetDescription.
+//
+// A redacted value is considered as set by the application: if it must be
+// within spec, such as Orientation, a neutral value cannot be serialized
+// unless Control Force is set.
+//
+// If the tag to redact is given as -1, all tags in the ifd are overwritten
+// with a neutral value, except embedded ifds, maker notes and thumbnails, and
+// replacement must be nil.
+//
+// It returns a non-nil error if the ifd is not present, if the tag is not
+// found, if the tag is an embedded ifd, a maker note or a thumbnail, or if
+// the replacement is not valid for the tag.
+func (d *Desc)Redact( id IfdId, tag int, replacement interface{} ) (err error) {
+    defer func ( ) { if err != nil { err = fmt.Errorf( "Redact: %w", err ) } }()
+
+    if id >= d.ifdCount() || tag < -1 || tag > 0xffff {
+        return fmt.Errorf( "invalid ifd %d or tag %d\n", id, tag )
+    }
+    ifd := d.getIfd( id )
+    if ifd == nil {
+        return fmt.Errorf( "%s %w\n", d.IfdName( id ), ErrIfdNotPresent )
+    }
+    if tag == -1 {
+        if replacement != nil {
+            return fmt.Errorf( "replacement given for all tags\n" )
+        }
+        for _, v := range ifd.values {
+            switch v.(type) {
+            case nil, *ifdValue, *descValue, *thumbnailValue:
+                continue
+            }
+            if err = d.redactValue( v, nil ); err != nil {
+                return
+            }
+        }
+        return
+    }
+    v := ifd.getValue( tTag(tag) )
+    if v == nil {
+        return fmt.Errorf( "tag %#04x not found in %s\n", tag, d.IfdName( id ) )
+    }
+    if err = d.redactValue( v, replacement ); err != nil {
+        err = &ValidationError{ id, uint16(tag), err }
+    }
+    return
+}
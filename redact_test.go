@@ -0,0 +1,94 @@
+package exif
+
+import (
+    "bytes"
+    "encoding/binary"
+    "testing"
+)
+
+// testEntryLayout is the tag, type and count of an entry
+type testEntryLayout struct {
+    tag     tTag
+    typ     tType
+    count   uint32
+}
+
+// testEntries returns the layout of each entry in the ifd
+func testEntries( ifd *ifdd ) (entries []testEntryLayout) {
+    for _, v := range ifd.values {
+        if v != nil {
+            src := v.getSource( )
+            entries = append( entries,
+                              testEntryLayout{ v.getTag( ), src.vType, src.vCount } )
+        }
+    }
+    return
+}
+
+func TestRedactRoundTrip( t *testing.T ) {
+    e := binary.BigEndian
+    gps := testGPSPosition( e )
+    d := testParse( t, testGPSTiff( e, gps ), &Control{ } )
+    if err := d.Redact( GPS, -1, nil ); err != nil {
+        t.Fatalf( "Redact GPS: %v", err )
+    }
+    if err := d.Redact( PRIMARY, _Make, "Maker" ); err != nil {
+        t.Fatalf( "Redact Make: %v", err )
+    }
+    data, err := d.Bytes( )
+    if err != nil {
+        t.Fatalf( "Bytes: %v", err )
+    }
+    for _, en := range append( gps, testEntry{ data: testString( "Nikon" ) } ) {
+        if len(en.data) > 2 && bytes.Contains( data, en.data ) {
+            t.Errorf( "original value %q still present", en.data )
+        }
+    }
+
+    r, err := Parse( data, 0, uint(len(data)), &Control{ } )
+    if err != nil {
+        t.Fatalf( "Parse redacted: %v", err )
+    }
+    o := testParse( t, testGPSTiff( e, gps ), &Control{ } )
+    for _, id := range []IfdId{ PRIMARY, GPS } {
+        want, got := testEntries( o.ifds[id] ), testEntries( r.ifds[id] )
+        if len(got) != len(want) {
+            t.Errorf( "%s: %d entries instead of %d", d.IfdName( id ),
+                      len(got), len(want) )
+            continue
+        }
+        for i := range want {
+            if got[i] != want[i] {
+                t.Errorf( "%s: entry %d %+v instead of %+v", d.IfdName( id ),
+                          i, got[i], want[i] )
+            }
+        }
+    }
+    if m, _ := r.ifds[PRIMARY].getAsciiString( _Make ); m != "Maker" {
+        t.Errorf( "Make %q", m )
+    }
+    lat := r.ifds[GPS].getValue( _GPSLatitude ).(*unsignedRationalValue)
+    for _, v := range lat.v {
+        if v != (UnsignedRational{ 0, 1 }) {
+            t.Errorf( "latitude not neutral: %v", lat.v )
+            break
+        }
+    }
+}
+
+func TestRedactInvalid( t *testing.T ) {
+    e := binary.LittleEndian
+    d := testParse( t, testGPSTiff( e, testGPSPosition( e ) ), &Control{ } )
+    if err := d.Redact( PRIMARY, _GpsIFD, nil ); err == nil {
+        t.Errorf( "GPS IFD pointer redacted" )
+    }
+    if err := d.Redact( GPS, _GPSLatitude, "N" ); err == nil {
+        t.Errorf( "string replacement accepted for a rational" )
+    }
+    if err := d.Redact( GPS, -1, "N" ); err == nil {
+        t.Errorf( "replacement accepted for all tags" )
+    }
+    if err := d.Redact( EXIF, _Make, nil ); err == nil {
+        t.Errorf( "missing ifd accepted" )
+    }
+}
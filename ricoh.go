@@ -0,0 +1,119 @@
+package exif
+
+// support for Ricoh Maker notes
+
+import (
+    "bytes"
+    "io"
+)
+
+/*
+    Ricoh maker notes start with an 8-byte header, "Ricoh" or "RICOH" padded
+    with 3 null bytes, followed by a regular IFD using the TIFF byte order and
+    offsets relative to the TIFF header:
+
+      "Ricoh\x00\x00\x00"       8-byte header
+      IFD                       2-byte count, entries and next IFD offset
+
+    More recent Ricoh cameras, derived from Pentax models, use a different
+    header ("RICOH\x00II" or "RICOH\x00MM") followed by a Pentax maker note,
+    which is not supported. Old models store a text maker note ("Ricoh Rev"),
+    which is ignored as well.
+*/
+
+const (
+    _RICOH_MAKER_SIGNATURE      = "Ricoh"       // case insensitive
+    _RICOH_MAKER_HEADER_SIZE    = 8
+)
+
+const (
+    _RicohMakerNoteType         = 0x0001  // ASCII string
+    _RicohFirmwareVersion       = 0x0002  // ASCII string
+    _RicohRecordingFormat       = 0x1000  // 1 _UnsignedShort
+    _RicohDriveMode             = 0x1002  // 1 _UnsignedShort
+    _RicohSharpness             = 0x1003  // 1 _UnsignedShort
+)
+
+func fmtRicohRecordingFormat( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+    var rf string
+    switch v.([]uint16)[0] {
+    case 2:     rf = "JPEG"
+    case 3:     rf = "TIFF"
+    default:    rf = "Unknown"
+    }
+    io.WriteString( w, rf )
+}
+
+func fmtRicohDriveMode( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+    var dm string
+    switch v.([]uint16)[0] {
+    case 0:     dm = "Single-frame"
+    case 1:     dm = "Continuous"
+    case 8:     dm = "AE Auto Bracketing"
+    default:    dm = "Unknown"
+    }
+    io.WriteString( w, dm )
+}
+
+func fmtRicohSharpness( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+    var s string
+    switch v.([]uint16)[0] {
+    case 0:     s = "Sharp"
+    case 1:     s = "Normal"
+    case 2:     s = "Soft"
+    default:    s = "Unknown"
+    }
+    io.WriteString( w, s )
+}
+
+func storeRicohTags( ifd *ifdd ) error {
+//    fmt.Printf( "storeRicohTags: tag (%#04x) @offset %#04x type %s count %d\n",
+//                 ifd.fTag, ifd.sOffset-8, getTiffTString( ifd.fType ), ifd.fCount )
+    switch ifd.fTag {
+    case _RicohMakerNoteType:
+        return ifd.storeAsciiString( "Ricoh Maker Note Type" )
+    case _RicohFirmwareVersion:
+        return ifd.storeAsciiString( "Ricoh Firmware Version" )
+    case _RicohRecordingFormat:
+        return ifd.storeUnsignedShorts( "Ricoh Recording Format", 1,
+                                        fmtRicohRecordingFormat )
+    case _RicohDriveMode:
+        return ifd.storeUnsignedShorts( "Ricoh Drive Mode", 1, fmtRicohDriveMode )
+    case _RicohSharpness:
+        return ifd.storeUnsignedShorts( "Ricoh Sharpness", 1, fmtRicohSharpness )
+    default:
+        return ifd.processUnknownTag( )
+    }
+}
+
+func (ifd *ifdd) processRicohMakerNote( offset uint32 ) error {
+    header := string(ifd.desc.data[offset:offset+_RICOH_MAKER_HEADER_SIZE])
+    _, ricoh, err := ifd.desc.storeIFD( MAKER,
+                                        offset + _RICOH_MAKER_HEADER_SIZE,
+                                        storeRicohTags )
+    if err == nil {
+        iv := ifd.newIfdValue( ricoh )
+        iv.header = header
+        ifd.storeValue( iv )
+    }
+    return err
+}
+
+func tryRicohMakerNote( ifd *ifdd, offset uint32 ) ( func( uint32 ) error ) {
+    if ifd.fCount < _RICOH_MAKER_HEADER_SIZE {
+        return nil
+    }
+    header := ifd.desc.data[offset:offset+_RICOH_MAKER_HEADER_SIZE]
+    if ! bytes.EqualFold( header[:len(_RICOH_MAKER_SIGNATURE)],
+                          []byte( _RICOH_MAKER_SIGNATURE ) ) {
+        return nil
+    }
+    if bytes.Equal( header[len(_RICOH_MAKER_SIGNATURE):], []byte{ 0, 0, 0 } ) {
+//        fmt.Printf("    MakerNote: Ricoh\n" )
+        return ifd.processRicohMakerNote
+    }
+    if header[len(_RICOH_MAKER_SIGNATURE)] == 0 {
+        ifd.makerWarning( "Ricoh", "Pentax type is not supported" )
+    }
+    return nil
+}
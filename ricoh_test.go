@@ -0,0 +1,94 @@
+package exif
+
+import (
+    "bytes"
+    "encoding/binary"
+    "strings"
+    "testing"
+)
+
+// testRicohMakerNoteTiff returns TIFF data with a Ricoh maker note made of
+// header and entries, with offsets relative to the TIFF header.
+func testRicohMakerNoteTiff( e binary.ByteOrder, header string,
+                             entries []testEntry ) []byte {
+    note := append( []byte( header ), testIfd( e, 0, entries, 0 )... )
+    at := bytes.Index( testMakerNoteTiff( e, "RICOH", note ), note )
+    note = append( []byte( header ),
+                   testIfd( e, uint32(at + len(header)), entries, 0 )... )
+    return testMakerNoteTiff( e, "RICOH", note )
+}
+
+func testRicohEntries( e binary.ByteOrder ) []testEntry {
+    return []testEntry{
+        { _RicohMakerNoteType, uint16(_ASCIIString), 4, testString( "Rdc" ) },
+        { _RicohFirmwareVersion, uint16(_ASCIIString), 8, testString( "Rev0113" ) },
+        { _RicohRecordingFormat, uint16(_UnsignedShort), 1, testShorts( e, 2 ) },
+        { _RicohDriveMode, uint16(_UnsignedShort), 1, testShorts( e, 1 ) },
+        { _RicohSharpness, uint16(_UnsignedShort), 1, testShorts( e, 2 ) },
+    }
+}
+
+func TestRicohMakerNote( t *testing.T ) {
+    want := []string{ "Ricoh Maker Note Type:\n    Rdc",
+                      "Ricoh Firmware Version:\n    Rev0113",
+                      "Ricoh Recording Format:\n    JPEG",
+                      "Ricoh Drive Mode:\n    Continuous",
+                      "Ricoh Sharpness:\n    Soft" }
+    for _, e := range []binary.ByteOrder{ binary.BigEndian, binary.LittleEndian } {
+        for _, header := range []string{ "Ricoh\x00\x00\x00", "RICOH\x00\x00\x00" } {
+            tiff := testRicohMakerNoteTiff( e, header, testRicohEntries( e ) )
+            d := testParse( t, tiff, &Control{ } )
+            if d.stats.MakerNote != "Ricoh" {
+                t.Fatalf( "%v %q: maker note %q", e, header, d.stats.MakerNote )
+            }
+            for _, v := range d.ifds[MAKER].values {
+                if v != nil && v.getName( ) == "" {
+                    t.Errorf( "%v %q: tag %#04x has no name", e, header, v.getTag( ) )
+                }
+            }
+            f := testFormat( t, d, MAKER )
+            for _, w := range want {
+                if ! strings.Contains( f, w ) {
+                    t.Errorf( "%v %q: %q not found in:\n%s", e, header, w, f )
+                }
+            }
+
+            // the header is kept and offsets are relocated when serialized
+            data, err := d.Bytes( )
+            if err != nil {
+                t.Fatalf( "%v %q: Bytes: %v", e, header, err )
+            }
+            if ! bytes.Contains( data, []byte( header ) ) {
+                t.Errorf( "%v %q: header not serialized", e, header )
+            }
+            r, err := Parse( data, 0, uint(len(data)), &Control{ } )
+            if err != nil {
+                t.Fatalf( "%v %q: Parse serialized: %v", e, header, err )
+            }
+            if g := testFormat( t, r, MAKER ); g != f {
+                t.Errorf( "%v %q: serialized maker note:\n%s\ninstead of:\n%s",
+                          e, header, g, f )
+            }
+        }
+    }
+}
+
+func TestRicohUnsupported( t *testing.T ) {
+    e := binary.BigEndian
+    for _, c := range []struct {
+        header  string
+        warn    bool
+    } {
+        { "RICOH\x00II", true },        // Pentax type
+        { "Ricoh Rev", false },         // text maker note
+    } {
+        tiff := testRicohMakerNoteTiff( e, c.header, testRicohEntries( e ) )
+        d := testParse( t, tiff, &Control{ } )
+        if d.stats.MakerNote != "" || d.ifds[MAKER] != nil {
+            t.Errorf( "%q: decoded as %q", c.header, d.stats.MakerNote )
+        }
+        if warned := len(d.stats.Warnings) > 0; warned != c.warn {
+            t.Errorf( "%q: warnings %v", c.header, d.stats.Warnings )
+        }
+    }
+}
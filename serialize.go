@@ -2,13 +2,82 @@ package exif
 
 import (
     "fmt"
+    "bytes"
     "encoding/binary"
     "io"
+    "math"
 )
 
+/*
+    Serializing is done in two passes:
+    - a layout pass, which calculates the size of each IFD, including all
+      embedded IFDs and maker notes, without writing anything. The size is
+      kept in each ifd dSize.
+    - a single write pass, which streams IFD entries and data areas, using
+      those sizes to calculate the offsets of embedded IFDs.
+    The layout pass is done again at each serialization, since the metadata
+    may have been modified in between.
+*/
+
+// layout calculates and returns the whole ifd size, including its entries,
+// next ifd offset and data area, with all embedded ifds. By side effect, the
+// size is kept in ifd.dSize for the following write pass.
+func (ifd *ifdd)layout( ) uint32 {
+    var nEntries, size uint32
+    for _, val := range ifd.values {
+        if val != nil {
+            nEntries ++
+            size += val.getDataSize( )
+        }
+    }
+    ifd.dSize = _ShortSize + (nEntries * _IfdEntrySize) + _LongSize + size
+    if ifd.desc.SrlzDbg {
+        ifd.desc.logf( LogDebug, "%s ifd layout: %d entries, size %d\n",
+                       ifd.desc.IfdName(ifd.id), nEntries, ifd.dSize )
+    }
+    return ifd.dSize
+}
+
+// SerializedSize returns the number of bytes that Serialize would write, from
+// the current metadata, without serializing it.
+func (d *Desc)SerializedSize( ) int {
+    if d.root == nil {
+        return 0
+    }
+    size := _originOffset + _headerSize + d.root.layout( )
+    if d.root.next != nil {
+        size += d.root.next.layout( )
+    }
+    return int(size)
+}
+
+// Bytes returns the serialized EXIF metadata in a newly allocated slice, as
+// written by Serialize, i.e. starting with the EXIF header "Exif\x00\x00".
+// Containers that expect only the TIFF data (e.g. PNG eXIf chunk) can use the
+// slice following the EXIF header.
+//
+// It returns the slice in case of success or a non-nil error in case of
+// failure.
+func (d *Desc)Bytes( ) ([]byte, error) {
+    size := d.SerializedSize( )
+    b := bytes.NewBuffer( make( []byte, 0, size ) )
+    n, err := d.Serialize( b )
+    if err != nil {
+        return nil, fmt.Errorf( "Bytes: %w", err )
+    }
+    if n != size {
+        return nil, fmt.Errorf( "Bytes: serialized size %d instead of %d\n",
+                                n, size )
+    }
+    return b.Bytes(), nil
+}
+
 // Serialize the parsed EXIF metadata, including all current IFDs.
 // The argument w is the io.Writer to use.
 //
+// Values set by the application must be within spec, unless Control Force is
+// set: an out-of-spec value, e.g. an Orientation of 9, is a ValidationError.
+//
 // It returns the number of bytes written in case of success or a non-nil error
 // in case of failure.
 func (d *Desc)Serialize( w io.Writer ) (written int, err error) {
@@ -17,55 +86,111 @@ func (d *Desc)Serialize( w io.Writer ) (written int, err error) {
         return 0, nil // ifd0 was removed - empty metadata
 // fmt.Errorf( "Serialize: empty descriptor\n" )
     }
+    if err = d.checkWrite( ); err != nil {
+        return 0, fmt.Errorf( "Serialize: %w", err )
+    }
+    total := uint(_headerSize + 6) + uint(d.root.layout( ))
+    if d.root.next != nil {
+        total += uint(d.root.next.layout( ))
+    }
+    w = d.getProgressWriter( w, total )
 
     if written, err = w.Write( []byte( "Exif\x00\x00" ) ); err != nil {
         return
     }
+    return d.serializeTiff( w, written )
+}
 
-    var es string                // TIFF header starts here
-    if d.endian == binary.BigEndian { es = "MM" } else { es = "II" }
-    _, err = w.Write( []byte( es ) )
-    if err != nil {
-        return
+// SerializeTiff serializes the metadata as a standalone TIFF stream, i.e. as
+// written by Serialize but without the EXIF header "Exif\x00\x00", as
+// expected by TIFF based containers.
+//
+// Unlike a JPEG APP1 segment, a TIFF stream is not limited to 64KB: values
+// of any size, such as large maker notes or preview images, are written in
+// the data area of their IFD and referred to by 32-bit offsets. This can be
+// used when UpdateJpeg or SerializeSidecar fail with ErrSegmentTooLarge.
+// Out-of-spec values are refused as for Serialize.
+//
+// It returns the number of bytes written in case of success or a non-nil error
+// in case of failure.
+func (d *Desc)SerializeTiff( w io.Writer ) (written int, err error) {
+    if d.root == nil {
+        return 0, nil
     }
-    written += 2
-
-    err = binary.Write( w, d.endian, uint16(0x002a) )
-    if err != nil {
-        return
+    total := uint(_headerSize) + uint(d.root.layout( ))
+    if d.root.next != nil {
+        total += uint(d.root.next.layout( ))
     }
-    written += 2
+    if total > math.MaxUint32 {
+        return 0, fmt.Errorf( "SerializeTiff: metadata size %d exceeds TIFF capacity\n",
+                              total )
+    }
+    if err = d.checkWrite( ); err != nil {
+        return 0, fmt.Errorf( "SerializeTiff: %w", err )
+    }
+    return d.serializeTiff( d.getProgressWriter( w, total ), 0 )
+}
 
-    err = binary.Write( w, d.endian, uint32(0x00000008) )
+// serializeTiff writes the TIFF header and all IFDs, once all IFDs have been
+// laid out. The argument written is the number of bytes already written in w
+// (EXIF header). It returns the total number of bytes written.
+func (d *Desc)serializeTiff( w io.Writer, written int ) (int, error) {
+    written, err := d.serializeTiffHeader( w, written )
     if err != nil {
-        return
+        return written, err
     }
-    written += 4
     var ns uint32
     ns, err = d.root.serializeEntries( w, _headerSize )
     if err != nil {
-        return
+        return written, err
     }
     written += int(ns)
     ns, err = d.root.serializeDataArea( w, _headerSize )
     if err != nil {
-        return
+        return written, err
     }
     written += int(ns)
     if d.root.next != nil {    // thumbnail IFD
         offset := d.root.dOffset
         ns, err = d.root.next.serializeEntries( w, offset )
         if err != nil {
-            return
+            return written, err
         }
         written += int(ns)
         ns, err = d.root.next.serializeDataArea( w, offset )
         if err != nil {
-            return
+            return written, err
         }
         written += int(ns)
     }
-    return
+    return written, nil
+}
+
+// serializeTiffHeader writes the TIFF header, with the first IFD immediately
+// following it. The argument written is the number of bytes already written
+// in w. It returns the total number of bytes written.
+func (d *Desc)serializeTiffHeader( w io.Writer, written int ) (int, error) {
+    var es string                // TIFF header starts here
+    if d.endian == binary.BigEndian { es = "MM" } else { es = "II" }
+    _, err := w.Write( []byte( es ) )
+    if err != nil {
+        return written, err
+    }
+    written += 2
+
+    err = binary.Write( w, d.endian, uint16(0x002a) )
+    if err != nil {
+        return written, err
+    }
+    written += 2
+
+    err = binary.Write( w, d.endian, uint32(0x00000008) )
+    if err != nil {
+        return written, err
+    }
+    written += 4
+    addSegment( w, HeaderSegment, PRIMARY, 0, 0, int64(written) )
+    return written, nil
 }
 
 func (ifd *ifdd)setDataAreaStart( origin uint32 ) (nEntries uint32 ){
@@ -92,10 +217,12 @@ func (ifd *ifdd)serializeEntries( w io.Writer, offset uint32 ) (uint32, error) {
     nEntries := ifd.setDataAreaStart( offset )
     endian := ifd.desc.endian
     written := uint32(0)
+    addSegment( w, EntriesSegment, ifd.id, 0, getWriteOffset( w ),
+                int64(_ShortSize + nEntries * _IfdEntrySize + _LongSize) )
 
     if ifd.desc.SrlzDbg {
-        fmt.Printf( "%s ifd serialize: %d entries starting @%#08x data Offset %#08x\n",
-                    GetIfdName(ifd.id), len(ifd.values), offset, ifd.dOffset )
+        ifd.desc.logf( LogDebug, "%s ifd serialize: %d entries starting @%#08x data Offset %#08x\n",
+                       ifd.desc.IfdName(ifd.id), len(ifd.values), offset, ifd.dOffset )
     }
     // write number of entries first as an _UnsignedShort
     err := binary.Write( w, endian, uint16(nEntries) )
@@ -108,20 +235,20 @@ func (ifd *ifdd)serializeEntries( w io.Writer, offset uint32 ) (uint32, error) {
     for i := 0; i < len(ifd.values); i++ {
         if ifd.values[i] == nil {   // removed entries must be ignored
             if ifd.desc.SrlzDbg {
-                fmt.Printf( "%s ifd serializeEntry %d skipping empty entry\n",
-                            GetIfdName(ifd.id), i )
+                ifd.desc.logf( LogDebug, "%s ifd serializeEntry %d skipping empty entry\n",
+                               ifd.desc.IfdName(ifd.id), i )
             }
             continue
         }
         err = ifd.values[i].serializeEntry( w )
         if err != nil {
-            err = fmt.Errorf( "%s ifd serializeEntry %d: %v\n",
-                              GetIfdName(ifd.id), i, err )
+            err = fmt.Errorf( "%s ifd serializeEntry %d: %w\n",
+                              ifd.desc.IfdName(ifd.id), i, err )
             return written, err
         }
         if ifd.desc.SrlzDbg {
-            fmt.Printf( "%s ifd serialized entry %d dOffset %#08x\n",
-                        GetIfdName(ifd.id), i, ifd.dOffset )
+            ifd.desc.logf( LogDebug, "%s ifd serialized entry %d dOffset %#08x\n",
+                           ifd.desc.IfdName(ifd.id), i, ifd.dOffset )
         }
         written += _IfdEntrySize
     }
@@ -131,8 +258,8 @@ func (ifd *ifdd)serializeEntries( w io.Writer, offset uint32 ) (uint32, error) {
         nIfdOffset = 0
     }
     if ifd.desc.SrlzDbg {
-        fmt.Printf( "%s ifd serialize: next ifd at offset %#08x\n",
-                    GetIfdName(ifd.id), nIfdOffset )
+        ifd.desc.logf( LogDebug, "%s ifd serialize: next ifd at offset %#08x\n",
+                       ifd.desc.IfdName(ifd.id), nIfdOffset )
     }
     err = binary.Write( w, endian, nIfdOffset )
     if err != nil {
@@ -151,27 +278,32 @@ func (ifd *ifdd)serializeDataArea( w io.Writer, origin uint32 ) (uint32, error)
     for i := 0; i < len(ifd.values); i++ {
         if ifd.values[i] == nil {   // removed entries must be ignored
             if ifd.desc.SrlzDbg {
-                fmt.Printf( "%s ifd serializeDataArea %d skipping empty entry\n",
-                            GetIfdName(ifd.id), i )
+                ifd.desc.logf( LogDebug, "%s ifd serializeDataArea %d skipping empty entry\n",
+                               ifd.desc.IfdName(ifd.id), i )
             }
             continue
         }
+        start := getWriteOffset( w )
         err = ifd.values[i].serializeData( w )
         if err != nil {
-            err = fmt.Errorf( "%s ifd serializeDataArea for entry %d: %v\n",
-                              GetIfdName(ifd.id), i, err )
+            err = fmt.Errorf( "%s ifd serializeDataArea for entry %d: %w\n",
+                              ifd.desc.IfdName(ifd.id), i, err )
             return 0, err
         }
+        if _, ok := ifd.values[i].(*ifdValue); ! ok {  // ifds have their own
+            addSegment( w, DataSegment, ifd.id, ifd.values[i].getTag(),
+                        start, getWriteOffset( w ) - start )
+        }
         if ifd.desc.SrlzDbg {
-            fmt.Printf( "%s ifd serialized data for entry %d dOffset %#08x\n",
-                        GetIfdName(ifd.id), i, ifd.dOffset )
+            ifd.desc.logf( LogDebug, "%s ifd serialized data for entry %d dOffset %#08x\n",
+                           ifd.desc.IfdName(ifd.id), i, ifd.dOffset )
         }
     }
 
     written := ifd.dOffset - origin
     if ifd.desc.SrlzDbg {
-        fmt.Printf( "%s ifd serialize data: returning with size %d\n",
-                    GetIfdName(ifd.id), written )
+        ifd.desc.logf( LogDebug, "%s ifd serialize data: returning with size %d\n",
+                       ifd.desc.IfdName(ifd.id), written )
     }
     return written, err
 }
@@ -212,8 +344,8 @@ func (ifd *ifdd)serializeSliceEntry( w io.Writer, eTT tEntry,
     }
     size := getSliceSize( sl )
     if ifd.desc.SrlzDbg {
-        fmt.Printf( "serializeSliceEntry: tag %#04x type %s count %d size %d\n",
-                    eTT.vTag, getTiffTString(eTT.vType), eTT.vCount, size )
+        ifd.desc.logf( LogDebug, "serializeSliceEntry: tag %#04x type %s count %d size %d\n",
+                       eTT.vTag, getTiffTString(eTT.vType), eTT.vCount, size )
     }
     if size <= _valOffSize {
         if err = binary.Write( w, endian, sl ); err == nil {
@@ -230,6 +362,12 @@ func (ifd *ifdd)serializeSliceEntry( w io.Writer, eTT tEntry,
     return
 }
 
+// getSliceAlignedDataSize returns the size that a slice of values takes in
+// the IFD data area, including alignment, or 0 if it fits in _valOffSize
+func (ifd *ifdd)getSliceAlignedDataSize( sl interface{} ) uint32 {
+    return ifd.getAlignedDataSize( getSliceDataSize( sl ) )
+}
+
 func getSliceDataSize( sl interface{} ) uint32 {
     size := getSliceSize( sl )
     if size <= _valOffSize {
@@ -266,7 +404,9 @@ func (ifd *ifdd)serializeSliceData( w io.Writer,
 func (ifd *ifdd)format( w io.Writer ) error {
 
     for i := 0; i < len(ifd.values); i++ {
-        ifd.values[i].format( w )
+        if ifd.values[i] != nil {   // removed entries must be ignored
+            ifd.values[i].format( w )
+        }
     }
     return nil
 }
@@ -0,0 +1,130 @@
+package exif
+
+// support for metadata sidecar files
+
+import (
+    "fmt"
+    "bytes"
+    "io"
+    "io/ioutil"
+    "os"
+    "strings"
+)
+
+/*
+    A sidecar file keeps metadata outside the image, for example next to a raw
+    image file that should not be modified. Two formats are supported:
+
+    - exif files (.exif), made of the EXIF header "Exif\x00\x00" followed by
+      the TIFF data, as written by Write.
+    - exiv2 files (.exv), made of the 7-byte signature "\xFF\x01Exiv2",
+      followed by JPEG segments (the EXIF APP1 segment, possibly XMP APP1 or
+      IPTC APP13 segments) and terminated by the EOI marker 0xFFD9.
+
+    Only the EXIF APP1 segment is written in exiv2 files, other segments are
+    ignored when reading.
+*/
+
+const _exvSignature = "\xff\x01Exiv2"
+
+// SerializeSidecar serializes the metadata as an exiv2 sidecar (.exv) into
+// the io.Writer w. Use Serialize instead for an exif sidecar (.exif).
+//
+// It returns the number of bytes written in case of success or a non-nil error
+// in case of failure.
+func (d *Desc)SerializeSidecar( w io.Writer ) (n int, err error) {
+    defer func ( ) {
+        if err != nil { err = fmt.Errorf( "SerializeSidecar: %w", err ) }
+    }()
+    var exif []byte
+    if exif, err = d.Bytes( ); err != nil {
+        return
+    }
+    if len(exif) + 2 > 0xffff {
+        err = fmt.Errorf( "metadata size %d %w\n", len(exif),
+                          ErrSegmentTooLarge )
+        return
+    }
+    var b bytes.Buffer
+    b.WriteString( _exvSignature )
+    if len(exif) > 0 {
+        sLen := len(exif) + 2
+        b.Write( []byte{ 0xff, _APP1, byte(sLen >> 8), byte(sLen) } )
+        b.Write( exif )
+    }
+    b.Write( []byte{ 0xff, _EOI } )
+    return w.Write( b.Bytes() )
+}
+
+// WriteSidecar writes the metadata into a new sidecar file. The argument
+// path gives the path of the file to write. If path ends with ".exv", the
+// file is written in exiv2 format, otherwise it is written as by Write.
+// As with Write, the Control Software identity is stamped into the written
+// metadata.
+//
+// It returns the number of bytes written in the file in case of success
+// or a non-nil error in case of failure.
+func (d *Desc)WriteSidecar( path string ) (n int, err error) {
+    if ! strings.HasSuffix( path, ".exv" ) {
+        return d.Write( path )
+    }
+    defer func ( ) {
+        if err != nil { err = fmt.Errorf( "WriteSidecar: %w", err ) }
+    }()
+    var f *os.File
+    f, err = os.OpenFile( path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
+    if err != nil {
+        return
+    }
+    defer func ( ) { if e := f.Close(); err == nil { err = e } }()
+    var s *Desc
+    if s, err = d.stamped( ); err != nil {
+        return
+    }
+    n, err = s.SerializeSidecar( f )
+    return
+}
+
+// ParseSidecar parses the metadata found in sidecar data, either in exiv2 or
+// in exif format. The returned descriptor can then be applied to an image
+// with UpdateJpeg.
+//
+// It returns the descriptor in case of success or a non-nil error in case of
+// failure, wrapping ErrNoExif if the sidecar does not include exif metadata.
+func ParseSidecar( data []byte, ec *Control ) (*Desc, error) {
+    if bytes.HasPrefix( data, []byte( _exvSignature ) ) {
+        segments, err := walkJpegSegments( data, uint(len(_exvSignature)) )
+        for _, s := range segments {
+            if s.marker == _APP1 &&
+               bytes.HasPrefix( data[s.payload:s.end], []byte( "Exif\x00\x00" ) ) {
+                d, err := Parse( data, s.payload, s.end - s.payload, ec )
+                if err != nil {
+                    return nil, fmt.Errorf( "ParseSidecar: %w", err )
+                }
+                return d, nil
+            }
+        }
+        if err == nil {
+            err = fmt.Errorf( "%w\n", ErrNoExif )
+        }
+        return nil, fmt.Errorf( "ParseSidecar: %w", err )
+    }
+    if ! bytes.HasPrefix( data, []byte( "Exif\x00\x00" ) ) {
+        return nil, fmt.Errorf( "ParseSidecar: %w\n", ErrNoExif )
+    }
+    d, err := Parse( data, 0, 0, ec )
+    if err != nil {
+        return nil, fmt.Errorf( "ParseSidecar: %w", err )
+    }
+    return d, nil
+}
+
+// ReadSidecar reads and parses a sidecar file, as ParseSidecar does. The
+// argument path gives the path of the file to read.
+func ReadSidecar( path string, ec *Control ) (*Desc, error) {
+    data, err := ioutil.ReadFile( path )
+    if err != nil {
+        return nil, fmt.Errorf( "ReadSidecar: %w", err )
+    }
+    return ParseSidecar( data, ec )
+}
@@ -0,0 +1,89 @@
+package exif
+
+// support for formatting metadata IFD by IFD
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "os"
+)
+
+/*
+    Format and FormatIfds write to their writer as values are formatted, in
+    many small writes, and go on formatting after a write error. Large maker
+    notes with huge raw dumps then take a while before anything is visible
+    when the writer is buffered, and keep being formatted for nothing when
+    the output is closed, e.g. when piped to a pager that exits.
+
+    FormatStream produces the same output as Format, but each IFD is first
+    formatted in memory, then written in a single write and flushed if the
+    writer can be flushed, such as a bufio.Writer or an http.ResponseWriter.
+    It stops at the first write error. Combined with Control MaxDump, which
+    truncates raw data dumps, it gives terminal friendly output for any size
+    of metadata.
+*/
+
+// flushWriter flushes w if it can be flushed, and returns any flush error.
+func flushWriter( w io.Writer ) error {
+    switch f := w.(type) {
+    case interface{ Flush( ) error }:
+        return f.Flush( )
+    case interface{ Flush( ) }:
+        f.Flush( )
+    }
+    return nil
+}
+
+// FormatStream formats the IFDs given by their ids in ifdIds, or all IFDs if
+// ifdIds is nil, as Format does. Each IFD is written to w in a single write,
+// after which w is flushed if it implements Flush. If w is nil, os.Stdout is
+// used instead. Absent IFDs are skipped.
+//
+// It returns the number of bytes written and the first write or flush error
+// encountered, which stops formatting. Nothing is written if one of the ids
+// is not in the range of valid IFD ids.
+func (d *Desc)FormatStream( w io.Writer, ifdIds []IfdId ) (n int, err error) {
+    if w == nil {
+        w = os.Stdout
+    }
+    if ifdIds == nil {
+        for id := PRIMARY; id < d.ifdCount(); id++ {
+            ifdIds = append( ifdIds, id )
+        }
+    }
+    for _, id := range ifdIds {
+        if id >= d.ifdCount() {
+            return 0, fmt.Errorf( "FormatStream: id %d is not valid for an ifd\n", id )
+        }
+    }
+
+    var b bytes.Buffer
+    cw := newCumulativeWriter( &b, d )
+    emit := func( ) error {
+        wn, err := w.Write( b.Bytes() )
+        n += wn
+        b.Reset()
+        if err != nil {
+            return err
+        }
+        return flushWriter( w )
+    }
+
+    cw.format( "------ Picture Metadata:\n\n" )
+    if err = emit( ); err != nil {
+        return
+    }
+    for _, id := range ifdIds {
+        if ifd := d.getIfd( id ); ifd != nil {
+            cw.format( "--- %s IFD (id %d)\n", d.IfdName(id), id )
+            ifd.format( cw )
+            if err = emit( ); err != nil {
+                return
+            }
+        }
+    }
+    cw.format( "------\n" )
+    err = emit( )
+    return
+}
@@ -0,0 +1,222 @@
+package exif
+
+// support for checking the layout of metadata in strict mode
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+)
+
+/*
+    Writers lay out IFDs and their data areas in a simple way: each IFD entry
+    table is followed by the values that do not fit in their entry, in entry
+    order, and IFDs never overlap. Metadata edited in place by tools that do
+    not rewrite it, or forged by hand, often breaks those rules.
+
+    The layout check walks the IFD tree directly from the TIFF data, without
+    decoding any value: IFD0 and the next IFDs in its list, the Exif and GPS
+    IFDs and the Interoperability IFD. The maker note is taken as a single
+    opaque value, since its own layout is vendor specific. It reports:
+
+      - values or IFDs outside the data area, i.e. in the TIFF header or
+        beyond the end of the data,
+      - values whose data is not in increasing offset order within an IFD,
+      - values overlapping an IFD entry table or another value,
+      - IFD pointers to an IFD already seen or inside an earlier IFD, which
+        would create a loop.
+
+    If Control Strict is set, metadata with any layout anomaly is rejected and
+    the error is a LayoutError giving all anomalies. Otherwise, anomalies can
+    be obtained after parsing with LayoutAnomalies.
+*/
+
+// LayoutAnomalyKind is the kind of a layout anomaly
+type LayoutAnomalyKind int
+
+const (
+    OutsideDataArea     LayoutAnomalyKind = iota // value or IFD out of bounds
+    OutOfOrderData                               // value before previous value
+    OverlappingData                              // value overlapping other data
+    IfdLoop                                      // IFD already seen or inside
+)                                                // an earlier IFD
+
+func (k LayoutAnomalyKind) String( ) string {
+    switch k {
+    case OutsideDataArea:   return "outside data area"
+    case OutOfOrderData:    return "out of order data"
+    case OverlappingData:   return "overlapping data"
+    case IfdLoop:           return "IFD loop"
+    }
+    return fmt.Sprintf( "anomaly %d", int(k) )
+}
+
+// LayoutAnomaly describes a suspicious layout. Offsets are relative to the
+// TIFF header.
+type LayoutAnomaly struct {
+    Kind    LayoutAnomalyKind
+    Ifd     IfdId       // IFD where the anomaly was found
+    Tag     uint16      // entry tag, or 0 for the IFD entry table itself
+    Offset  uint32      // offset of the suspicious area
+    Size    uint32      // size of the suspicious area
+}
+
+func (a LayoutAnomaly) String( ) string {
+    what := "entry table"
+    if a.Tag != 0 {
+        what = fmt.Sprintf( "tag %#04x", a.Tag )
+    }
+    return fmt.Sprintf( "%s: %s IFD %s @%#08x (%d bytes)",
+                        a.Kind, GetIfdName( a.Ifd ), what, a.Offset, a.Size )
+}
+
+// LayoutError is returned (wrapped) by parsing functions with Control Strict
+// set, if the layout of the metadata is suspicious. It wraps ErrSuspiciousLayout.
+type LayoutError struct {
+    Anomalies   []LayoutAnomaly
+}
+
+func (e *LayoutError) Error( ) string {
+    s := make( []string, len(e.Anomalies) )
+    for i, a := range e.Anomalies {
+        s[i] = a.String( )
+    }
+    return fmt.Sprintf( "%v: %s\n", ErrSuspiciousLayout, strings.Join( s, ", " ) )
+}
+
+func (e *LayoutError) Unwrap( ) error {
+    return ErrSuspiciousLayout
+}
+
+// layoutArea is an IFD entry table or a value data area
+type layoutArea struct {
+    start, end  uint32
+    id          IfdId
+    tag         uint16      // 0 for an entry table
+}
+
+type layoutChecker struct {
+    prober
+    areas       []layoutArea
+    anomalies   []LayoutAnomaly
+}
+
+func (lc *layoutChecker) report( kind LayoutAnomalyKind, id IfdId, tag uint16,
+                                 start, end uint64 ) {
+    lc.anomalies = append( lc.anomalies,
+                    LayoutAnomaly{ kind, id, tag, uint32(start), uint32(end - start) } )
+}
+
+// inBounds returns true if the area between start and end is in the data
+// area, after the TIFF header and before the end of data.
+func (lc *layoutChecker) inBounds( start, end uint64 ) bool {
+    return start >= _headerSize && end <= uint64(len(lc.data))
+}
+
+// isKnownIfd returns true if offset is the start of an IFD already seen or
+// is inside an IFD entry table.
+func (lc *layoutChecker) isKnownIfd( offset uint32 ) bool {
+    for _, a := range lc.areas {
+        if a.tag == 0 && offset >= a.start && offset < a.end {
+            return true
+        }
+    }
+    return false
+}
+
+// checkIfd checks the ifd id at offset and the IFDs it points to, and
+// returns the offset of the next IFD in list.
+func (lc *layoutChecker) checkIfd( id IfdId, offset uint32 ) uint32 {
+    if lc.isKnownIfd( offset ) {
+        lc.report( IfdLoop, id, 0, uint64(offset), uint64(offset) )
+        return 0
+    }
+    if ! lc.inBounds( uint64(offset), uint64(offset) + _ShortSize ) {
+        lc.report( OutsideDataArea, id, 0, uint64(offset), uint64(offset) )
+        return 0
+    }
+    n := uint64(lc.endian.Uint16( lc.data[offset:] ))
+    end := uint64(offset) + _ShortSize + n * _IfdEntrySize + _LongSize
+    if ! lc.inBounds( uint64(offset), end ) {
+        lc.report( OutsideDataArea, id, 0, uint64(offset), end )
+        return 0
+    }
+    lc.areas = append( lc.areas, layoutArea{ offset, uint32(end), id, 0 } )
+
+    type subIfd struct {
+        id      IfdId
+        offset  uint32
+    }
+    var subIfds []subIfd
+    var last uint32                     // previous value data offset
+    next := lc.entries( offset, func( tag tTag, typ tType, count, vo uint32 ) {
+        switch {
+        case id == PRIMARY && tag == _ExifIFD:
+            subIfds = append( subIfds, subIfd{ EXIF, lc.integer( typ, vo ) } )
+        case id == PRIMARY && tag == _GpsIFD:
+            subIfds = append( subIfds, subIfd{ GPS, lc.integer( typ, vo ) } )
+        case id == EXIF && tag == _InteroperabilityIFD:
+            subIfds = append( subIfds, subIfd{ IOP, lc.integer( typ, vo ) } )
+        }
+        tSize, err := getTiffTypeSize( typ )
+        size := uint64(tSize) * uint64(count)
+        if err != nil || size <= _valOffSize {
+            return
+        }
+        start := uint64(lc.endian.Uint32( lc.data[vo:] ))
+        if ! lc.inBounds( start, start + size ) {
+            lc.report( OutsideDataArea, id, uint16(tag), start, start + size )
+            return
+        }
+        if uint32(start) < last {
+            lc.report( OutOfOrderData, id, uint16(tag), start, start + size )
+        }
+        last = uint32(start)
+        lc.areas = append( lc.areas,
+                           layoutArea{ uint32(start), uint32(start + size),
+                                       id, uint16(tag) } )
+    } )
+    for _, s := range subIfds {
+        lc.checkIfd( s.id, s.offset )
+    }
+    return next
+}
+
+// checkOverlaps reports all areas overlapping a previous area
+func (lc *layoutChecker) checkOverlaps( ) {
+    sort.SliceStable( lc.areas, func( i, j int ) bool {
+        return lc.areas[i].start < lc.areas[j].start
+    } )
+    var end uint32
+    for i, a := range lc.areas {
+        if i > 0 && a.start < end {
+            lc.report( OverlappingData, a.id, a.tag, uint64(a.start), uint64(a.end) )
+        }
+        if a.end > end {
+            end = a.end
+        }
+    }
+}
+
+// checkLayout returns the layout anomalies found in the TIFF data, starting
+// with the TIFF header, in the given byte order.
+func checkLayout( p prober ) []LayoutAnomaly {
+    lc := layoutChecker{ prober: p }
+    id := PRIMARY
+    for offset := p.endian.Uint32( p.data[4:] ); offset != 0; {
+        offset = lc.checkIfd( id, offset )
+        id = THUMBNAIL                  // following IFDs
+    }
+    lc.checkOverlaps( )
+    return lc.anomalies
+}
+
+// LayoutAnomalies returns the anomalies found in the layout of the metadata
+// as it was parsed, or nil if there is none. See LayoutAnomalyKind for the
+// kinds of anomalies reported.
+func (d *Desc) LayoutAnomalies( ) []LayoutAnomaly {
+    if len(d.data) < _headerSize {
+        return nil
+    }
+    return checkLayout( prober{ data: d.data, endian: d.endian } )
+}
@@ -0,0 +1,84 @@
+package exif
+
+import (
+    "encoding/binary"
+    "errors"
+    "testing"
+)
+
+// testOverlapTiff returns TIFF data where the Model value overlaps the Make
+// value, as if edited in place
+func testOverlapTiff( e binary.ByteOrder ) []byte {
+    ifd0 := []testEntry{
+        { _Make, uint16(_ASCIIString), 6, testString( "Nikon" ) },
+        { _Model, uint16(_ASCIIString), 6, testString( "Nikon" ) },
+    }
+    tiff := testTiff( e, ifd0, nil )
+    // IFD0 at 8: count, then 12-byte entries with their value/offset field at 8
+    copy( tiff[8+2+12+8:], tiff[8+2+8:8+2+12] )
+    return tiff
+}
+
+func TestStrictLayout( t *testing.T ) {
+    for _, e := range []binary.ByteOrder{ binary.BigEndian, binary.LittleEndian } {
+        tiff := append( []byte( "Exif\x00\x00" ), testOverlapTiff( e )... )
+        _, err := Parse( tiff, 0, uint(len(tiff)), &Control{ Strict: true } )
+        var le *LayoutError
+        if ! errors.Is( err, ErrSuspiciousLayout ) || ! errors.As( err, &le ) {
+            t.Fatalf( "%v: strict error %v", e, err )
+        }
+        if len(le.Anomalies) != 1 || le.Anomalies[0].Kind != OverlappingData ||
+           le.Anomalies[0].Tag != _Model {
+            t.Errorf( "%v: anomalies %v", e, le.Anomalies )
+        }
+
+        d, err := Parse( tiff, 0, uint(len(tiff)), &Control{ } )
+        if err != nil {
+            t.Fatalf( "%v: non-strict error %v", e, err )
+        }
+        if a := d.LayoutAnomalies( ); len(a) != 1 {
+            t.Errorf( "%v: LayoutAnomalies %v", e, a )
+        }
+    }
+
+    ifd0 := []testEntry{
+        { _Make, uint16(_ASCIIString), 6, testString( "Nikon" ) },
+        { _Model, uint16(_ASCIIString), 6, testString( "Nikon" ) },
+    }
+    tiff := append( []byte( "Exif\x00\x00" ),
+                    testTiff( binary.BigEndian, ifd0, nil )... )
+    if _, err := Parse( tiff, 0, uint(len(tiff)), &Control{ Strict: true } ); err != nil {
+        t.Errorf( "regular layout rejected: %v", err )
+    }
+}
+
+func TestStrictZeroDenominator( t *testing.T ) {
+    e := binary.LittleEndian
+    for _, c := range []struct {
+        name    string
+        entry   testEntry
+    } {
+        { "unsigned", testEntry{ _ExposureTime, uint16(_UnsignedRational), 1,
+                                 testLongs( e, 1, 0 ) } },
+        { "signed", testEntry{ _BrightnessValue, uint16(_SignedRational), 1,
+                               testLongs( e, 0xfffffffd, 0 ) } },
+    } {
+        tiff := append( []byte( "Exif\x00\x00" ),
+                        testTiff( e, nil, []testEntry{ c.entry } )... )
+        _, err := Parse( tiff, 0, uint(len(tiff)), &Control{ Strict: true } )
+        if ! errors.Is( err, ErrZeroDenominator ) {
+            t.Errorf( "%s: strict error %v", c.name, err )
+        }
+        if _, err = Parse( tiff, 0, uint(len(tiff)), &Control{ } ); err != nil {
+            t.Errorf( "%s: non-strict error %v", c.name, err )
+        }
+    }
+
+    // 0/0 is a valid unknown value, even in strict mode
+    tiff := append( []byte( "Exif\x00\x00" ), testTiff( e, nil, []testEntry{
+        { _ExposureTime, uint16(_UnsignedRational), 1, testLongs( e, 0, 0 ) },
+    } )... )
+    if _, err := Parse( tiff, 0, uint(len(tiff)), &Control{ Strict: true } ); err != nil {
+        t.Errorf( "0/0 rejected: %v", err )
+    }
+}
@@ -0,0 +1,159 @@
+package exif
+
+// support for a summary of common photo information
+
+import (
+    "time"
+)
+
+/*
+    Summary gathers in a single structure the information most applications
+    need, without requiring any knowledge of IFDs and tags. Values are taken
+    from wherever they are stored: TIFF/EP tags are looked for in the Exif IFD
+    first and then in IFD0, dimensions in the Exif IFD first and then in IFD0.
+    Missing values are left as their zero value.
+*/
+
+// Metadata gives the common photo information, as returned by Summary
+type Metadata struct {
+    Make            string      // camera make
+    Model           string      // camera model
+    LensMake        string      // lens make
+    LensModel       string      // lens model
+    Software        string      // software used to create or edit the image
+    Artist          string      // image creator
+    Copyright       string      // copyright notice
+    Description     string      // image description, decoded to UTF-8
+
+    Width           uint32      // image width in pixels
+    Height          uint32      // image height in pixels
+    Orientation     uint16      // orientation (1 to 8), 0 if unknown
+
+    ExposureTime    float64     // exposure time in seconds
+    FNumber         float64     // aperture f-number
+    ISO             uint32      // sensitivity, as returned by ISO
+    FocalLength     float64     // focal length in mm
+    FocalLength35mm uint32      // equivalent focal length for 35mm film
+    ExposureBias    float64     // exposure bias in EV
+    Flash           bool        // true if the flash fired
+
+    DateTime        time.Time   // date of last modification
+    DateTimeOriginal time.Time  // date of the original image capture
+    DateTimeDigitized time.Time // date when the image was digitized
+
+    HasGPS          bool        // true if a GPS IFD is present
+    Latitude        float64     // degrees, negative in the southern hemisphere
+    Longitude       float64     // degrees, negative west of Greenwich
+    Altitude        float64     // meters, negative below sea level
+
+    HasThumbnail    bool        // true if a thumbnail is present (IFD1)
+    ColorSpace      ColorSpace  // as returned by EffectiveColorSpace
+}
+
+// getSummaryValue returns the value of tag in the ifd id, or in IFD0 for a
+// TIFF/EP tag absent from the Exif IFD, or nil if there is no such value.
+func (d *Desc) getSummaryValue( id IfdId, tag tTag ) serializer {
+    if ifd := d.getIfd( id ); ifd != nil {
+        if v := ifd.getValue( tag ); v != nil {
+            return v
+        }
+    }
+    if id == EXIF && tiffEPTags[tag] && d.ifds[PRIMARY] != nil {
+        return d.ifds[PRIMARY].getValue( tag )
+    }
+    return nil
+}
+
+func (d *Desc) getSummaryString( id IfdId, tag tTag ) string {
+    if ifd := d.getIfd( id ); ifd != nil {
+        s, _ := ifd.getAsciiString( tag )
+        return s
+    }
+    return ""
+}
+
+func (d *Desc) getSummaryInteger( id IfdId, tag tTag ) uint32 {
+    if ifd := d.getIfd( id ); ifd != nil {
+        i, _ := ifd.getUnsignedInteger( tag )
+        return i
+    }
+    return 0
+}
+
+// getSummaryRational returns the value of an unsigned or signed rational tag
+// at index i, or 0 if it is absent or invalid
+func (d *Desc) getSummaryRational( id IfdId, tag tTag, i int ) float64 {
+    switch v := d.getSummaryValue( id, tag ).(type) {
+    case *unsignedRationalValue:
+        if i < len(v.v) {
+            return v.v[i].checkedFloat( )
+        }
+    case *signedRationalValue:
+        if i < len(v.v) {
+            return v.v[i].checkedFloat( )
+        }
+    }
+    return 0
+}
+
+// getSummaryCoordinate returns a GPS latitude or longitude in degrees,
+// negative if ref is the negative reference (S or W).
+func (d *Desc) getSummaryCoordinate( tag, ref tTag, negative string ) float64 {
+    c := d.getSummaryRational( GPS, tag, 0 ) +
+         d.getSummaryRational( GPS, tag, 1 ) / 60 +
+         d.getSummaryRational( GPS, tag, 2 ) / 3600
+    if d.getSummaryString( GPS, ref ) == negative {
+        return -c
+    }
+    return c
+}
+
+// Summary returns the common photo information found in the metadata, such
+// as camera, lens, exposure, dimensions, dates and location.
+func (d *Desc)Summary( ) (m Metadata) {
+    m.Make = d.getSummaryString( PRIMARY, _Make )
+    m.Model = d.getSummaryString( PRIMARY, _Model )
+    m.LensMake = d.getSummaryString( EXIF, _LensMake )
+    m.LensModel = d.getSummaryString( EXIF, _LensModel )
+    m.Software = d.getSummaryString( PRIMARY, _Software )
+    m.Artist = d.getSummaryString( PRIMARY, _Artist )
+    m.Copyright = d.getSummaryString( PRIMARY, _Copyright )
+    _, m.Description, _ = d.GetImageDescription( )
+
+    m.Width = d.getSummaryInteger( EXIF, _PixelXDimension )
+    m.Height = d.getSummaryInteger( EXIF, _PixelYDimension )
+    if m.Width == 0 || m.Height == 0 {
+        m.Width = d.getSummaryInteger( PRIMARY, _ImageWidth )
+        m.Height = d.getSummaryInteger( PRIMARY, _ImageLength )
+    }
+    m.Orientation = uint16(d.getSummaryInteger( PRIMARY, _Orientation ))
+
+    m.ExposureTime = d.getSummaryRational( EXIF, _ExposureTime, 0 )
+    m.FNumber = d.getSummaryRational( EXIF, _FNumber, 0 )
+    m.ISO, _ = d.ISO( )
+    m.FocalLength = d.getSummaryRational( EXIF, _FocalLength, 0 )
+    m.FocalLength35mm = d.getSummaryInteger( EXIF, _FocalLengthIn35mmFilm )
+    m.ExposureBias = d.getSummaryRational( EXIF, _ExposureBiasValue, 0 )
+    if f, ok := d.getSummaryValue( EXIF, _Flash ).(*unsignedShortValue);
+       ok && len(f.v) > 0 {
+        m.Flash = f.v[0] & 1 != 0
+    }
+
+    m.DateTime, _ = d.GetDateTime( Modified )
+    m.DateTimeOriginal, _ = d.GetDateTime( Original )
+    m.DateTimeDigitized, _ = d.GetDateTime( Digitized )
+
+    if d.ifds[GPS] != nil {
+        m.HasGPS = true
+        m.Latitude = d.getSummaryCoordinate( _GPSLatitude, _GPSLatitudeRef, "S" )
+        m.Longitude = d.getSummaryCoordinate( _GPSLongitude, _GPSLongitudeRef, "W" )
+        m.Altitude = d.getSummaryRational( GPS, _GPSAltitude, 0 )
+        if ar, ok := d.ifds[GPS].getValue( _GPSAltitudeRef ).(*unsignedByteValue);
+           ok && len(ar.v) > 0 && ar.v[0] == 1 {
+            m.Altitude = -m.Altitude
+        }
+    }
+    m.HasThumbnail = d.ifds[THUMBNAIL] != nil
+    m.ColorSpace = d.EffectiveColorSpace( )
+    return
+}
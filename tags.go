@@ -0,0 +1,358 @@
+package exif
+
+// support for the registry of known tags
+
+/*
+    Entries that are not decoded are processed as unknown entries, which are
+    kept or removed as requested by Control Unknown or OnUnknown. Among them,
+    some tags are defined by the standards or known in a maker note, but are
+    not supported by this package, or could not be decoded. The registry
+    below gives the names of the tags known in each namespace. It is used to
+    tell those known but unsupported tags from really unknown tags, in
+    warnings and in statistics (IfdStats Unknown and Unsupported), and by
+    TagName.
+
+    Tiff and Exif tags share the same table, since TIFF/EP tags are found in
+    both the primary and the Exif IFDs. IFDs embedded in maker notes use the
+    same table as well. Maker note tags depend on the maker note vendor.
+*/
+
+// tiffTagNames gives the names of tiff and Exif tags
+var tiffTagNames = map[tTag]string{
+    _ImageWidth:                          "ImageWidth",
+    _ImageLength:                         "ImageLength",
+    _BitsPerSample:                       "BitsPerSample",
+    _Compression:                         "Compression",
+    _PhotometricInterpretation:           "PhotometricInterpretation",
+    _Threshholding:                       "Threshholding",
+    _CellWidth:                           "CellWidth",
+    _CellLength:                          "CellLength",
+    _FillOrder:                           "FillOrder",
+    _DocumentName:                        "DocumentName",
+    _ImageDescription:                    "ImageDescription",
+    _Make:                                "Make",
+    _Model:                               "Model",
+    _StripOffsets:                        "StripOffsets",
+    _Orientation:                         "Orientation",
+    _SamplesPerPixel:                     "SamplesPerPixel",
+    _RowsPerStrip:                        "RowsPerStrip",
+    _StripByteCounts:                     "StripByteCounts",
+    _MinSampleValue:                      "MinSampleValue",
+    _MaxSampleValue:                      "MaxSampleValue",
+    _XResolution:                         "XResolution",
+    _YResolution:                         "YResolution",
+    _PlanarConfiguration:                 "PlanarConfiguration",
+    _PageName:                            "PageName",
+    _XPosition:                           "XPosition",
+    _YPosition:                           "YPosition",
+    _FreeOffsets:                         "FreeOffsets",
+    _FreeByteCounts:                      "FreeByteCounts",
+    _GrayResponseUnit:                    "GrayResponseUnit",
+    _GrayResponseCurve:                   "GrayResponseCurve",
+    _T4Options:                           "T4Options",
+    _T6Options:                           "T6Options",
+    _ResolutionUnit:                      "ResolutionUnit",
+    _PageNumber:                          "PageNumber",
+    _TransferFunction:                    "TransferFunction",
+    _Software:                            "Software",
+    _DateTime:                            "DateTime",
+    _Artist:                              "Artist",
+    _HostComputer:                        "HostComputer",
+    _Predictor:                           "Predictor",
+    _WhitePoint:                          "WhitePoint",
+    _PrimaryChromaticities:               "PrimaryChromaticities",
+    _ColorMap:                            "ColorMap",
+    _HalftoneHints:                       "HalftoneHints",
+    _TileWidth:                           "TileWidth",
+    _TileLength:                          "TileLength",
+    _TileOffsets:                         "TileOffsets",
+    _TileByteCounts:                      "TileByteCounts",
+    _InkSet:                              "InkSet",
+    _InkNames:                            "InkNames",
+    _NumberOfInks:                        "NumberOfInks",
+    _DotRange:                            "DotRange",
+    _TargetPrinter:                       "TargetPrinter",
+    _ExtraSamples:                        "ExtraSamples",
+    _SampleFormat:                        "SampleFormat",
+    _SMinSampleValue:                     "SMinSampleValue",
+    _SMaxSampleValue:                     "SMaxSampleValue",
+    _TransferRange:                       "TransferRange",
+    _JPEGProc:                            "JPEGProc",
+    _JPEGInterchangeFormat:               "JPEGInterchangeFormat",
+    _JPEGInterchangeFormatLength:         "JPEGInterchangeFormatLength",
+    _JPEGRestartInterval:                 "JPEGRestartInterval",
+    _JPEGLosslessPredictors:              "JPEGLosslessPredictors",
+    _JPEGPointTransforms:                 "JPEGPointTransforms",
+    _JPEGQTables:                         "JPEGQTables",
+    _JPEGDCTables:                        "JPEGDCTables",
+    _JPEGACTables:                        "JPEGACTables",
+    _YCbCrCoefficients:                   "YCbCrCoefficients",
+    _YCbCrSubSampling:                    "YCbCrSubSampling",
+    _YCbCrPositioning:                    "YCbCrPositioning",
+    _ReferenceBlackWhite:                 "ReferenceBlackWhite",
+    _Rating:                              "Rating",
+    _RatingPercent:                       "RatingPercent",
+    _Copyright:                           "Copyright",
+    _ExifIFD:                             "ExifIFD",
+    _GpsIFD:                              "GpsIFD",
+    _SecurityClassification:              "SecurityClassification",
+    _ImageHistory:                        "ImageHistory",
+    _XPTitle:                             "XPTitle",
+    _XPComment:                           "XPComment",
+    _XPAuthor:                            "XPAuthor",
+    _XPKeywords:                          "XPKeywords",
+    _XPSubject:                           "XPSubject",
+    _PrintIM:                             "PrintIM",
+    _Padding:                             "Padding",
+    _ExposureTime:                        "ExposureTime",
+    _FNumber:                             "FNumber",
+    _ExposureProgram:                     "ExposureProgram",
+    _ISOSpeedRatings:                     "ISOSpeedRatings",
+    _SensitivityType:                     "SensitivityType",
+    _StandardOutputSensitivity:           "StandardOutputSensitivity",
+    _RecommendedExposureIndex:            "RecommendedExposureIndex",
+    _ISOSpeed:                            "ISOSpeed",
+    _ISOSpeedLatitudeyyy:                 "ISOSpeedLatitudeyyy",
+    _ISOSpeedLatitudezzz:                 "ISOSpeedLatitudezzz",
+    _ExifVersion:                         "ExifVersion",
+    _DateTimeOriginal:                    "DateTimeOriginal",
+    _DateTimeDigitized:                   "DateTimeDigitized",
+    _OffsetTime:                          "OffsetTime",
+    _OffsetTimeOriginal:                  "OffsetTimeOriginal",
+    _OffsetTimeDigitized:                 "OffsetTimeDigitized",
+    _ComponentsConfiguration:             "ComponentsConfiguration",
+    _CompressedBitsPerPixel:              "CompressedBitsPerPixel",
+    _ShutterSpeedValue:                   "ShutterSpeedValue",
+    _ApertureValue:                       "ApertureValue",
+    _BrightnessValue:                     "BrightnessValue",
+    _ExposureBiasValue:                   "ExposureBiasValue",
+    _MaxApertureValue:                    "MaxApertureValue",
+    _SubjectDistance:                     "SubjectDistance",
+    _MeteringMode:                        "MeteringMode",
+    _LightSource:                         "LightSource",
+    _Flash:                               "Flash",
+    _FocalLength:                         "FocalLength",
+    _SubjectArea:                         "SubjectArea",
+    _MakerNote:                           "MakerNote",
+    _UserComment:                         "UserComment",
+    _SubsecTime:                          "SubsecTime",
+    _SubsecTimeOriginal:                  "SubsecTimeOriginal",
+    _SubsecTimeDigitized:                 "SubsecTimeDigitized",
+    _FlashpixVersion:                     "FlashpixVersion",
+    _ColorSpace:                          "ColorSpace",
+    _PixelXDimension:                     "PixelXDimension",
+    _PixelYDimension:                     "PixelYDimension",
+    _InteroperabilityIFD:                 "InteroperabilityIFD",
+    _SubjectLocation:                     "SubjectLocation",
+    _SensingMethod:                       "SensingMethod",
+    _FileSource:                          "FileSource",
+    _SceneType:                           "SceneType",
+    _CFAPattern:                          "CFAPattern",
+    _CustomRendered:                      "CustomRendered",
+    _ExposureMode:                        "ExposureMode",
+    _WhiteBalance:                        "WhiteBalance",
+    _DigitalZoomRatio:                    "DigitalZoomRatio",
+    _FocalLengthIn35mmFilm:               "FocalLengthIn35mmFilm",
+    _SceneCaptureType:                    "SceneCaptureType",
+    _GainControl:                         "GainControl",
+    _Contrast:                            "Contrast",
+    _Saturation:                          "Saturation",
+    _Sharpness:                           "Sharpness",
+    _SubjectDistanceRange:                "SubjectDistanceRange",
+    _ImageUniqueID:                       "ImageUniqueID",
+    _LensSpecification:                   "LensSpecification",
+    _LensMake:                            "LensMake",
+    _LensModel:                           "LensModel",
+    _CompositeImage:                      "CompositeImage",
+    _SourceImageNumberOfCompositeImage:   "SourceImageNumberOfCompositeImage",
+    _SourceExposureTimesOfCompositeImage: "SourceExposureTimesOfCompositeImage",
+}
+
+// gpsTagNames gives the names of GPS tags
+var gpsTagNames = map[tTag]string{
+    _GPSVersionID:        "GPSVersionID",
+    _GPSLatitudeRef:      "GPSLatitudeRef",
+    _GPSLatitude:         "GPSLatitude",
+    _GPSLongitudeRef:     "GPSLongitudeRef",
+    _GPSLongitude:        "GPSLongitude",
+    _GPSAltitudeRef:      "GPSAltitudeRef",
+    _GPSAltitude:         "GPSAltitude",
+    _GPSTimeStamp:        "GPSTimeStamp",
+    _GPSSatellites:       "GPSSatellites",
+    _GPSStatus:           "GPSStatus",
+    _GPSMeasureMode:      "GPSMeasureMode",
+    _GPSDOP:              "GPSDOP",
+    _GPSSpeedRef:         "GPSSpeedRef",
+    _GPSSpeed:            "GPSSpeed",
+    _GPSTrackRef:         "GPSTrackRef",
+    _GPSTrack:            "GPSTrack",
+    _GPSImgDirectionRef:  "GPSImgDirectionRef",
+    _GPSImgDirection:     "GPSImgDirection",
+    _GPSMapDatum:         "GPSMapDatum",
+    _GPSDestLatitudeRef:  "GPSDestLatitudeRef",
+    _GPSDestLatitude:     "GPSDestLatitude",
+    _GPSDestLongitudeRef: "GPSDestLongitudeRef",
+    _GPSDestLongitude:    "GPSDestLongitude",
+    _GPSDestBearingRef:   "GPSDestBearingRef",
+    _GPSDestBearing:      "GPSDestBearing",
+    _GPSDestDistanceRef:  "GPSDestDistanceRef",
+    _GPSDestDistance:     "GPSDestDistance",
+    _GPSProcessingMethod: "GPSProcessingMethod",
+    _GPSAreaInformation:  "GPSAreaInformation",
+    _GPSDateStamp:        "GPSDateStamp",
+    _GPSDifferential:     "GPSDifferential",
+}
+
+// iopTagNames gives the names of Interoperability tags
+var iopTagNames = map[tTag]string{
+    _InteroperabilityIndex:   "InteroperabilityIndex",
+    _InteroperabilityVersion: "InteroperabilityVersion",
+}
+
+// appleTagNames gives the names of known Apple maker note tags
+var appleTagNames = map[tTag]string{
+    _AppleRunTime:            "RunTime",
+    _AppleAccelerationVector: "AccelerationVector",
+    _AppleHDRImageType:       "HDRImageType",
+    _BurstUUID:               "BurstUUID",
+    _AppleOrientation:        "Orientation",
+    _AppleMediaGroupUUID:     "MediaGroupUUID",
+    _AppleImageUniqueID:      "ImageUniqueID",
+    _AppleHDRHeadroom:        "HDRHeadroom",
+    _AppleHDRGain:            "HDRGain",
+}
+
+// nikonTagNames gives the names of known Nikon type 3 maker note tags
+var nikonTagNames = map[tTag]string{
+    _Nikon3Version:                   "Version",
+    _Nikon3ISOSpeed:                  "ISOSpeed",
+    _Nikon3ColorMode:                 "ColorMode",
+    _Nikon3Quality:                   "Quality",
+    _Nikon3WhiteBalance:              "WhiteBalance",
+    _Nikon3Sharpness:                 "Sharpness",
+    _Nikon3FocusMode:                 "FocusMode",
+    _Nikon3FlashSetting:              "FlashSetting",
+    _Nikon3FlashType:                 "FlashType",
+    _Nikon3WhiteBalanceBias:          "WhiteBalanceBias",
+    _Nikon3WhiteBalanceRBLevels:      "WhiteBalanceRBLevels",
+    _Nikon3ProgramShift:              "ProgramShift",
+    _Nikon3ExposureDiff:              "ExposureDiff",
+    _Nikon3ISOSelection:              "ISOSelection",
+    _Nikon3DataDump:                  "DataDump",
+    _Nikon3Preview:                   "Preview",
+    _Nikon3FlashExposureCompensation: "FlashExposureCompensation",
+    _Nikon3ISOSpeedRequested:         "ISOSpeedRequested",
+    _Nikon3ImageBoundary:             "ImageBoundary",
+    _Nikon3ExtFlashExposureComp:      "ExtFlashExposureComp",
+    _Nikon3AEBracketCompensation:     "AEBracketCompensation",
+    _Nikon3ExposureBracketValue:      "ExposureBracketValue",
+    _Nikon3ImageProcessing:           "ImageProcessing",
+    _Nikon3CropHiSpeed:               "CropHiSpeed",
+    _Nikon3ExposureTuning:            "ExposureTuning",
+    _Nikon3SerialNumber:              "SerialNumber",
+    _Nikon3ColorSpace:                "ColorSpace",
+    _Nikon3VRInfo:                    "VRInfo",
+    _Nikon3ActiveDLighting:           "ActiveDLighting",
+    _Nikon3PictureControlData:        "PictureControlData",
+    _Nikon3WorldTime:                 "WorldTime",
+    _Nikon3ISOInfo:                   "ISOInfo",
+    _Nikon3DistortInfo:               "DistortInfo",
+    _Nikon3ImageAdjustment:           "ImageAdjustment",
+    _Nikon3ToneCompensation:          "ToneCompensation",
+    _Nikon3AuxillaryLens:             "AuxillaryLens",
+    _Nikon3LensType:                  "LensType",
+    _Nikon3LensInfo:                  "LensInfo",
+    _Nikon3ManualFocusDistance:       "ManualFocusDistance",
+    _Nikon3DigitalZoomFactor:         "DigitalZoomFactor",
+    _Nikon3FlashMode:                 "FlashMode",
+    _Nikon3AutoFocusArea:             "AutoFocusArea",
+    _Nikon3ShootingMode:              "ShootingMode",
+    _Nikon3LensFStops:                "LensFStops",
+    _Nikon3ContrastCurve:             "ContrastCurve",
+    _Nikon3ColorHue:                  "ColorHue",
+    _Nikon3SceneMode:                 "SceneMode",
+    _Nikon3LightSource:               "LightSource",
+    _Nikon3ShotInfo:                  "ShotInfo",
+    _Nikon3HueAdjustment:             "HueAdjustment",
+    _Nikon3NEFCompression:            "NEFCompression",
+    _Nikon3Saturation:                "Saturation",
+    _Nikon3NoiseReduction:            "NoiseReduction",
+    _NikonLinearizationTable:         "LinearizationTable",
+    _Nikon3ColorBalance:              "ColorBalance",
+    _Nikon3LensData:                  "LensData",
+    _Nikon3DateStampMode:             "DateStampMode",
+    _Nikon3RetouchHistory:            "RetouchHistory",
+    _Nikon3ImageSize:                 "ImageSize",
+    _Nikon3ShutterCount:              "ShutterCount",
+    _Nikon3FlashInfo:                 "FlashInfo",
+    _Nikon3ImageOptimization:         "ImageOptimization",
+    _Nikon3Saturation2:               "Saturation2",
+    _Nikon3DigitalVariProgram:        "DigitalVariProgram",
+    _Nikon3MultiExposure:             "MultiExposure",
+    _Nikon3HighISONoiseReduction:     "HighISONoiseReduction",
+    _Nikon3PowerUpTime:               "PowerUpTime",
+    _Nikon3AFInfo2:                   "AFInfo2",
+    _Nikon3FileInfo:                  "FileInfo",
+    _Nikon3RetouchInfo:               "RetouchInfo",
+}
+
+// djiTagNames gives the names of known DJI maker note tags
+var djiTagNames = map[tTag]string{
+    _DJIMake:        "Make",
+    _DJISpeedX:      "SpeedX",
+    _DJISpeedY:      "SpeedY",
+    _DJISpeedZ:      "SpeedZ",
+    _DJIPitch:       "Pitch",
+    _DJIYaw:         "Yaw",
+    _DJIRoll:        "Roll",
+    _DJICameraPitch: "CameraPitch",
+    _DJICameraYaw:   "CameraYaw",
+    _DJICameraRoll:  "CameraRoll",
+}
+
+// ricohTagNames gives the names of known Ricoh maker note tags
+var ricohTagNames = map[tTag]string{
+    _RicohMakerNoteType:    "MakerNoteType",
+    _RicohFirmwareVersion:  "FirmwareVersion",
+    _RicohRecordingFormat:  "RecordingFormat",
+    _RicohDriveMode:        "DriveMode",
+    _RicohSharpness:        "Sharpness",
+}
+
+// makerTagNames gives the known maker note tags, by maker note vendor
+var makerTagNames = map[string]map[tTag]string{
+    "Apple": appleTagNames,
+    "Nikon": nikonTagNames,
+    "DJI":   djiTagNames,
+    "Ricoh": ricohTagNames,
+}
+
+// getTagName returns the name of tag in the ifd id of d, and true if the tag
+// is known in that ifd.
+func (d *Desc) getTagName( id IfdId, tag tTag ) (string, bool) {
+    var names map[tTag]string
+    switch id {
+    case PRIMARY, THUMBNAIL, EXIF:
+        names = tiffTagNames
+    case GPS:
+        names = gpsTagNames
+    case IOP:
+        names = iopTagNames
+    case MAKER:
+        names = makerTagNames[d.stats.MakerNote]
+    default:
+        if d.isEmbedded( id ) {
+            names = tiffTagNames
+        }
+    }
+    name, ok := names[tag]
+    return name, ok
+}
+
+// TagName returns the name of tag in the ifd id, as defined by the standards
+// or, for the MAKER ifd, as known for the maker note vendor, and true if the
+// tag is known. Known tags may not be supported: such tags are kept as
+// unknown entries and counted as Unsupported in IfdStats.
+func (d *Desc)TagName( id IfdId, tag uint16 ) (string, bool) {
+    return d.getTagName( id, tTag(tag) )
+}
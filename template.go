@@ -0,0 +1,104 @@
+package exif
+
+// support for template driven formatting
+
+import (
+    "fmt"
+    "io"
+    "math"
+    "strings"
+    "text/template"
+)
+
+/*
+    FormatTemplate executes a text/template with a TemplateData, which gives
+    the common photo information returned by Summary and the text of each tag
+    value, as printed by Format, indexed by IFD and tag names. IFD and tag
+    names are used without space, dash or underscore so that they can be used
+    directly in templates, for instance:
+
+      {{.Model}}: f/{{.FNumber}} {{.ShutterSpeed}}s ISO {{.ISO}} @ {{.FocalLength}}mm
+      {{.Tags.Exif.DateTimeOriginal}}
+      {{index .Tags "GPS" "Latitude"}}
+*/
+
+// TemplateData is the data given to templates by FormatTemplate
+type TemplateData struct {
+    Metadata                            // as returned by Summary
+    Tags    map[string]map[string]string // tag value text by IFD and tag names
+}
+
+// ShutterSpeed returns the exposure time as a fraction of a second, e.g.
+// "1/500", or in seconds if it is longer than half a second, e.g. "2.5".
+// It returns an empty string if the exposure time is unknown.
+func (m Metadata) ShutterSpeed( ) string {
+    switch {
+    case m.ExposureTime <= 0:
+        return ""
+    case m.ExposureTime > 0.5:
+        return fmt.Sprintf( "%g", m.ExposureTime )
+    }
+    return fmt.Sprintf( "1/%d", int(math.Round( 1 / m.ExposureTime )) )
+}
+
+// getTemplateName returns name without space, dash or underscore
+func getTemplateName( name string ) string {
+    return strings.Map( func( r rune ) rune {
+        switch r {
+        case ' ', '-', '_':
+            return -1
+        }
+        return r
+    }, name )
+}
+
+// getValueText returns the text of a value as printed by Format, without its
+// name and indentation, or an empty string if it has no text.
+func (d *Desc) getValueText( v serializer ) string {
+    var b strings.Builder
+    v.format( newCumulativeWriter( &b, d ) )
+    s := b.String( )
+    if i := strings.IndexByte( s, '\n' ); i != -1 {
+        s = s[i+1:]                         // skip name line
+    }
+    return strings.TrimSpace( s )
+}
+
+// getTemplateData returns the data given to templates
+func (d *Desc) getTemplateData( ) *TemplateData {
+    td := &TemplateData{ Metadata: d.Summary( ),
+                         Tags: make( map[string]map[string]string ) }
+    for id := PRIMARY; id < d.ifdCount(); id++ {
+        ifd := d.getIfd( id )
+        if ifd == nil {
+            continue
+        }
+        tags := make( map[string]string )
+        for _, v := range ifd.values {
+            if v == nil {
+                continue
+            }
+            if text := d.getValueText( v ); text != "" {
+                tags[getTemplateName( v.getName( ) )] = text
+            }
+        }
+        td.Tags[getTemplateName( d.IfdName(id) )] = tags
+    }
+    return td
+}
+
+// FormatTemplate executes the template tmpl with a TemplateData built from
+// the metadata and writes the result to w. This allows rendering captions or
+// watermarks directly from the metadata.
+//
+// It returns the number of bytes written and any template execution or write
+// error encountered.
+func (d *Desc)FormatTemplate( w io.Writer,
+                              tmpl *template.Template ) (n int, err error) {
+    cw := newCumulativeWriter( w, d )
+    if err = tmpl.Execute( cw, d.getTemplateData( ) ); err != nil {
+        err = fmt.Errorf( "FormatTemplate: %w", err )
+    }
+    n, _ = cw.result()
+    return
+}
@@ -0,0 +1,409 @@
+package exif
+
+// support for modifying metadata
+
+import (
+    "fmt"
+    "bytes"
+    "strings"
+    "time"
+    "unicode/utf8"
+)
+
+/*
+    Values are created with the same constructors as during parsing, which take
+    their entry tag and type from the current ifd entry (ifd.fTag, ifd.fType).
+    When modifying metadata, newEntry sets them before calling a constructor,
+    and setValue replaces the existing value or inserts the new one, keeping
+    entries in increasing tag order as required by TIFF.
+*/
+
+// newEntry prepares the ifd for creating a new value with tag and type. The
+// new value does not come from parsing and therefore has no source.
+func (ifd *ifdd) newEntry( tag tTag, t tType ) {
+    ifd.fTag = tag
+    ifd.fType = t
+    ifd.sOffset = 0
+}
+
+// getValue returns the current value for tag in the ifd, or nil if absent
+func (ifd *ifdd) getValue( tag tTag ) serializer {
+    for _, v := range ifd.values {
+        if v != nil && v.getTag() == tag {
+            return v
+        }
+    }
+    return nil
+}
+
+// setValue stores value in the ifd, replacing the current value for the same
+// tag if any, or inserting it in increasing tag order otherwise.
+func (ifd *ifdd) setValue( value serializer ) {
+    tag := value.getTag()
+    i := 0
+    for ; i < len(ifd.values); i++ {
+        v := ifd.values[i]
+        if v == nil {
+            continue
+        }
+        if t := v.getTag(); t == tag {
+            ifd.values[i] = value
+            return
+        } else if t > tag {
+            break
+        }
+    }
+    ifd.values = append( ifd.values, nil )
+    copy( ifd.values[i+1:], ifd.values[i:] )
+    ifd.values[i] = value
+}
+
+// getExifIfd returns the Exif IFD. If it does not exist and Control CreateExif
+// is set, it is created with an ExifVersion 0232 and linked to the primary
+// IFD, as scanned TIFF images often lack an Exif IFD. Otherwise, an error is
+// returned.
+func (d *Desc) getExifIfd( ) (*ifdd, error) {
+    if exif := d.ifds[EXIF]; exif != nil {
+        return exif, nil
+    }
+    if ! d.CreateExif {
+        return nil, fmt.Errorf( "Exif %w\n", ErrIfdNotPresent )
+    }
+    primary := d.ifds[PRIMARY]
+    if primary == nil {
+        return nil, fmt.Errorf( "Primary %w\n", ErrIfdNotPresent )
+    }
+    exif := primary.newEmbeddedIfd( EXIF, _ExifIFD )
+    exif.newEntry( _ExifVersion, _Undefined )
+    exif.setValue( exif.newAsciiStringValue( "Exif Version", []byte( "0232" ) ) )
+    return exif, nil
+}
+
+// newEmbeddedIfd creates an empty ifd in the namespace id, and links it to the
+// ifd with the pointer tag.
+func (ifd *ifdd) newEmbeddedIfd( id IfdId, tag tTag ) *ifdd {
+    embedded := new( ifdd )
+    embedded.id = id
+    embedded.desc = ifd.desc
+    ifd.newEntry( tag, _UnsignedLong )
+    ifd.setValue( ifd.newIfdValue( embedded ) )
+    ifd.desc.ifds[id] = embedded
+    return embedded
+}
+
+// setThumbnail replaces the JPEG thumbnail data in the ifd, and updates its
+// length accordingly. It returns false if the ifd has no JPEG thumbnail.
+func (ifd *ifdd) setThumbnail( data []byte ) bool {
+    tbn, ok := ifd.getValue( _JPEGInterchangeFormat ).(*thumbnailValue)
+    if ! ok {
+        return false
+    }
+    if l, ok := ifd.getValue( _JPEGInterchangeFormatLength ).(*unsignedLongValue); ok {
+        l.v = []uint32{ uint32(len(data)) }
+    }
+    tbn.v = data
+    return true
+}
+
+// setDimension sets a single SHORT value if v fits in 16 bits, or a single
+// LONG value otherwise.
+func (ifd *ifdd) setDimension( tag tTag, name string,
+                               f tFormatter,
+                               v uint32 ) {
+    if v <= 0xffff {
+        ifd.newEntry( tag, _UnsignedShort )
+        ifd.setValue( ifd.newUnsignedShortValue( name, f, []uint16{ uint16(v) } ) )
+    } else {
+        ifd.newEntry( tag, _UnsignedLong )
+        ifd.setValue( ifd.newUnsignedLongValue( name, f, []uint32{ v } ) )
+    }
+}
+
+// SetPixelDimensions updates the image dimensions after the image has been
+// resized. It takes the new width (w) and height (h) in pixels.
+//
+// It sets PixelXDimension and PixelYDimension in the Exif IFD, and updates
+// ImageWidth and ImageLength in the primary IFD if they are present. Each
+// value is stored as SHORT if it fits in 16 bits, as LONG otherwise. The
+// thumbnail IFD describes the thumbnail image, and is not modified.
+//
+// It returns a non-nil error if the Exif IFD is not present, unless Control
+// CreateExif is set.
+func (d *Desc) SetPixelDimensions( w, h uint32 ) error {
+    exif, err := d.getExifIfd( )
+    if err != nil {
+        return fmt.Errorf( "SetPixelDimensions: %w", err )
+    }
+    exif.setDimension( _PixelXDimension, "PixelX Dimension", nil, w )
+    exif.setDimension( _PixelYDimension, "PixelY Dimension", nil, h )
+
+    if primary := d.ifds[PRIMARY]; primary != nil {
+        if primary.getValue( _ImageWidth ) != nil {
+            primary.setDimension( _ImageWidth, "Image Width", fmtImageSize, w )
+        }
+        if primary.getValue( _ImageLength ) != nil {
+            primary.setDimension( _ImageLength, "Image Length", fmtImageSize, h )
+        }
+    }
+    return nil
+}
+
+// getUnsignedInteger returns the first value of tag in the ifd, if it is
+// stored as SHORT or LONG, or false otherwise.
+func (ifd *ifdd) getUnsignedInteger( tag tTag ) (uint32, bool) {
+    switch v := ifd.getValue( tag ).(type) {
+    case *unsignedShortValue:
+        if len(v.v) > 0 {
+            return uint32(v.v[0]), true
+        }
+    case *unsignedLongValue:
+        if len(v.v) > 0 {
+            return v.v[0], true
+        }
+    }
+    return 0, false
+}
+
+// getAsciiString returns the string value of tag in the ifd, without its
+// terminating NUL, or false if tag is absent or is not an ASCII string.
+func (ifd *ifdd) getAsciiString( tag tTag ) (string, bool) {
+    if ub, ok := ifd.getValue( tag ).(*unsignedByteValue); ok && ub.s {
+        return string( bytes.TrimRight( ub.v, "\x00" ) ), true
+    }
+    return "", false
+}
+
+// setAsciiString sets the ASCII string value of tag in the ifd
+func (ifd *ifdd) setAsciiString( tag tTag, name string, s string ) {
+    ifd.newEntry( tag, _ASCIIString )
+    ifd.setValue( ifd.newAsciiStringValue( name, append( []byte(s), 0 ) ) )
+}
+
+const (
+    _historySeparator   = "; "
+    _maxHistoryEntries  = 16        // most recent ImageHistory entries kept
+)
+
+// lastHistoryField returns the last field of s, a list of fields separated by
+// _historySeparator.
+func lastHistoryField( s string ) string {
+    if i := strings.LastIndex( s, _historySeparator ); i != -1 {
+        return s[i+len(_historySeparator):]
+    }
+    return s
+}
+
+// AppendSoftware stamps the metadata with the identity of the software that
+// modifies it. It takes an identity string (e.g. "myapp 1.2").
+//
+// The identity is appended to the Software tag in the primary IFD, unless it
+// is already its last field, and an entry made of the current date and time
+// followed by the identity is appended to the ImageHistory tag, in order to
+// keep track of each rewrite. If the last entry is from the same identity, it
+// is replaced instead, and only the _maxHistoryEntries most recent entries are
+// kept, so that rewriting a file again and again does not grow the history.
+//
+// It returns a non-nil error if the identity is not a valid string, as for
+// SetDescription, or includes the "; " separator, if the resulting Software
+// or ImageHistory string would be too long, or if the primary IFD is not
+// present.
+func (d *Desc) AppendSoftware( identity string ) error {
+    err := d.checkAsciiString( identity )
+    if err == nil && strings.Contains( identity, _historySeparator ) {
+        err = fmt.Errorf( "identity includes %q\n", _historySeparator )
+    }
+    if err != nil {
+        return fmt.Errorf( "AppendSoftware: %w",
+                           &ValidationError{ PRIMARY, _Software, err } )
+    }
+    primary := d.ifds[PRIMARY]
+    if primary == nil {
+        return fmt.Errorf( "AppendSoftware: Primary %w\n", ErrIfdNotPresent )
+    }
+    sw, _ := primary.getAsciiString( _Software )
+    stamped := lastHistoryField( sw ) == identity
+    if ! stamped {
+        if sw != "" {
+            sw += _historySeparator
+        }
+        sw += identity
+        if err := d.checkAsciiString( sw ); err != nil {
+            return fmt.Errorf( "AppendSoftware: %w",
+                               &ValidationError{ PRIMARY, _Software, err } )
+        }
+    }
+
+    stamp := time.Now().Format( _exifDateTimeFormat )
+    var entries []string
+    if h, _ := primary.getAsciiString( _ImageHistory ); h != "" {
+        entries = strings.Split( h, _historySeparator )
+        last := entries[len(entries)-1]
+        if len(last) > len(stamp) && last[len(stamp)+1:] == identity {
+            entries = entries[:len(entries)-1]  // replaced by the new entry
+        }
+    }
+    entries = append( entries, stamp + " " + identity )
+    if len(entries) > _maxHistoryEntries {
+        entries = entries[len(entries)-_maxHistoryEntries:]
+    }
+    history := strings.Join( entries, _historySeparator )
+    if err := d.checkAsciiString( history ); err != nil {
+        return fmt.Errorf( "AppendSoftware: %w",
+                           &ValidationError{ PRIMARY, _ImageHistory, err } )
+    }
+    if ! stamped {
+        primary.setAsciiString( _Software, "Software", sw )
+    }
+    primary.setAsciiString( _ImageHistory, "Image History", history )
+    return nil
+}
+
+// stamped returns the descriptor to write: d itself if the Control Software
+// identity is empty or if the metadata is empty, otherwise a copy of d stamped
+// by AppendSoftware, so that writing d does not modify it and writing it
+// again does not stamp it twice.
+func (d *Desc) stamped( ) (*Desc, error) {
+    if d.Software == "" || d.root == nil {
+        return d, nil
+    }
+    c := d.Clone( )
+    if err := c.AppendSoftware( d.Software ); err != nil {
+        return nil, err
+    }
+    return c, nil
+}
+
+// a string must fit in a JPEG APP1 segment, with its TIFF header and IFD0
+const _maxAsciiLength = 0xffff - 2 - _originOffset - _headerSize -
+                        _ShortSize - _IfdEntrySize - _LongSize - 1
+
+// checkAsciiString verifies that s can be stored as a TIFF ASCII string: it
+// must not include any NUL character, must not be too long and must be made
+// of 7-bit ASCII characters, unless UTF-8 is allowed by Control.
+func (d *Desc) checkAsciiString( s string ) error {
+    if len(s) > _maxAsciiLength {
+        return fmt.Errorf( "string too long (%d bytes)\n", len(s) )
+    }
+    if strings.IndexByte( s, 0 ) != -1 {
+        return fmt.Errorf( "string includes a NUL character\n" )
+    }
+    if d.AllowUTF8 {
+        if ! utf8.ValidString( s ) {
+            return fmt.Errorf( "invalid UTF-8 string\n" )
+        }
+        return nil
+    }
+    for i := 0; i < len(s); i++ {
+        if s[i] >= 0x80 {
+            return fmt.Errorf( "non-ASCII character at position %d\n", i )
+        }
+    }
+    return nil
+}
+
+func (d *Desc) setPrimaryString( tag tTag, name string, s string ) error {
+    if err := d.checkAsciiString( s ); err != nil {
+        return &ValidationError{ PRIMARY, uint16(tag), err }
+    }
+    primary := d.ifds[PRIMARY]
+    if primary == nil {
+        return fmt.Errorf( "Primary %w\n", ErrIfdNotPresent )
+    }
+    primary.setAsciiString( tag, name, s )
+    return nil
+}
+
+// SetInkNames sets the InkNames tag in the primary IFD, creating it if it is
+// missing. InkNames is a single ASCII value made of one NUL terminated string
+// per ink, in the order of the ink channels. Each name must be valid as for
+// SetDescription.
+//
+// It returns a non-nil error if no name is given, if a name is not valid or
+// if the primary IFD is not present.
+func (d *Desc) SetInkNames( names []string ) (err error) {
+    defer func ( ) {
+        if err != nil { err = fmt.Errorf( "SetInkNames: %w", err ) }
+    }()
+    if len(names) == 0 {
+        return fmt.Errorf( "no ink name\n" )
+    }
+    size := 0
+    for _, name := range names {
+        if err = d.checkAsciiString( name ); err != nil {
+            return &ValidationError{ PRIMARY, _InkNames, err }
+        }
+        size += len(name) + 1
+    }
+    if size > _maxAsciiLength {
+        return &ValidationError{ PRIMARY, _InkNames,
+                    fmt.Errorf( "names too long (%d bytes)\n", size ) }
+    }
+    primary := d.ifds[PRIMARY]
+    if primary == nil {
+        return fmt.Errorf( "Primary %w\n", ErrIfdNotPresent )
+    }
+    primary.newEntry( _InkNames, _ASCIIString )
+    primary.setValue( primary.newAsciiStringValue( "Ink Names",
+                                                   joinAsciiStrings( names ) ) )
+    return nil
+}
+
+// SetDescription sets the ImageDescription tag in the primary IFD, creating
+// it if it is missing. The description must be 7-bit ASCII, unless UTF-8 is
+// allowed by Control (which is not standard but is understood by most
+// readers), and must not include NUL characters.
+//
+// It returns a non-nil error if the description is not valid or if the
+// primary IFD is not present.
+func (d *Desc) SetDescription( description string ) error {
+    if err := d.setPrimaryString( _ImageDescription, "Image Description",
+                                  description ); err != nil {
+        return fmt.Errorf( "SetDescription: %w", err )
+    }
+    return nil
+}
+
+// SetArtist sets the Artist tag in the primary IFD, as SetDescription does.
+func (d *Desc) SetArtist( artist string ) error {
+    if err := d.setPrimaryString( _Artist, "Artist", artist ); err != nil {
+        return fmt.Errorf( "SetArtist: %w", err )
+    }
+    return nil
+}
+
+// SetSecurityClassification sets the TIFF/EP SecurityClassification tag in
+// the primary IFD, as SetDescription does. The classification is normally
+// one of "T" (top secret), "S" (secret), "C" (confidential), "R" (restricted)
+// or "U" (unclassified), but other classification systems can be given as
+// free text.
+func (d *Desc) SetSecurityClassification( classification string ) error {
+    if err := d.setPrimaryString( _SecurityClassification,
+                                  "Security Classification",
+                                  classification ); err != nil {
+        return fmt.Errorf( "SetSecurityClassification: %w", err )
+    }
+    d.ifds[PRIMARY].getValue( _SecurityClassification ).(*unsignedByteValue).fpr =
+                                            formatSecurityClassification
+    return nil
+}
+
+// SetImageHistory sets the TIFF/EP ImageHistory tag in the primary IFD, as
+// SetDescription does, replacing any existing history. The history records
+// the processing applied to the image since it was captured. Use
+// AppendSoftware instead to add a new entry to the existing history.
+func (d *Desc) SetImageHistory( history string ) error {
+    if err := d.setPrimaryString( _ImageHistory, "Image History",
+                                  history ); err != nil {
+        return fmt.Errorf( "SetImageHistory: %w", err )
+    }
+    return nil
+}
+
+// SetCopyright sets the Copyright tag in the primary IFD, as SetDescription
+// does. The copyright is the photographer copyright.
+func (d *Desc) SetCopyright( copyright string ) error {
+    if err := d.setPrimaryString( _Copyright, "Copyright", copyright ); err != nil {
+        return fmt.Errorf( "SetCopyright: %w", err )
+    }
+    return nil
+}
@@ -0,0 +1,170 @@
+package exif
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// testSoftwareDesc returns metadata with a Software tag, parsed with the
+// Control Software identity "app 1.0"
+func testSoftwareDesc( t *testing.T ) *Desc {
+    e := binary.LittleEndian
+    ifd0 := []testEntry{
+        { _Make, uint16(_ASCIIString), 6, testString( "Nikon" ) },
+        { _Software, uint16(_ASCIIString), 6, testString( "fw 12" ) },
+    }
+    exif := []testEntry{
+        { _ExifVersion, uint16(_Undefined), 4, []byte( "0232" ) },
+    }
+    return testParse( t, testTiff( e, ifd0, exif ),
+                      &Control{ Software: "app 1.0" } )
+}
+
+// checkStamp checks that d is stamped once by "app 1.0"
+func checkStamp( t *testing.T, d *Desc, from string ) {
+    t.Helper( )
+    if sw, _ := d.ifds[PRIMARY].getAsciiString( _Software );
+       sw != "fw 12" + _historySeparator + "app 1.0" {
+        t.Errorf( "%s: Software %q", from, sw )
+    }
+    h, _ := d.ifds[PRIMARY].getAsciiString( _ImageHistory )
+    if strings.Count( h, "app 1.0" ) != 1 {
+        t.Errorf( "%s: ImageHistory %q", from, h )
+    }
+}
+
+// checkNotStamped checks that d was not modified by writing it
+func checkNotStamped( t *testing.T, d *Desc ) {
+    t.Helper( )
+    if sw, _ := d.ifds[PRIMARY].getAsciiString( _Software ); sw != "fw 12" {
+        t.Errorf( "written descriptor modified: Software %q", sw )
+    }
+    if _, ok := d.ifds[PRIMARY].getAsciiString( _ImageHistory ); ok {
+        t.Errorf( "written descriptor modified: ImageHistory added" )
+    }
+}
+
+func TestWriteStampsCopy( t *testing.T ) {
+    d := testSoftwareDesc( t )
+    dir := t.TempDir( )
+    for _, name := range []string{ "a.exif", "b.exif", "c.exv", "d.exv" } {
+        path := filepath.Join( dir, name )
+        var err error
+        if strings.HasSuffix( name, ".exv" ) {
+            _, err = d.WriteSidecar( path )
+        } else {
+            _, err = d.Write( path )
+        }
+        if err != nil {
+            t.Fatalf( "%s: %v", name, err )
+        }
+        w, err := ReadSidecar( path, &Control{ } )
+        if err != nil {
+            t.Fatalf( "%s: %v", name, err )
+        }
+        checkStamp( t, w, name )        // stamped once, even if written again
+    }
+    checkNotStamped( t, d )
+}
+
+func TestUpdateJpegStamps( t *testing.T ) {
+    d := testSoftwareDesc( t )
+    img := testJpegImage( t, 8, 8 )
+    for i := 0; i < 2; i++ {
+        var b bytes.Buffer
+        if _, err := d.UpdateJpeg( &b, img, false ); err != nil {
+            t.Fatalf( "UpdateJpeg: %v", err )
+        }
+        w, err := parseJpeg( b.Bytes( ), 0, &Control{ } )
+        if err != nil {
+            t.Fatalf( "parseJpeg: %v", err )
+        }
+        checkStamp( t, w, "UpdateJpeg" )
+    }
+    checkNotStamped( t, d )
+
+    var b bytes.Buffer
+    if err := EncodeWithMetadata( &b, testImage( 8, 8 ), d, nil ); err != nil {
+        t.Fatalf( "EncodeWithMetadata: %v", err )
+    }
+    w, err := parseJpeg( b.Bytes( ), 0, &Control{ } )
+    if err != nil {
+        t.Fatalf( "parseJpeg: %v", err )
+    }
+    checkStamp( t, w, "EncodeWithMetadata" )
+    checkNotStamped( t, d )
+}
+
+func TestAppendSoftwareField( t *testing.T ) {
+    for _, c := range []struct {
+        software, identity, want    string
+    } {
+        { "", "Tool", "Tool" },
+        { "Tool", "Tool", "Tool" },
+        { "ProTool", "Tool", "ProTool; Tool" },
+        { "Tool; fw 1", "Tool", "Tool; fw 1; Tool" },
+        { "fw 1; Tool", "Tool", "fw 1; Tool" },
+    } {
+        d := testParse( t, testTiff( binary.BigEndian, nil, nil ), &Control{ } )
+        if c.software != "" {
+            d.ifds[PRIMARY].setAsciiString( _Software, "Software", c.software )
+        }
+        if err := d.AppendSoftware( c.identity ); err != nil {
+            t.Fatalf( "%q: %v", c.software, err )
+        }
+        if sw, _ := d.ifds[PRIMARY].getAsciiString( _Software ); sw != c.want {
+            t.Errorf( "%q + %q: Software %q instead of %q",
+                      c.software, c.identity, sw, c.want )
+        }
+    }
+}
+
+func TestAppendSoftwareHistory( t *testing.T ) {
+    d := testParse( t, testTiff( binary.BigEndian, nil, nil ), &Control{ } )
+    history := func( ) []string {
+        h, _ := d.ifds[PRIMARY].getAsciiString( _ImageHistory )
+        return strings.Split( h, _historySeparator )
+    }
+    for i := 0; i < 3; i++ {            // rewrites by the same tool
+        if err := d.AppendSoftware( "app" ); err != nil {
+            t.Fatal( err )
+        }
+    }
+    if h := history( ); len(h) != 1 || ! strings.HasSuffix( h[0], " app" ) {
+        t.Errorf( "same identity: history %q", h )
+    }
+    for i := 0; i < 2 * _maxHistoryEntries; i++ {
+        if err := d.AppendSoftware( fmt.Sprintf( "app %d", i ) ); err != nil {
+            t.Fatal( err )
+        }
+    }
+    h := history( )
+    last := fmt.Sprintf( " app %d", 2 * _maxHistoryEntries - 1 )
+    if len(h) != _maxHistoryEntries || ! strings.HasSuffix( h[len(h)-1], last ) {
+        t.Errorf( "history of %d entries, last %q", len(h), h[len(h)-1] )
+    }
+}
+
+func TestAppendSoftwareInvalid( t *testing.T ) {
+    d := testParse( t, testTiff( binary.BigEndian, nil, nil ), &Control{ } )
+    long := strings.Repeat( "x", _maxAsciiLength - 2 )
+    d.ifds[PRIMARY].setAsciiString( _Software, "Software", long )
+    for _, identity := range []string{ "a; b", "app" } {
+        err := d.AppendSoftware( identity )
+        var ve *ValidationError
+        if ! errors.As( err, &ve ) || ve.Tag != _Software {
+            t.Errorf( "%q: error %v", identity, err )
+        }
+    }
+    if sw, _ := d.ifds[PRIMARY].getAsciiString( _Software ); sw != long {
+        t.Errorf( "Software modified on error" )
+    }
+    if _, ok := d.ifds[PRIMARY].getAsciiString( _ImageHistory ); ok {
+        t.Errorf( "ImageHistory added on error" )
+    }
+}
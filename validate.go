@@ -0,0 +1,90 @@
+package exif
+
+// support for checking the consistency of metadata
+
+import (
+    "fmt"
+)
+
+/*
+    Validate checks that related pieces of metadata agree with each other,
+    beyond the checks done on each entry while parsing. Each inconsistency is
+    reported as a ValidationError giving the IFD and tag to correct. When
+    asked, Validate corrects the tags to match the actual data.
+
+    Checks:
+    - the Exif thumbnail Compression, ImageWidth and ImageLength tags agree
+      with the thumbnail JPEG data (frame header), and the thumbnail
+      Orientation agrees with the primary image Orientation.
+    - values of tags with a restricted set of values, such as Orientation or
+      ColorSpace, are within spec (see tagConstraints). Out-of-spec values
+      are reported but not corrected, since the right value is not known.
+*/
+
+// Validate checks the consistency of the metadata and returns the list of
+// inconsistencies found, each as a *ValidationError, or nil if none is found.
+// If fix is true, the inconsistent tags are corrected to match the actual
+// data, and the returned errors indicate what was corrected.
+func (d *Desc)Validate( fix bool ) (errs []error) {
+    errs = append( errs, d.validateConstraints( true )... )
+    errs = append( errs, d.validateThumbnail( fix )... )
+    return
+}
+
+// validateThumbnail checks the thumbnail IFD tags against the thumbnail data
+func (d *Desc)validateThumbnail( fix bool ) (errs []error) {
+    ifd := d.ifds[THUMBNAIL]
+    if ifd == nil {
+        return
+    }
+    report := func( tag tTag, format string, args ...interface{} ) {
+        errs = append( errs, &ValidationError{ THUMBNAIL, uint16(tag),
+                                               fmt.Errorf( format, args... ) } )
+    }
+
+    if o, ok := ifd.getUnsignedInteger( _Orientation ); ok {
+        if primary := d.ifds[PRIMARY]; primary != nil {
+            if po, ok := primary.getUnsignedInteger( _Orientation ); ok && po != o {
+                report( _Orientation, "thumbnail orientation %d instead of %d\n",
+                        o, po )
+                if fix && checkConstraint( THUMBNAIL, _Orientation, po ) == nil {
+                    ifd.newEntry( _Orientation, _UnsignedShort )
+                    ifd.setValue( ifd.newUnsignedShortValue( "Orientation",
+                                    ifd.fmtEnum( _Orientation, "orientation" ),
+                                    []uint16{ uint16(po) } ) )
+                }
+            }
+        }
+    }
+
+    data, err := d.GetThumbnailData( THUMBNAIL )
+    if err != nil || ! isJpeg( data, 0 ) {
+        return                  // only JPEG thumbnails can be checked
+    }
+    if c, ok := ifd.getUnsignedInteger( _Compression ); ok && c != 6 {
+        report( _Compression, "thumbnail compression %d for JPEG data\n", c )
+        if fix {
+            ifd.newEntry( _Compression, _UnsignedShort )
+            ifd.setValue( ifd.newUnsignedShortValue( "Compression",
+                                ifd.fmtEnum( _Compression, "compression" ),
+                                []uint16{ 6 } ) )
+            d.global.thumbType = JPEG
+        }
+    }
+
+    w, h, ok := getJpegDimensions( data )
+    if ! ok {
+        return
+    }
+    checkDimension := func( tag tTag, name string, v uint32 ) {
+        if tv, ok := ifd.getUnsignedInteger( tag ); ok && tv != v {
+            report( tag, "thumbnail %s %d instead of %d\n", name, tv, v )
+            if fix {
+                ifd.setDimension( tag, name, fmtImageSize, v )
+            }
+        }
+    }
+    checkDimension( _ImageWidth, "Image Width", w )
+    checkDimension( _ImageLength, "Image Length", h )
+    return
+}
@@ -2,10 +2,13 @@ package exif
 
 import (
     "fmt"
-    "bytes"
     "encoding/binary"
     "io"
+    "strings"
+    "strconv"
+    "bytes"
     "reflect"
+    "unicode/utf16"
 )
 
 // common IFD entry structure (offset/value are specific to each value)
@@ -32,6 +35,9 @@ type tEntry struct {
     _SignedRational     => []SignedRational struct
     _Float              => []float32
     _Double             => []float64
+    _UnsignedLong8      => []uint64
+    _SignedLong8        => []int64
+    _IFD8               => []uint64
 
     Then those go types are saved as <type>Values:
     []uint8            -> unsignedByteValue for _UnsignedByte(s) & _ASCIIString
@@ -44,6 +50,10 @@ type tEntry struct {
     []int16            -> signedShortValue for _SignedShort(s)
     []int32            -> signedLongValue for _SignedLong(s)
     []SignedRational   -> signedRationalValue for _SignedRational(s)
+    []uint64           -> unsignedLong8Value for _UnsignedLong8(s) & _IFD8(s)
+    []int64            -> signedLong8Value for _SignedLong8(s)
+    []float32          -> floatValue for _Float(s)
+    []float64          -> doubleValue for _Double(s)
 */
 
 // A tiffValue is defined as its entry definition followed by one of the
@@ -61,12 +71,50 @@ type serializer interface {
 // size written in the IFD data area or 0 if it fits in _valOffSize
     serializeData( w io.Writer ) error
 
+// return the size of the value in the IFD data area, 0 if it fits in the
+// entry. For embedded IFDs, this calculates the whole IFD layout.
+    getDataSize( ) uint32
+
 // implement tag specific formated print of the value
     format( w io.Writer )
 
 // return tag of the value
     getTag( ) tTag
-}
+
+// return name of the value, as used by format
+    getName( ) string
+
+// move the value to another ifd in the same desc
+    setIfd( ifd *ifdd )
+
+// return the original entry if the value was parsed, or the current type
+// and count with a 0 entry offset otherwise
+    getSource( ) tSource
+
+// forget the original entry after the value was modified in place, so that
+// it is checked as a value set by the application
+    setModified( )
+}
+
+// all values must implement the serializer interface
+var (
+    _ serializer = (*descValue)(nil)
+    _ serializer = (*ifdValue)(nil)
+    _ serializer = (*thumbnailValue)(nil)
+    _ serializer = (*unsignedByteValue)(nil)
+    _ serializer = (*signedByteValue)(nil)
+    _ serializer = (*unsignedShortValue)(nil)
+    _ serializer = (*signedShortValue)(nil)
+    _ serializer = (*unsignedLongValue)(nil)
+    _ serializer = (*signedLongValue)(nil)
+    _ serializer = (*unsignedLong8Value)(nil)
+    _ serializer = (*signedLong8Value)(nil)
+    _ serializer = (*floatValue)(nil)
+    _ serializer = (*doubleValue)(nil)
+    _ serializer = (*rawValue)(nil)
+    _ serializer = (*unsignedRationalValue)(nil)
+    _ serializer = (*signedRationalValue)(nil)
+)
 
 // All ifd.get<type> functions ignore the actual entry type and read <count> 
 // value of their type.
@@ -114,6 +162,38 @@ func (ifd *ifdd) getUnsignedLongs( ) []uint32 {
     }
 }
 
+func (ifd *ifdd) getSignedLongs( ) []int32 {
+    if ifd.fCount * _LongSize <= 4 {
+        return ifd.desc.getSignedLongs( ifd.sOffset, ifd.fCount )
+    } else {
+        rOffset := ifd.desc.getUnsignedLong( ifd.sOffset )
+        return ifd.desc.getSignedLongs( rOffset, ifd.fCount )
+    }
+}
+
+// getRawBytes ignores the entry type and returns its raw value if it can be
+// decoded, or the 4-byte entry value/offset field if it cannot (unknown type
+// or value out of bounds).
+func (ifd *ifdd) getRawBytes( ) []byte {
+    size, err := ifd.checkEntryData( )
+    if err != nil || size <= _valOffSize {
+        return ifd.desc.getUnsignedBytes( ifd.sOffset, _valOffSize )
+    }
+    rOffset := ifd.desc.getUnsignedLong( ifd.sOffset )
+    return ifd.desc.getUnsignedBytes( rOffset, size )
+}
+
+// validateCount returns an error if the entry count is less than min or
+// greater than max, where name identifies the entry. A max of 0 means that
+// the count has no maximum, so that validateCount( name, 0, 0 ) accepts any
+// count and validateCount( name, n, n ) requires exactly n values if n > 0.
+func (ifd *ifdd) validateCount( name string, min, max uint32 ) error {
+    if ifd.fCount < min || ( max != 0 && ifd.fCount > max ) {
+        return fmt.Errorf( "%s: incorrect count (%d)\n", name, ifd.fCount )
+    }
+    return nil
+}
+
 // All ifd.check<type> functions check the entry type (and sometimes count)
 // and return an error if it does not match expectations, otherwise return
 // the corresponding value
@@ -123,9 +203,8 @@ func (ifd *ifdd) checkUnsignedBytes( count uint32 ) ([]uint8, error) {
         return nil, fmt.Errorf( "checkUnsignedBytes: incorrect type (%s)\n",
                                 getTiffTString( ifd.fType ) )
     }
-    if count != 0 && count != ifd.fCount {
-        return nil, fmt.Errorf( "checkUnsignedBytes: incorrect count (%d)\n",
-                                ifd.fCount )
+    if err := ifd.validateCount( "checkUnsignedBytes", count, count ); err != nil {
+        return nil, err
     }
     return ifd.getUnsignedBytes( ), nil
 }
@@ -135,67 +214,275 @@ func (ifd *ifdd) checkSignedBytes( count uint32 ) ([]int8, error) {
         return nil, fmt.Errorf( "checkSignedBytes: incorrect type (%s)\n",
                                 getTiffTString( ifd.fType ) )
     }
-    if count != 0 && count != ifd.fCount {
-        return nil, fmt.Errorf( "checkSignedBytes: incorrect count (%d)\n",
-                                ifd.fCount )
+    if err := ifd.validateCount( "checkSignedBytes", count, count ); err != nil {
+        return nil, err
     }
     return ifd.getSignedBytes( ), nil
 }
 
+// In lenient mode, some common vendor mistakes are fixed instead of failing:
+// integer types of the same signedness are coerced into the expected type if
+// the values fit. The entry type is then updated so that the value is stored
+// with the type it was coerced into.
+func (ifd *ifdd) lenientWarning( format string, a ...interface{} ) {
+    ifd.desc.stats.getIfd( ifd.id ).Coerced ++
+    if ifd.desc.Warn {
+        ifd.desc.logf( LogWarning, "%s: Warning: tag %#04x %s",
+                       ifd.desc.IfdName(ifd.id), ifd.fTag, fmt.Sprintf( format, a... ) )
+    }
+}
+
+func (ifd *ifdd) coerce( to tType ) {
+    ifd.lenientWarning( "coerced from %s to %s\n",
+                        getTiffTString( ifd.fType ), getTiffTString( to ) )
+    ifd.fType = to
+}
+
+// ASCII string counts do not always match their content. A count too short
+// for the terminating NUL, or an empty string, is extended by adding the NUL
+// so that the string is written with the correct count. A count too long,
+// leaving bytes other than NUL padding after the first NUL, is truncated
+// after that NUL, except for tags made of several NUL terminated strings, in
+// order to avoid formatting or writing garbage. Trailing NUL padding is kept.
+func (ifd *ifdd) asciiWarning( format string, a ...interface{} ) {
+    ifd.desc.stats.getIfd( ifd.id ).Normalized ++
+    if ifd.desc.Warn {
+        ifd.desc.logf( LogWarning, "%s: Warning: tag %#04x %s",
+                       ifd.desc.IfdName(ifd.id), ifd.fTag, fmt.Sprintf( format, a... ) )
+    }
+}
+
+// isMultiString returns true if the current entry is an ASCII value made of
+// several NUL terminated strings.
+func (ifd *ifdd) isMultiString( ) bool {
+    return ifd.fTag == _InkNames && (ifd.id == PRIMARY || ifd.id == THUMBNAIL)
+}
+
+// normalizeAsciiString returns text with a count matching its content
+func (ifd *ifdd) normalizeAsciiString( text []byte ) []byte {
+    n := len(text)
+    if ! ifd.isMultiString( ) {
+        end := bytes.IndexByte( text, 0 ) + 1
+        if end > 0 && len(bytes.TrimRight( text[end:], "\x00" )) != 0 {
+            ifd.asciiWarning( "ASCII string count %d truncated to %d\n", n, end )
+            return text[:end:end]
+        }
+    }
+    if n == 0 || text[n-1] != 0 {
+        ifd.asciiWarning( "ASCII string count %d without terminating NUL\n", n )
+        return append( text[:n:n], 0 )
+    }
+    return text
+}
+
 func (ifd *ifdd) checkTiffAsciiString( ) ([]byte, error) {
     if ifd.fType != _ASCIIString {
         return nil, fmt.Errorf( "checkTiffAsciiString: incorrect type (%s)\n",
                                 getTiffTString( ifd.fType ) )
     }
-    return ifd.getUnsignedBytes( ), nil
+    return ifd.normalizeAsciiString( ifd.getUnsignedBytes( ) ), nil
+}
+
+// lenientUnsignedShorts returns the entry values as unsigned shorts if the
+// entry type is another unsigned integer type and all values fit.
+func (ifd *ifdd) lenientUnsignedShorts( ) ([]uint16, bool) {
+    var values []uint16
+    switch ifd.fType {
+    case _UnsignedByte:
+        for _, v := range ifd.getUnsignedBytes( ) {
+            values = append( values, uint16(v) )
+        }
+    case _UnsignedLong:
+        for _, v := range ifd.getUnsignedLongs( ) {
+            if v > 0xffff {
+                return nil, false
+            }
+            values = append( values, uint16(v) )
+        }
+    default:
+        return nil, false
+    }
+    ifd.coerce( _UnsignedShort )
+    return values, true
+}
+
+func (ifd *ifdd) lenientUnsignedLongs( ) ([]uint32, bool) {
+    var values []uint32
+    switch ifd.fType {
+    case _UnsignedByte:
+        for _, v := range ifd.getUnsignedBytes( ) {
+            values = append( values, uint32(v) )
+        }
+    case _UnsignedShort:
+        for _, v := range ifd.getUnsignedShorts( ) {
+            values = append( values, uint32(v) )
+        }
+    default:
+        return nil, false
+    }
+    ifd.coerce( _UnsignedLong )
+    return values, true
+}
+
+func (ifd *ifdd) lenientSignedShorts( ) ([]int16, bool) {
+    var values []int16
+    switch ifd.fType {
+    case _SignedByte:
+        for _, v := range ifd.getSignedBytes( ) {
+            values = append( values, int16(v) )
+        }
+    case _SignedLong:
+        for _, v := range ifd.getSignedLongs( ) {
+            if v > 0x7fff || v < -0x8000 {
+                return nil, false
+            }
+            values = append( values, int16(v) )
+        }
+    default:
+        return nil, false
+    }
+    ifd.coerce( _SignedShort )
+    return values, true
+}
+
+func (ifd *ifdd) lenientSignedLongs( ) ([]int32, bool) {
+    var values []int32
+    switch ifd.fType {
+    case _SignedByte:
+        for _, v := range ifd.getSignedBytes( ) {
+            values = append( values, int32(v) )
+        }
+    case _SignedShort:
+        for _, v := range ifd.getSignedShorts( ) {
+            values = append( values, int32(v) )
+        }
+    default:
+        return nil, false
+    }
+    ifd.coerce( _SignedLong )
+    return values, true
 }
 
 func (ifd *ifdd) checkUnsignedShorts( count uint32 ) ([]uint16, error) {
+    if ifd.desc.Lenient && ifd.fType != _UnsignedShort &&
+       ( count == 0 || count == ifd.fCount ) {
+        if values, ok := ifd.lenientUnsignedShorts( ); ok {
+            return values, nil
+        }
+    }
     if ifd.fType != _UnsignedShort {
         return nil, fmt.Errorf( "checkUnsignedShorts: incorrect type (%s)\n",
                                 getTiffTString( ifd.fType ) )
     }
-    if count != 0 && count != ifd.fCount {
-        return nil, fmt.Errorf( "checkUnsignedShorts: incorrect count (%d)\n",
-                                ifd.fCount )
+    if err := ifd.validateCount( "checkUnsignedShorts", count, count ); err != nil {
+        return nil, err
     }
     return ifd.getUnsignedShorts( ), nil
 }
 
 func (ifd *ifdd) checkSignedShorts( count uint32 ) ([]int16, error) {
+    if ifd.desc.Lenient && ifd.fType != _SignedShort &&
+       ( count == 0 || count == ifd.fCount ) {
+        if values, ok := ifd.lenientSignedShorts( ); ok {
+            return values, nil
+        }
+    }
     if ifd.fType != _SignedShort {
         return nil, fmt.Errorf( "checkSignedShorts: incorrect type (%s)\n",
                                 getTiffTString( ifd.fType ) )
     }
-    if count != 0 && count != ifd.fCount {
-        return nil, fmt.Errorf( "checkSignedShorts: incorrect count (%d)\n",
-                                ifd.fCount )
+    if err := ifd.validateCount( "checkSignedShorts", count, count ); err != nil {
+        return nil, err
     }
     return ifd.getSignedShorts( ), nil
 }
 
 func (ifd *ifdd) checkUnsignedLongs( count uint32 ) ([]uint32, error) {
+    if ifd.desc.Lenient && ifd.fType != _UnsignedLong &&
+       ( count == 0 || count == ifd.fCount ) {
+        if values, ok := ifd.lenientUnsignedLongs( ); ok {
+            return values, nil
+        }
+    }
     if ifd.fType != _UnsignedLong {
         return nil, fmt.Errorf( "checkUnsignedLongs: incorrect type (%s)\n",
                             getTiffTString( ifd.fType ) )
     }
-    if count != 0 && count != ifd.fCount {
-        return nil, fmt.Errorf( "checkUnsignedLongs: incorrect count (%d)\n",
-                                ifd.fCount )
+    if err := ifd.validateCount( "checkUnsignedLongs", count, count ); err != nil {
+        return nil, err
     }
-    return ifd.desc.getUnsignedLongs( ifd.sOffset, ifd.fCount ), nil
+    return ifd.getUnsignedLongs( ), nil
 }
 
 func (ifd *ifdd) checkSignedLongs( count uint32 ) ([]int32, error) {
+    if ifd.desc.Lenient && ifd.fType != _SignedLong &&
+       ( count == 0 || count == ifd.fCount ) {
+        if values, ok := ifd.lenientSignedLongs( ); ok {
+            return values, nil
+        }
+    }
     if ifd.fType != _SignedLong {
         return nil, fmt.Errorf( "checkSignedLongs: incorrect type (%s)\n",
                             getTiffTString( ifd.fType ) )
     }
-    if count != 0 && count != ifd.fCount {
-        return nil, fmt.Errorf( "checkSignedLongs: incorrect count (%d)\n",
-                                ifd.fCount )
+    if err := ifd.validateCount( "checkSignedLongs", count, count ); err != nil {
+        return nil, err
     }
-    return ifd.desc.getSignedLongs( ifd.sOffset, ifd.fCount ), nil
+    return ifd.getSignedLongs( ), nil
+}
+
+func (ifd *ifdd) checkUnsignedLong8s( count uint32 ) ([]uint64, error) {
+    if ifd.fType != _UnsignedLong8 && ifd.fType != _IFD8 {
+        return nil, fmt.Errorf( "checkUnsignedLong8s: incorrect type (%s)\n",
+                            getTiffTString( ifd.fType ) )
+    }
+    if err := ifd.validateCount( "checkUnsignedLong8s", count, count ); err != nil {
+        return nil, err
+    }
+    // a long8 never fits directly in valOffset (requires more than 4 bytes)
+    offset := ifd.desc.getUnsignedLong( ifd.sOffset )
+    return ifd.desc.getUnsignedLong8s( offset, ifd.fCount ), nil
+}
+
+func (ifd *ifdd) checkSignedLong8s( count uint32 ) ([]int64, error) {
+    if ifd.fType != _SignedLong8 {
+        return nil, fmt.Errorf( "checkSignedLong8s: incorrect type (%s)\n",
+                            getTiffTString( ifd.fType ) )
+    }
+    if err := ifd.validateCount( "checkSignedLong8s", count, count ); err != nil {
+        return nil, err
+    }
+    // a long8 never fits directly in valOffset (requires more than 4 bytes)
+    offset := ifd.desc.getUnsignedLong( ifd.sOffset )
+    return ifd.desc.getSignedLong8s( offset, ifd.fCount ), nil
+}
+
+func (ifd *ifdd) checkFloats( count uint32 ) ([]float32, error) {
+    if ifd.fType != _Float {
+        return nil, fmt.Errorf( "checkFloats: incorrect type (%s)\n",
+                            getTiffTString( ifd.fType ) )
+    }
+    if err := ifd.validateCount( "checkFloats", count, count ); err != nil {
+        return nil, err
+    }
+    if ifd.fCount * _FloatSize <= 4 {
+        return ifd.desc.getFloats( ifd.sOffset, ifd.fCount ), nil
+    }
+    offset := ifd.desc.getUnsignedLong( ifd.sOffset )
+    return ifd.desc.getFloats( offset, ifd.fCount ), nil
+}
+
+func (ifd *ifdd) checkDoubles( count uint32 ) ([]float64, error) {
+    if ifd.fType != _Double {
+        return nil, fmt.Errorf( "checkDoubles: incorrect type (%s)\n",
+                            getTiffTString( ifd.fType ) )
+    }
+    if err := ifd.validateCount( "checkDoubles", count, count ); err != nil {
+        return nil, err
+    }
+    // a double never fits directly in valOffset (requires more than 4 bytes)
+    offset := ifd.desc.getUnsignedLong( ifd.sOffset )
+    return ifd.desc.getDoubles( offset, ifd.fCount ), nil
 }
 
 func (ifd *ifdd) checkUnsignedRationals( 
@@ -204,13 +491,21 @@ func (ifd *ifdd) checkUnsignedRationals(
         return nil, fmt.Errorf( "checkUnsignedRational: incorrect type (%s)\n",
                                 getTiffTString( ifd.fType ) )
     }
-    if count != 0 && count != ifd.fCount {
-        return nil, fmt.Errorf( "checkUnsignedRational: incorrect count (%d)\n",
-                                ifd.fCount )
+    if err := ifd.validateCount( "checkUnsignedRational", count, count ); err != nil {
+        return nil, err
     }
     // a rational never fits directly in valOffset (requires more than 4 bytes)
     offset := ifd.desc.getUnsignedLong( ifd.sOffset )
-    return ifd.desc.getUnsignedRationals( offset, ifd.fCount ), nil
+    v := ifd.desc.getUnsignedRationals( offset, ifd.fCount )
+    if ifd.desc.Strict {
+        for _, r := range v {
+            if r.Denominator == 0 && r.Numerator != 0 {
+                return nil, fmt.Errorf( "checkUnsignedRationals: %d/0: %w\n",
+                                        r.Numerator, ErrZeroDenominator )
+            }
+        }
+    }
+    return v, nil
 }
 
 func (ifd *ifdd) checkSignedRationals(
@@ -219,30 +514,87 @@ func (ifd *ifdd) checkSignedRationals(
         return nil, fmt.Errorf( "checkUnsignedRational: incorrect type (%s)\n",
                                 getTiffTString( ifd.fType ) )
     }
-    if count != 0 && count != ifd.fCount {
-        return nil, fmt.Errorf( "checkUnsignedRational: incorrect count (%d)\n",
-                                ifd.fCount )
+    if err := ifd.validateCount( "checkUnsignedRational", count, count ); err != nil {
+        return nil, err
     }
     // a rational never fits directly in valOffset (requires more than 4 bytes)
     offset := ifd.desc.getUnsignedLong( ifd.sOffset )
-    return ifd.desc.getSignedRationals( offset, ifd.fCount ), nil
+    v := ifd.desc.getSignedRationals( offset, ifd.fCount )
+    if ifd.desc.Strict {
+        for _, r := range v {
+            if r.Denominator == 0 && r.Numerator != 0 {
+                return nil, fmt.Errorf( "checkSignedRationals: %d/0: %w\n",
+                                        r.Numerator, ErrZeroDenominator )
+            }
+        }
+    }
+    return v, nil
+}
+
+// original entry, as found in the input data when parsing
+type tSource struct {
+    entry   uint32      // entry offset in desc data, 0 if not parsed
+    value   uint32      // value offset in desc data (in entry if it fits)
+    vType   tType       // original type
+    vCount  uint32      // original count
 }
 
+// getSource returns the source of the current ifd entry, or an empty source
+// if the entry was not parsed (see newEntry). Type and count are read again
+// from the entry, since they may have been coerced in lenient mode.
+func (ifd *ifdd) getSource( ) (src tSource) {
+    if ifd.sOffset == 0 {
+        return
+    }
+    src.entry = ifd.sOffset - 8
+    src.value = ifd.sOffset
+    src.vType = tType(ifd.desc.getUnsignedShort( ifd.sOffset - 6 ))
+    src.vCount = ifd.desc.getUnsignedLong( ifd.sOffset - 4 )
+    tSize, err := getTiffTypeSize( src.vType )
+    if err == nil && uint64(tSize) * uint64(src.vCount) > _valOffSize {
+        src.value = ifd.desc.getUnsignedLong( ifd.sOffset )
+    }
+    return
+}
+
+// Value specific format function, called with the ifd where the value is when
+// it is formatted, the value to print and the indentation to use in case of
+// multiple lines. Formatters must look up other tags in that ifd, not in the
+// ifd where the formatter was created, which may be a clone or merge source.
+type tFormatter func( ifd *ifdd, w io.Writer, v interface{}, indent string )
+
 // Common value structure to embed in specific value definition
 type tVal struct {
     ifd     *ifdd       // parent IFD
-    fpr     func(       // value specific print func
-              w io.Writer,
-              v interface{},
-              indent string )   // indentation in case of multiple lines
+    fpr     tFormatter  // value specific print func
     name    string      // value name
             tEntry      // common entry structure
+    src     tSource     // original entry, if parsed
 }
 
 func (tv *tVal)getTag( ) tTag {
     return tv.vTag
 }
 
+func (tv *tVal)getName( ) string {
+    return tv.name
+}
+
+func (tv *tVal)setIfd( ifd *ifdd ) {
+    tv.ifd = ifd
+}
+
+func (tv *tVal)setModified( ) {
+    tv.src = tSource{ }
+}
+
+func (tv *tVal)getSource( ) tSource {
+    if tv.src.entry == 0 {      // not parsed, give the current type & count
+        return tSource{ vType: tv.vType, vCount: tv.vCount }
+    }
+    return tv.src
+}
+
 // TIFF Value definitions - all values embed tVal and have actual data a v field
 
 type descValue struct {     // used for some maker notes
@@ -251,13 +603,13 @@ type descValue struct {     // used for some maker notes
     origin  uint32
     v      *Desc
 }
-func (ifd *ifdd) newDescValue( dVal *Desc, header string,
-                               origin uint32 ) (dv *descValue) {
+func (ifd *ifdd) newDescValue( dVal *Desc, header string ) (dv *descValue) {
     dv = new( descValue )
     dv.ifd = ifd
     dv.vTag = ifd.fTag
+    dv.src = ifd.getSource( )
     dv.vType = ifd.fType
-    dv.origin = origin
+    dv.origin = dVal.origin
 //  dv.vCount will be calculated when serializeEntry is called
     dv.header = header
     dv.v = dVal
@@ -265,27 +617,18 @@ func (ifd *ifdd) newDescValue( dVal *Desc, header string,
     return
 }
 
+// the maker note size is the header size plus the whole ifd size
+func (dv *descValue) getDataSize( ) uint32 {
+    return uint32(len(dv.header)) + dv.v.root.layout( )
+}
+
 func (dv *descValue) serializeEntry( w io.Writer ) (err error) {
-    sz := dv.v.root.dSize
-    if sz == 0 {
-        if dv.ifd.desc.SrlzDbg {
-            fmt.Printf( "%s ifd serializeEntry: Get %s ifd size @offset %#08x\n",
-                        GetIfdName(dv.ifd.id), GetIfdName(dv.v.root.id), dv.ifd.dOffset )
-        }
-        _, err = dv.v.root.serializeEntries( io.Discard, 0 )
-        if err != nil {
-            err = fmt.Errorf( "%s ifd serializeEntry: Get %s ifd size: %v",
-                              GetIfdName(dv.ifd.id), GetIfdName(dv.v.root.id), err )
-            return
-        }
-        sz = dv.v.root.dOffset + uint32(len(dv.header))
-        dv.v.root.dSize = sz
-    }
+    sz := uint32(len(dv.header)) + dv.v.root.dSize  // as given by layout
 
     dv.vCount = sz
     if dv.ifd.desc.SrlzDbg {
-        fmt.Printf( "%s ifd got embedded %s ifd size=%d\n",
-                    GetIfdName(dv.ifd.id), GetIfdName(dv.v.root.id), sz )
+        dv.ifd.desc.logf( LogDebug, "%s ifd got embedded %s ifd size=%d\n",
+                          dv.ifd.desc.IfdName(dv.ifd.id), dv.v.IfdName(dv.v.root.id), sz )
     }
 
     if err = binary.Write( w, dv.ifd.desc.endian, dv.tVal.tEntry ); err == nil {
@@ -297,8 +640,8 @@ func (dv *descValue) serializeEntry( w io.Writer ) (err error) {
 
 func (dv *descValue)serializeData( w io.Writer ) (err error) {
     if dv.ifd.desc.SrlzDbg {
-        fmt.Printf( "%s ifd Serialize in data whole %s ifd @offset %#08x\n",
-                    GetIfdName(dv.ifd.id), GetIfdName(dv.v.root.id), dv.ifd.dOffset )
+        dv.ifd.desc.logf( LogDebug, "%s ifd Serialize in data whole %s ifd @offset %#08x\n",
+                          dv.ifd.desc.IfdName(dv.ifd.id), dv.v.IfdName(dv.v.root.id), dv.ifd.dOffset )
     }
 
     _, err = w.Write( []byte( dv.header ) ) // including endian+0x002a+0x00000008
@@ -313,7 +656,7 @@ func (dv *descValue)serializeData( w io.Writer ) (err error) {
     if err != nil {
         return
     }
-    dv.ifd.dOffset += dv.v.root.dSize
+    dv.ifd.dOffset += uint32(len(dv.header)) + dv.v.root.dSize
     return
 }
 
@@ -322,46 +665,39 @@ func (dv *descValue)format( w io.Writer ) {
 }
 
 type ifdValue struct {
-        tVal
-    v   *ifdd           // embedded IFD
+            tVal
+    header  string      // maker note header preceding the IFD, if any
+    v       *ifdd       // embedded IFD
 }
 func (ifd *ifdd) newIfdValue( ifdVal *ifdd ) (iv *ifdValue) {
     iv = new( ifdValue )
     iv.ifd = ifd
     iv.vTag = ifd.fTag
+    iv.src = ifd.getSource( )
     iv.vType = ifd.fType
     iv.vCount = 1
     iv.v = ifdVal
     ifdVal.pValue = iv
     return
 }
+func (iv *ifdValue) getDataSize( ) uint32 {
+    return uint32(len(iv.header)) + iv.v.layout( )
+}
 func (iv *ifdValue) serializeEntry( w io.Writer ) (err error) {
     if iv == nil {
         panic("serializeEntry: nill entry")
     }
 
-    if err = binary.Write( w, iv.ifd.desc.endian, iv.tVal.tEntry ); err != nil {
-        return
+    sz := uint32(len(iv.header)) + iv.v.dSize  // as given by layout
+    if iv.ifd.desc.SrlzDbg {
+        iv.ifd.desc.logf( LogDebug, "%s ifd got embedded %s ifd size=%d\n",
+                          iv.ifd.desc.IfdName(iv.ifd.id), iv.ifd.desc.IfdName(iv.v.id), sz )
     }
-
-    sz := iv.v.dSize
-    if sz == 0 {
-        if iv.ifd.desc.SrlzDbg {
-            fmt.Printf( "%s ifd serializeEntry: Get %s ifd size @offset %#08x\n",
-                        GetIfdName(iv.ifd.id), GetIfdName(iv.v.id), iv.ifd.dOffset )
-        }
-        _, err = iv.v.serializeEntries( io.Discard, 0 )
-        if err != nil {
-            err = fmt.Errorf( "%s ifd serializeEntry: Get %s ifd size: %v\n",
-                        GetIfdName(iv.ifd.id), GetIfdName(iv.v.id), err )
-            return
-        }
-        sz = iv.v.dOffset   // since we serialized from offset 0
-        iv.v.dSize = sz     // save in case serializeEntry is called again
+    if iv.vType == _Undefined {     // maker note stored as a plain IFD
+        iv.vCount = sz
     }
-    if iv.ifd.desc.SrlzDbg {
-        fmt.Printf( "%s ifd got embedded %s ifd size=%d\n",
-                    GetIfdName(iv.ifd.id), GetIfdName(iv.v.id), sz )
+    if err = binary.Write( w, iv.ifd.desc.endian, iv.tVal.tEntry ); err != nil {
+        return
     }
     err = binary.Write( w, iv.ifd.desc.endian, iv.ifd.dOffset )
     iv.ifd.dOffset += sz
@@ -373,9 +709,13 @@ func (iv *ifdValue)serializeData( w io.Writer ) (err error) {
 
     }
     if iv.ifd.desc.SrlzDbg {
-        fmt.Printf( "%s ifd Serialize in data whole %s ifd @offset %#08x\n",
-                    GetIfdName(iv.ifd.id), GetIfdName(iv.v.id), iv.ifd.dOffset )
+        iv.ifd.desc.logf( LogDebug, "%s ifd Serialize in data whole %s ifd @offset %#08x\n",
+                          iv.ifd.desc.IfdName(iv.ifd.id), iv.ifd.desc.IfdName(iv.v.id), iv.ifd.dOffset )
     }
+    if _, err = w.Write( []byte( iv.header ) ); err != nil {
+        return
+    }
+    iv.ifd.dOffset += uint32(len(iv.header))
     var eSz, dSz uint32
     eSz, err = iv.v.serializeEntries( w, iv.ifd.dOffset )
     if err != nil {
@@ -400,6 +740,7 @@ func (ifd *ifdd) newThumbnailValue( tag tTag,
     tbn = new( thumbnailValue )
     tbn.ifd = ifd
     tbn.vTag = tag
+    tbn.src = ifd.desc.global.thumbSource
     tbn.vType = ifd.fType
     tbn.vCount = ifd.fCount
     tbn.v = tbnVal
@@ -421,120 +762,229 @@ func (tbn *thumbnailValue)serializeEntry( w io.Writer ) (err error) {
 func (tbn *thumbnailValue)serializeData( w io.Writer ) error {
     return tbn.ifd.serializeSliceData( w, tbn.v )
 }
+func (tbn *thumbnailValue)getDataSize( ) uint32 {
+    return tbn.ifd.getSliceAlignedDataSize( tbn.v )
+}
 func (ub *thumbnailValue)format( w io.Writer ) {
 }
 
-func formatValue( w io.Writer, name string, v interface{},
-                f func( io.Writer, interface{}, string ) ) {
-    if name != "" {
-        const indentation = "    "
-        fmt.Fprintf( w, "  %s:\n", name )
+// formatValue prints the value name, indented by one indentation unit, and
+// the value itself on the following lines, indented by two units. The value
+// is formatted with f in the context of its current ifd, so that formatters
+// looking up other tags find them where the value is now, for instance after
+// the value has been cloned or merged.
+func (tv *tVal) formatValue( w io.Writer, v interface{}, f tFormatter ) {
+    if tv.name != "" {
+        unit := getIndentUnit( w )
+        indentation := unit + unit
+        fmt.Fprintf( w, "%s%s:\n", unit, tv.name )
         io.WriteString( w, indentation )
-        f( w, v, indentation )
+        f( tv.ifd, w, v, indentation )
         io.WriteString( w, "\n\n" )
     }
 }
 
-func formatString( w io.Writer, v interface{}, indent string ) {
-    ubv := v.([]uint8)
-    ubs := bytes.TrimSuffix( ubv, []byte{0} )
-    ubs = bytes.Trim( ubs, " " )
+// formatList prints n items separated by commas. If the formatting context
+// gives a line width, lines are wrapped before reaching that width and the
+// following lines are indented with indent.
+func formatList( w io.Writer, indent string, n int, item func( i int ) string ) {
+    width := getFormatWidth( w )
+    col := len(indent)
+    for i := 0; i < n; i++ {
+        s := item( i )
+        if i > 0 {
+            if width > 0 && col + 2 + len(s) > width {
+                io.WriteString( w, ",\n" + indent )
+                col = len(indent)
+            } else {
+                io.WriteString( w, ", " )
+                col += 2
+            }
+        }
+        io.WriteString( w, s )
+        col += len(s)
+    }
+}
+
+// splitAsciiStrings returns the strings in an ASCII value, which may include
+// several NUL terminated strings (e.g. InkNames). Trailing NULs are taken as
+// padding, so that a single string is returned if there is no embedded NUL.
+func splitAsciiStrings( b []byte ) []string {
+    b = bytes.TrimRight( b, "\x00" )
+    if len(b) == 0 {
+        return nil
+    }
+    return strings.Split( string(b), "\x00" )
+}
+
+// joinAsciiStrings returns an ASCII value made of NUL terminated strings
+func joinAsciiStrings( s []string ) []byte {
+    var b []byte
+    for _, str := range s {
+        b = append( append( b, str... ), 0 )
+    }
+    return b
+}
+
+func formatString( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+    strs := splitAsciiStrings( v.([]uint8) )
+    if len(strs) > 1 {                      // multiple strings
+        formatList( w, indent, len(strs), func( i int ) string {
+            s, _ := decodeText( []byte(strs[i]) )
+            return strconv.Quote( s )
+        } )
+        return
+    }
+    ubs, _ := decodeText( v.([]uint8) )     // UTF-8 or Latin-1 if not ASCII
+    ubs = strings.Trim( ubs, " " )
     if len(ubs) == 0 {
         io.WriteString( w, "-" )
     } else {
-        io.WriteString( w, string( ubs ) )
+        io.WriteString( w, ubs )
     }
 }
 
-func formatUnsignedBytes( w io.Writer, v interface{}, indent string ) {
+// decodeXPString converts a Windows XP tag value (UTF-16LE, NUL terminated)
+// into a go string.
+func decodeXPString( b []byte ) string {
+    u := make( []uint16, 0, len(b)/2 )
+    for i := 0; i + 1 < len(b); i += 2 {
+        c := uint16(b[i]) | uint16(b[i+1]) << 8
+        if c == 0 {
+            break
+        }
+        u = append( u, c )
+    }
+    return string( utf16.Decode( u ) )
+}
+
+// encodeXPString converts a go string into a Windows XP tag value (UTF-16LE,
+// NUL terminated).
+func encodeXPString( s string ) []byte {
+    u := utf16.Encode( []rune( s ) )
+    b := make( []byte, 0, 2 * len(u) + 2 )
+    for _, c := range u {
+        b = append( b, byte(c), byte(c >> 8) )
+    }
+    return append( b, 0, 0 )
+}
+
+func formatXPString( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+    xps := strings.TrimSpace( decodeXPString( v.([]uint8) ) )
+    if len(xps) == 0 {
+        io.WriteString( w, "-" )
+    } else {
+        io.WriteString( w, xps )
+    }
+}
+
+func formatUnsignedBytes( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
     ubv := v.([]uint8)
     // unsignedBytes are also used for large amount of unknown data
     // to help presenting large array of data, choose dumpData if length
-    // is larger than 16 bytes:
-    if len(ubv) > 16 {
+    // is larger than the dump threshold (16 bytes by default):
+    if len(ubv) > getDumpFormat( w ).threshold {
         dumpData( w, "Unknown - Raw data", indent, true, ubv )
     } else {
-        for i := 0; i < len(ubv); i++ {
-            if i > 0 { io.WriteString( w, "," ) }
-            fmt.Fprintf( w, " %d", ubv[i] )
-        }
+        formatList( w, indent, len(ubv), func( i int ) string {
+            return fmt.Sprintf( "%d", ubv[i] )
+        } )
     }
 }
 
-func formatSignedBytes( w io.Writer, v interface{}, indent string ) {
+func formatSignedBytes( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
     sbv := v.([]int8)
-    for i := 0; i < len(sbv); i++ {
-        if i > 0 { io.WriteString( w, "," ) }
-        fmt.Fprintf( w, " %d", sbv[i] )
-    }
+    formatList( w, indent, len(sbv), func( i int ) string {
+        return fmt.Sprintf( "%d", sbv[i] )
+    } )
 }
 
-func formatUnsignedShorts( w io.Writer, v interface{}, indent string ) {
+func formatUnsignedShorts( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
     usv := v.([]uint16)
-    for i := 0; i < len(usv); i++ {
-        if i > 0 { io.WriteString( w, "," ) }
-        fmt.Fprintf( w, " %d", usv[i] )
-    }
+    formatList( w, indent, len(usv), func( i int ) string {
+        return fmt.Sprintf( "%d", usv[i] )
+    } )
 }
 
-func formatSignedShorts( w io.Writer, v interface{}, indent string ) {
+func formatSignedShorts( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
     ssv := v.([]int16)
-    for i := 0; i < len(ssv); i++ {
-        if i > 0 { io.WriteString( w, "," ) }
-        fmt.Fprintf( w, " %d", ssv[i] )
-    }
+    formatList( w, indent, len(ssv), func( i int ) string {
+        return fmt.Sprintf( "%d", ssv[i] )
+    } )
 }
 
-func formatUnsignedLongs( w io.Writer, v interface{}, indent string ) {
+func formatUnsignedLongs( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
     ulv := v.([]uint32)
-    for i := 0; i < len(ulv); i++ {
-        if i > 0 { io.WriteString( w, "," ) }
-        fmt.Fprintf( w, " %d", ulv[i] )
-    }
+    formatList( w, indent, len(ulv), func( i int ) string {
+        return fmt.Sprintf( "%d", ulv[i] )
+    } )
 }
 
-func formatSignedLongs( w io.Writer, v interface{}, indent string ) {
+func formatSignedLongs( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
     slv := v.([]int32)
-    for i := 0; i < len(slv); i++ {
-        if i > 0 { io.WriteString( w, "," ) }
-        fmt.Fprintf( w, " %d", slv[i] )
-    }
+    formatList( w, indent, len(slv), func( i int ) string {
+        return fmt.Sprintf( "%d", slv[i] )
+    } )
+}
+
+func formatUnsignedLong8s( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+    ulv := v.([]uint64)
+    formatList( w, indent, len(ulv), func( i int ) string {
+        return fmt.Sprintf( "%d", ulv[i] )
+    } )
+}
+
+func formatSignedLong8s( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+    slv := v.([]int64)
+    formatList( w, indent, len(slv), func( i int ) string {
+        return fmt.Sprintf( "%d", slv[i] )
+    } )
+}
+
+func formatFloats( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+    fv := v.([]float32)
+    formatList( w, indent, len(fv), func( i int ) string {
+        return fmt.Sprintf( "%g", fv[i] )
+    } )
+}
+
+func formatDoubles( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+    dv := v.([]float64)
+    formatList( w, indent, len(dv), func( i int ) string {
+        return fmt.Sprintf( "%g", dv[i] )
+    } )
 }
 
-func formatUnsignedRationals( w io.Writer, v interface{}, indent string ) {
+func formatUnsignedRationals( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
     urv := v.([]UnsignedRational)
-    for i := 0; i < len(urv); i++ {
-        if i > 0 { io.WriteString( w, "," ) }
-        fmt.Fprintf( w, " %f (%d/%d)",
-                     float32(urv[i].Numerator)/float32(urv[i].Denominator),
-                     urv[i].Numerator, urv[i].Denominator )
-    }
+    formatList( w, indent, len(urv), func( i int ) string {
+        return urv[i].formatFraction( )
+    } )
 }
 
-func formatSignedRationals( w io.Writer, v interface{}, indent string ) {
+func formatSignedRationals( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
     srv := v.([]SignedRational)
-    for i := 0; i < len(srv); i++ {
-        if i > 0 { io.WriteString( w, "," ) }
-        fmt.Fprintf( w, " %f (%d/%d)",
-                     float32(srv[i].Numerator)/float32(srv[i].Denominator),
-                     srv[i].Numerator, srv[i].Denominator )
-    }
+    formatList( w, indent, len(srv), func( i int ) string {
+        return srv[i].formatFraction( )
+    } )
 }
 
 type unsignedByteValue struct {
         tVal
     v   []uint8
     s   bool        // true if AsciiString (seen as unsigned byte slice)
+    u   bool        // true if UTF-16LE string (Windows XP tags)
 }
 func (ifd *ifdd) newUnsignedByteValue(
                         name string,
-                        f func( io.Writer, interface{}, string ),
+                        f tFormatter,
                         ubVal []uint8 ) (ub *unsignedByteValue) {
-    ub = new( unsignedByteValue )
+    ub = ifd.desc.allocUnsignedByteValue( )
     ub.ifd = ifd
     ub.fpr = f
     ub.name = name
     ub.vTag = ifd.fTag
+    ub.src = ifd.getSource( )
     ub.vType = ifd.fType
     ub.vCount = uint32(len(ubVal))
     ub.v = ubVal
@@ -547,20 +997,38 @@ func (ub *unsignedByteValue)serializeEntry( w io.Writer ) error {
 func (ub *unsignedByteValue)serializeData( w io.Writer ) error {
     return ub.ifd.serializeSliceData( w, ub.v )
 }
+func (ub *unsignedByteValue)getDataSize( ) uint32 {
+    return ub.ifd.getSliceAlignedDataSize( ub.v )
+}
 func (ub *unsignedByteValue)format( w io.Writer ) {
     f := ub.fpr; if f == nil {
-        if ub.s { f = formatString } else { f = formatUnsignedBytes }
+        if ub.s {
+            f = formatString
+        } else if ub.u {
+            f = formatXPString
+        } else {
+            f = formatUnsignedBytes
+        }
     }
-    formatValue( w, ub.name, ub.v, f )
+    ub.formatValue( w, ub.v, f )
+}
+
+// treat Windows XP strings as unsignedByteValue
+func (ifd *ifdd) newXPStringValue(
+                        name string, xpVal []byte ) (xp *unsignedByteValue) {
+    xp = ifd.newUnsignedByteValue( name, nil, xpVal )
+    xp.u = true
+    return
 }
 
 // treat asciiStringgValue as unsignedByteValue 
 func (ifd *ifdd) newAsciiStringValue(
                         name string, asVal []byte ) (as *unsignedByteValue) {
-    as = new( unsignedByteValue )
+    as = ifd.desc.allocUnsignedByteValue( )
     as.ifd = ifd
     as.name = name
     as.vTag = ifd.fTag
+    as.src = ifd.getSource( )
     as.vType = ifd.fType
     as.vCount = uint32(len(asVal))  // assuming terminating 0 was included
     as.v = asVal
@@ -574,13 +1042,14 @@ type signedByteValue  struct {
 }
 func (ifd *ifdd) newSignedByteValue(
                         name string,
-                        f func( io.Writer, interface{}, string ),
+                        f tFormatter,
                         sbVal []int8 ) (sb *signedByteValue) {
     sb = new( signedByteValue )
     sb.ifd = ifd
     sb.fpr = f
     sb.name = name
     sb.vTag = ifd.fTag
+    sb.src = ifd.getSource( )
     sb.vType = ifd.fType
     sb.vCount = uint32(len(sbVal))
     sb.v = sbVal
@@ -592,11 +1061,14 @@ func (sb *signedByteValue)serializeEntry( w io.Writer ) error {
 func (sb *signedByteValue)serializeData( w io.Writer ) error {
     return sb.ifd.serializeSliceData( w, sb.v )
 }
+func (sb *signedByteValue)getDataSize( ) uint32 {
+    return sb.ifd.getSliceAlignedDataSize( sb.v )
+}
 func (sb *signedByteValue)format( w io.Writer ) {
     f := sb.fpr; if f == nil {
         f = formatSignedBytes
     }
-    formatValue( w, sb.name, sb.v, f )
+    sb.formatValue( w, sb.v, f )
 }
 
 type unsignedShortValue struct {
@@ -605,13 +1077,14 @@ type unsignedShortValue struct {
 }
 func (ifd *ifdd) newUnsignedShortValue(
                         name string,
-                        f func( io.Writer, interface{}, string ),
+                        f tFormatter,
                         usVal []uint16 ) (us *unsignedShortValue) {
-    us = new( unsignedShortValue )
+    us = ifd.desc.allocUnsignedShortValue( )
     us.ifd = ifd
     us.fpr = f
     us.name = name
     us.vTag = ifd.fTag
+    us.src = ifd.getSource( )
     us.vType = ifd.fType
     us.vCount = uint32(len(usVal))
     us.v = usVal
@@ -623,11 +1096,14 @@ func (us *unsignedShortValue)serializeEntry( w io.Writer ) error {
 func (us *unsignedShortValue)serializeData( w io.Writer ) error {
     return us.ifd.serializeSliceData( w, us.v )
 }
+func (us *unsignedShortValue)getDataSize( ) uint32 {
+    return us.ifd.getSliceAlignedDataSize( us.v )
+}
 func (us *unsignedShortValue)format( w io.Writer ) {
     f := us.fpr; if f == nil {
         f = formatUnsignedShorts
     }
-    formatValue( w, us.name, us.v, f )
+    us.formatValue( w, us.v, f )
 }
 
 type signedShortValue struct {
@@ -636,13 +1112,14 @@ type signedShortValue struct {
 }
 func (ifd *ifdd) newSignedShortValue(
                         name string,
-                        f func( io.Writer, interface{}, string ),
+                        f tFormatter,
                         ssVal []int16 ) (ss *signedShortValue) {
     ss = new( signedShortValue )
     ss.ifd = ifd
     ss.fpr = f
     ss.name = name
     ss.vTag = ifd.fTag
+    ss.src = ifd.getSource( )
     ss.vType = ifd.fType
     ss.vCount = uint32(len(ssVal))
     ss.v = ssVal
@@ -654,11 +1131,14 @@ func (ss *signedShortValue)serializeEntry( w io.Writer ) error {
 func (ss *signedShortValue)serializeData( w io.Writer ) error {
     return ss.ifd.serializeSliceData( w, ss.v )
 }
+func (ss *signedShortValue)getDataSize( ) uint32 {
+    return ss.ifd.getSliceAlignedDataSize( ss.v )
+}
 func (ss *signedShortValue)format( w io.Writer ) {
     f := ss.fpr; if f == nil {
         f = formatSignedShorts
     }
-    formatValue( w, ss.name, ss.v, f )
+    ss.formatValue( w, ss.v, f )
 }
 
 type unsignedLongValue struct {
@@ -667,13 +1147,14 @@ type unsignedLongValue struct {
 }
 func (ifd *ifdd) newUnsignedLongValue(
                         name string,
-                        f func( io.Writer, interface{}, string ),
+                        f tFormatter,
                         ulVal []uint32 ) (ul *unsignedLongValue) {
-    ul = new( unsignedLongValue )
+    ul = ifd.desc.allocUnsignedLongValue( )
     ul.ifd = ifd
     ul.fpr = f
     ul.name = name
     ul.vTag = ifd.fTag
+    ul.src = ifd.getSource( )
     ul.vType = ifd.fType
     ul.vCount = uint32(len(ulVal))
     ul.v = ulVal
@@ -685,11 +1166,14 @@ func (ul *unsignedLongValue)serializeEntry( w io.Writer ) error {
 func (ul *unsignedLongValue)serializeData( w io.Writer ) error {
     return ul.ifd.serializeSliceData( w, ul.v )
 }
+func (ul *unsignedLongValue)getDataSize( ) uint32 {
+    return ul.ifd.getSliceAlignedDataSize( ul.v )
+}
 func (ul *unsignedLongValue)format( w io.Writer ) {
     f := ul.fpr; if f == nil {
         f = formatUnsignedLongs
     }
-    formatValue( w, ul.name, ul.v, f )
+    ul.formatValue( w, ul.v, f )
 }
 
 type signedLongValue struct {
@@ -698,12 +1182,14 @@ type signedLongValue struct {
 }
 func (ifd *ifdd) newSignedLongValue(
                         name string,
-                        f func( io.Writer, interface{}, string ),
+                        f tFormatter,
                         slVal []int32 ) (sl *signedLongValue) {
     sl = new( signedLongValue )
     sl.ifd = ifd
     sl.fpr = f
+    sl.name = name
     sl.vTag = ifd.fTag
+    sl.src = ifd.getSource( )
     sl.vType = ifd.fType
     sl.vCount = uint32(len(slVal))
     sl.v = slVal
@@ -715,11 +1201,196 @@ func (sl *signedLongValue)serializeEntry( w io.Writer ) error {
 func (sl *signedLongValue)serializeData( w io.Writer ) error {
     return sl.ifd.serializeSliceData( w, sl.v )
 }
+func (sl *signedLongValue)getDataSize( ) uint32 {
+    return sl.ifd.getSliceAlignedDataSize( sl.v )
+}
 func (sl *signedLongValue)format( w io.Writer ) {
     f := sl.fpr; if f == nil {
         f = formatSignedLongs
     }
-    formatValue( w, sl.name, sl.v, f )
+    sl.formatValue( w, sl.v, f )
+}
+
+type unsignedLong8Value struct {
+        tVal
+    v   []uint64
+}
+func (ifd *ifdd) newUnsignedLong8Value(
+                        name string,
+                        f tFormatter,
+                        ulVal []uint64 ) (ul *unsignedLong8Value) {
+    ul = new( unsignedLong8Value )
+    ul.ifd = ifd
+    ul.fpr = f
+    ul.name = name
+    ul.vTag = ifd.fTag
+    ul.src = ifd.getSource( )
+    ul.vType = ifd.fType
+    ul.vCount = uint32(len(ulVal))
+    ul.v = ulVal
+    return
+}
+func (ul *unsignedLong8Value)serializeEntry( w io.Writer ) error {
+    return ul.ifd.serializeSliceEntry( w, ul.tEntry, ul.v )
+}
+func (ul *unsignedLong8Value)serializeData( w io.Writer ) error {
+    return ul.ifd.serializeSliceData( w, ul.v )
+}
+func (ul *unsignedLong8Value)getDataSize( ) uint32 {
+    return ul.ifd.getSliceAlignedDataSize( ul.v )
+}
+func (ul *unsignedLong8Value)format( w io.Writer ) {
+    f := ul.fpr; if f == nil {
+        f = formatUnsignedLong8s
+    }
+    ul.formatValue( w, ul.v, f )
+}
+
+type signedLong8Value struct {
+        tVal
+    v   []int64
+}
+func (ifd *ifdd) newSignedLong8Value(
+                        name string,
+                        f tFormatter,
+                        slVal []int64 ) (sl *signedLong8Value) {
+    sl = new( signedLong8Value )
+    sl.ifd = ifd
+    sl.fpr = f
+    sl.name = name
+    sl.vTag = ifd.fTag
+    sl.src = ifd.getSource( )
+    sl.vType = ifd.fType
+    sl.vCount = uint32(len(slVal))
+    sl.v = slVal
+    return
+}
+func (sl *signedLong8Value)serializeEntry( w io.Writer ) error {
+    return sl.ifd.serializeSliceEntry( w, sl.tEntry, sl.v )
+}
+func (sl *signedLong8Value)serializeData( w io.Writer ) error {
+    return sl.ifd.serializeSliceData( w, sl.v )
+}
+func (sl *signedLong8Value)getDataSize( ) uint32 {
+    return sl.ifd.getSliceAlignedDataSize( sl.v )
+}
+func (sl *signedLong8Value)format( w io.Writer ) {
+    f := sl.fpr; if f == nil {
+        f = formatSignedLong8s
+    }
+    sl.formatValue( w, sl.v, f )
+}
+
+type floatValue struct {
+        tVal
+    v   []float32
+}
+func (ifd *ifdd) newFloatValue(
+                        name string,
+                        f tFormatter,
+                        fVal []float32 ) (fv *floatValue) {
+    fv = new( floatValue )
+    fv.ifd = ifd
+    fv.fpr = f
+    fv.name = name
+    fv.vTag = ifd.fTag
+    fv.src = ifd.getSource( )
+    fv.vType = ifd.fType
+    fv.vCount = uint32(len(fVal))
+    fv.v = fVal
+    return
+}
+func (fv *floatValue)serializeEntry( w io.Writer ) error {
+    return fv.ifd.serializeSliceEntry( w, fv.tEntry, fv.v )
+}
+func (fv *floatValue)serializeData( w io.Writer ) error {
+    return fv.ifd.serializeSliceData( w, fv.v )
+}
+func (fv *floatValue)getDataSize( ) uint32 {
+    return fv.ifd.getSliceAlignedDataSize( fv.v )
+}
+func (fv *floatValue)format( w io.Writer ) {
+    f := fv.fpr; if f == nil {
+        f = formatFloats
+    }
+    fv.formatValue( w, fv.v, f )
+}
+
+type doubleValue struct {
+        tVal
+    v   []float64
+}
+func (ifd *ifdd) newDoubleValue(
+                        name string,
+                        f tFormatter,
+                        dVal []float64 ) (dv *doubleValue) {
+    dv = new( doubleValue )
+    dv.ifd = ifd
+    dv.fpr = f
+    dv.name = name
+    dv.vTag = ifd.fTag
+    dv.src = ifd.getSource( )
+    dv.vType = ifd.fType
+    dv.vCount = uint32(len(dVal))
+    dv.v = dVal
+    return
+}
+func (dv *doubleValue)serializeEntry( w io.Writer ) error {
+    return dv.ifd.serializeSliceEntry( w, dv.tEntry, dv.v )
+}
+func (dv *doubleValue)serializeData( w io.Writer ) error {
+    return dv.ifd.serializeSliceData( w, dv.v )
+}
+func (dv *doubleValue)getDataSize( ) uint32 {
+    return dv.ifd.getSliceAlignedDataSize( dv.v )
+}
+func (dv *doubleValue)format( w io.Writer ) {
+    f := dv.fpr; if f == nil {
+        f = formatDoubles
+    }
+    dv.formatValue( w, dv.v, f )
+}
+
+// rawValue keeps an entry that is not decoded, as read from the ifd entry:
+// v is the raw value returned by getRawBytes. The original type and count are
+// preserved if v holds the whole value, otherwise (unknown type) v is stored
+// as _Undefined bytes, so that the serialized entry remains consistent.
+type rawValue struct {
+        tVal
+    v   []byte
+}
+func (ifd *ifdd) newRawValue( name string,
+                              f tFormatter,
+                              rVal []byte ) (rv *rawValue) {
+    rv = new( rawValue )
+    rv.ifd = ifd
+    rv.fpr = f
+    rv.name = name
+    rv.vTag = ifd.fTag
+    rv.src = ifd.getSource( )
+    rv.vType = ifd.fType
+    rv.vCount = ifd.fCount
+    if size, err := ifd.checkEntryData( ); err != nil || size != uint32(len(rVal)) {
+        rv.vType = _Undefined
+        rv.vCount = uint32(len(rVal))
+    }
+    rv.v = rVal
+    return
+}
+func (rv *rawValue)serializeEntry( w io.Writer ) error {
+    return rv.ifd.serializeSliceEntry( w, rv.tEntry, rv.v )
+}
+func (rv *rawValue)serializeData( w io.Writer ) error {
+    return rv.ifd.serializeSliceData( w, rv.v )
+}
+func (rv *rawValue)getDataSize( ) uint32 {
+    return rv.ifd.getSliceAlignedDataSize( rv.v )
+}
+func (rv *rawValue)format( w io.Writer ) {
+    f := rv.fpr; if f == nil {
+        f = formatUnsignedBytes
+    }
+    rv.formatValue( w, rv.v, f )
 }
 
 type unsignedRationalValue struct {
@@ -728,13 +1399,14 @@ type unsignedRationalValue struct {
 }
 func (ifd *ifdd) newUnsignedRationalValue(
                     name string,
-                    f func( io.Writer, interface{}, string ),
+                    f tFormatter,
                     urVal []UnsignedRational ) (ur *unsignedRationalValue) {
-    ur = new( unsignedRationalValue )
+    ur = ifd.desc.allocUnsignedRationalValue( )
     ur.ifd = ifd
     ur.fpr = f
     ur.name = name
     ur.vTag = ifd.fTag
+    ur.src = ifd.getSource( )
     ur.vType = ifd.fType
     ur.vCount = uint32(len(urVal))
     ur.v = urVal
@@ -746,11 +1418,14 @@ func (ur *unsignedRationalValue)serializeEntry( w io.Writer ) error {
 func (ur *unsignedRationalValue)serializeData( w io.Writer ) error {
     return ur.ifd.serializeSliceData( w, ur.v )
 }
+func (ur *unsignedRationalValue)getDataSize( ) uint32 {
+    return ur.ifd.getSliceAlignedDataSize( ur.v )
+}
 func (ur *unsignedRationalValue)format( w io.Writer ) {
     f := ur.fpr; if f == nil {
         f = formatUnsignedRationals
     }
-    formatValue( w, ur.name, ur.v, f )
+    ur.formatValue( w, ur.v, f )
 }
 
 type signedRationalValue struct {
@@ -759,13 +1434,14 @@ type signedRationalValue struct {
 }
 func (ifd *ifdd) newSignedRationalValue(
                         name string,
-                        f func( io.Writer, interface{}, string ),
+                        f tFormatter,
                         srVal []SignedRational ) (sr *signedRationalValue) {
     sr = new( signedRationalValue )
     sr.ifd = ifd
     sr.fpr = f
     sr.name = name
     sr.vTag = ifd.fTag
+    sr.src = ifd.getSource( )
     sr.vType = ifd.fType
     sr.vCount = uint32(len(srVal))
     sr.v = srVal
@@ -777,11 +1453,14 @@ func (sr *signedRationalValue)serializeEntry( w io.Writer ) error {
 func (sr *signedRationalValue)serializeData( w io.Writer ) error {
     return sr.ifd.serializeSliceData( w, sr.v )
 }
+func (sr *signedRationalValue)getDataSize( ) uint32 {
+    return sr.ifd.getSliceAlignedDataSize( sr.v )
+}
 func (sr *signedRationalValue)format( w io.Writer ) {
     f := sr.fpr; if f == nil {
         f = formatSignedRationals
     }
-    formatValue( w, sr.name, sr.v, f )
+    sr.formatValue( w, sr.v, f )
 }
 
 // storage does not presume any ifd data layout. This is done only at serializing
@@ -814,6 +1493,16 @@ func (ifd *ifdd) storeEmbeddedIfd(
                             name string, id IfdId,
                             storeTags func( ifd *ifdd) error ) error {
     offset, err := ifd.checkUnsignedLongs( 1 )
+    if err == nil && ifd.isParallel( id ) {
+        ifd.parseInParallel( func( shadow *ifdd ) error {
+            _, eIfd, err := shadow.desc.storeIFD( id, offset[0], storeTags )
+            if err == nil {
+                shadow.storeValue( shadow.newIfdValue( eIfd ) )
+            }
+            return err
+        } )
+        return nil
+    }
     if err == nil {
         // recusively process the embedded IFD here
         var eIfd *ifdd
@@ -827,7 +1516,7 @@ func (ifd *ifdd) storeEmbeddedIfd(
 
 func (ifd *ifdd) storeUnsignedBytes(
                             name string, count uint32,
-                            p func( io.Writer, interface{}, string) ) error {
+                            p tFormatter ) error {
     values, err := ifd.checkUnsignedBytes( count )
     if err == nil {
         ifd.storeValue( ifd.newUnsignedByteValue( name, p, values ) )
@@ -837,7 +1526,7 @@ func (ifd *ifdd) storeUnsignedBytes(
 
 func (ifd *ifdd) storeSignedBytes(
                             name string, count uint32,
-                            p func( io.Writer, interface{}, string) ) error {
+                            p tFormatter ) error {
     values, err := ifd.checkSignedBytes( count )
     if err == nil {
         ifd.storeValue( ifd.newSignedByteValue( name, p, values ) )
@@ -847,13 +1536,13 @@ func (ifd *ifdd) storeSignedBytes(
 
 func (ifd *ifdd) storeUndefinedAsUnsignedBytes(
                             name string, count uint32,
-                            p func( io.Writer, interface{}, string) ) error {
+                            p tFormatter ) error {
     if ifd.fType != _Undefined {
         return fmt.Errorf( "%s: incorrect type (%s)\n",
                            name, getTiffTString( ifd.fType ) )
     }
-    if count != 0 && count != ifd.fCount {
-        return fmt.Errorf( "%s: incorrect count (%d)\n", name, ifd.fCount )
+    if err := ifd.validateCount( name, count, count ); err != nil {
+        return err
     }
     ifd.storeValue( ifd.newUnsignedByteValue( name, p, ifd.getUnsignedBytes( ) ) )
     return nil
@@ -861,18 +1550,30 @@ func (ifd *ifdd) storeUndefinedAsUnsignedBytes(
 
 func (ifd *ifdd) storeUndefinedAsSignedBytes(
                             name string, count uint32,
-                            p func( io.Writer, interface{}, string) ) error {
+                            p tFormatter ) error {
     if ifd.fType != _Undefined {
         return fmt.Errorf( "%s: incorrect type (%s)\n",
                            name, getTiffTString( ifd.fType ) )
     }
-    if count != 0 && count != ifd.fCount {
-        return fmt.Errorf( "%s: incorrect count (%d)\n", name, ifd.fCount )
+    if err := ifd.validateCount( name, count, count ); err != nil {
+        return err
     }
     ifd.storeValue( ifd.newSignedByteValue( name, p, ifd.getSignedBytes( ) ) )
     return nil
 }
 
+// Windows XP strings are stored as unsigned bytes (UTF-16LE)
+func (ifd *ifdd) storeXPString( name string ) error {
+    values, err := ifd.checkUnsignedBytes( 0 )
+    if err == nil {
+        if len(values) & 1 == 1 {
+            return fmt.Errorf( "%s: incorrect count (%d)\n", name, ifd.fCount )
+        }
+        ifd.storeValue( ifd.newXPStringValue( name, values ) )
+    }
+    return err
+}
+
 // no pretty print should be necessary for strings.
 func (ifd *ifdd) storeAsciiString( name string ) error {
     text, err := ifd.checkTiffAsciiString( )
@@ -884,7 +1585,7 @@ func (ifd *ifdd) storeAsciiString( name string ) error {
 
 func (ifd *ifdd) storeUnsignedShorts(
                             name string, count uint32,
-                            p func( io.Writer, interface{}, string) ) error {
+                            p tFormatter ) error {
     values, err := ifd.checkUnsignedShorts( count )
     if err == nil {
         ifd.storeValue( ifd.newUnsignedShortValue( name, p, values ) )
@@ -894,7 +1595,7 @@ func (ifd *ifdd) storeUnsignedShorts(
 
 func (ifd *ifdd) storeSignedShorts(
                             name string, count uint32,
-                            p func( io.Writer, interface{}, string) ) error {
+                            p tFormatter ) error {
     values, err := ifd.checkSignedShorts( count )
     if err == nil {
         ifd.storeValue( ifd.newSignedShortValue( name, p, values ) )
@@ -904,7 +1605,7 @@ func (ifd *ifdd) storeSignedShorts(
 
 func (ifd *ifdd) storeUnsignedLongs(
                             name string, count uint32,
-                            p func( io.Writer, interface{}, string) ) error {
+                            p tFormatter ) error {
     values, err := ifd.checkUnsignedLongs( count )
     if err == nil {
         ifd.storeValue( ifd.newUnsignedLongValue( name, p, values ) )
@@ -914,7 +1615,7 @@ func (ifd *ifdd) storeUnsignedLongs(
 
 func (ifd *ifdd) storeUnsignedShortsOrLongs(
                             name string, count uint32,
-                            p func( io.Writer, interface{}, string) ) error {
+                            p tFormatter ) error {
     switch ifd.fType {
         case _UnsignedShort:
             return ifd.storeUnsignedShorts( name, count, p )
@@ -926,7 +1627,7 @@ func (ifd *ifdd) storeUnsignedShortsOrLongs(
 
 func (ifd *ifdd) storeSignedLongs(
                             name string, count uint32,
-                            p func( io.Writer, interface{}, string) ) error {
+                            p tFormatter ) error {
     values, err := ifd.checkSignedLongs( count )
     if err == nil {
         ifd.storeValue( ifd.newSignedLongValue( name, p, values ) )
@@ -934,9 +1635,49 @@ func (ifd *ifdd) storeSignedLongs(
     return err
 }
 
+func (ifd *ifdd) storeUnsignedLong8s(
+                            name string, count uint32,
+                            p tFormatter ) error {
+    values, err := ifd.checkUnsignedLong8s( count )
+    if err == nil {
+        ifd.storeValue( ifd.newUnsignedLong8Value( name, p, values ) )
+    }
+    return err
+}
+
+func (ifd *ifdd) storeSignedLong8s(
+                            name string, count uint32,
+                            p tFormatter ) error {
+    values, err := ifd.checkSignedLong8s( count )
+    if err == nil {
+        ifd.storeValue( ifd.newSignedLong8Value( name, p, values ) )
+    }
+    return err
+}
+
+func (ifd *ifdd) storeFloats(
+                            name string, count uint32,
+                            p tFormatter ) error {
+    values, err := ifd.checkFloats( count )
+    if err == nil {
+        ifd.storeValue( ifd.newFloatValue( name, p, values ) )
+    }
+    return err
+}
+
+func (ifd *ifdd) storeDoubles(
+                            name string, count uint32,
+                            p tFormatter ) error {
+    values, err := ifd.checkDoubles( count )
+    if err == nil {
+        ifd.storeValue( ifd.newDoubleValue( name, p, values ) )
+    }
+    return err
+}
+
 func (ifd *ifdd) storeUnsignedRationals(
                             name string, count uint32,
-                            p func( io.Writer, interface{}, string) ) error {
+                            p tFormatter ) error {
     values, err := ifd.checkUnsignedRationals( count )
     if err == nil {
         ifd.storeValue( ifd.newUnsignedRationalValue( name, p, values ) )
@@ -946,7 +1687,7 @@ func (ifd *ifdd) storeUnsignedRationals(
 
 func (ifd *ifdd) storeSignedRationals(
                             name string, count uint32,
-                            p func( io.Writer, interface{}, string) ) error {
+                            p tFormatter ) error {
     values, err := ifd.checkSignedRationals( count )
     if err == nil {
         ifd.storeValue( ifd.newSignedRationalValue( name, p, values ) )
@@ -956,7 +1697,21 @@ func (ifd *ifdd) storeSignedRationals(
 
 // Store as read from the ifd entry fType and fCount.
 // no name and no format function are given, so as to prevent display
+// Entries of unknown type are kept as raw bytes, entries whose value is out of
+// bounds are dropped, since their value cannot be serialized again.
 func (ifd *ifdd) storeAnyUnknownSilently( ) error {
+    if _, err := ifd.checkEntryData( ); err != nil {
+        if _, terr := getTiffTypeSize( ifd.fType ); terr == nil {
+            if ifd.desc.Warn {
+                ifd.desc.logf( LogWarning, "%s: tag %#04x dropped: %v",
+                               ifd.desc.IfdName(ifd.id), ifd.fTag, err )
+            }
+            ifd.removeEntry( )
+            return nil
+        }
+        ifd.storeValue( ifd.newRawValue( "", nil, ifd.getRawBytes( ) ) )
+        return nil
+    }
     switch ifd.fType {
     case _UnsignedByte:     return ifd.storeUnsignedBytes( "", 0, nil )
     case _ASCIIString:      return ifd.storeAsciiString( "" )
@@ -968,8 +1723,13 @@ func (ifd *ifdd) storeAnyUnknownSilently( ) error {
     case _SignedShort:      return ifd.storeSignedShorts( "", 0, nil )
     case _SignedLong:       return ifd.storeSignedLongs( "", 0, nil )
     case _SignedRational:   return ifd.storeSignedRationals( "", 0, nil )
+    case _UnsignedLong8, _IFD8:
+                            return ifd.storeUnsignedLong8s( "", 0, nil )
+    case _SignedLong8:      return ifd.storeSignedLong8s( "", 0, nil )
+    case _Float:            return ifd.storeFloats( "", 0, nil )
+    case _Double:           return ifd.storeDoubles( "", 0, nil )
     }
-    return fmt.Errorf( "storeAnyNonUndefined: unsupported type %s\n",
-                       getTiffTString( ifd.fType ) )
+    ifd.storeValue( ifd.newRawValue( "", nil, ifd.getRawBytes( ) ) )
+    return nil
 }
 
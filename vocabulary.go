@@ -0,0 +1,303 @@
+package exif
+
+// text used by Format for enumerated tag values
+
+import (
+    "fmt"
+    "io"
+)
+
+/*
+    Many tags take their values from a small set of codes, each with a given
+    meaning. The default english text for each code is kept in enumTables,
+    indexed by namespace and tag. Tags in IFD0 and IFD1 share the PRIMARY
+    namespace.
+
+    Applications can replace the default text, for instance to provide a
+    translation, by giving a Vocabulary in Control. The default tables are
+    available through GetEnumText and GetEnumValues, so that a vocabulary can
+    be built from them.
+*/
+
+// Vocabulary gives the text used by Format for enumerated tag values. Text is
+// called with the IFD namespace (PRIMARY for both IFD0 and IFD1, EXIF for the
+// TIFF/EP tags also defined by Exif, wherever they are stored), the tag,
+// the tag value and the default text, which is empty if the value is not
+// valid. Returning the default text keeps the default vocabulary, returning
+// an empty string formats the value as illegal.
+type Vocabulary interface {
+    Text( id IfdId, tag uint16, value uint, def string ) string
+}
+
+type enumKey struct {
+    id      IfdId
+    tag     tTag
+}
+
+var enumTables = map[enumKey]map[uint]string {
+    { PRIMARY, _Compression }: {
+        1: "No compression",
+        2: "CCITT 1D modified Huffman RLE",
+        3: "CCITT Group 3 fax encoding",
+        4: "CCITT Group 4 fax encoding",
+        5: "LZW",
+        6: "JPEG",
+        7: "JPEG (Technote2)",
+        8: "Deflate",
+        9: "RFC 2301 (black and white JBIG)",
+        10: "RFC 2301 (color JBIG)",
+        32773: "PackBits compression (Macintosh RLE)",
+    },
+    { PRIMARY, _PhotometricInterpretation }: {
+        0: "Bilevel or Gray-scale, white is 0",
+        1: "Bilevel or Gray-scale, black is 0",
+        2: "RGB",
+        3: "Palette",
+        4: "Transparency mask",
+        5: "CMYK",
+        6: "YCbCr",
+        8: "CIE L*a*b*",
+    },
+    { PRIMARY, _FillOrder }: {
+        1: "lower column values in higher-order bits of bytes",
+        2: "lower column values in lower-order bits of bytes",
+    },
+    { PRIMARY, _PlanarConfiguration }: {
+        1: "Chunky format (contiguous component values)",
+        2: "Planar format (separate component planes)",
+    },
+    { PRIMARY, _Orientation }: {
+        1: "Row #0 Top, Col #0 Left",
+        2: "Row #0 Top, Col #0 Right",
+        3: "Row #0 Bottom, Col #0 Right",
+        4: "Row #0 Bottom, Col #0 Left",
+        5: "Row #0 Left, Col #0 Top",
+        6: "Row #0 Right, Col #0 Top",
+        7: "Row #0 Right, Col #0 Bottom",
+        8: "Row #0 Left, Col #0 Bottom",
+    },
+    { PRIMARY, _ResolutionUnit }: {
+        1: "Dots per Arbitrary unit",
+        2: "Dots per Inch",
+        3: "Dots per Cm",
+    },
+    { PRIMARY, _YCbCrPositioning }: {
+        1: "Centered",
+        2: "Cosited",
+    },
+    { EXIF, _ExposureProgram }: {
+        0: "Undefined",
+        1: "Manual",
+        2: "Normal program",
+        3: "Aperture priority",
+        4: "Shutter priority",
+        5: "Creative program (biased toward depth of field)",
+        6: "Action program (biased toward fast shutter speed)",
+        7: "Portrait mode (for closeup photos with the background out of focus)",
+        8: "Landscape mode (for landscape photos with the background in focus)",
+    },
+    { EXIF, _SensitivityType }: {
+        0: "Unknown",
+        1: "Standard output sensitivity",
+        2: "Recommended exposure index",
+        3: "ISO speed",
+        4: "Standard output sensitivity and recommended exposure index",
+        5: "Standard output sensitivity and ISO speed",
+        6: "Recommended exposure index and ISO speed",
+        7: "Standard output sensitivity, recommended exposure index and ISO speed",
+    },
+    { EXIF, _MeteringMode }: {
+        0: "Unknown",
+        1: "Average",
+        2: "CenterWeightedAverage program",
+        3: "Spot",
+        4: "MultiSpot",
+        5: "Pattern",
+        6: "Partial",
+        255: "Other",
+    },
+    { EXIF, _LightSource }: {
+        0: "Unknown",
+        1: "Daylight",
+        2: "Fluorescent",
+        3: "Tungsten (incandescent light)",
+        4: "Flash",
+        9: "Fine weather",
+        10: "Cloudy weather",
+        11: "Shade",
+        12: "Daylight fluorescent (D 5700 - 7100K)",
+        13: "Day white fluorescent (N 4600 - 5400K)",
+        14: "Cool white fluorescent (W 3900 - 4500K)",
+        15: "White fluorescent (WW 3200 - 3700K)",
+        17: "Standard light A",
+        18: "Standard light B",
+        19: "Standard light C",
+        20: "D55",
+        21: "D65",
+        22: "D75",
+        23: "D50",
+        24: "ISO studio tungsten",
+        255: "Other light source",
+    },
+    { EXIF, _Flash }: {
+        0x00: "Flash did not fire",
+        0x01: "Flash fired",
+        0x05: "Flash fired, strobe return light not detected",
+        0x07: "Flash fired, strobe return light detected",
+        0x09: "Flash fired, compulsory flash mode, return light not detected",
+        0x0F: "Flash fired, compulsory flash mode, return light detected",
+        0x10: "Flash did not fire, compulsory flash mode",
+        0x18: "Flash did not fire, auto mode",
+        0x19: "Flash fired, auto mode",
+        0x1D: "Flash fired, auto mode, return light not detected",
+        0x1F: "Flash fired, auto mode, return light detected",
+        0x20: "No flash function",
+        0x41: "Flash fired, red-eye reduction mode",
+        0x45: "Flash fired, red-eye reduction mode, return light not detected",
+        0x47: "Flash fired, red-eye reduction mode, return light detected",
+        0x49: "Flash fired, compulsory flash mode, red-eye reduction mode",
+        0x4D: "Flash fired, compulsory flash mode, red-eye reduction mode, return light not detected",
+        0x4F: "Flash fired, compulsory flash mode, red-eye reduction mode, return light detected",
+        0x59: "Flash fired, auto mode, red-eye reduction mode",
+        0x5D: "Flash fired, auto mode, return light not detected, red-eye reduction mode",
+        0x5F: "Flash fired, auto mode, return light detected, red-eye reduction mode",
+    },
+    { EXIF, _ColorSpace }: {
+        1: "sRGB",
+        65535: "Uncalibrated",
+    },
+    { EXIF, _SensingMethod }: {
+        1: "Undefined",
+        2: "One-chip color area sensor",
+        3: "Two-chip color area sensor",
+        4: "Three-chip color area sensor",
+        5: "Color sequential area sensor",
+        7: "Trilinear sensor",
+        8: "Color sequential linear sensor",
+    },
+    { EXIF, _CustomRendered }: {
+        0: "Normal process",
+        1: "Custom process",
+    },
+    { EXIF, _ExposureMode }: {
+        0: "Auto exposure",
+        1: "Manual exposure",
+        2: "Auto bracket",
+    },
+    { EXIF, _WhiteBalance }: {
+        0: "Auto white balance",
+        1: "Manual white balance",
+    },
+    { EXIF, _SceneCaptureType }: {
+        0: "Standard",
+        1: "Landscape",
+        2: "Portrait",
+        3: "Night scene",
+    },
+    { EXIF, _GainControl }: {
+        0: "none",
+        1: "Low gain up",
+        2: "high gain up",
+        3: "low gain down",
+        4: "high gain down",
+    },
+    { EXIF, _Contrast }: {
+        0: "Normal",
+        1: "Soft",
+        2: "Hard",
+    },
+    { EXIF, _Saturation }: {
+        0: "Normal",
+        1: "Low saturation",
+        2: "High saturation",
+    },
+    { EXIF, _Sharpness }: {
+        0: "Normal",
+        1: "Soft",
+        2: "Hard",
+    },
+    { EXIF, _SubjectDistanceRange }: {
+        0: "Unknown",
+        1: "Macro",
+        2: "Close View",
+        3: "Distant View",
+    },
+    { EXIF, _CompositeImage }: {
+        0: "Unknown",
+        1: "Not a composite image",
+        2: "General composite image",
+        3: "Composite image captured while shooting",
+    },
+    { GPS, _GPSDifferential }: {
+        0: "Measurement without differential correction",
+        1: "Differential correction applied",
+    },
+}
+
+func getEnumNamespace( id IfdId ) IfdId {
+    if id == THUMBNAIL {
+        return PRIMARY
+    }
+    return id
+}
+
+// getEnumKey returns the key of the enumerated tag in enumTables. TIFF/EP tags
+// found in IFD0 share the Exif namespace.
+func getEnumKey( id IfdId, tag tTag ) enumKey {
+    id = getEnumNamespace( id )
+    if id == PRIMARY && tiffEPTags[tag] {
+        id = EXIF
+    }
+    return enumKey{ id, tag }
+}
+
+// GetEnumText returns the default text for the value of an enumerated tag in
+// the given IFD namespace. It returns false if the tag is not enumerated or
+// if the value is not valid for that tag.
+func GetEnumText( id IfdId, tag uint16, value uint ) (string, bool) {
+    text, ok := enumTables[getEnumKey( id, tTag(tag) )][value]
+    return text, ok
+}
+
+// GetEnumValues returns a copy of the default text for all valid values of
+// an enumerated tag in the given IFD namespace, or nil if the tag is not
+// enumerated.
+func GetEnumValues( id IfdId, tag uint16 ) map[uint]string {
+    table, ok := enumTables[getEnumKey( id, tTag(tag) )]
+    if ! ok {
+        return nil
+    }
+    values := make( map[uint]string, len(table) )
+    for k, v := range table {
+        values[k] = v
+    }
+    return values
+}
+
+// getEnumText returns the text for the value of an enumerated tag, according
+// to the vocabulary given in the formatting context w, if any. If the value
+// is illegal, the text indicates it using what to name the tag.
+func (ifd *ifdd) getEnumText( w io.Writer, tag tTag,
+                              value uint, what string ) string {
+    key := getEnumKey( ifd.id, tag )
+    text := enumTables[key][value]
+    if cw, ok := w.(*cumulativeWriter); ok && cw.vocabulary != nil {
+        text = cw.vocabulary.Text( key.id, uint16(tag), value, text )
+    }
+    if text == "" {
+        return fmt.Sprintf( "Illegal %s (%d)", what, value )
+    }
+    if cw, ok := w.(*cumulativeWriter); ok && cw.codes {
+        return fmt.Sprintf( "%d (%s)", value, text )
+    }
+    return text
+}
+
+// fmtEnum returns a format function for an enumerated tag stored as a single
+// unsigned short.
+func (ifd *ifdd) fmtEnum( tag tTag,
+                          what string ) tFormatter {
+    return func( ifd *ifdd, w io.Writer, v interface{}, indent string ) {
+        io.WriteString( w, ifd.getEnumText( w, tag, uint(v.([]uint16)[0]), what ) )
+    }
+}
@@ -0,0 +1,51 @@
+package exif
+
+// support for structured maker note warnings
+
+import (
+    "fmt"
+    "strings"
+)
+
+/*
+    Maker notes are not standardized, and their structure varies with the
+    camera model and firmware. Structures that do not conform to what is
+    expected for the vendor, such as an unexpected version or size, or an
+    entry that cannot be decoded, are not fatal: the entry is kept as it is,
+    or as an unknown entry.
+
+    Each of those issues is recorded as a MakerNoteWarning in the parse
+    statistics, giving the vendor, the camera model, the IFD and the tag, so
+    that applications checking large sets of images can track which cameras
+    produce non-conforming maker notes. Warnings are recorded whether Control
+    Warn is set or not. If Warn is set, they are also sent as LogWarning
+    messages, as other warnings.
+*/
+
+// MakerNoteWarning describes a non-conforming maker note structure found
+// while parsing.
+type MakerNoteWarning struct {
+    Vendor  string      // maker note vendor, e.g. "Nikon"
+    Model   string      // camera model, as given in the primary IFD, or ""
+    Ifd     IfdId       // IFD where the issue was found
+    Tag     uint16      // entry tag
+    Msg     string      // human readable description
+}
+
+func (w MakerNoteWarning) String( ) string {
+    return fmt.Sprintf( "%s maker note (%s): %s IFD tag %#04x: %s",
+                        w.Vendor, w.Model, GetIfdName( w.Ifd ), w.Tag, w.Msg )
+}
+
+// makerWarning records a warning about the current entry of ifd, in the maker
+// note from vendor, and logs it if Control Warn is set.
+func (ifd *ifdd) makerWarning( vendor string, format string, a ...interface{} ) {
+    d := ifd.desc
+    w := MakerNoteWarning{ vendor, d.global.model, ifd.id, uint16(ifd.fTag),
+                           strings.TrimSpace( fmt.Sprintf( format, a... ) ) }
+    d.stats.Warnings = append( d.stats.Warnings, w )
+    if d.Warn {
+        d.logf( LogWarning, "%s maker note: %s IFD tag %#04x: %s\n",
+                vendor, d.IfdName( ifd.id ), w.Tag, w.Msg )
+    }
+}